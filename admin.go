@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/auth"
+	"github.com/RedShiftVelocity/sqlite-otel/handlers"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+	"github.com/RedShiftVelocity/sqlite-otel/stats"
+)
+
+// registerServerStats adds metrics that depend on the running server's
+// configuration to the default registry
+func registerServerStats(dbPath string, authStore *auth.Store) {
+	fileSize := func(path string) func() float64 {
+		return func() float64 {
+			info, err := os.Stat(path)
+			if err != nil {
+				return 0
+			}
+			return float64(info.Size())
+		}
+	}
+	stats.Default.NewGaugeFunc("sqlite_otel_db_size_bytes", "Size of the main SQLite database file.", fileSize(dbPath))
+	stats.Default.NewGaugeFunc("sqlite_otel_wal_size_bytes", "Size of the main SQLite write-ahead log.", fileSize(dbPath+"-wal"))
+	stats.Default.NewFunc("sqlite_otel_log_lines_dropped_total", "Execution log lines dropped because the log buffer was full.", stats.TypeCounter, func() []stats.Sample {
+		return []stats.Sample{{Value: float64(logging.Dropped())}}
+	})
+
+	if authStore != nil {
+		stats.Default.NewFunc("sqlite_otel_auth_rejections_total", "Requests rejected by authentication, by key name.", stats.TypeCounter, func() []stats.Sample {
+			var samples []stats.Sample
+			for name, count := range authStore.Rejections() {
+				samples = append(samples, stats.Sample{Labels: []stats.Label{{Name: "key", Value: name}}, Value: float64(count)})
+			}
+			return samples
+		})
+	}
+	// The limiter is looked up on every scrape since SIGHUP may replace it
+	stats.Default.NewFunc("sqlite_otel_throttled_requests_total", "Requests rejected by rate limits, by client key and limit.", stats.TypeCounter, func() []stats.Sample {
+		limiter := handlers.RateLimiter()
+		if limiter == nil {
+			return nil
+		}
+		var samples []stats.Sample
+		for _, t := range limiter.Throttled() {
+			samples = append(samples, stats.Sample{
+				Labels: []stats.Label{{Name: "key", Value: t.Key}, {Name: "reason", Value: t.Reason}},
+				Value:  float64(t.Count),
+			})
+		}
+		return samples
+	})
+}
+
+// startAdminServer serves the admin endpoints on their own listener and
+// returns the server so it can be shut down with the main one
+func startAdminServer(addr string, handler http.Handler) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{
+		Handler:      handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logging.Error("Admin server failed: %v", err)
+		}
+	}()
+	logging.Info("Admin endpoints listening on %s", listener.Addr())
+	return server, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/exporter"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+	"github.com/RedShiftVelocity/sqlite-otel/parquet"
+)
+
+// archiveBatchSize is the number of rows read per query while archiving
+const archiveBatchSize = 5000
+
+// runArchive implements the archive subcommand
+func runArchive(args []string) int {
+	fs := flag.NewFlagSet("archive", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s archive [options]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Write stored telemetry to Parquet files partitioned by table and UTC day.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	dbPath := fs.String("db", getDefaultDBPath(), "Path to the SQLite database to read")
+	output := fs.String("output", "", "Directory to write the Parquet files under (required)")
+	compression := fs.String("compression", parquet.CompressionGzip, "Parquet page compression: gzip or none")
+	rowGroupSize := fs.Int("row-group-size", parquet.DefaultRowGroupSize, "Rows per Parquet row group")
+	since := fs.String("since", "", "Only records at or after this time: RFC 3339 or a duration ago such as 2h or 7d")
+	until := fs.String("until", "", "Only records at or before this time: RFC 3339 or a duration ago")
+	service := fs.String("service", "", "Only records whose service.name resource attribute matches")
+	signals := fs.String("signal", "", "Comma separated signals to archive: traces, metrics, logs (default: all)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+
+	read, list, code := parseReadFlags(fs, *since, *until, *service, *signals)
+	if code != 0 {
+		return code
+	}
+	if *output == "" {
+		return usageError(fs, "-output", fmt.Errorf("an output directory is required"))
+	}
+	if *compression != parquet.CompressionGzip && *compression != parquet.CompressionNone {
+		return usageError(fs, "-compression", fmt.Errorf("expected gzip or none"))
+	}
+	if *rowGroupSize <= 0 {
+		return usageError(fs, "-row-group-size", fmt.Errorf("must be positive"))
+	}
+	read.Limit = archiveBatchSize
+
+	conn, err := database.OpenReadOnly(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "archive: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	written, paths, err := exporter.WriteParquet(ctx, conn, *output, list, exporter.ParquetOptions{
+		Read:         read,
+		Compression:  *compression,
+		RowGroupSize: *rowGroupSize,
+	})
+	var counts []string
+	for _, signal := range list {
+		counts = append(counts, fmt.Sprintf("%d %s", written[signal], signal))
+	}
+	fmt.Fprintf(os.Stderr, "Archived %s in %d files under %s\n", strings.Join(counts, ", "), len(paths), *output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "archive: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// retentionArchiver writes expired records to Parquet files under dir
+// before retention deletes them. Tenants other than the default get their
+// own directory under dir/tenants. Every signal is written in one run, so
+// a failure leaves no files behind to be archived again by the next one.
+func retentionArchiver(dir string) database.Archiver {
+	return func(tenant string, conn *sql.DB, cutoff time.Time, upTo map[string]int64) error {
+		out := dir
+		if tenant != database.DefaultTenant {
+			out = filepath.Join(dir, "tenants", tenant)
+		}
+		var signals []string
+		for _, signal := range database.Signals {
+			// An empty table has no row ID bound and nothing to archive
+			if upTo[signal] != 0 {
+				signals = append(signals, signal)
+			}
+		}
+		if len(signals) == 0 {
+			return nil
+		}
+		read := database.ReadOptions{Until: cutoff.UnixNano() - 1, Limit: archiveBatchSize}
+		written, paths, err := exporter.WriteParquet(context.Background(), conn, out, signals, exporter.ParquetOptions{Read: read, UpToIDs: upTo})
+		if err != nil {
+			return err
+		}
+		if len(paths) > 0 {
+			var counts []string
+			for _, signal := range signals {
+				counts = append(counts, fmt.Sprintf("%d %s", written[signal], database.ArchiveTable(signal)))
+			}
+			logging.Info("Archived expired %s for tenant %s in %d files under %s",
+				strings.Join(counts, ", "), tenant, len(paths), out)
+		}
+		return nil
+	}
+}
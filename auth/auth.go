@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+)
+
+// Permissions that can be granted to a key
+const (
+	PermTraces  = "traces"  // write to /v1/traces
+	PermMetrics = "metrics" // write to /v1/metrics
+	PermLogs    = "logs"    // write to /v1/logs
+	PermRead    = "read"    // access the read/query API
+	PermAdmin   = "admin"   // run arbitrary read-only SQL with /api/v1/sql
+	PermAll     = "*"       // every permission except admin
+)
+
+// hashPrefix identifies the hashing scheme used for stored keys
+const hashPrefix = "sha256:"
+
+// Key describes a credential entry in the keys file.
+// Only the hash of the token is stored, never the token itself.
+type Key struct {
+	Name        string   `json:"name"`
+	Hash        string   `json:"hash"`
+	Permissions []string `json:"permissions"`
+	Tenant      string   `json:"tenant,omitempty"` // Tenant the key writes to and reads from
+}
+
+// keysFile is the on-disk format of the keys file
+type keysFile struct {
+	Keys []Key `json:"keys"`
+}
+
+// Identity is the authenticated principal attached to a request
+type Identity struct {
+	Name        string
+	Tenant      string
+	permissions map[string]bool
+}
+
+// Allows reports whether the identity holds the given permission. Admin
+// must be granted explicitly and is not implied by "*".
+func (i *Identity) Allows(permission string) bool {
+	if permission == PermAdmin {
+		return i.permissions[PermAdmin]
+	}
+	return i.permissions[PermAll] || i.permissions[permission]
+}
+
+// credential is a parsed key ready for comparison
+type credential struct {
+	identity *Identity
+	hash     []byte
+}
+
+// Store authenticates requests against a set of hashed keys
+type Store struct {
+	mu          sync.RWMutex
+	credentials []credential
+	static      []credential // Tokens added with AddToken, kept across reloads
+
+	rejectMu   sync.Mutex
+	rejections map[string]uint64
+}
+
+// contextKey is used to store the identity in a request context
+type contextKey struct{}
+
+// HashToken returns the hashed form of a token as stored in the keys file
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// NewStore creates a store from the given keys
+func NewStore(keys []Key) (*Store, error) {
+	s := &Store{rejections: make(map[string]uint64)}
+	if err := s.setKeys(keys); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadFile creates a store from a JSON keys file
+func LoadFile(path string) (*Store, error) {
+	keys, err := readKeysFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(keys)
+}
+
+// readKeysFile parses a JSON keys file
+func readKeysFile(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys file: %w", err)
+	}
+	var file keysFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse keys file %s: %w", path, err)
+	}
+	return file.Keys, nil
+}
+
+// setKeys validates and installs a new set of keys
+func (s *Store) setKeys(keys []Key) error {
+	credentials := make([]credential, 0, len(keys))
+	names := make(map[string]bool)
+	for i, key := range keys {
+		if key.Name == "" {
+			return fmt.Errorf("key %d: name is required", i)
+		}
+		if names[key.Name] {
+			return fmt.Errorf("key '%s': duplicate name", key.Name)
+		}
+		names[key.Name] = true
+
+		c, err := newCredential(key)
+		if err != nil {
+			return err
+		}
+		credentials = append(credentials, c)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.static {
+		if names[c.identity.Name] {
+			return fmt.Errorf("key '%s': duplicate name", c.identity.Name)
+		}
+		credentials = append(credentials, c)
+	}
+	s.credentials = credentials
+	return nil
+}
+
+// ReloadFile replaces the keys with those in a JSON keys file. Tokens added
+// with AddToken are kept. On error the current keys stay in effect.
+func (s *Store) ReloadFile(path string) error {
+	keys, err := readKeysFile(path)
+	if err != nil {
+		return err
+	}
+	return s.setKeys(keys)
+}
+
+// newCredential parses and validates a single key
+func newCredential(key Key) (credential, error) {
+	if !strings.HasPrefix(key.Hash, hashPrefix) {
+		return credential{}, fmt.Errorf("key '%s': hash must start with '%s'", key.Name, hashPrefix)
+	}
+	hash, err := hex.DecodeString(strings.TrimPrefix(key.Hash, hashPrefix))
+	if err != nil || len(hash) != sha256.Size {
+		return credential{}, fmt.Errorf("key '%s': hash is not a valid SHA-256 hex digest", key.Name)
+	}
+
+	permissions := make(map[string]bool)
+	for _, p := range key.Permissions {
+		switch p {
+		case PermTraces, PermMetrics, PermLogs, PermRead, PermAdmin, PermAll:
+			permissions[p] = true
+		default:
+			return credential{}, fmt.Errorf("key '%s': unknown permission '%s'", key.Name, p)
+		}
+	}
+
+	return credential{
+		identity: &Identity{Name: key.Name, Tenant: key.Tenant, permissions: permissions},
+		hash:     hash,
+	}, nil
+}
+
+// AddToken registers a plaintext static token under the given name.
+// The token is hashed immediately and only the hash is kept in memory.
+func (s *Store) AddToken(name, token string, permissions ...string) error {
+	c, err := newCredential(Key{Name: name, Hash: HashToken(token), Permissions: permissions})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.credentials {
+		if existing.identity.Name == name {
+			return fmt.Errorf("key '%s': duplicate name", name)
+		}
+	}
+	s.credentials = append(s.credentials, c)
+	s.static = append(s.static, c)
+	return nil
+}
+
+// Authenticate returns the identity owning the token, if any.
+// Every stored hash is compared in constant time so the response time does
+// not reveal which key, if any, matched.
+func (s *Store) Authenticate(token string) (*Identity, bool) {
+	if token == "" {
+		return nil, false
+	}
+	sum := sha256.Sum256([]byte(token))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var match *Identity
+	for _, c := range s.credentials {
+		if subtle.ConstantTimeCompare(sum[:], c.hash) == 1 {
+			match = c.identity
+		}
+	}
+	return match, match != nil
+}
+
+// tokenFromRequest extracts a bearer token or API key from the request headers
+func tokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// Require wraps a handler so only requests holding the permission reach it.
+// Missing or unknown credentials get 401, insufficient permissions get 403.
+func (s *Store) Require(permission string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := tokenFromRequest(r)
+		identity, ok := s.Authenticate(token)
+		if !ok {
+			name := "unknown"
+			if token == "" {
+				name = "anonymous"
+			}
+			s.recordRejection(name)
+			logging.Info("Rejected unauthenticated request to %s from %s", r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sqlite-otel-collector"`)
+			writeStatus(w, http.StatusUnauthorized, codeUnauthenticated, "missing or invalid credentials")
+			return
+		}
+		if !identity.Allows(permission) {
+			s.recordRejection(identity.Name)
+			logging.Info("Rejected request to %s from key '%s': missing '%s' permission",
+				r.URL.Path, identity.Name, permission)
+			writeStatus(w, http.StatusForbidden, codePermissionDenied,
+				fmt.Sprintf("key is not permitted to %s", describePermission(permission)))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, identity)))
+	})
+}
+
+// describePermission returns a human readable description of a permission
+func describePermission(permission string) string {
+	switch permission {
+	case PermRead:
+		return "read data"
+	case PermAdmin:
+		return "run SQL queries"
+	}
+	return "write " + permission
+}
+
+// recordRejection increments the rejected request counter for a key
+func (s *Store) recordRejection(name string) {
+	s.rejectMu.Lock()
+	s.rejections[name]++
+	s.rejectMu.Unlock()
+}
+
+// Rejections returns a snapshot of rejected request counts per key name.
+// Requests without credentials are counted as "anonymous" and requests
+// with unrecognised credentials as "unknown".
+func (s *Store) Rejections() map[string]uint64 {
+	s.rejectMu.Lock()
+	defer s.rejectMu.Unlock()
+
+	snapshot := make(map[string]uint64, len(s.rejections))
+	for name, count := range s.rejections {
+		snapshot[name] = count
+	}
+	return snapshot
+}
+
+// FromContext returns the authenticated identity stored in ctx, if any
+func FromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(*Identity)
+	return identity, ok
+}
+
+// gRPC status codes used in OTLP error responses
+const (
+	codePermissionDenied = 7
+	codeUnauthenticated  = 16
+)
+
+// writeStatus writes an OTLP error response as a JSON encoded google.rpc.Status
+func writeStatus(w http.ResponseWriter, httpStatus, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    code,
+		"message": message,
+	})
+}
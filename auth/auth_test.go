@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := NewStore([]Key{
+		{Name: "writer", Hash: HashToken("writer-token"), Permissions: []string{PermTraces, PermLogs}},
+		{Name: "reader", Hash: HashToken("reader-token"), Permissions: []string{PermRead}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestAuthenticate(t *testing.T) {
+	store := newTestStore(t)
+
+	identity, ok := store.Authenticate("writer-token")
+	if !ok || identity.Name != "writer" {
+		t.Fatalf("Expected writer identity, got %v (ok=%v)", identity, ok)
+	}
+	if !identity.Allows(PermTraces) || identity.Allows(PermMetrics) {
+		t.Error("Unexpected permissions for writer key")
+	}
+
+	if _, ok := store.Authenticate("wrong-token"); ok {
+		t.Error("Expected unknown token to be rejected")
+	}
+	if _, ok := store.Authenticate(""); ok {
+		t.Error("Expected empty token to be rejected")
+	}
+}
+
+func TestRequire(t *testing.T) {
+	store := newTestStore(t)
+
+	var seen string
+	handler := store.Require(PermTraces, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identity, ok := FromContext(r.Context()); ok {
+			seen = identity.Name
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		expected int
+	}{
+		{"missing credentials", "", "", http.StatusUnauthorized},
+		{"invalid bearer token", "Authorization", "Bearer nope", http.StatusUnauthorized},
+		{"insufficient permission", "Authorization", "Bearer reader-token", http.StatusForbidden},
+		{"valid bearer token", "Authorization", "Bearer writer-token", http.StatusOK},
+		{"valid api key", "X-API-Key", "writer-token", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/traces", nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, rec.Code)
+		}
+	}
+
+	if seen != "writer" {
+		t.Errorf("Expected identity 'writer' in request context, got '%s'", seen)
+	}
+
+	rejections := store.Rejections()
+	if rejections["anonymous"] != 1 || rejections["unknown"] != 1 || rejections["reader"] != 1 {
+		t.Errorf("Unexpected rejection counts: %v", rejections)
+	}
+}
+
+func TestAdminRequiresExplicitGrant(t *testing.T) {
+	store, err := NewStore([]Key{
+		{Name: "all", Hash: HashToken("all-token"), Permissions: []string{PermAll}},
+		{Name: "admin", Hash: HashToken("admin-token"), Permissions: []string{PermAdmin}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddToken("static-token", "static", PermAll); err != nil {
+		t.Fatal(err)
+	}
+	handler := store.Require(PermAdmin, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		token    string
+		expected int
+	}{
+		{"all-token", http.StatusForbidden},
+		{"static", http.StatusForbidden},
+		{"admin-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/sql", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.token, tt.expected, rec.Code)
+		}
+	}
+
+	identity, _ := store.Authenticate("all-token")
+	if !identity.Allows(PermRead) || !identity.Allows(PermTraces) {
+		t.Error("Expected '*' to grant every other permission")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `{"keys": [{"name": "ci", "hash": "` + HashToken("secret") + `", "permissions": ["*"]}]}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, ok := store.Authenticate("secret")
+	if !ok || !identity.Allows(PermMetrics) || !identity.Allows(PermRead) {
+		t.Error("Expected wildcard key to grant every permission")
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	os.WriteFile(bad, []byte(`{"keys": [{"name": "x", "hash": "plaintext"}]}`), 0600)
+	if _, err := LoadFile(bad); err == nil {
+		t.Error("Expected error for unhashed key")
+	}
+}
+
+func TestReloadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKey := func(token string) {
+		content := `{"keys": [{"name": "ci", "hash": "` + HashToken(token) + `", "permissions": ["traces"]}]}`
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeKey("old")
+	store, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddToken("static-token", "static", PermAll); err != nil {
+		t.Fatal(err)
+	}
+
+	writeKey("new")
+	if err := store.ReloadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Authenticate("old"); ok {
+		t.Error("Expected replaced key to be rejected")
+	}
+	if _, ok := store.Authenticate("new"); !ok {
+		t.Error("Expected reloaded key to authenticate")
+	}
+	if _, ok := store.Authenticate("static"); !ok {
+		t.Error("Expected static token to survive a reload")
+	}
+
+	os.WriteFile(path, []byte(`not json`), 0600)
+	if err := store.ReloadFile(path); err == nil {
+		t.Error("Expected error for invalid keys file")
+	}
+	if _, ok := store.Authenticate("new"); !ok {
+		t.Error("Expected previous keys to stay in effect after a failed reload")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/config"
+)
+
+// subcommands maps the first command line argument to a command. Each
+// receives the remaining arguments and returns the process exit status.
+// Without a subcommand the collector runs as a server.
+var subcommands = map[string]func(args []string) int{
+	"replay":  runReplay,
+	"export":  runExport,
+	"import":  runImport,
+	"archive": runArchive,
+	"query":   runQuery,
+	"tail":    runTail,
+}
+
+// exitUsage is the exit status for invalid command line arguments
+const exitUsage = 2
+
+// parseTimeArg parses a time given as RFC 3339 or as a duration before
+// now, such as 90m or 7d, into Unix nanoseconds. An empty string is 0.
+func parseTimeArg(s string, now time.Time) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.UnixNano(), nil
+	}
+	d, err := config.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid time '%s' (expected RFC 3339 or a duration such as 2h or 7d)", s)
+	}
+	return now.Add(-d).UnixNano(), nil
+}
+
+// headerFlag collects repeated "Name: value" flags
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	var parts []string
+	for name, values := range h {
+		for _, v := range values {
+			parts = append(parts, name+": "+v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (h headerFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected 'Name: value'")
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	return nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/ratelimit"
+)
+
+// Config is the structure of the optional JSON configuration file.
+// Scalar settings are command-line flags; the file holds settings that
+// need per-tenant or per-key structure.
+type Config struct {
+	Tenants    map[string]TenantConfig `json:"tenants"`
+	RateLimits *ratelimit.Config       `json:"rate_limits,omitempty"`
+	Logging    *LoggingConfig          `json:"logging,omitempty"`
+	Exporters  []ExporterConfig        `json:"exporters,omitempty"`
+}
+
+// ExporterConfig forwards stored telemetry to an upstream OTLP/HTTP endpoint
+type ExporterConfig struct {
+	Name         string            `json:"name"`
+	Endpoint     string            `json:"endpoint"`                // Base URL, e.g. http://otel-collector:4318
+	Encoding     string            `json:"encoding,omitempty"`      // json or protobuf (default: protobuf)
+	Compression  string            `json:"compression,omitempty"`   // gzip or none (default: gzip)
+	Headers      map[string]string `json:"headers,omitempty"`       // Added to every request
+	Signals      []string          `json:"signals,omitempty"`       // traces, metrics, logs (default: all)
+	TenantHeader string            `json:"tenant_header,omitempty"` // Header carrying the tenant name
+	BatchSize    int               `json:"batch_size,omitempty"`    // Records per request (default: 1000)
+	BatchDelay   *Duration         `json:"batch_delay,omitempty"`   // Wait for more data after a commit (default: 200ms)
+	PollInterval *Duration         `json:"poll_interval,omitempty"` // Check for other writes (default: 10s)
+	Timeout      *Duration         `json:"timeout,omitempty"`       // Per request (default: 10s)
+	MaxBackoff   *Duration         `json:"max_backoff,omitempty"`   // Longest retry delay (default: 30s)
+	StartAt      string            `json:"start_at,omitempty"`      // latest or oldest (default: latest)
+}
+
+// LoggingConfig selects execution log outputs. Command-line flags that are
+// set explicitly take precedence.
+type LoggingConfig struct {
+	Outputs       []string `json:"outputs,omitempty"`        // auto, stdout, file, journald, syslog
+	SyslogAddress string   `json:"syslog_address,omitempty"` // unix:///dev/log or udp://host:514
+}
+
+// TenantConfig overrides the default retention and quota for one tenant
+type TenantConfig struct {
+	Retention *Duration `json:"retention,omitempty"`      // e.g. "72h" or "30d"
+	MaxSizeMB *int64    `json:"max_db_size_mb,omitempty"` // 0 means unlimited
+}
+
+// Duration is a time.Duration that also accepts a day suffix ("7d")
+type Duration time.Duration
+
+// ParseDuration parses a Go duration string or a whole number of days such as "7d"
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration '%s'", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration '%s'", s)
+	}
+	return d, nil
+}
+
+// UnmarshalJSON accepts duration strings such as "90m", "72h" or "30d"
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"72h\" or \"30d\"")
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration in Go duration syntax
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Load reads and parses a configuration file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg := &Config{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Archive column types
+const (
+	ColumnInt  = "int"
+	ColumnReal = "real"
+	ColumnText = "text"
+	ColumnTime = "time" // Unix nanoseconds, 0 read as null
+)
+
+// ArchiveColumn is a column of the flat rows returned by ReadArchive
+type ArchiveColumn struct {
+	Name string
+	Type string
+	expr string
+}
+
+// ArchiveRow is a record with its resource and scope denormalized
+type ArchiveRow struct {
+	Time   int64         // The timestamp retention compares, in Unix nanoseconds
+	Values []interface{} // int64, float64, string or nil, one per column
+}
+
+// ArchiveBatch is a page of rows read by ReadArchive
+type ArchiveBatch struct {
+	Rows   []ArchiveRow
+	LastID int64 // Row ID of the last row, for paging
+}
+
+// archiveSource describes the rows archived for a signal
+type archiveSource struct {
+	table    string
+	idColumn string
+	// timeExpr matches the timestamp PurgeBefore compares, so archiving up
+	// to a cutoff covers exactly what retention deletes
+	timeExpr string
+	from     string
+	columns  []ArchiveColumn
+}
+
+// resourceArchiveColumns are appended to every signal's columns
+var resourceArchiveColumns = []ArchiveColumn{
+	{"service_name", ColumnText, serviceNameExpr},
+	{"resource_attributes", ColumnText, "r.attributes"},
+	{"resource_schema_url", ColumnText, "r.schema_url"},
+	{"scope_name", ColumnText, "sc.name"},
+	{"scope_version", ColumnText, "sc.version"},
+	{"scope_attributes", ColumnText, "sc.attributes"},
+}
+
+var archiveSources = map[string]archiveSource{
+	SignalTraces: {
+		table:    "spans",
+		idColumn: "s.id",
+		timeExpr: "COALESCE(NULLIF(s.end_time_unix_nano, 0), s.start_time_unix_nano)",
+		from:     signalSources[SignalTraces].from,
+		columns: []ArchiveColumn{
+			{"trace_id", ColumnText, "s.trace_id"},
+			{"span_id", ColumnText, "s.span_id"},
+			{"parent_span_id", ColumnText, "NULLIF(s.parent_span_id, '')"},
+			{"trace_state", ColumnText, "NULLIF(s.trace_state, '')"},
+			{"name", ColumnText, "s.name"},
+			{"kind", ColumnInt, "s.kind"},
+			{"start_time", ColumnTime, "s.start_time_unix_nano"},
+			{"end_time", ColumnTime, "s.end_time_unix_nano"},
+			{"duration_nano", ColumnInt, "CASE WHEN s.start_time_unix_nano > 0 AND s.end_time_unix_nano >= s.start_time_unix_nano THEN s.end_time_unix_nano - s.start_time_unix_nano END"},
+			{"status_code", ColumnInt, "s.status_code"},
+			{"status_message", ColumnText, "NULLIF(s.status_message, '')"},
+			{"attributes", ColumnText, "s.attributes"},
+			{"events", ColumnText, "s.events"},
+			{"links", ColumnText, "s.links"},
+		},
+	},
+	SignalLogs: {
+		table:    "log_records",
+		idColumn: "l.id",
+		timeExpr: signalSources[SignalLogs].timeColumn,
+		from:     signalSources[SignalLogs].from,
+		columns: []ArchiveColumn{
+			{"time", ColumnTime, "l.time_unix_nano"},
+			{"observed_time", ColumnTime, "l.observed_time_unix_nano"},
+			{"severity_number", ColumnInt, "l.severity_number"},
+			{"severity_text", ColumnText, "NULLIF(l.severity_text, '')"},
+			{"body", ColumnText, "l.body"},
+			{"attributes", ColumnText, "l.attributes"},
+			{"trace_id", ColumnText, "NULLIF(l.trace_id, '')"},
+			{"span_id", ColumnText, "NULLIF(l.span_id, '')"},
+			{"flags", ColumnInt, "l.flags"},
+		},
+	},
+	SignalMetrics: {
+		table:    "metric_data_points",
+		idColumn: "dp.id",
+		timeExpr: signalSources[SignalMetrics].timeColumn,
+		from:     signalSources[SignalMetrics].from,
+		columns: []ArchiveColumn{
+			{"metric_name", ColumnText, "m.name"},
+			{"metric_description", ColumnText, "NULLIF(m.description, '')"},
+			{"metric_unit", ColumnText, "NULLIF(m.unit, '')"},
+			{"metric_type", ColumnText, "m.metric_type"},
+			{"start_time", ColumnTime, "dp.start_time_unix_nano"},
+			{"time", ColumnTime, "dp.time_unix_nano"},
+			{"value_double", ColumnReal, "dp.value_double"},
+			{"value_int", ColumnInt, "dp.value_int"},
+			{"attributes", ColumnText, "dp.attributes"},
+			{"exemplars", ColumnText, "dp.exemplars"},
+			{"flags", ColumnInt, "dp.flags"},
+		},
+	},
+}
+
+// ArchiveTable returns the table a signal's archived rows come from
+func ArchiveTable(signal string) string {
+	return archiveSources[signal].table
+}
+
+// ArchiveColumns returns the columns of a signal's archived rows
+func ArchiveColumns(signal string) []ArchiveColumn {
+	src, ok := archiveSources[signal]
+	if !ok {
+		return nil
+	}
+	return append(append([]ArchiveColumn(nil), src.columns...), resourceArchiveColumns...)
+}
+
+// ReadArchive reads the records matching opts as flat rows in row ID
+// order, with their resource and scope attributes as JSON text columns.
+// Since and Until compare the timestamp retention uses.
+func ReadArchive(conn *sql.DB, signal string, opts ReadOptions) (*ArchiveBatch, error) {
+	src, ok := archiveSources[signal]
+	if !ok {
+		return nil, fmt.Errorf("unknown signal '%s'", signal)
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultReadLimit
+	}
+	columns := ArchiveColumns(signal)
+	exprs := make([]string, len(columns))
+	for i, c := range columns {
+		exprs[i] = c.expr
+	}
+	conditions, args := readConditions(src.idColumn, src.timeExpr, opts)
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT %s, COALESCE(%s, 0), %s
+		FROM %s
+		%s
+		ORDER BY %s
+		LIMIT ?`, src.idColumn, src.timeExpr, strings.Join(exprs, ", "), src.from,
+		whereClause(conditions), src.idColumn), append(args, opts.Limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", src.table, err)
+	}
+	defer rows.Close()
+
+	b := &ArchiveBatch{LastID: opts.AfterID}
+	raw := make([]interface{}, len(columns))
+	dest := []interface{}{&b.LastID, new(int64)}
+	for i := range raw {
+		dest = append(dest, &raw[i])
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", src.table, err)
+		}
+		row := ArchiveRow{Time: *dest[1].(*int64), Values: make([]interface{}, len(columns))}
+		for i, c := range columns {
+			row.Values[i] = archiveValue(c.Type, raw[i])
+		}
+		b.Rows = append(b.Rows, row)
+	}
+	return b, rows.Err()
+}
+
+// archiveValue converts a scanned value to the Go type of its column
+func archiveValue(typ string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case int64:
+		switch typ {
+		case ColumnReal:
+			return float64(v)
+		case ColumnText:
+			return fmt.Sprint(v)
+		case ColumnTime:
+			if v == 0 {
+				return nil
+			}
+		}
+		return v
+	case float64:
+		switch typ {
+		case ColumnInt, ColumnTime:
+			return int64(v)
+		case ColumnText:
+			return fmt.Sprint(v)
+		}
+		return v
+	case []byte:
+		return archiveValue(typ, string(v))
+	case string:
+		if typ == ColumnText {
+			return v
+		}
+		return nil
+	}
+	return nil
+}
+
+// PurgeArchived deletes the records PurgeBefore would, but only up to the
+// given row ID per signal, so rows stored after they were archived survive
+func PurgeArchived(conn *sql.DB, cutoff time.Time, upTo map[string]int64) (int64, error) {
+	return purge(conn, cutoff.UnixNano(), upTo)
+}
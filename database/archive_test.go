@@ -0,0 +1,78 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReadArchiveDenormalizes(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	resource := map[string]interface{}{"attributes": []interface{}{map[string]interface{}{
+		"key": "service.name", "value": map[string]interface{}{"stringValue": "checkout"},
+	}}}
+	scope := map[string]interface{}{"name": "http", "version": "1.2"}
+	err := InsertTraceData(map[string]interface{}{"resourceSpans": []interface{}{map[string]interface{}{
+		"resource": resource,
+		"scopeSpans": []interface{}{map[string]interface{}{"scope": scope, "spans": []interface{}{map[string]interface{}{
+			"traceId": "0102030405060708090a0b0c0d0e0f10", "spanId": "0000000000000001", "name": "GET /",
+			"kind": float64(2), "startTimeUnixNano": "1700000000000000000", "endTimeUnixNano": "1700000000250000000",
+		}}}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = InsertMetricsData(map[string]interface{}{"resourceMetrics": []interface{}{map[string]interface{}{
+		"resource": resource,
+		"scopeMetrics": []interface{}{map[string]interface{}{"scope": scope, "metrics": []interface{}{map[string]interface{}{
+			"name": "queue.depth", "unit": "1",
+			"gauge": map[string]interface{}{"dataPoints": []interface{}{map[string]interface{}{
+				"timeUnixNano": "1700000000000000000", "asDouble": 4.5,
+			}}},
+		}}}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := func(signal string) map[string]interface{} {
+		t.Helper()
+		batch, err := ReadArchive(DB(), signal, ReadOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(batch.Rows) != 1 || batch.LastID == 0 {
+			t.Fatalf("Expected one %s row, got %d", signal, len(batch.Rows))
+		}
+		values := make(map[string]interface{})
+		for i, c := range ArchiveColumns(signal) {
+			values[c.Name] = batch.Rows[0].Values[i]
+		}
+		return values
+	}
+
+	span := row(SignalTraces)
+	if span["service_name"] != "checkout" || span["scope_name"] != "http" || span["scope_version"] != "1.2" {
+		t.Errorf("Expected resource and scope on the span row, got %v", span)
+	}
+	if span["duration_nano"] != int64(250000000) || span["kind"] != int64(2) || span["parent_span_id"] != nil {
+		t.Errorf("Unexpected span columns: %v", span)
+	}
+
+	point := row(SignalMetrics)
+	if point["metric_name"] != "queue.depth" || point["value_double"] != 4.5 || point["value_int"] != nil {
+		t.Errorf("Unexpected data point columns: %v", point)
+	}
+	if point["start_time"] != nil || point["time"] != int64(1700000000000000000) {
+		t.Errorf("Expected unset timestamps to be null, got %v", point)
+	}
+
+	// Paging resumes after the last row ID
+	batch, err := ReadArchive(DB(), SignalTraces, ReadOptions{AfterID: 1})
+	if err != nil || len(batch.Rows) != 0 {
+		t.Errorf("Expected no spans after the last row ID, got %v, %v", batch, err)
+	}
+}
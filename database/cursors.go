@@ -0,0 +1,33 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ExportCursor returns the last row ID an exporter has forwarded for a
+// signal. ok is false if the exporter has not forwarded anything yet.
+func ExportCursor(conn *sql.DB, exporter, signal string) (id int64, ok bool, err error) {
+	err = conn.QueryRow("SELECT last_id FROM export_cursors WHERE exporter = ? AND signal = ?",
+		exporter, signal).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read export cursor: %w", err)
+	}
+	return id, true, nil
+}
+
+// SetExportCursor records the last row ID an exporter has forwarded
+func SetExportCursor(conn *sql.DB, exporter, signal string, id int64) error {
+	_, err := conn.Exec(`
+		INSERT INTO export_cursors (exporter, signal, last_id, updated_unix_nano) VALUES (?, ?, ?, ?)
+		ON CONFLICT(exporter, signal) DO UPDATE SET last_id = excluded.last_id, updated_unix_nano = excluded.updated_unix_nano`,
+		exporter, signal, id, time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to save export cursor: %w", err)
+	}
+	return nil
+}
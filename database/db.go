@@ -2,8 +2,11 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -16,23 +19,69 @@ func DB() *sql.DB {
 
 // InitDB initializes the SQLite database connection and creates tables
 func InitDB(dbPath string) error {
-	var err error
-	db, err = sql.Open("sqlite3", dbPath)
+	conn, err := openDB(dbPath)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return err
+	}
+	db = conn
+	schemaReady.Store(true)
+	return nil
+}
+
+// openDB opens a SQLite database file and makes sure the schema exists
+func openDB(dbPath string) (*sql.DB, error) {
+	conn, err := sql.Open("sqlite3", dataSourceName(dbPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Enable WAL mode for better concurrent performance
-	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
-		return fmt.Errorf("failed to enable WAL mode: %w", err)
+	if _, err := conn.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
 	}
 
 	// Create tables
-	if err := createTables(); err != nil {
-		return fmt.Errorf("failed to create tables: %w", err)
+	if err := createTables(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
-	return nil
+	return conn, nil
+}
+
+// OpenReadOnly opens an existing database file for reading. The schema is
+// not created or migrated and writes through the connection fail.
+func OpenReadOnly(dbPath string) (*sql.DB, error) {
+	return openReadOnly("sqlite3", dbPath, "")
+}
+
+// openReadOnly opens dbPath read-only with a driver, appending options to
+// the data source name
+func openReadOnly(driver, dbPath, options string) (*sql.DB, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// Characters with a meaning in SQLite URIs are escaped in the path
+	uri := "file:" + strings.NewReplacer("%", "%25", "?", "%3F", "#", "%23").Replace(dbPath) + "?mode=ro" + options
+	conn, err := sql.Open(driver, dataSourceName(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return conn, nil
+}
+
+// dataSourceName adds the connection options shared by every database
+func dataSourceName(dbPath string) string {
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s_busy_timeout=%d", dbPath, sep, BusyTimeout.Milliseconds())
 }
 
 // GetDB returns the database connection
@@ -40,18 +89,44 @@ func GetDB() *sql.DB {
 	return db
 }
 
-// CloseDB closes the database connection
-func CloseDB() {
-	if db != nil {
-		if err := db.Close(); err != nil {
-			log.Printf("failed to close database: %v", err)
-		}
+// CloseDB optimizes, checkpoints and closes the database connection.
+// An error means the database was not left in a clean state.
+func CloseDB() error {
+	schemaReady.Store(false)
+	if db == nil {
+		return nil
+	}
+	err := closeConn(db)
+	if err != nil {
+		log.Printf("failed to close database cleanly: %v", err)
+	}
+	return err
+}
+
+// closeConn refreshes query planner statistics, folds the write-ahead log
+// back into the database file and closes the connection, so the file is
+// self-contained once the process exits
+func closeConn(conn *sql.DB) error {
+	var errs []error
+	if _, err := conn.Exec("PRAGMA optimize"); err != nil {
+		errs = append(errs, fmt.Errorf("optimize failed: %w", err))
+	}
+	var busy, walFrames, checkpointed int
+	err := conn.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &walFrames, &checkpointed)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("checkpoint failed: %w", err))
+	} else if busy != 0 {
+		errs = append(errs, fmt.Errorf("checkpoint incomplete: database busy"))
 	}
+	if err := conn.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close failed: %w", err))
+	}
+	return errors.Join(errs...)
 }
 
 // createTables creates all required tables
-func createTables() error {
-	tx, err := db.Begin()
+func createTables(conn *sql.DB) error {
+	tx, err := conn.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -75,8 +150,10 @@ func createTables() error {
 			schema_url TEXT NOT NULL DEFAULT ''
 		)`,
 
-		// Spans table
+		// Spans table. The id pages exports and is never reused, unlike the
+		// implicit rowid of a table without an INTEGER PRIMARY KEY.
 		`CREATE TABLE IF NOT EXISTS spans (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			trace_id TEXT NOT NULL,
 			span_id TEXT NOT NULL,
 			trace_state TEXT,
@@ -92,7 +169,7 @@ func createTables() error {
 			status_message TEXT,
 			resource_id INTEGER,
 			scope_id INTEGER,
-			PRIMARY KEY (trace_id, span_id),
+			UNIQUE (trace_id, span_id),
 			FOREIGN KEY (resource_id) REFERENCES resources (id),
 			FOREIGN KEY (scope_id) REFERENCES instrumentation_scopes (id)
 		)`,
@@ -142,6 +219,15 @@ func createTables() error {
 			FOREIGN KEY (scope_id) REFERENCES instrumentation_scopes (id)
 		)`,
 
+		// Export cursors: the last row forwarded per exporter and signal
+		`CREATE TABLE IF NOT EXISTS export_cursors (
+			exporter TEXT NOT NULL,
+			signal TEXT NOT NULL,
+			last_id INTEGER NOT NULL,
+			updated_unix_nano INTEGER NOT NULL,
+			PRIMARY KEY (exporter, signal)
+		)`,
+
 		// Create indexes for performance
 		`CREATE INDEX IF NOT EXISTS idx_spans_trace_id ON spans(trace_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_spans_resource_id ON spans(resource_id)`,
@@ -155,11 +241,21 @@ func createTables() error {
 		`CREATE UNIQUE INDEX IF NOT EXISTS idx_metrics_unique ON metrics(name, metric_type, resource_id, scope_id)`,
 	}
 
+	// A spans table without ids is set aside and copied into the new one
+	legacySpans, err := renameLegacySpans(tx)
+	if err != nil {
+		return err
+	}
 	for _, table := range tables {
 		if _, err := tx.Exec(table); err != nil {
 			return fmt.Errorf("failed to create table: %w", err)
 		}
 	}
+	if legacySpans {
+		if err := copyLegacySpans(tx); err != nil {
+			return err
+		}
+	}
 
 	return tx.Commit()
 }
\ No newline at end of file
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package database
+
+import "errors"
+
+// FreeSpace is not supported on this platform
+func FreeSpace(path string) (uint64, error) {
+	return 0, errors.New("free disk space is not available on this platform")
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd
+
+package database
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// FreeSpace returns the bytes available to unprivileged users on the file
+// system holding path
+func FreeSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, fmt.Errorf("failed to stat file system: %w", err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
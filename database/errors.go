@@ -0,0 +1,41 @@
+package database
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// SQLite primary result codes used to classify storage errors
+const (
+	sqliteBusy   = 5
+	sqliteLocked = 6
+	sqliteIOErr  = 10
+	sqliteFull   = 13
+)
+
+// BusyTimeout is how long a statement waits for a lock held by another
+// connection before failing with SQLITE_BUSY
+var BusyTimeout = 5 * time.Second
+
+// SetBusyTimeout sets the lock wait used by databases opened afterwards
+func SetBusyTimeout(d time.Duration) {
+	BusyTimeout = d
+}
+
+// IsBusy reports whether err means the database was locked by another
+// writer. The write may succeed if it is retried.
+func IsBusy(err error) bool {
+	code, _, ok := sqliteError(err)
+	return ok && (code == sqliteBusy || code == sqliteLocked)
+}
+
+// IsFull reports whether err means the database or its file system ran
+// out of space
+func IsFull(err error) bool {
+	if errors.Is(err, syscall.ENOSPC) {
+		return true
+	}
+	code, errno, ok := sqliteError(err)
+	return ok && (code == sqliteFull || (code == sqliteIOErr && errno == syscall.ENOSPC))
+}
@@ -0,0 +1,20 @@
+//go:build cgo
+
+package database
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteError extracts the primary result code and OS errno from a
+// SQLite error
+func sqliteError(err error) (int, syscall.Errno, bool) {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return 0, 0, false
+	}
+	return int(sqliteErr.Code), sqliteErr.SystemErrno, true
+}
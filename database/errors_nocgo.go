@@ -0,0 +1,10 @@
+//go:build !cgo
+
+package database
+
+import "syscall"
+
+// sqliteError always fails without cgo, where the SQLite driver is a stub
+func sqliteError(err error) (int, syscall.Errno, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyStorageErrors(t *testing.T) {
+	defer SetBusyTimeout(BusyTimeout)
+	SetBusyTimeout(10 * time.Millisecond)
+
+	path := filepath.Join(t.TempDir(), "errors.db")
+	holder, err := openDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+	writer, err := openDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	// Hold the write lock so the other connection times out
+	tx, err := holder.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("DELETE FROM resources WHERE 0"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Exec("INSERT INTO resources (attributes) VALUES ('{}')")
+	tx.Rollback()
+	if !IsBusy(fmt.Errorf("insert failed: %w", err)) || IsFull(err) {
+		t.Errorf("Expected a busy error, got %v", err)
+	}
+
+	// Cap the database at its current size so the next insert runs out of
+	// pages. The limit is per connection, so pin one.
+	conn, err := writer.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var pages int
+	if err := conn.QueryRowContext(context.Background(), "PRAGMA page_count").Scan(&pages); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(context.Background(), fmt.Sprintf("PRAGMA max_page_count = %d", pages)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.ExecContext(context.Background(), "INSERT INTO resources (attributes) SELECT printf('%.10000c', 'x') FROM (SELECT 1 UNION SELECT 2 UNION SELECT 3)")
+	if !IsFull(err) || IsBusy(err) {
+		t.Errorf("Expected a full database error, got %v", err)
+	}
+
+	if !IsFull(fmt.Errorf("write failed: %w", syscall.ENOSPC)) {
+		t.Error("Expected ENOSPC to be classified as full")
+	}
+	if IsBusy(nil) || IsFull(nil) {
+		t.Error("nil is not a storage error")
+	}
+}
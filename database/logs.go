@@ -4,11 +4,26 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 // InsertLogsData inserts logs telemetry data into the database
 func InsertLogsData(data map[string]interface{}) error {
-	tx, err := db.Begin()
+	return InsertLogsDataInto(db, data)
+}
+
+// InsertLogsDataInto inserts logs telemetry data into the given database
+func InsertLogsDataInto(conn *sql.DB, data map[string]interface{}) error {
+	return insertLogsData(conn, data, observeInsert)
+}
+
+// insertLogsData inserts logs data and reports the outcome to observe
+func insertLogsData(conn *sql.DB, data map[string]interface{}, observe insertObserver) (err error) {
+	var recordCount int64
+	start := time.Now()
+	defer func() { observe("logs", start, recordCount, err) }()
+
+	tx, err := conn.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -77,6 +92,7 @@ func InsertLogsData(data map[string]interface{}) error {
 				if err := InsertLogRecord(tx, logRecord, resourceID, scopeID); err != nil {
 					return fmt.Errorf("failed to insert log record: %w", err)
 				}
+				recordCount++
 			}
 		}
 	}
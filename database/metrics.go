@@ -5,11 +5,26 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 )
 
 // InsertMetricsData inserts metrics telemetry data into the database
 func InsertMetricsData(data map[string]interface{}) error {
-	tx, err := db.Begin()
+	return InsertMetricsDataInto(db, data)
+}
+
+// InsertMetricsDataInto inserts metrics telemetry data into the given database
+func InsertMetricsDataInto(conn *sql.DB, data map[string]interface{}) error {
+	return insertMetricsData(conn, data, observeInsert)
+}
+
+// insertMetricsData inserts metrics data and reports the outcome to observe
+func insertMetricsData(conn *sql.DB, data map[string]interface{}, observe insertObserver) (err error) {
+	var pointCount int64
+	start := time.Now()
+	defer func() { observe("metrics", start, pointCount, err) }()
+
+	tx, err := conn.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -84,6 +99,7 @@ func InsertMetricsData(data map[string]interface{}) error {
 				if err := InsertMetric(tx, metric, resourceID, scopeID); err != nil {
 					return fmt.Errorf("failed to insert metric: %w", err)
 				}
+				pointCount += CountDataPoints(metric)
 			}
 		}
 	}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// legacySpansTable holds the spans of an older database while they are
+// copied into the current schema
+const legacySpansTable = "spans_legacy"
+
+// spanColumns are the columns copied from a legacy spans table
+const spanColumns = `trace_id, span_id, trace_state, parent_span_id, name, kind,
+	start_time_unix_nano, end_time_unix_nano, attributes, events, links,
+	status_code, status_message, resource_id, scope_id`
+
+// renameLegacySpans moves a spans table created before spans had an id
+// column out of the way, together with its indexes, so the current table
+// can be created. It reports whether there was one.
+func renameLegacySpans(tx *sql.Tx) (bool, error) {
+	var tables, ids int
+	err := tx.QueryRow(`SELECT COUNT(*), COUNT(CASE WHEN p.name = 'id' THEN 1 END)
+		FROM sqlite_master m, pragma_table_info(m.name) p
+		WHERE m.type = 'table' AND m.name = 'spans'`).Scan(&tables, &ids)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect spans table: %w", err)
+	}
+	if tables == 0 || ids > 0 {
+		return false, nil
+	}
+	for _, stmt := range []string{
+		"ALTER TABLE spans RENAME TO " + legacySpansTable,
+		"DROP INDEX IF EXISTS idx_spans_trace_id",
+		"DROP INDEX IF EXISTS idx_spans_resource_id",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return false, fmt.Errorf("failed to migrate spans table: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// copyLegacySpans copies the spans set aside by renameLegacySpans into the
+// current table and drops the old one. Row IDs become span ids, so export
+// cursors keep their position.
+func copyLegacySpans(tx *sql.Tx) error {
+	result, err := tx.Exec(fmt.Sprintf("INSERT INTO spans (id, %s) SELECT rowid, %s FROM %s ORDER BY rowid",
+		spanColumns, spanColumns, legacySpansTable))
+	if err != nil {
+		return fmt.Errorf("failed to migrate spans: %w", err)
+	}
+	if _, err := tx.Exec("DROP TABLE " + legacySpansTable); err != nil {
+		return fmt.Errorf("failed to migrate spans: %w", err)
+	}
+	copied, _ := result.RowsAffected()
+	log.Printf("migrated %d spans to a table with span ids", copied)
+	return nil
+}
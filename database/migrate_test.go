@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// insertSpans stores spans with the given span ids under one trace
+func insertSpans(t *testing.T, conn *sql.DB, ids ...int) {
+	t.Helper()
+	var spans []interface{}
+	for _, id := range ids {
+		spans = append(spans, map[string]interface{}{
+			"traceId": "0102030405060708090a0b0c0d0e0f10", "spanId": fmt.Sprintf("%016x", id), "name": "op",
+			"startTimeUnixNano": fmt.Sprint(time.Now().UnixNano()), "endTimeUnixNano": fmt.Sprint(time.Now().UnixNano()),
+		})
+	}
+	err := InsertTraceDataInto(conn, map[string]interface{}{"resourceSpans": []interface{}{map[string]interface{}{
+		"resource":   map[string]interface{}{},
+		"scopeSpans": []interface{}{map[string]interface{}{"spans": spans}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpanIDsNotReusedAfterPurge(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	insertSpans(t, DB(), 1, 2, 3, 4, 5)
+	cursor, err := LastRowID(DB(), SignalTraces)
+	if err != nil || cursor != 5 {
+		t.Fatalf("Expected last span id 5, got %d (%v)", cursor, err)
+	}
+	if _, err := PurgeBefore(DB(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// New spans must sort after the cursor even though the table was emptied
+	insertSpans(t, DB(), 6)
+	if pending, err := CountAfter(DB(), SignalTraces, cursor); err != nil || pending != 1 {
+		t.Errorf("Expected 1 pending span after the purge, got %d (%v)", pending, err)
+	}
+	batch, err := ReadBatch(DB(), SignalTraces, ReadOptions{AfterID: cursor})
+	if err != nil || batch.Records != 1 || batch.LastID <= cursor {
+		t.Errorf("Expected the new span after cursor %d, got %d records up to %d (%v)", cursor, batch.Records, batch.LastID, err)
+	}
+}
+
+func TestLegacySpansTableMigrated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	legacy, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE spans (
+			trace_id TEXT NOT NULL, span_id TEXT NOT NULL, trace_state TEXT, parent_span_id TEXT,
+			name TEXT, kind INTEGER, start_time_unix_nano INTEGER, end_time_unix_nano INTEGER,
+			attributes TEXT, events TEXT, links TEXT, status_code INTEGER, status_message TEXT,
+			resource_id INTEGER, scope_id INTEGER, PRIMARY KEY (trace_id, span_id))`,
+		`CREATE INDEX idx_spans_trace_id ON spans(trace_id)`,
+		`INSERT INTO spans (rowid, trace_id, span_id, name) VALUES (7, 't', 'a', 'first'), (9, 't', 'b', 'second')`,
+	} {
+		if _, err := legacy.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	legacy.Close()
+
+	conn, err := openDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var name string
+	if err := conn.QueryRow("SELECT name FROM spans WHERE id = 9").Scan(&name); err != nil || name != "second" {
+		t.Errorf("Expected row IDs kept as span ids, got %q (%v)", name, err)
+	}
+	var indexes int
+	conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = 'spans' AND name LIKE 'idx_spans_%'").Scan(&indexes)
+	if indexes != 2 {
+		t.Errorf("Expected the spans indexes recreated, got %d", indexes)
+	}
+	insertSpans(t, conn, 1)
+	if last, _ := LastRowID(conn, SignalTraces); last != 10 {
+		t.Errorf("Expected new spans to continue after the migrated ids, got %d", last)
+	}
+	if err := conn.QueryRow("SELECT name FROM sqlite_master WHERE name = ?", legacySpansTable).Scan(&name); err != sql.ErrNoRows {
+		t.Errorf("Expected the legacy table to be dropped, got %v", err)
+	}
+}
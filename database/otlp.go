@@ -0,0 +1,515 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Signals stored in the database
+const (
+	SignalTraces  = "traces"
+	SignalMetrics = "metrics"
+	SignalLogs    = "logs"
+)
+
+// Signals lists every signal in a stable order
+var Signals = []string{SignalTraces, SignalMetrics, SignalLogs}
+
+// DefaultReadLimit is the number of records read by ReadBatch when no
+// limit is given
+const DefaultReadLimit = 1000
+
+// ReadOptions selects the records returned by ReadBatch
+type ReadOptions struct {
+	AfterID int64  // Only records with a larger row ID
+	UpToID  int64  // Only records with a row ID at most this (0 for none)
+	Since   int64  // Timestamp lower bound in Unix nanoseconds (0 for none)
+	Until   int64  // Timestamp upper bound in Unix nanoseconds (0 for none)
+	Service string // service.name resource attribute (empty for all)
+	Limit   int    // Maximum number of spans, log records or data points
+}
+
+// Batch is an OTLP export request rebuilt from stored rows
+type Batch struct {
+	Signal  string
+	Payload map[string]interface{} // ExportTraceServiceRequest etc. in OTLP JSON form
+	Records int                    // Spans, log records or data points in the payload
+	LastID  int64                  // Row ID of the last record, for paging
+}
+
+// otlpKeys are the JSON field names of each signal's export request
+var otlpKeys = map[string][3]string{
+	SignalTraces:  {"resourceSpans", "scopeSpans", "spans"},
+	SignalMetrics: {"resourceMetrics", "scopeMetrics", "metrics"},
+	SignalLogs:    {"resourceLogs", "scopeLogs", "logRecords"},
+}
+
+// signalTables maps each signal to the table whose row IDs page through it
+var signalTables = map[string]string{
+	SignalTraces:  "spans",
+	SignalMetrics: "metric_data_points",
+	SignalLogs:    "log_records",
+}
+
+// signalSource describes where a signal's records are read from
+type signalSource struct {
+	from       string // Tables joined to the record's resource (r) and scope (sc)
+	idColumn   string // Row ID used for paging
+	timeColumn string // Timestamp compared against Since and Until
+}
+
+var signalSources = map[string]signalSource{
+	SignalTraces: {
+		from: `spans s
+		LEFT JOIN resources r ON r.id = s.resource_id
+		LEFT JOIN instrumentation_scopes sc ON sc.id = s.scope_id`,
+		idColumn:   "s.id",
+		timeColumn: "s.start_time_unix_nano",
+	},
+	SignalLogs: {
+		from: `log_records l
+		LEFT JOIN resources r ON r.id = l.resource_id
+		LEFT JOIN instrumentation_scopes sc ON sc.id = l.scope_id`,
+		idColumn:   "l.id",
+		timeColumn: "COALESCE(NULLIF(l.time_unix_nano, 0), l.observed_time_unix_nano)",
+	},
+	SignalMetrics: {
+		from: `metric_data_points dp
+		JOIN metrics m ON m.id = dp.metric_id
+		LEFT JOIN resources r ON r.id = m.resource_id
+		LEFT JOIN instrumentation_scopes sc ON sc.id = m.scope_id`,
+		idColumn:   "dp.id",
+		timeColumn: "dp.time_unix_nano",
+	},
+}
+
+// ReadBatch rebuilds an OTLP export request from the records matching
+// opts, in row ID order. Records are regrouped under their resource and
+// instrumentation scope. An empty batch has zero Records.
+func ReadBatch(conn *sql.DB, signal string, opts ReadOptions) (*Batch, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultReadLimit
+	}
+	b := &Batch{Signal: signal, LastID: opts.AfterID}
+	g := newOTLPGrouper(signal)
+	var err error
+	switch signal {
+	case SignalTraces:
+		err = readSpans(conn, opts, g, b)
+	case SignalLogs:
+		err = readLogRecords(conn, opts, g, b)
+	case SignalMetrics:
+		err = readDataPoints(conn, opts, g, b)
+	default:
+		return nil, fmt.Errorf("unknown signal '%s'", signal)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.Payload = map[string]interface{}{otlpKeys[signal][0]: g.resources}
+	return b, nil
+}
+
+// LastRowID returns the highest row ID stored for a signal, or 0
+func LastRowID(conn *sql.DB, signal string) (int64, error) {
+	table, ok := signalTables[signal]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal '%s'", signal)
+	}
+	var id sql.NullInt64
+	if err := conn.QueryRow("SELECT MAX(id) FROM " + table).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to read last %s row: %w", signal, err)
+	}
+	return id.Int64, nil
+}
+
+// CountAfter returns the number of records of a signal with a row ID
+// larger than id
+func CountAfter(conn *sql.DB, signal string, id int64) (int64, error) {
+	table, ok := signalTables[signal]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal '%s'", signal)
+	}
+	var count int64
+	if err := conn.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE id > ?", id).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count pending %s: %w", signal, err)
+	}
+	return count, nil
+}
+
+// Extent summarizes the records matching a ReadOptions
+type Extent struct {
+	Records int64 // Number of records, ignoring Limit
+	Oldest  int64 // Oldest timestamp in Unix nanoseconds, 0 if none
+	Newest  int64 // Newest timestamp in Unix nanoseconds, 0 if none
+}
+
+// ReadExtent counts the records matching opts and finds their time range
+func ReadExtent(conn *sql.DB, signal string, opts ReadOptions) (Extent, error) {
+	src, ok := signalSources[signal]
+	if !ok {
+		return Extent{}, fmt.Errorf("unknown signal '%s'", signal)
+	}
+	conditions, args := readConditions(src.idColumn, src.timeColumn, opts)
+	var oldest, newest sql.NullInt64
+	var e Extent
+	query := fmt.Sprintf("SELECT COUNT(*), MIN(NULLIF(%[1]s, 0)), MAX(NULLIF(%[1]s, 0)) FROM %s %s",
+		src.timeColumn, src.from, whereClause(conditions))
+	if err := conn.QueryRow(query, args...).Scan(&e.Records, &oldest, &newest); err != nil {
+		return Extent{}, fmt.Errorf("failed to read %s extent: %w", signal, err)
+	}
+	e.Oldest, e.Newest = oldest.Int64, newest.Int64
+	return e, nil
+}
+
+// readConditions builds the filters shared by every signal. timeColumn is
+// the timestamp compared against Since and Until.
+func readConditions(idColumn, timeColumn string, opts ReadOptions) ([]string, []interface{}) {
+	conditions := []string{idColumn + " > ?"}
+	args := []interface{}{opts.AfterID}
+	if opts.UpToID > 0 {
+		conditions = append(conditions, idColumn+" <= ?")
+		args = append(args, opts.UpToID)
+	}
+	if opts.Service != "" {
+		conditions = append(conditions, serviceNameExpr+" = ?")
+		args = append(args, opts.Service)
+	}
+	if opts.Since > 0 {
+		conditions = append(conditions, timeColumn+" >= ?")
+		args = append(args, opts.Since)
+	}
+	if opts.Until > 0 {
+		conditions = append(conditions, timeColumn+" <= ?")
+		args = append(args, opts.Until)
+	}
+	return conditions, args
+}
+
+// resourceColumns and scopeColumns select the resource and scope of a row
+const (
+	resourceColumns = "r.id, r.attributes, r.schema_url"
+	scopeColumns    = "sc.id, sc.name, sc.version, sc.attributes, sc.schema_url"
+)
+
+// resourceRow and scopeRow hold the scanned resource and scope columns
+type resourceRow struct {
+	id                    sql.NullInt64
+	attributes, schemaURL sql.NullString
+}
+
+type scopeRow struct {
+	id                                   sql.NullInt64
+	name, version, attributes, schemaURL sql.NullString
+}
+
+func (r *resourceRow) dest() []interface{} {
+	return []interface{}{&r.id, &r.attributes, &r.schemaURL}
+}
+
+func (s *scopeRow) dest() []interface{} {
+	return []interface{}{&s.id, &s.name, &s.version, &s.attributes, &s.schemaURL}
+}
+
+// readSpans adds the spans matching opts to g
+func readSpans(conn *sql.DB, opts ReadOptions, g *otlpGrouper, b *Batch) error {
+	src := signalSources[SignalTraces]
+	conditions, args := readConditions(src.idColumn, src.timeColumn, opts)
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT s.id, s.trace_id, s.span_id, s.trace_state, s.parent_span_id, s.name, s.kind,
+			s.start_time_unix_nano, s.end_time_unix_nano, s.attributes, s.events, s.links,
+			s.status_code, s.status_message, %s, %s
+		FROM %s
+		%s
+		ORDER BY s.id
+		LIMIT ?`, resourceColumns, scopeColumns, src.from, whereClause(conditions)), append(args, opts.Limit)...)
+	if err != nil {
+		return fmt.Errorf("failed to read spans: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var traceID, spanID string
+		var state, parent, name, statusMessage sql.NullString
+		var kind, start, end, statusCode sql.NullInt64
+		var attributes, events, links sql.NullString
+		var res resourceRow
+		var scope scopeRow
+		dest := []interface{}{&id, &traceID, &spanID, &state, &parent, &name, &kind,
+			&start, &end, &attributes, &events, &links, &statusCode, &statusMessage}
+		dest = append(append(dest, res.dest()...), scope.dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to scan span: %w", err)
+		}
+
+		span := map[string]interface{}{
+			"traceId":           traceID,
+			"spanId":            spanID,
+			"name":              name.String,
+			"kind":              kind.Int64,
+			"startTimeUnixNano": nanoString(start.Int64),
+			"endTimeUnixNano":   nanoString(end.Int64),
+		}
+		setIfNotEmpty(span, "traceState", state.String)
+		setIfNotEmpty(span, "parentSpanId", parent.String)
+		setJSON(span, "attributes", attributes)
+		setJSON(span, "events", events)
+		setJSON(span, "links", links)
+		if statusCode.Int64 != 0 || statusMessage.String != "" {
+			status := map[string]interface{}{"code": statusCode.Int64}
+			setIfNotEmpty(status, "message", statusMessage.String)
+			span["status"] = status
+		}
+
+		g.scope(res, scope).add(span)
+		b.Records++
+		b.LastID = id
+	}
+	return rows.Err()
+}
+
+// readLogRecords adds the log records matching opts to g
+func readLogRecords(conn *sql.DB, opts ReadOptions, g *otlpGrouper, b *Batch) error {
+	src := signalSources[SignalLogs]
+	conditions, args := readConditions(src.idColumn, src.timeColumn, opts)
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT l.id, l.time_unix_nano, l.observed_time_unix_nano, l.severity_number,
+			l.severity_text, l.body, l.attributes, l.trace_id, l.span_id, l.flags, %s, %s
+		FROM %s
+		%s
+		ORDER BY l.id
+		LIMIT ?`, resourceColumns, scopeColumns, src.from, whereClause(conditions)), append(args, opts.Limit)...)
+	if err != nil {
+		return fmt.Errorf("failed to read log records: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var timeUnix, observed, severity, flags sql.NullInt64
+		var severityText, body, attributes, traceID, spanID sql.NullString
+		var res resourceRow
+		var scope scopeRow
+		dest := []interface{}{&id, &timeUnix, &observed, &severity,
+			&severityText, &body, &attributes, &traceID, &spanID, &flags}
+		dest = append(append(dest, res.dest()...), scope.dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to scan log record: %w", err)
+		}
+
+		record := map[string]interface{}{}
+		if timeUnix.Int64 != 0 {
+			record["timeUnixNano"] = nanoString(timeUnix.Int64)
+		}
+		if observed.Int64 != 0 {
+			record["observedTimeUnixNano"] = nanoString(observed.Int64)
+		}
+		if severity.Int64 != 0 {
+			record["severityNumber"] = severity.Int64
+		}
+		setIfNotEmpty(record, "severityText", severityText.String)
+		if v := parseJSONColumn(body); v != nil {
+			// Records without a body were stored as an empty object
+			if m, ok := v.(map[string]interface{}); !ok || len(m) > 0 {
+				record["body"] = v
+			}
+		}
+		setJSON(record, "attributes", attributes)
+		setIfNotEmpty(record, "traceId", traceID.String)
+		setIfNotEmpty(record, "spanId", spanID.String)
+		if flags.Int64 != 0 {
+			record["flags"] = flags.Int64
+		}
+
+		g.scope(res, scope).add(record)
+		b.Records++
+		b.LastID = id
+	}
+	return rows.Err()
+}
+
+// readDataPoints adds the metric data points matching opts to g, grouped
+// under their metric
+func readDataPoints(conn *sql.DB, opts ReadOptions, g *otlpGrouper, b *Batch) error {
+	src := signalSources[SignalMetrics]
+	conditions, args := readConditions(src.idColumn, src.timeColumn, opts)
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT dp.id, m.id, m.name, m.description, m.unit, m.metric_type,
+			dp.attributes, dp.start_time_unix_nano, dp.time_unix_nano,
+			dp.value_double, dp.value_int, dp.exemplars, dp.flags, %s, %s
+		FROM %s
+		%s
+		ORDER BY dp.id
+		LIMIT ?`, resourceColumns, scopeColumns, src.from, whereClause(conditions)), append(args, opts.Limit)...)
+	if err != nil {
+		return fmt.Errorf("failed to read metric data points: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, metricID int64
+		var name, metricType string
+		var description, unit, attributes, exemplars sql.NullString
+		var start, timeUnix, valueInt, flags sql.NullInt64
+		var valueDouble sql.NullFloat64
+		var res resourceRow
+		var scope scopeRow
+		dest := []interface{}{&id, &metricID, &name, &description, &unit, &metricType,
+			&attributes, &start, &timeUnix, &valueDouble, &valueInt, &exemplars, &flags}
+		dest = append(append(dest, res.dest()...), scope.dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to scan metric data point: %w", err)
+		}
+
+		point := map[string]interface{}{
+			"startTimeUnixNano": nanoString(start.Int64),
+			"timeUnixNano":      nanoString(timeUnix.Int64),
+		}
+		// Histogram and summary fields are kept next to the attributes
+		// under _metricData, see InsertMetricDataPoint
+		switch attrs := parseJSONColumn(attributes).(type) {
+		case []interface{}:
+			point["attributes"] = attrs
+		case map[string]interface{}:
+			if data, ok := attrs["_metricData"].(map[string]interface{}); ok {
+				for k, v := range data {
+					point[k] = v
+				}
+			}
+		}
+		if valueDouble.Valid {
+			point["asDouble"] = valueDouble.Float64
+		} else if valueInt.Valid {
+			point["asInt"] = strconv.FormatInt(valueInt.Int64, 10)
+		}
+		setJSON(point, "exemplars", exemplars)
+		if flags.Int64 != 0 {
+			point["flags"] = flags.Int64
+		}
+
+		metric := g.scope(res, scope).metric(metricID, name, description.String, unit.String, metricType)
+		data := metric[metricType].(map[string]interface{})
+		data["dataPoints"] = append(data["dataPoints"].([]interface{}), point)
+		b.Records++
+		b.LastID = id
+	}
+	return rows.Err()
+}
+
+// otlpGrouper rebuilds the resource and scope nesting of an export request
+// while preserving the order in which resources and scopes first appear
+type otlpGrouper struct {
+	keys      [3]string
+	resources []interface{}
+	byID      map[int64]*resourceGroup
+}
+
+type resourceGroup struct {
+	entry  map[string]interface{}
+	scopes map[int64]*scopeGroup
+}
+
+type scopeGroup struct {
+	keys    [3]string
+	entry   map[string]interface{}
+	metrics map[int64]map[string]interface{}
+}
+
+func newOTLPGrouper(signal string) *otlpGrouper {
+	return &otlpGrouper{keys: otlpKeys[signal], resources: []interface{}{}, byID: make(map[int64]*resourceGroup)}
+}
+
+// scope returns the group for a resource and scope, creating it if needed
+func (g *otlpGrouper) scope(res resourceRow, scope scopeRow) *scopeGroup {
+	rg, ok := g.byID[res.id.Int64]
+	if !ok {
+		resource := map[string]interface{}{}
+		setJSON(resource, "attributes", res.attributes)
+		entry := map[string]interface{}{"resource": resource, g.keys[1]: []interface{}{}}
+		setIfNotEmpty(entry, "schemaUrl", res.schemaURL.String)
+		rg = &resourceGroup{entry: entry, scopes: make(map[int64]*scopeGroup)}
+		g.byID[res.id.Int64] = rg
+		g.resources = append(g.resources, entry)
+	}
+
+	sg, ok := rg.scopes[scope.id.Int64]
+	if !ok {
+		s := map[string]interface{}{}
+		setIfNotEmpty(s, "name", scope.name.String)
+		setIfNotEmpty(s, "version", scope.version.String)
+		setJSON(s, "attributes", scope.attributes)
+		entry := map[string]interface{}{"scope": s, g.keys[2]: []interface{}{}}
+		setIfNotEmpty(entry, "schemaUrl", scope.schemaURL.String)
+		sg = &scopeGroup{keys: g.keys, entry: entry, metrics: make(map[int64]map[string]interface{})}
+		rg.scopes[scope.id.Int64] = sg
+		rg.entry[g.keys[1]] = append(rg.entry[g.keys[1]].([]interface{}), entry)
+	}
+	return sg
+}
+
+// add appends a span or log record to the scope
+func (s *scopeGroup) add(item map[string]interface{}) {
+	s.entry[s.keys[2]] = append(s.entry[s.keys[2]].([]interface{}), item)
+}
+
+// metric returns the metric a data point belongs to, creating it if needed.
+// Temporality and monotonicity are not stored, so sums are rebuilt as
+// cumulative and non-monotonic and histograms as cumulative.
+func (s *scopeGroup) metric(id int64, name, description, unit, metricType string) map[string]interface{} {
+	if m, ok := s.metrics[id]; ok {
+		return m
+	}
+	data := map[string]interface{}{"dataPoints": []interface{}{}}
+	switch metricType {
+	case "sum":
+		data["aggregationTemporality"] = 2
+		data["isMonotonic"] = false
+	case "histogram", "exponentialHistogram":
+		data["aggregationTemporality"] = 2
+	}
+	m := map[string]interface{}{"name": name, metricType: data}
+	setIfNotEmpty(m, "description", description)
+	setIfNotEmpty(m, "unit", unit)
+	s.metrics[id] = m
+	s.add(m)
+	return m
+}
+
+// nanoString formats a timestamp the way OTLP JSON encodes 64-bit integers
+func nanoString(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// parseJSONColumn decodes a JSON column, returning nil for NULL, empty
+// and JSON null values
+func parseJSONColumn(s sql.NullString) interface{} {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	// Numbers are kept as written so nanosecond timestamps are not rounded
+	dec := json.NewDecoder(strings.NewReader(s.String))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil
+	}
+	return v
+}
+
+// setJSON sets key to a decoded JSON array column. Empty arrays and the
+// empty object stored for missing attributes are skipped.
+func setJSON(m map[string]interface{}, key string, s sql.NullString) {
+	if list, ok := parseJSONColumn(s).([]interface{}); ok && len(list) > 0 {
+		m[key] = list
+	}
+}
+
+func setIfNotEmpty(m map[string]interface{}, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
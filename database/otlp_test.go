@@ -0,0 +1,91 @@
+package database
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadBatchRegroupsRecords(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	resource := func(service string) map[string]interface{} {
+		return map[string]interface{}{"attributes": []interface{}{map[string]interface{}{
+			"key": "service.name", "value": map[string]interface{}{"stringValue": service},
+		}}}
+	}
+	span := func(id string) map[string]interface{} {
+		return map[string]interface{}{
+			"traceId": "0102030405060708090a0b0c0d0e0f10", "spanId": id, "name": "op-" + id,
+			"kind": float64(2), "startTimeUnixNano": "1700000000000000000", "endTimeUnixNano": "1700000001000000000",
+			"status": map[string]interface{}{"code": float64(2), "message": "boom"},
+		}
+	}
+	traces := map[string]interface{}{"resourceSpans": []interface{}{
+		map[string]interface{}{"resource": resource("checkout"), "scopeSpans": []interface{}{
+			map[string]interface{}{"scope": map[string]interface{}{"name": "http"}, "spans": []interface{}{span("0000000000000001"), span("0000000000000002")}},
+		}},
+		map[string]interface{}{"resource": resource("cart"), "scopeSpans": []interface{}{
+			map[string]interface{}{"scope": map[string]interface{}{"name": "http"}, "spans": []interface{}{span("0000000000000003")}},
+		}},
+	}}
+	if err := InsertTraceData(traces); err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := ReadBatch(DB(), SignalTraces, ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Records != 3 || batch.LastID == 0 {
+		t.Fatalf("Expected 3 spans, got %d (last ID %d)", batch.Records, batch.LastID)
+	}
+	resourceSpans := batch.Payload["resourceSpans"].([]interface{})
+	if len(resourceSpans) != 2 {
+		t.Fatalf("Expected spans grouped under 2 resources, got %d", len(resourceSpans))
+	}
+	first := resourceSpans[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})
+	if got := len(first["spans"].([]interface{})); got != 2 {
+		t.Errorf("Expected 2 spans under the first scope, got %d", got)
+	}
+	if name := first["scope"].(map[string]interface{})["name"]; name != "http" {
+		t.Errorf("Expected scope name http, got %v", name)
+	}
+
+	// The rebuilt request is valid input for the insert path
+	data, _ := json.Marshal(batch.Payload)
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	copyDB, err := openDB(filepath.Join(t.TempDir(), "copy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copyDB.Close()
+	if err := InsertTraceDataInto(copyDB, decoded); err != nil {
+		t.Fatalf("Rebuilt request was rejected: %v", err)
+	}
+	spans, err := QuerySpans(copyDB, SpanQuery{Service: "checkout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 2 || spans[0].StatusMessage != "boom" || spans[0].Kind != 2 {
+		t.Errorf("Unexpected spans after round trip: %+v", spans)
+	}
+
+	// Paging and filters
+	page, err := ReadBatch(DB(), SignalTraces, ReadOptions{AfterID: batch.LastID})
+	if err != nil || page.Records != 0 {
+		t.Errorf("Expected no spans after the last ID, got %d, %v", page.Records, err)
+	}
+	filtered, err := ReadBatch(DB(), SignalTraces, ReadOptions{Service: "cart"})
+	if err != nil || filtered.Records != 1 {
+		t.Errorf("Expected 1 cart span, got %d, %v", filtered.Records, err)
+	}
+	extent, err := ReadExtent(DB(), SignalTraces, ReadOptions{Service: "checkout"})
+	if err != nil || extent.Records != 2 || extent.Oldest != 1700000000000000000 || extent.Newest != extent.Oldest {
+		t.Errorf("Unexpected extent of checkout spans: %+v, %v", extent, err)
+	}
+}
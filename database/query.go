@@ -0,0 +1,517 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// serviceNameExpr extracts the service.name attribute from a resources row
+const serviceNameExpr = `COALESCE((SELECT json_extract(value, '$.value.stringValue') FROM json_each(r.attributes)
+	WHERE json_extract(value, '$.key') = 'service.name' LIMIT 1), '')`
+
+// DefaultQueryLimit and MaxQueryLimit bound the number of rows returned by queries
+const (
+	DefaultQueryLimit = 100
+	MaxQueryLimit     = 1000
+)
+
+// SpanQuery filters the spans returned by QuerySpans
+type SpanQuery struct {
+	TraceID string
+	Service string
+	Name    string
+	Since   int64 // Start time lower bound in Unix nanoseconds (0 for none)
+	Until   int64 // Start time upper bound in Unix nanoseconds (0 for none)
+	// MinDuration only returns spans lasting at least this many nanoseconds
+	MinDuration int64
+	ErrorsOnly  bool // Only spans whose status is error
+	Limit       int
+}
+
+// SpanRecord is a stored span joined with its resource and scope
+type SpanRecord struct {
+	TraceID            string          `json:"traceId"`
+	SpanID             string          `json:"spanId"`
+	ParentSpanID       string          `json:"parentSpanId,omitempty"`
+	TraceState         string          `json:"traceState,omitempty"`
+	Name               string          `json:"name"`
+	Kind               int64           `json:"kind"`
+	StartTimeUnixNano  int64           `json:"startTimeUnixNano"`
+	EndTimeUnixNano    int64           `json:"endTimeUnixNano"`
+	Attributes         json.RawMessage `json:"attributes"`
+	Events             json.RawMessage `json:"events"`
+	Links              json.RawMessage `json:"links"`
+	StatusCode         int64           `json:"statusCode"`
+	StatusMessage      string          `json:"statusMessage,omitempty"`
+	ServiceName        string          `json:"serviceName"`
+	ResourceAttributes json.RawMessage `json:"resourceAttributes"`
+	ScopeName          string          `json:"scopeName,omitempty"`
+	ScopeVersion       string          `json:"scopeVersion,omitempty"`
+}
+
+// LogQuery filters the log records returned by QueryLogs
+type LogQuery struct {
+	TraceID     string
+	Service     string
+	MinSeverity int64  // Minimum severity number (0 for all)
+	Search      string // Substring match on the body
+	Since       int64  // Timestamp lower bound in Unix nanoseconds (0 for none)
+	Until       int64  // Timestamp upper bound in Unix nanoseconds (0 for none)
+	Limit       int
+}
+
+// LogRecord is a stored log record joined with its resource and scope
+type LogRecord struct {
+	ID                   int64           `json:"id"`
+	TimeUnixNano         int64           `json:"timeUnixNano"`
+	ObservedTimeUnixNano int64           `json:"observedTimeUnixNano"`
+	SeverityNumber       int64           `json:"severityNumber"`
+	SeverityText         string          `json:"severityText,omitempty"`
+	Body                 json.RawMessage `json:"body"`
+	Attributes           json.RawMessage `json:"attributes"`
+	TraceID              string          `json:"traceId,omitempty"`
+	SpanID               string          `json:"spanId,omitempty"`
+	Flags                int64           `json:"flags"`
+	ServiceName          string          `json:"serviceName"`
+	ResourceAttributes   json.RawMessage `json:"resourceAttributes"`
+	ScopeName            string          `json:"scopeName,omitempty"`
+	ScopeVersion         string          `json:"scopeVersion,omitempty"`
+}
+
+// MetricQuery filters the data points returned by QueryMetricPoints
+type MetricQuery struct {
+	Name    string
+	Service string
+	Since   int64 // Timestamp lower bound in Unix nanoseconds (0 for none)
+	Until   int64 // Timestamp upper bound in Unix nanoseconds (0 for none)
+	Limit   int
+}
+
+// MetricPoint is a stored data point joined with its metric and resource
+type MetricPoint struct {
+	ID                 int64           `json:"id"`
+	Name               string          `json:"name"`
+	Description        string          `json:"description,omitempty"`
+	Unit               string          `json:"unit,omitempty"`
+	MetricType         string          `json:"metricType"`
+	ServiceName        string          `json:"serviceName"`
+	Attributes         json.RawMessage `json:"attributes"`
+	StartTimeUnixNano  int64           `json:"startTimeUnixNano"`
+	TimeUnixNano       int64           `json:"timeUnixNano"`
+	Value              *float64        `json:"value"`
+	ResourceAttributes json.RawMessage `json:"resourceAttributes"`
+}
+
+// clampLimit applies the default and maximum row limits
+func clampLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultQueryLimit
+	}
+	if limit > MaxQueryLimit {
+		return MaxQueryLimit
+	}
+	return limit
+}
+
+// rawJSON converts a nullable JSON column to a RawMessage
+func rawJSON(s sql.NullString) json.RawMessage {
+	if !s.Valid || s.String == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s.String)
+}
+
+// whereClause joins conditions into a WHERE clause
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
+
+// QuerySpans returns spans matching q, newest first. When a trace ID is
+// given the whole trace is returned in start time order instead.
+func QuerySpans(conn *sql.DB, q SpanQuery) ([]SpanRecord, error) {
+	var conditions []string
+	var args []interface{}
+	if q.TraceID != "" {
+		conditions = append(conditions, "s.trace_id = ?")
+		args = append(args, q.TraceID)
+	}
+	if q.Service != "" {
+		conditions = append(conditions, serviceNameExpr+" = ?")
+		args = append(args, q.Service)
+	}
+	if q.Name != "" {
+		conditions = append(conditions, "s.name = ?")
+		args = append(args, q.Name)
+	}
+	if q.Since > 0 {
+		conditions = append(conditions, "s.start_time_unix_nano >= ?")
+		args = append(args, q.Since)
+	}
+	if q.Until > 0 {
+		conditions = append(conditions, "s.start_time_unix_nano <= ?")
+		args = append(args, q.Until)
+	}
+	if q.MinDuration > 0 {
+		conditions = append(conditions, "s.end_time_unix_nano - s.start_time_unix_nano >= ?")
+		args = append(args, q.MinDuration)
+	}
+	if q.ErrorsOnly {
+		conditions = append(conditions, "s.status_code = 2")
+	}
+
+	order := "s.start_time_unix_nano DESC"
+	if q.TraceID != "" {
+		order = "s.start_time_unix_nano ASC"
+	}
+	args = append(args, clampLimit(q.Limit))
+
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT s.trace_id, s.span_id, s.parent_span_id, s.trace_state, s.name, s.kind,
+			s.start_time_unix_nano, s.end_time_unix_nano, s.attributes, s.events, s.links,
+			s.status_code, s.status_message, %s, r.attributes,
+			COALESCE(sc.name, ''), COALESCE(sc.version, '')
+		FROM spans s
+		LEFT JOIN resources r ON r.id = s.resource_id
+		LEFT JOIN instrumentation_scopes sc ON sc.id = s.scope_id
+		%s
+		ORDER BY %s
+		LIMIT ?`, serviceNameExpr, whereClause(conditions), order), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query spans: %w", err)
+	}
+	defer rows.Close()
+
+	spans := []SpanRecord{}
+	for rows.Next() {
+		var s SpanRecord
+		var parent, state, name, statusMessage sql.NullString
+		var kind, start, end, statusCode sql.NullInt64
+		var attributes, events, links, resourceAttributes sql.NullString
+		if err := rows.Scan(&s.TraceID, &s.SpanID, &parent, &state, &name, &kind,
+			&start, &end, &attributes, &events, &links,
+			&statusCode, &statusMessage, &s.ServiceName, &resourceAttributes,
+			&s.ScopeName, &s.ScopeVersion); err != nil {
+			return nil, fmt.Errorf("failed to scan span: %w", err)
+		}
+		s.ParentSpanID = parent.String
+		s.TraceState = state.String
+		s.Name = name.String
+		s.Kind = kind.Int64
+		s.StartTimeUnixNano = start.Int64
+		s.EndTimeUnixNano = end.Int64
+		s.Attributes = rawJSON(attributes)
+		s.Events = rawJSON(events)
+		s.Links = rawJSON(links)
+		s.StatusCode = statusCode.Int64
+		s.StatusMessage = statusMessage.String
+		s.ResourceAttributes = rawJSON(resourceAttributes)
+		spans = append(spans, s)
+	}
+	return spans, rows.Err()
+}
+
+// QueryLogs returns log records matching q, newest first
+func QueryLogs(conn *sql.DB, q LogQuery) ([]LogRecord, error) {
+	var conditions []string
+	var args []interface{}
+	if q.TraceID != "" {
+		conditions = append(conditions, "l.trace_id = ?")
+		args = append(args, q.TraceID)
+	}
+	if q.Service != "" {
+		conditions = append(conditions, serviceNameExpr+" = ?")
+		args = append(args, q.Service)
+	}
+	if q.MinSeverity > 0 {
+		conditions = append(conditions, "l.severity_number >= ?")
+		args = append(args, q.MinSeverity)
+	}
+	if q.Search != "" {
+		conditions = append(conditions, "l.body LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+escapeLike(q.Search)+"%")
+	}
+	if q.Since > 0 {
+		conditions = append(conditions, "l.time_unix_nano >= ?")
+		args = append(args, q.Since)
+	}
+	if q.Until > 0 {
+		conditions = append(conditions, "l.time_unix_nano <= ?")
+		args = append(args, q.Until)
+	}
+	args = append(args, clampLimit(q.Limit))
+
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT l.id, l.time_unix_nano, l.observed_time_unix_nano, l.severity_number,
+			l.severity_text, l.body, l.attributes, l.trace_id, l.span_id, l.flags,
+			%s, r.attributes, COALESCE(sc.name, ''), COALESCE(sc.version, '')
+		FROM log_records l
+		LEFT JOIN resources r ON r.id = l.resource_id
+		LEFT JOIN instrumentation_scopes sc ON sc.id = l.scope_id
+		%s
+		ORDER BY l.time_unix_nano DESC, l.id DESC
+		LIMIT ?`, serviceNameExpr, whereClause(conditions)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query logs: %w", err)
+	}
+	defer rows.Close()
+
+	records := []LogRecord{}
+	for rows.Next() {
+		var l LogRecord
+		var timeUnix, observed, severity, flags sql.NullInt64
+		var severityText, traceID, spanID sql.NullString
+		var body, attributes, resourceAttributes sql.NullString
+		if err := rows.Scan(&l.ID, &timeUnix, &observed, &severity,
+			&severityText, &body, &attributes, &traceID, &spanID, &flags,
+			&l.ServiceName, &resourceAttributes, &l.ScopeName, &l.ScopeVersion); err != nil {
+			return nil, fmt.Errorf("failed to scan log record: %w", err)
+		}
+		l.TimeUnixNano = timeUnix.Int64
+		l.ObservedTimeUnixNano = observed.Int64
+		l.SeverityNumber = severity.Int64
+		l.SeverityText = severityText.String
+		l.Body = rawJSON(body)
+		l.Attributes = rawJSON(attributes)
+		l.TraceID = traceID.String
+		l.SpanID = spanID.String
+		l.Flags = flags.Int64
+		l.ResourceAttributes = rawJSON(resourceAttributes)
+		records = append(records, l)
+	}
+	return records, rows.Err()
+}
+
+// QueryMetricPoints returns metric data points matching q, newest first
+func QueryMetricPoints(conn *sql.DB, q MetricQuery) ([]MetricPoint, error) {
+	var conditions []string
+	var args []interface{}
+	if q.Name != "" {
+		conditions = append(conditions, "m.name = ?")
+		args = append(args, q.Name)
+	}
+	if q.Service != "" {
+		conditions = append(conditions, serviceNameExpr+" = ?")
+		args = append(args, q.Service)
+	}
+	if q.Since > 0 {
+		conditions = append(conditions, "dp.time_unix_nano >= ?")
+		args = append(args, q.Since)
+	}
+	if q.Until > 0 {
+		conditions = append(conditions, "dp.time_unix_nano <= ?")
+		args = append(args, q.Until)
+	}
+	args = append(args, clampLimit(q.Limit))
+
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT dp.id, m.name, m.description, m.unit, m.metric_type, %s,
+			dp.attributes, dp.start_time_unix_nano, dp.time_unix_nano,
+			COALESCE(dp.value_double, dp.value_int), r.attributes
+		FROM metric_data_points dp
+		JOIN metrics m ON m.id = dp.metric_id
+		LEFT JOIN resources r ON r.id = m.resource_id
+		%s
+		ORDER BY dp.time_unix_nano DESC, dp.id DESC
+		LIMIT ?`, serviceNameExpr, whereClause(conditions)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metrics: %w", err)
+	}
+	defer rows.Close()
+
+	points := []MetricPoint{}
+	for rows.Next() {
+		var p MetricPoint
+		var description, unit, attributes, resourceAttributes sql.NullString
+		var start, timeUnix sql.NullInt64
+		var value sql.NullFloat64
+		if err := rows.Scan(&p.ID, &p.Name, &description, &unit, &p.MetricType, &p.ServiceName,
+			&attributes, &start, &timeUnix, &value, &resourceAttributes); err != nil {
+			return nil, fmt.Errorf("failed to scan metric data point: %w", err)
+		}
+		p.Description = description.String
+		p.Unit = unit.String
+		p.Attributes = rawJSON(attributes)
+		p.StartTimeUnixNano = start.Int64
+		p.TimeUnixNano = timeUnix.Int64
+		if value.Valid {
+			v := value.Float64
+			p.Value = &v
+		}
+		p.ResourceAttributes = rawJSON(resourceAttributes)
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// escapeLike escapes LIKE wildcards in a user supplied search string
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(s)
+}
+
+// TraceQuery filters the traces returned by QueryTraces. A trace matches
+// when any of its spans matches the service, name and time filters.
+type TraceQuery struct {
+	Service     string
+	Name        string
+	Since       int64 // Span start time lower bound in Unix nanoseconds (0 for none)
+	Until       int64 // Span start time upper bound in Unix nanoseconds (0 for none)
+	MinDuration int64 // Minimum trace duration in nanoseconds (0 for none)
+	ErrorsOnly  bool  // Only traces with a span whose status is error
+	Limit       int
+}
+
+// TraceSummary describes a stored trace
+type TraceSummary struct {
+	TraceID           string   `json:"traceId"`
+	RootName          string   `json:"rootName"`
+	RootServiceName   string   `json:"rootServiceName"`
+	StartTimeUnixNano int64    `json:"startTimeUnixNano"`
+	EndTimeUnixNano   int64    `json:"endTimeUnixNano"`
+	SpanCount         int64    `json:"spanCount"`
+	ErrorCount        int64    `json:"errorCount"`
+	Services          []string `json:"services"`
+}
+
+// QueryTraces returns summaries of the traces matching q, newest first.
+// The root is the span without a parent, or the earliest span when the
+// root has not been received.
+func QueryTraces(conn *sql.DB, q TraceQuery) ([]TraceSummary, error) {
+	var conditions []string
+	var args []interface{}
+	if q.Service != "" {
+		conditions = append(conditions, serviceNameExpr+" = ?")
+		args = append(args, q.Service)
+	}
+	if q.Name != "" {
+		conditions = append(conditions, "s.name = ?")
+		args = append(args, q.Name)
+	}
+	if q.Since > 0 {
+		conditions = append(conditions, "s.start_time_unix_nano >= ?")
+		args = append(args, q.Since)
+	}
+	if q.Until > 0 {
+		conditions = append(conditions, "s.start_time_unix_nano <= ?")
+		args = append(args, q.Until)
+	}
+	having := []string{"MAX(s.end_time_unix_nano) - MIN(s.start_time_unix_nano) >= ?"}
+	args = append(args, q.MinDuration)
+	if q.ErrorsOnly {
+		having = append(having, "SUM(s.status_code = 2) > 0")
+	}
+	args = append(args, clampLimit(q.Limit))
+
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT s.trace_id, MIN(s.start_time_unix_nano) AS start, MAX(s.end_time_unix_nano),
+			COUNT(*), SUM(s.status_code = 2), json_group_array(DISTINCT %[1]s),
+			(SELECT p.name FROM spans p WHERE p.trace_id = s.trace_id
+				ORDER BY COALESCE(p.parent_span_id, '') <> '', p.start_time_unix_nano LIMIT 1),
+			(SELECT %[1]s FROM spans p LEFT JOIN resources r ON r.id = p.resource_id WHERE p.trace_id = s.trace_id
+				ORDER BY COALESCE(p.parent_span_id, '') <> '', p.start_time_unix_nano LIMIT 1)
+		FROM spans s
+		LEFT JOIN resources r ON r.id = s.resource_id
+		WHERE s.trace_id IN (SELECT s.trace_id FROM spans s LEFT JOIN resources r ON r.id = s.resource_id %[2]s)
+		GROUP BY s.trace_id
+		HAVING %[3]s
+		ORDER BY start DESC
+		LIMIT ?`, serviceNameExpr, whereClause(conditions), strings.Join(having, " AND ")), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query traces: %w", err)
+	}
+	defer rows.Close()
+
+	traces := []TraceSummary{}
+	for rows.Next() {
+		var t TraceSummary
+		var start, end, errorCount sql.NullInt64
+		var services string
+		var rootName, rootService sql.NullString
+		if err := rows.Scan(&t.TraceID, &start, &end, &t.SpanCount, &errorCount, &services,
+			&rootName, &rootService); err != nil {
+			return nil, fmt.Errorf("failed to scan trace: %w", err)
+		}
+		t.StartTimeUnixNano = start.Int64
+		t.EndTimeUnixNano = end.Int64
+		t.ErrorCount = errorCount.Int64
+		t.RootName = rootName.String
+		t.RootServiceName = rootService.String
+		t.Services = []string{}
+		var names []string
+		json.Unmarshal([]byte(services), &names)
+		for _, name := range names {
+			if name != "" {
+				t.Services = append(t.Services, name)
+			}
+		}
+		traces = append(traces, t)
+	}
+	return traces, rows.Err()
+}
+
+// QueryServices returns the service names of the stored resources
+func QueryServices(conn *sql.DB) ([]string, error) {
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT DISTINCT %s AS service FROM resources r
+		WHERE service <> ''
+		ORDER BY service`, serviceNameExpr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query services: %w", err)
+	}
+	defer rows.Close()
+
+	services := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan service: %w", err)
+		}
+		services = append(services, name)
+	}
+	return services, rows.Err()
+}
+
+// MetricInfo describes a stored metric
+type MetricInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	MetricType  string `json:"metricType"`
+}
+
+// QueryMetricNames returns the stored metrics by name and type, optionally
+// only those of one service
+func QueryMetricNames(conn *sql.DB, service string) ([]MetricInfo, error) {
+	var conditions []string
+	var args []interface{}
+	if service != "" {
+		conditions = append(conditions, serviceNameExpr+" = ?")
+		args = append(args, service)
+	}
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT m.name, m.metric_type, COALESCE(MAX(m.unit), ''), COALESCE(MAX(m.description), '')
+		FROM metrics m
+		LEFT JOIN resources r ON r.id = m.resource_id
+		%s
+		GROUP BY m.name, m.metric_type
+		ORDER BY m.name`, whereClause(conditions)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metric names: %w", err)
+	}
+	defer rows.Close()
+
+	metrics := []MetricInfo{}
+	for rows.Next() {
+		var m MetricInfo
+		if err := rows.Scan(&m.Name, &m.MetricType, &m.Unit, &m.Description); err != nil {
+			return nil, fmt.Errorf("failed to scan metric: %w", err)
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestQueryTracesSummarizes(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	resource := func(service string) map[string]interface{} {
+		return map[string]interface{}{"attributes": []interface{}{map[string]interface{}{
+			"key": "service.name", "value": map[string]interface{}{"stringValue": service},
+		}}}
+	}
+	span := func(trace, id, parent, name, start, end string, status float64) map[string]interface{} {
+		return map[string]interface{}{"traceId": trace, "spanId": id, "parentSpanId": parent, "name": name,
+			"startTimeUnixNano": start, "endTimeUnixNano": end, "status": map[string]interface{}{"code": status}}
+	}
+	const slow, fast = "0102030405060708090a0b0c0d0e0f10", "1112131415161718191a1b1c1d1e1f20"
+	err := InsertTraceData(map[string]interface{}{"resourceSpans": []interface{}{
+		map[string]interface{}{"resource": resource("frontend"), "scopeSpans": []interface{}{map[string]interface{}{"spans": []interface{}{
+			span(slow, "0000000000000001", "", "GET /checkout", "1700000000000000000", "1700000001000000000", 0),
+			span(fast, "0000000000000003", "", "GET /health", "1700000005000000000", "1700000005001000000", 0),
+		}}}},
+		map[string]interface{}{"resource": resource("payments"), "scopeSpans": []interface{}{map[string]interface{}{"spans": []interface{}{
+			span(slow, "0000000000000002", "0000000000000001", "charge", "1700000000100000000", "1700000000900000000", 2),
+		}}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traces, err := QueryTraces(DB(), TraceQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 2 || traces[0].TraceID != fast {
+		t.Fatalf("Expected both traces, newest first, got %+v", traces)
+	}
+	got := traces[1]
+	if got.RootName != "GET /checkout" || got.RootServiceName != "frontend" || got.SpanCount != 2 ||
+		got.ErrorCount != 1 || len(got.Services) != 2 || got.EndTimeUnixNano-got.StartTimeUnixNano != 1e9 {
+		t.Errorf("Unexpected summary %+v", got)
+	}
+
+	// A span of another service selects the whole trace
+	traces, err = QueryTraces(DB(), TraceQuery{Service: "payments", ErrorsOnly: true, MinDuration: 5e8})
+	if err != nil || len(traces) != 1 || traces[0].TraceID != slow || traces[0].SpanCount != 2 {
+		t.Errorf("Expected the failed checkout trace, got %+v, %v", traces, err)
+	}
+
+	services, err := QueryServices(DB())
+	if err != nil || len(services) != 2 || services[0] != "frontend" {
+		t.Errorf("Expected frontend and payments, got %v, %v", services, err)
+	}
+}
@@ -0,0 +1,282 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DatabaseSize returns the size in bytes of the database file behind conn
+func DatabaseSize(conn *sql.DB) (int64, error) {
+	var pageCount, pageSize int64
+	if err := conn.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, fmt.Errorf("failed to read page count: %w", err)
+	}
+	if err := conn.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("failed to read page size: %w", err)
+	}
+	return pageCount * pageSize, nil
+}
+
+// PurgeBefore deletes spans, log records and metric data points with a
+// timestamp older than cutoff and returns the number of rows removed
+func PurgeBefore(conn *sql.DB, cutoff time.Time) (int64, error) {
+	return purge(conn, cutoff.UnixNano(), nil)
+}
+
+// purgeStatements delete each signal's records older than a cutoff
+var purgeStatements = map[string]string{
+	SignalTraces:  `DELETE FROM spans WHERE COALESCE(NULLIF(end_time_unix_nano, 0), start_time_unix_nano) < ?`,
+	SignalLogs:    `DELETE FROM log_records WHERE COALESCE(NULLIF(time_unix_nano, 0), observed_time_unix_nano) < ?`,
+	SignalMetrics: `DELETE FROM metric_data_points WHERE time_unix_nano < ?`,
+}
+
+// purge deletes records older than cutoffNano. A non-nil upTo also limits
+// each signal to row IDs at most upTo[signal].
+func purge(conn *sql.DB, cutoffNano int64, upTo map[string]int64) (int64, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var total int64
+	for _, signal := range Signals {
+		stmt, args := purgeStatements[signal], []interface{}{cutoffNano}
+		if upTo != nil {
+			stmt += " AND id <= ?"
+			args = append(args, upTo[signal])
+		}
+		result, err := tx.Exec(stmt, args...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to purge old data: %w", err)
+		}
+		if n, err := result.RowsAffected(); err == nil {
+			total += n
+		}
+	}
+
+	// Remove metric definitions that no longer have any data points
+	if _, err := tx.Exec(`
+		DELETE FROM metrics WHERE NOT EXISTS (
+			SELECT 1 FROM metric_data_points WHERE metric_data_points.metric_id = metrics.id
+		)`); err != nil {
+		return 0, fmt.Errorf("failed to purge unused metrics: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// FreelistSize returns the bytes of unused pages inside the database file.
+// Deleted rows leave free pages behind that later inserts reuse before the
+// file grows.
+func FreelistSize(conn *sql.DB) (int64, error) {
+	var freePages, pageSize int64
+	if err := conn.QueryRow("PRAGMA freelist_count").Scan(&freePages); err != nil {
+		return 0, fmt.Errorf("failed to read freelist count: %w", err)
+	}
+	if err := conn.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("failed to read page size: %w", err)
+	}
+	return freePages * pageSize, nil
+}
+
+// PurgeOldest deletes the oldest fraction of the records stored in the
+// database, using the same timestamps as PurgeBefore. Each call removes at
+// least the oldest record, so repeated calls always make progress.
+func PurgeOldest(conn *sql.DB, fraction float64) (int64, error) {
+	cutoff, ok, err := oldestCutoff(conn, fraction)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return PurgeBefore(conn, cutoff)
+}
+
+// recordTimes selects the timestamp PurgeBefore compares for every record
+const recordTimes = `
+	SELECT COALESCE(NULLIF(end_time_unix_nano, 0), start_time_unix_nano) AS t FROM spans
+	UNION ALL SELECT COALESCE(NULLIF(time_unix_nano, 0), observed_time_unix_nano) FROM log_records
+	UNION ALL SELECT time_unix_nano FROM metric_data_points`
+
+// oldestCutoff returns the time before which PurgeOldest deletes records,
+// or false when the database holds none. The cutoff follows the timestamp
+// of the record at the given fraction of the row count rather than of the
+// time range, so a single record stamped far in the future cannot make one
+// pass delete everything else.
+func oldestCutoff(conn *sql.DB, fraction float64) (time.Time, bool, error) {
+	var count int64
+	if err := conn.QueryRow("SELECT COUNT(*) FROM (" + recordTimes + ")").Scan(&count); err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to count stored records: %w", err)
+	}
+	if count == 0 {
+		return time.Time{}, false, nil
+	}
+	offset := int64(float64(count)*fraction) - 1
+	if offset < 0 {
+		offset = 0
+	}
+	var last int64
+	if err := conn.QueryRow("SELECT t FROM ("+recordTimes+") ORDER BY t LIMIT 1 OFFSET ?", offset).Scan(&last); err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to read oldest records: %w", err)
+	}
+	return time.Unix(0, last+1), true, nil
+}
+
+// FreelistSize returns the unused bytes inside every tenant database
+func (m *TenantManager) FreelistSize() (int64, error) {
+	tenants, err := m.Tenants()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, tenant := range tenants {
+		conn, release, err := m.Acquire(tenant)
+		if err != nil {
+			return 0, err
+		}
+		size, err := FreelistSize(conn)
+		release()
+		if err != nil {
+			return 0, fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// PurgeOldest runs PurgeOldest against every tenant database, archiving
+// the records first when an archiver is set, and returns the total number
+// of rows removed. Errors for one tenant do not stop the others.
+func (m *TenantManager) PurgeOldest(fraction float64) int64 {
+	tenants, err := m.Tenants()
+	if err != nil {
+		log.Printf("emergency retention: %v", err)
+		return 0
+	}
+
+	var total int64
+	for _, tenant := range tenants {
+		conn, release, err := m.Acquire(tenant)
+		if err != nil {
+			log.Printf("emergency retention: %v", err)
+			continue
+		}
+		removed, err := m.purgeOldest(tenant, conn, fraction)
+		release()
+		if err != nil {
+			log.Printf("emergency retention: tenant %s: %v", tenant, err)
+			continue
+		}
+		if removed > 0 {
+			log.Printf("emergency retention: removed %d oldest records for tenant %s", removed, tenant)
+		}
+		total += removed
+	}
+	return total
+}
+
+// Archiver copies a tenant's records older than cutoff, up to the given
+// row ID per signal, before retention deletes them
+type Archiver func(tenant string, conn *sql.DB, cutoff time.Time, upTo map[string]int64) error
+
+// SetArchiver makes ApplyRetention archive expired records before deleting
+// them. A nil archiver deletes without archiving.
+func (m *TenantManager) SetArchiver(a Archiver) {
+	m.policyMu.Lock()
+	defer m.policyMu.Unlock()
+	m.archiver = a
+}
+
+// ApplyRetention purges expired data for every tenant that has a retention
+// policy, archiving it first when an archiver is set. Errors for one
+// tenant do not stop the others.
+func (m *TenantManager) ApplyRetention(now time.Time) {
+	tenants, err := m.Tenants()
+	if err != nil {
+		log.Printf("retention: %v", err)
+		return
+	}
+
+	for _, tenant := range tenants {
+		retention := m.Policy(tenant).Retention
+		if retention <= 0 {
+			continue
+		}
+
+		conn, release, err := m.Acquire(tenant)
+		if err != nil {
+			log.Printf("retention: %v", err)
+			continue
+		}
+		removed, err := m.expire(tenant, conn, now.Add(-retention))
+		release()
+		if err != nil {
+			log.Printf("retention: tenant %s: %v", tenant, err)
+			continue
+		}
+		if removed > 0 {
+			log.Printf("retention: removed %d expired records for tenant %s", removed, tenant)
+		}
+	}
+}
+
+// expire purges a tenant's records older than cutoff, archiving them first
+// when an archiver is set. Nothing is deleted if archiving fails.
+func (m *TenantManager) expire(tenant string, conn *sql.DB, cutoff time.Time) (int64, error) {
+	upTo, err := m.archive(tenant, conn, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("archive failed, expired data kept: %w", err)
+	}
+	if upTo == nil {
+		return PurgeBefore(conn, cutoff)
+	}
+	return PurgeArchived(conn, cutoff, upTo)
+}
+
+// purgeOldest runs PurgeOldest for one tenant, archiving the records first
+// when an archiver is set. Freeing disk space comes first, so the records
+// are deleted even if archiving fails.
+func (m *TenantManager) purgeOldest(tenant string, conn *sql.DB, fraction float64) (int64, error) {
+	cutoff, ok, err := oldestCutoff(conn, fraction)
+	if err != nil || !ok {
+		return 0, err
+	}
+	upTo, err := m.archive(tenant, conn, cutoff)
+	if err != nil {
+		log.Printf("emergency retention: tenant %s: archive failed, deleting records before %s without archiving them: %v",
+			tenant, cutoff.UTC().Format(time.RFC3339), err)
+	}
+	if upTo == nil {
+		return PurgeBefore(conn, cutoff)
+	}
+	return PurgeArchived(conn, cutoff, upTo)
+}
+
+// archive passes a tenant's records older than cutoff to the archiver and
+// returns the last row ID per signal it covered, or nil when no archiver
+// is set or archiving failed
+func (m *TenantManager) archive(tenant string, conn *sql.DB, cutoff time.Time) (map[string]int64, error) {
+	m.policyMu.RLock()
+	archiver := m.archiver
+	m.policyMu.RUnlock()
+	if archiver == nil {
+		return nil, nil
+	}
+
+	upTo := make(map[string]int64, len(Signals))
+	for _, signal := range Signals {
+		id, err := LastRowID(conn, signal)
+		if err != nil {
+			return nil, err
+		}
+		upTo[signal] = id
+	}
+	if err := archiver(tenant, conn, cutoff, upTo); err != nil {
+		return nil, err
+	}
+	return upTo, nil
+}
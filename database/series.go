@@ -0,0 +1,294 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ServiceLabel is the label holding the service.name resource attribute of
+// a metric series
+const ServiceLabel = "service.name"
+
+// MaxSeriesPoints bounds the data points read by one QueryMetricSeries call
+const MaxSeriesPoints = 200000
+
+// labelSampleSize is the number of recent data points QueryMetricLabels reads
+const labelSampleSize = 10000
+
+// ErrTooManyPoints is returned when a series query would read more than
+// MaxSeriesPoints data points
+var ErrTooManyPoints = fmt.Errorf("more than %d data points match, narrow the time range or filters", MaxSeriesPoints)
+
+// aggregations are the ways QueryMetricSeries can combine the points of a bucket
+var aggregations = map[string]bool{"avg": true, "min": true, "max": true, "sum": true, "count": true, "last": true}
+
+// ValidAggregation reports whether name is an aggregation QueryMetricSeries supports
+func ValidAggregation(name string) bool {
+	return aggregations[name]
+}
+
+// SeriesQuery selects the data points aggregated by QueryMetricSeries
+type SeriesQuery struct {
+	Name        string
+	Labels      map[string]string // Only series with these label values
+	Since       int64             // Timestamp lower bound in Unix nanoseconds (0 for none)
+	Until       int64             // Timestamp upper bound in Unix nanoseconds (0 for none)
+	Step        int64             // Bucket width in nanoseconds (0 keeps every timestamp)
+	Aggregation string            // avg (default), min, max, sum, count or last
+}
+
+// SeriesPoint is one bucket of a series
+type SeriesPoint struct {
+	TimeUnixNano int64
+	Value        float64
+}
+
+// Series is the data points of a metric sharing one set of labels
+type Series struct {
+	Name   string
+	Labels map[string]string
+	Points []SeriesPoint
+}
+
+// seriesBucket accumulates the points of one bucket
+type seriesBucket struct {
+	start               int64
+	sum, min, max, last float64
+	count               int
+}
+
+func (b *seriesBucket) add(v float64) {
+	if b.count == 0 || v < b.min {
+		b.min = v
+	}
+	if b.count == 0 || v > b.max {
+		b.max = v
+	}
+	b.sum += v
+	b.last = v
+	b.count++
+}
+
+func (b *seriesBucket) value(aggregation string) float64 {
+	switch aggregation {
+	case "min":
+		return b.min
+	case "max":
+		return b.max
+	case "sum":
+		return b.sum
+	case "count":
+		return float64(b.count)
+	case "last":
+		return b.last
+	}
+	return b.sum / float64(b.count)
+}
+
+// QueryMetricSeries returns the gauge and sum data points of a metric as
+// one series per label set, oldest first, with the points of each Step
+// wide bucket aggregated. Histograms and summaries have no single value
+// and are left out.
+func QueryMetricSeries(conn *sql.DB, q SeriesQuery) ([]Series, error) {
+	if q.Aggregation == "" {
+		q.Aggregation = "avg"
+	}
+	if !ValidAggregation(q.Aggregation) {
+		return nil, fmt.Errorf("unknown aggregation '%s'", q.Aggregation)
+	}
+	conditions := []string{"m.name = ?", "dp.time_unix_nano IS NOT NULL", "COALESCE(dp.value_double, dp.value_int) IS NOT NULL"}
+	args := []interface{}{q.Name}
+	if service, ok := q.Labels[ServiceLabel]; ok {
+		conditions = append(conditions, serviceNameExpr+" = ?")
+		args = append(args, service)
+	}
+	if q.Since > 0 {
+		conditions = append(conditions, "dp.time_unix_nano >= ?")
+		args = append(args, q.Since)
+	}
+	if q.Until > 0 {
+		conditions = append(conditions, "dp.time_unix_nano <= ?")
+		args = append(args, q.Until)
+	}
+	args = append(args, MaxSeriesPoints+1)
+
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT %s, dp.attributes, dp.time_unix_nano, COALESCE(dp.value_double, dp.value_int)
+		FROM metric_data_points dp
+		JOIN metrics m ON m.id = dp.metric_id
+		LEFT JOIN resources r ON r.id = m.resource_id
+		%s
+		ORDER BY dp.time_unix_nano, dp.id
+		LIMIT ?`, serviceNameExpr, whereClause(conditions)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metric series: %w", err)
+	}
+	defer rows.Close()
+
+	type builder struct {
+		series Series
+		bucket seriesBucket
+	}
+	builders := make(map[string]*builder)
+	decoded := make(map[string]map[string]string)
+	flush := func(b *builder) {
+		if b.bucket.count > 0 {
+			b.series.Points = append(b.series.Points, SeriesPoint{b.bucket.start, b.bucket.value(q.Aggregation)})
+		}
+	}
+
+	read := 0
+	for rows.Next() {
+		if read++; read > MaxSeriesPoints {
+			return nil, ErrTooManyPoints
+		}
+		var service string
+		var attributes sql.NullString
+		var timeUnix int64
+		var value float64
+		if err := rows.Scan(&service, &attributes, &timeUnix, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan metric data point: %w", err)
+		}
+		cacheKey := service + "\x00" + attributes.String
+		labels, ok := decoded[cacheKey]
+		if !ok {
+			labels = attributeLabels(attributes.String)
+			if service != "" {
+				labels[ServiceLabel] = service
+			}
+			decoded[cacheKey] = labels
+		}
+		if !matchLabels(labels, q.Labels) {
+			continue
+		}
+
+		key := labelKey(labels)
+		b, ok := builders[key]
+		if !ok {
+			b = &builder{series: Series{Name: q.Name, Labels: labels, Points: []SeriesPoint{}}}
+			builders[key] = b
+		}
+		start := timeUnix
+		if q.Step > 0 {
+			start -= timeUnix % q.Step
+		}
+		if b.bucket.count > 0 && b.bucket.start != start {
+			flush(b)
+			b.bucket = seriesBucket{}
+		}
+		b.bucket.start = start
+		b.bucket.add(value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metric series: %w", err)
+	}
+
+	keys := make([]string, 0, len(builders))
+	for key := range builders {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]Series, 0, len(keys))
+	for _, key := range keys {
+		flush(builders[key])
+		series = append(series, builders[key].series)
+	}
+	return series, nil
+}
+
+// QueryMetricLabels returns the label keys of recently stored data points
+// with their sorted values. service.name is included.
+func QueryMetricLabels(conn *sql.DB) (map[string][]string, error) {
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT DISTINCT %s, dp.attributes
+		FROM (SELECT metric_id, attributes FROM metric_data_points ORDER BY id DESC LIMIT ?) dp
+		JOIN metrics m ON m.id = dp.metric_id
+		LEFT JOIN resources r ON r.id = m.resource_id`, serviceNameExpr), labelSampleSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metric labels: %w", err)
+	}
+	defer rows.Close()
+
+	seen := make(map[string]map[string]bool)
+	add := func(key, value string) {
+		if seen[key] == nil {
+			seen[key] = make(map[string]bool)
+		}
+		seen[key][value] = true
+	}
+	for rows.Next() {
+		var service string
+		var attributes sql.NullString
+		if err := rows.Scan(&service, &attributes); err != nil {
+			return nil, fmt.Errorf("failed to scan metric labels: %w", err)
+		}
+		if service != "" {
+			add(ServiceLabel, service)
+		}
+		for key, value := range attributeLabels(attributes.String) {
+			add(key, value)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metric labels: %w", err)
+	}
+
+	labels := make(map[string][]string, len(seen))
+	for key, values := range seen {
+		list := make([]string, 0, len(values))
+		for value := range values {
+			list = append(list, value)
+		}
+		sort.Strings(list)
+		labels[key] = list
+	}
+	return labels, nil
+}
+
+// attributeLabels converts stored OTLP attributes to labels, formatting
+// values other than strings as JSON
+func attributeLabels(raw string) map[string]string {
+	labels := make(map[string]string)
+	var attributes []struct {
+		Key   string                     `json:"key"`
+		Value map[string]json.RawMessage `json:"value"`
+	}
+	if raw == "" || json.Unmarshal([]byte(raw), &attributes) != nil {
+		return labels
+	}
+	for _, a := range attributes {
+		for _, value := range a.Value {
+			// Strings, and intValue which OTLP JSON encodes as a string,
+			// are used unquoted
+			var s string
+			if json.Unmarshal(value, &s) != nil {
+				s = string(value)
+			}
+			labels[a.Key] = s
+		}
+	}
+	return labels
+}
+
+// matchLabels reports whether labels holds every wanted value
+func matchLabels(labels, want map[string]string) bool {
+	for key, value := range want {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// labelKey identifies a label set
+func labelKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"\x00"+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\x01")
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestQueryMetricSeriesBuckets(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	point := func(route string, seconds string, value float64) map[string]interface{} {
+		return map[string]interface{}{"timeUnixNano": "17000000" + seconds + "000000000", "asDouble": value,
+			"attributes": []interface{}{map[string]interface{}{"key": "route", "value": map[string]interface{}{"stringValue": route}}}}
+	}
+	err := InsertMetricsData(map[string]interface{}{"resourceMetrics": []interface{}{map[string]interface{}{
+		"resource": map[string]interface{}{"attributes": []interface{}{map[string]interface{}{
+			"key": "service.name", "value": map[string]interface{}{"stringValue": "api"}}}},
+		"scopeMetrics": []interface{}{map[string]interface{}{"metrics": []interface{}{map[string]interface{}{
+			"name": "latency",
+			"gauge": map[string]interface{}{"dataPoints": []interface{}{
+				point("/a", "00", 1), point("/a", "05", 3), point("/a", "12", 10), point("/b", "01", 7),
+			}},
+		}}}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series, err := QueryMetricSeries(DB(), SeriesQuery{Name: "latency", Step: 10e9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 2 || series[0].Labels["route"] != "/a" || series[0].Labels[ServiceLabel] != "api" {
+		t.Fatalf("Expected a series per route, got %+v", series)
+	}
+	points := series[0].Points
+	if len(points) != 2 || points[0].Value != 2 || points[0].TimeUnixNano != 1700000000e9 || points[1].Value != 10 {
+		t.Errorf("Expected averaged 10s buckets, got %+v", points)
+	}
+
+	series, err = QueryMetricSeries(DB(), SeriesQuery{Name: "latency", Labels: map[string]string{"route": "/a"}, Step: 60e9, Aggregation: "max"})
+	if err != nil || len(series) != 1 || len(series[0].Points) != 1 || series[0].Points[0].Value != 10 {
+		t.Errorf("Expected one filtered bucket holding the maximum, got %+v, %v", series, err)
+	}
+
+	labels, err := QueryMetricLabels(DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels["route"]) != 2 || labels[ServiceLabel][0] != "api" {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// severityNumbers maps severity names to the lowest OTLP severity number
+// of their range
+var severityNumbers = map[string]int64{
+	"trace": 1,
+	"debug": 5,
+	"info":  9,
+	"warn":  13,
+	"error": 17,
+	"fatal": 21,
+}
+
+// ParseSeverity parses a severity name such as warn, or a severity number
+func ParseSeverity(s string) (int64, error) {
+	if n, ok := severityNumbers[strings.ToLower(s)]; ok {
+		return n, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n >= 0 {
+		return n, nil
+	}
+	return 0, fmt.Errorf("unknown severity '%s' (expected trace, debug, info, warn, error, fatal or a number)", s)
+}
+
+// SeverityName names the range of an OTLP severity number, or returns ""
+// when it is unset
+func SeverityName(n int64) string {
+	if n <= 0 {
+		return ""
+	}
+	for _, name := range []string{"fatal", "error", "warn", "info", "debug", "trace"} {
+		if n >= severityNumbers[name] {
+			return strings.ToUpper(name)
+		}
+	}
+	return ""
+}
@@ -160,4 +160,16 @@ func GetOrCreateMetric(tx *sql.Tx, name, description, unit, metricType string, r
 	}
 	
 	return id, nil
-}
\ No newline at end of file
+}
+
+// CountDataPoints returns the number of data points in an OTLP metric
+func CountDataPoints(metric map[string]interface{}) int64 {
+	var count int64
+	for _, kind := range []string{"gauge", "sum", "histogram", "exponentialHistogram", "summary"} {
+		if body, ok := metric[kind].(map[string]interface{}); ok {
+			points, _ := body["dataPoints"].([]interface{})
+			count += int64(len(points))
+		}
+	}
+	return count
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// guardedDriver is the driver used by OpenGuarded. Without cgo the stub
+// driver is used, which fails to open like every other connection.
+var guardedDriver = "sqlite3"
+
+// Authorizer action codes, see https://www.sqlite.org/c3ref/c_alter_table.html
+const (
+	actionRead      = 20
+	actionSelect    = 21
+	actionFunction  = 31
+	actionRecursive = 33
+)
+
+// sqlFunctions are the functions a guarded connection may call. Functions
+// that load code, allocate arbitrary memory or expose the connection, such
+// as load_extension, zeroblob and randomblob, are left out.
+var sqlFunctions = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`
+		abs char coalesce concat concat_ws format glob hex ifnull iif instr
+		length like likelihood likely lower ltrim max min nullif octet_length
+		printf quote random replace round rtrim sign soundex substr substring
+		trim typeof unhex unicode unlikely upper
+		avg count group_concat string_agg sum total
+		date time datetime julianday unixepoch strftime timediff
+		json json_array json_array_length json_each json_error_position
+		json_extract json_group_array json_group_object json_insert
+		json_object json_patch json_quote json_remove json_replace json_set
+		json_tree json_type json_valid -> ->>
+		row_number rank dense_rank percent_rank cume_dist ntile lag lead
+		first_value last_value nth_value
+		acos acosh asin asinh atan atan2 atanh ceil ceiling cos cosh degrees
+		exp floor ln log log10 log2 mod pi pow power radians sin sinh sqrt
+		tan tanh trunc`) {
+		sqlFunctions[name] = true
+	}
+}
+
+// authorizeAction decides whether a guarded connection may perform an
+// action. Only reads of the main database and allowlisted functions are
+// permitted, which rules out writes, PRAGMA and ATTACH.
+func authorizeAction(action int, arg1, arg2, dbName string) bool {
+	switch action {
+	case actionSelect, actionRecursive:
+		return true
+	case actionRead:
+		// Table reads without columns, as in count(*), have no database name
+		return dbName == "main" || dbName == ""
+	case actionFunction:
+		return sqlFunctions[strings.ToLower(arg2)]
+	}
+	return false
+}
+
+// ErrNotSelect is returned for SQL that is not a single SELECT statement
+var ErrNotSelect = errors.New("expected a single SELECT statement")
+
+// CheckSelect validates that query is a single SELECT statement and returns
+// it without a trailing semicolon. The authorizer still has the final say;
+// this only rejects statement lists and other commands early with a clear
+// message.
+func CheckSelect(query string) (string, error) {
+	end := -1
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			j := strings.IndexByte(query[i+1:], closing)
+			if j < 0 {
+				return "", fmt.Errorf("%w: unterminated quote", ErrNotSelect)
+			}
+			i += j + 1
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = len(query) - i
+			}
+			i += j
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				j = len(query) - i - 2
+			}
+			i += j + 3
+		case c == ';':
+			if end < 0 {
+				end = i
+			}
+		case end >= 0 && !isSpace(c):
+			return "", fmt.Errorf("%w: found more than one statement", ErrNotSelect)
+		}
+	}
+	if end >= 0 {
+		query = query[:end]
+	}
+	query = strings.TrimSpace(query)
+
+	keyword := strings.ToUpper(strings.TrimLeft(query, "( \t\r\n"))
+	if !strings.HasPrefix(keyword, "SELECT") && !strings.HasPrefix(keyword, "WITH") && !strings.HasPrefix(keyword, "VALUES") {
+		return "", ErrNotSelect
+	}
+	return query, nil
+}
+
+// isSpace reports whether c is whitespace in SQL
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// OpenGuarded opens a database file for untrusted queries. The connection
+// is read-only, runs with the query_only pragma and an authorizer that
+// denies anything other than reading the main database with allowlisted
+// functions.
+func OpenGuarded(dbPath string) (*sql.DB, error) {
+	return openReadOnly(guardedDriver, dbPath, "&_query_only=1")
+}
+
+// Path returns the database file of a tenant other than the default one
+func (m *TenantManager) Path(tenant string) string {
+	return m.tenantPath(tenant)
+}
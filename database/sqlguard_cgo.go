@@ -0,0 +1,30 @@
+//go:build cgo
+
+package database
+
+import (
+	"database/sql"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// guardedMaxLength caps the size of any string or blob a guarded query
+// builds, so a query cannot allocate unbounded memory
+const guardedMaxLength = 16 << 20
+
+func init() {
+	guardedDriver = "sqlite3_guarded"
+	sql.Register(guardedDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			conn.RegisterAuthorizer(func(action int, arg1, arg2, dbName string) int {
+				if authorizeAction(action, arg1, arg2, dbName) {
+					return sqlite3.SQLITE_OK
+				}
+				return sqlite3.SQLITE_DENY
+			})
+			conn.SetLimit(sqlite3.SQLITE_LIMIT_ATTACHED, 0)
+			conn.SetLimit(sqlite3.SQLITE_LIMIT_LENGTH, guardedMaxLength)
+			return nil
+		},
+	})
+}
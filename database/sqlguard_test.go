@@ -0,0 +1,58 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckSelect(t *testing.T) {
+	valid := map[string]string{
+		"SELECT 1;": "SELECT 1",
+		"  with t as (select 1) select * from t ": "with t as (select 1) select * from t",
+		"SELECT ';' -- trailing; comment\n;":      "SELECT ';' -- trailing; comment",
+		"SELECT \"a;b\" FROM spans /* ; */":       "SELECT \"a;b\" FROM spans /* ; */",
+	}
+	for query, want := range valid {
+		got, err := CheckSelect(query)
+		if err != nil || got != want {
+			t.Errorf("CheckSelect(%q) = %q, %v; want %q", query, got, err, want)
+		}
+	}
+	for _, query := range []string{"", "DELETE FROM spans", "SELECT 1; DROP TABLE spans", "SELECT 'open", "PRAGMA table_info(spans)"} {
+		if _, err := CheckSelect(query); !errors.Is(err, ErrNotSelect) {
+			t.Errorf("CheckSelect(%q) = %v, want ErrNotSelect", query, err)
+		}
+	}
+}
+
+func TestOpenGuardedDeniesWrites(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "main.db")
+	if err := InitDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	conn, err := OpenGuarded(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var count int
+	if err := conn.QueryRow("SELECT count(*) FROM spans").Scan(&count); err != nil {
+		t.Fatalf("Expected a SELECT to run, got %v", err)
+	}
+	for _, query := range []string{
+		"DELETE FROM spans",
+		"WITH t AS (SELECT 1) INSERT INTO spans (trace_id) SELECT * FROM t",
+		"PRAGMA journal_mode",
+		"ATTACH DATABASE ':memory:' AS other",
+		"SELECT load_extension('x')",
+		"SELECT zeroblob(1000000000)",
+	} {
+		if _, err := conn.Exec(query); err == nil {
+			t.Errorf("Expected %q to be denied", query)
+		}
+	}
+}
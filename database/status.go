@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/stats"
+)
+
+// schemaReady is set once the main database schema has been created
+var schemaReady atomic.Bool
+
+// SchemaReady reports whether the main database is open with its schema
+// in place
+func SchemaReady() bool {
+	return schemaReady.Load()
+}
+
+// WriteError describes the most recent failed insert
+type WriteError struct {
+	Time    time.Time `json:"time"`
+	Signal  string    `json:"signal"`
+	Message string    `json:"message"`
+}
+
+var (
+	lastWriteErrorMu sync.Mutex
+	lastWriteError   *WriteError
+	writeFailing     bool // the last insert that reached SQLite failed
+)
+
+// LastWriteError returns the most recent failed insert, if any
+func LastWriteError() *WriteError {
+	lastWriteErrorMu.Lock()
+	defer lastWriteErrorMu.Unlock()
+	if lastWriteError == nil {
+		return nil
+	}
+	e := *lastWriteError
+	return &e
+}
+
+// insertObserver receives the outcome of one insert transaction
+type insertObserver func(signal string, start time.Time, records int64, err error)
+
+// InsertUnobserved inserts an OTLP payload of a signal without counting it
+// in the ingest statistics or the last write error. The collector stores
+// its own telemetry this way.
+func InsertUnobserved(conn *sql.DB, signal string, data map[string]interface{}) error {
+	ignore := func(string, time.Time, int64, error) {}
+	switch signal {
+	case SignalTraces:
+		return insertTraceData(conn, data, ignore)
+	case SignalMetrics:
+		return insertMetricsData(conn, data, ignore)
+	case SignalLogs:
+		return insertLogsData(conn, data, ignore)
+	}
+	return fmt.Errorf("unknown signal '%s'", signal)
+}
+
+// observeInsert records the outcome of one insert transaction
+func observeInsert(signal string, start time.Time, records int64, err error) {
+	stats.ObserveInsert(signal, start, records, err)
+	lastWriteErrorMu.Lock()
+	defer lastWriteErrorMu.Unlock()
+	if err != nil {
+		lastWriteError = &WriteError{Time: time.Now(), Signal: signal, Message: err.Error()}
+	}
+	// Payload errors say nothing about the database, and a busy database
+	// recovers on its own
+	_, _, fromSQLite := sqliteError(err)
+	switch {
+	case err == nil:
+		writeFailing = false
+	case fromSQLite && !IsBusy(err):
+		writeFailing = true
+	}
+}
+
+// CheckLastWrite returns an error while the most recent insert that
+// reached SQLite failed. Unlike a probe write it never takes the write
+// lock, so it can run on every readiness check.
+func CheckLastWrite() error {
+	lastWriteErrorMu.Lock()
+	defer lastWriteErrorMu.Unlock()
+	if !writeFailing {
+		return nil
+	}
+	return fmt.Errorf("last %s write failed at %s: %s", lastWriteError.Signal,
+		lastWriteError.Time.UTC().Format(time.RFC3339), lastWriteError.Message)
+}
+
+// statusTables are the tables whose row counts are reported by Summarize
+var statusTables = []string{"resources", "instrumentation_scopes", "spans", "metrics", "metric_data_points", "log_records"}
+
+// signalTimes maps each signal to the table and column holding its timestamps
+var signalTimes = map[string][2]string{
+	"traces":  {"spans", "start_time_unix_nano"},
+	"metrics": {"metric_data_points", "time_unix_nano"},
+	"logs":    {"log_records", "time_unix_nano"},
+}
+
+// TimeRange is the oldest and newest timestamp stored for a signal
+type TimeRange struct {
+	Oldest *time.Time `json:"oldest"`
+	Newest *time.Time `json:"newest"`
+}
+
+// Summary describes the contents of a database
+type Summary struct {
+	Rows    map[string]int64     `json:"rows"`
+	Signals map[string]TimeRange `json:"signals"`
+}
+
+// Summarize counts rows per table and finds the time range of each signal
+func Summarize(ctx context.Context, conn *sql.DB) (*Summary, error) {
+	summary := &Summary{
+		Rows:    make(map[string]int64, len(statusTables)),
+		Signals: make(map[string]TimeRange, len(signalTimes)),
+	}
+	for _, table := range statusTables {
+		var count int64
+		if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", table, err)
+		}
+		summary.Rows[table] = count
+	}
+	for signal, tc := range signalTimes {
+		var oldest, newest sql.NullInt64
+		query := fmt.Sprintf("SELECT MIN(%[2]s), MAX(%[2]s) FROM %[1]s WHERE %[2]s > 0", tc[0], tc[1])
+		if err := conn.QueryRowContext(ctx, query).Scan(&oldest, &newest); err != nil {
+			return nil, fmt.Errorf("failed to read %s time range: %w", signal, err)
+		}
+		var r TimeRange
+		if oldest.Valid {
+			t := time.Unix(0, oldest.Int64).UTC()
+			r.Oldest = &t
+		}
+		if newest.Valid {
+			t := time.Unix(0, newest.Int64).UTC()
+			r.Newest = &t
+		}
+		summary.Signals[signal] = r
+	}
+	return summary, nil
+}
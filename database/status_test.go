@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.db")
+	conn, err := openDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	summary, err := Summarize(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Rows["spans"] != 0 || summary.Signals["traces"].Oldest != nil {
+		t.Errorf("Expected an empty database, got %+v", summary)
+	}
+
+	first := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, ts := range []time.Time{first, first.Add(time.Hour)} {
+		_, err := conn.Exec(`INSERT INTO log_records (time_unix_nano, body) VALUES (?, 'x')`, ts.UnixNano())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	summary, err = Summarize(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := summary.Signals["logs"]
+	if summary.Rows["log_records"] != 2 || logs.Oldest == nil || !logs.Oldest.Equal(first) || !logs.Newest.Equal(first.Add(time.Hour)) {
+		t.Errorf("Unexpected summary: rows %v, logs %+v", summary.Rows, logs)
+	}
+
+}
+
+func TestCheckLastWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.db")
+	conn, err := openDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	readOnly, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+
+	logs := map[string]interface{}{"resourceLogs": []interface{}{map[string]interface{}{
+		"resource":  map[string]interface{}{},
+		"scopeLogs": []interface{}{map[string]interface{}{"logRecords": []interface{}{map[string]interface{}{}}}},
+	}}}
+	if err := InsertLogsDataInto(readOnly, logs); err == nil {
+		t.Fatal("Expected an insert into a read-only database to fail")
+	}
+	if err := CheckLastWrite(); err == nil {
+		t.Error("Expected the failed insert to be reported")
+	}
+
+	// Payload errors do not change the state, a successful insert clears it
+	if err := InsertLogsDataInto(conn, map[string]interface{}{"resourceLogs": "bogus"}); err == nil {
+		t.Fatal("Expected an invalid payload to fail")
+	}
+	if err := CheckLastWrite(); err == nil {
+		t.Error("Expected an invalid payload to keep the failed state")
+	}
+	if err := InsertLogsDataInto(conn, logs); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckLastWrite(); err != nil {
+		t.Errorf("Expected a successful insert to clear the state: %v", err)
+	}
+}
+
+func TestCloseDBCheckpointsWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.db")
+	if err := InitDB(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB().Exec(`INSERT INTO log_records (time_unix_nano, body) VALUES (1, 'x')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := CloseDB(); err != nil {
+		t.Fatalf("CloseDB failed: %v", err)
+	}
+	if info, err := os.Stat(path + "-wal"); err == nil && info.Size() > 0 {
+		t.Errorf("Expected the WAL to be checkpointed, %d bytes remain", info.Size())
+	}
+	if SchemaReady() {
+		t.Error("Expected SchemaReady to be false after CloseDB")
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// Relative paths and URI characters in file names must work
+	for _, name := range []string{"plain.db", "odd #1%.db"} {
+		conn, err := openDB(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		closeConn(conn)
+
+		readOnly, err := OpenReadOnly(name)
+		if err != nil {
+			t.Fatalf("OpenReadOnly(%q): %v", name, err)
+		}
+		if _, err := readOnly.Exec("INSERT INTO resources (attributes) VALUES ('[]')"); err == nil {
+			t.Errorf("Expected writes through %q to fail", name)
+		}
+		readOnly.Close()
+	}
+	if _, err := OpenReadOnly("missing.db"); err == nil {
+		t.Error("Expected a missing database to be an error")
+	}
+}
@@ -0,0 +1,275 @@
+package database
+
+import (
+	"container/list"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTenant is the tenant whose data lives in the main database file
+const DefaultTenant = "default"
+
+// ErrQuotaExceeded is returned when a tenant database has reached its size quota
+var ErrQuotaExceeded = errors.New("tenant storage quota exceeded")
+
+// ErrTooManyTenants is returned when creating a tenant database would
+// exceed the tenant limit
+var ErrTooManyTenants = errors.New("tenant limit reached")
+
+// tenantNamePattern restricts tenant names to safe file names
+var tenantNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// ValidTenantName reports whether name can be used as a tenant identifier
+func ValidTenantName(name string) bool {
+	return tenantNamePattern.MatchString(name) && !strings.Contains(name, "..")
+}
+
+// TenantPolicy defines retention and quota limits for a tenant
+type TenantPolicy struct {
+	Retention    time.Duration // Delete data older than this (0 keeps data forever)
+	MaxSizeBytes int64         // Reject writes once the database reaches this size (0 is unlimited)
+}
+
+// tenantHandle is an open tenant database tracked by the LRU
+type tenantHandle struct {
+	name    string
+	db      *sql.DB
+	refs    int
+	element *list.Element
+}
+
+// TenantManager routes tenants to their own SQLite files under a directory.
+// Databases are opened lazily and at most maxOpen idle handles are kept.
+type TenantManager struct {
+	dir     string
+	maxOpen int
+
+	mu         sync.Mutex
+	handles    map[string]*tenantHandle
+	lru        *list.List // front is most recently used
+	maxTenants int        // Tenant databases that may exist (0 is unlimited)
+
+	policyMu      sync.RWMutex
+	defaultPolicy TenantPolicy
+	policies      map[string]TenantPolicy
+	archiver      Archiver
+}
+
+// NewTenantManager creates a manager storing tenant databases in dir.
+// The directory is created when the first tenant database is opened.
+// The default tenant always maps to the main database opened by InitDB.
+func NewTenantManager(dir string, maxOpen int) *TenantManager {
+	if maxOpen < 1 {
+		maxOpen = 1
+	}
+	return &TenantManager{
+		dir:      dir,
+		maxOpen:  maxOpen,
+		handles:  make(map[string]*tenantHandle),
+		lru:      list.New(),
+		policies: make(map[string]TenantPolicy),
+	}
+}
+
+// SetMaxTenants limits how many tenant databases may exist besides the
+// main one, so clients naming arbitrary tenants cannot exhaust the disk.
+// Existing tenants stay usable when the limit is lowered. 0 is unlimited.
+func (m *TenantManager) SetMaxTenants(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxTenants = n
+}
+
+// SetPolicies replaces the default and per-tenant policies
+func (m *TenantManager) SetPolicies(defaultPolicy TenantPolicy, policies map[string]TenantPolicy) {
+	copied := make(map[string]TenantPolicy, len(policies))
+	for name, p := range policies {
+		copied[name] = p
+	}
+
+	m.policyMu.Lock()
+	defer m.policyMu.Unlock()
+	m.defaultPolicy = defaultPolicy
+	m.policies = copied
+}
+
+// Policy returns the effective policy for a tenant
+func (m *TenantManager) Policy(tenant string) TenantPolicy {
+	m.policyMu.RLock()
+	defer m.policyMu.RUnlock()
+	if p, ok := m.policies[tenant]; ok {
+		return p
+	}
+	return m.defaultPolicy
+}
+
+// tenantPath returns the database file used for a tenant
+func (m *TenantManager) tenantPath(tenant string) string {
+	return filepath.Join(m.dir, tenant+".db")
+}
+
+// Exists reports whether a tenant already has a database
+func (m *TenantManager) Exists(tenant string) bool {
+	if tenant == "" || tenant == DefaultTenant {
+		return true
+	}
+	if !ValidTenantName(tenant) {
+		return false
+	}
+	_, err := os.Stat(m.tenantPath(tenant))
+	return err == nil
+}
+
+// Acquire returns the database for a tenant, opening it if needed.
+// The release function must be called once the caller is done with it.
+func (m *TenantManager) Acquire(tenant string) (*sql.DB, func(), error) {
+	if tenant == "" || tenant == DefaultTenant {
+		return db, func() {}, nil
+	}
+	if !ValidTenantName(tenant) {
+		return nil, nil, fmt.Errorf("invalid tenant name '%s'", tenant)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.handles[tenant]
+	if !ok {
+		if err := m.checkTenantLimitLocked(tenant); err != nil {
+			return nil, nil, err
+		}
+		if err := os.MkdirAll(m.dir, 0755); err != nil {
+			return nil, nil, fmt.Errorf("failed to create tenant directory: %w", err)
+		}
+		conn, err := openDB(m.tenantPath(tenant))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open database for tenant '%s': %w", tenant, err)
+		}
+		h = &tenantHandle{name: tenant, db: conn}
+		h.element = m.lru.PushFront(h)
+		m.handles[tenant] = h
+	} else {
+		m.lru.MoveToFront(h.element)
+	}
+	h.refs++
+	m.evictLocked()
+
+	released := false
+	release := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if released {
+			return
+		}
+		released = true
+		h.refs--
+		m.evictLocked()
+	}
+	return h.db, release, nil
+}
+
+// checkTenantLimitLocked fails if opening tenant would create a database
+// beyond the tenant limit. Databases are only created with m.mu held, so
+// the count cannot change before the caller opens it.
+func (m *TenantManager) checkTenantLimitLocked(tenant string) error {
+	if m.maxTenants <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(m.tenantPath(tenant)); err == nil {
+		return nil
+	}
+	tenants, err := m.Tenants()
+	if err != nil {
+		return err
+	}
+	// Tenants includes the default tenant, which has no file here
+	if len(tenants)-1 >= m.maxTenants {
+		return fmt.Errorf("%w: cannot create tenant '%s', %d tenants exist", ErrTooManyTenants, tenant, m.maxTenants)
+	}
+	return nil
+}
+
+// evictLocked closes least recently used idle handles beyond maxOpen.
+// Handles still in use are skipped, so the limit may be exceeded briefly.
+// Must be called with m.mu held.
+func (m *TenantManager) evictLocked() {
+	for e := m.lru.Back(); e != nil && len(m.handles) > m.maxOpen; {
+		prev := e.Prev()
+		h := e.Value.(*tenantHandle)
+		if h.refs == 0 {
+			m.lru.Remove(e)
+			delete(m.handles, h.name)
+			if err := h.db.Close(); err != nil {
+				log.Printf("failed to close database for tenant %s: %v", h.name, err)
+			}
+		}
+		e = prev
+	}
+}
+
+// Tenants returns the default tenant and every tenant with a database file
+func (m *TenantManager) Tenants() ([]string, error) {
+	tenants := []string{DefaultTenant}
+	entries, err := os.ReadDir(m.dir)
+	if os.IsNotExist(err) {
+		return tenants, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenant directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".db") {
+			continue
+		}
+		tenant := strings.TrimSuffix(name, ".db")
+		if ValidTenantName(tenant) && tenant != DefaultTenant {
+			tenants = append(tenants, tenant)
+		}
+	}
+	sort.Strings(tenants[1:])
+	return tenants, nil
+}
+
+// CheckQuota returns ErrQuotaExceeded if the tenant database is at or
+// above its configured size limit
+func (m *TenantManager) CheckQuota(tenant string, conn *sql.DB) error {
+	limit := m.Policy(tenant).MaxSizeBytes
+	if limit <= 0 {
+		return nil
+	}
+	size, err := DatabaseSize(conn)
+	if err != nil {
+		return err
+	}
+	if size >= limit {
+		return fmt.Errorf("%w: tenant '%s' uses %d of %d bytes", ErrQuotaExceeded, tenant, size, limit)
+	}
+	return nil
+}
+
+// Close optimizes, checkpoints and closes every open tenant database
+func (m *TenantManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []error
+	for name, h := range m.handles {
+		if err := closeConn(h.db); err != nil {
+			log.Printf("failed to close database for tenant %s cleanly: %v", name, err)
+			errs = append(errs, fmt.Errorf("tenant %s: %w", name, err))
+		}
+		delete(m.handles, name)
+	}
+	m.lru.Init()
+	return errors.Join(errs...)
+}
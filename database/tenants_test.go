@@ -0,0 +1,303 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTenantManagerLRU(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := InitDB(filepath.Join(tmpDir, "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	manager := NewTenantManager(filepath.Join(tmpDir, "tenants"), 1)
+	defer manager.Close()
+
+	connA, releaseA, err := manager.Acquire("team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connB, releaseB, err := manager.Acquire("team-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both handles are in use, so neither may be closed yet
+	if err := connA.Ping(); err != nil {
+		t.Errorf("In-use handle was closed: %v", err)
+	}
+	releaseA()
+	releaseB()
+
+	if len(manager.handles) != 1 {
+		t.Errorf("Expected 1 open handle after release, got %d", len(manager.handles))
+	}
+	if err := connB.Ping(); err != nil {
+		t.Errorf("Most recently used handle was closed: %v", err)
+	}
+
+	tenants, err := manager.Tenants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 3 || tenants[0] != DefaultTenant {
+		t.Errorf("Unexpected tenants: %v", tenants)
+	}
+
+	if _, _, err := manager.Acquire("../escape"); err == nil {
+		t.Error("Expected invalid tenant name to be rejected")
+	}
+}
+
+func TestTenantLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := InitDB(filepath.Join(tmpDir, "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	manager := NewTenantManager(filepath.Join(tmpDir, "tenants"), 4)
+	defer manager.Close()
+	manager.SetMaxTenants(1)
+
+	for _, tenant := range []string{"team-a", "team-a", DefaultTenant} {
+		_, release, err := manager.Acquire(tenant)
+		if err != nil {
+			t.Fatalf("Acquire(%s): %v", tenant, err)
+		}
+		release()
+	}
+	if _, _, err := manager.Acquire("team-b"); !errors.Is(err, ErrTooManyTenants) {
+		t.Errorf("Expected the tenant limit to be reached, got %v", err)
+	}
+	if manager.Exists("team-b") {
+		t.Error("Rejected tenant database was created")
+	}
+}
+
+func TestRetentionPurge(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := InitDB(filepath.Join(tmpDir, "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	logs := map[string]interface{}{
+		"resourceLogs": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{},
+			"scopeLogs": []interface{}{map[string]interface{}{
+				"logRecords": []interface{}{
+					map[string]interface{}{"timeUnixNano": formatNano(old), "body": map[string]interface{}{"stringValue": "old"}},
+					map[string]interface{}{"timeUnixNano": formatNano(now), "body": map[string]interface{}{"stringValue": "new"}},
+				},
+			}},
+		}},
+	}
+	if err := InsertLogsData(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewTenantManager(filepath.Join(tmpDir, "tenants"), 4)
+	manager.SetPolicies(TenantPolicy{Retention: 24 * time.Hour}, nil)
+	manager.ApplyRetention(now)
+
+	var count int
+	if err := DB().QueryRow("SELECT COUNT(*) FROM log_records").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 log record after retention, got %d", count)
+	}
+}
+
+func formatNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func TestPurgeOldest(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := InitDB(filepath.Join(tmpDir, "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	base := time.Now().Add(-100 * time.Hour)
+	var records []interface{}
+	for i := 0; i <= 100; i++ {
+		records = append(records, map[string]interface{}{"timeUnixNano": formatNano(base.Add(time.Duration(i) * time.Hour))})
+	}
+	logs := map[string]interface{}{
+		"resourceLogs": []interface{}{map[string]interface{}{
+			"resource":  map[string]interface{}{},
+			"scopeLogs": []interface{}{map[string]interface{}{"logRecords": records}},
+		}},
+	}
+	if err := InsertLogsData(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewTenantManager(filepath.Join(tmpDir, "tenants"), 4)
+	if removed := manager.PurgeOldest(0.1); removed != 10 {
+		t.Errorf("Expected the oldest 10 records to be purged, got %d", removed)
+	}
+	if _, err := manager.FreelistSize(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A single remaining timestamp is still purged
+	if _, err := PurgeBefore(DB(), base.Add(100*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := PurgeOldest(DB(), 0.1); err != nil || removed != 1 {
+		t.Errorf("Expected the last record to be purged, got %d, %v", removed, err)
+	}
+}
+
+func TestPurgeOldestIgnoresOutlierTimestamps(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	base := time.Now().Add(-100 * time.Hour)
+	var records []interface{}
+	for i := 0; i < 99; i++ {
+		records = append(records, map[string]interface{}{"timeUnixNano": formatNano(base.Add(time.Duration(i) * time.Hour))})
+	}
+	// One record claims to come from the year 2200
+	records = append(records, map[string]interface{}{"timeUnixNano": "7258118400000000000"})
+	err := InsertLogsData(map[string]interface{}{"resourceLogs": []interface{}{map[string]interface{}{
+		"resource":  map[string]interface{}{},
+		"scopeLogs": []interface{}{map[string]interface{}{"logRecords": records}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed, err := PurgeOldest(DB(), 0.1); err != nil || removed != 10 {
+		t.Errorf("Expected the oldest 10 records to be purged, got %d, %v", removed, err)
+	}
+	var remaining int
+	DB().QueryRow("SELECT COUNT(*) FROM log_records").Scan(&remaining)
+	if remaining != 90 {
+		t.Errorf("Expected 90 records to remain, got %d", remaining)
+	}
+}
+
+func TestPurgeOldestArchivesFirst(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := InitDB(filepath.Join(tmpDir, "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	base := time.Now().Add(-100 * time.Hour)
+	var records []interface{}
+	for i := 0; i <= 100; i++ {
+		records = append(records, map[string]interface{}{"timeUnixNano": formatNano(base.Add(time.Duration(i) * time.Hour))})
+	}
+	err := InsertLogsData(map[string]interface{}{"resourceLogs": []interface{}{map[string]interface{}{
+		"resource":  map[string]interface{}{},
+		"scopeLogs": []interface{}{map[string]interface{}{"logRecords": records}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewTenantManager(filepath.Join(tmpDir, "tenants"), 4)
+	var archived int
+	manager.SetArchiver(func(tenant string, conn *sql.DB, cutoff time.Time, upTo map[string]int64) error {
+		batch, err := ReadArchive(conn, SignalLogs, ReadOptions{Until: cutoff.UnixNano() - 1, UpToID: upTo[SignalLogs]})
+		if err != nil {
+			return err
+		}
+		archived += len(batch.Rows)
+		return nil
+	})
+	if removed := manager.PurgeOldest(0.1); removed != 10 || archived != 10 {
+		t.Errorf("Expected the 10 purged records to be archived, got %d removed and %d archived", removed, archived)
+	}
+
+	// Space comes first: a failed archive still deletes
+	manager.SetArchiver(func(string, *sql.DB, time.Time, map[string]int64) error {
+		return fmt.Errorf("disk full")
+	})
+	if removed := manager.PurgeOldest(0.1); removed == 0 {
+		t.Error("Expected records to be purged even though archiving failed")
+	}
+}
+
+func TestRetentionArchivesBeforePurge(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := InitDB(filepath.Join(tmpDir, "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	insert := func(body string, at time.Time) {
+		t.Helper()
+		err := InsertLogsData(map[string]interface{}{"resourceLogs": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{},
+			"scopeLogs": []interface{}{map[string]interface{}{"logRecords": []interface{}{
+				map[string]interface{}{"timeUnixNano": formatNano(at), "body": map[string]interface{}{"stringValue": body}},
+			}}},
+		}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func() int {
+		t.Helper()
+		var n int
+		if err := DB().QueryRow("SELECT COUNT(*) FROM log_records").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	insert("old", old)
+	insert("new", now)
+
+	manager := NewTenantManager(filepath.Join(tmpDir, "tenants"), 4)
+	manager.SetPolicies(TenantPolicy{Retention: 24 * time.Hour}, nil)
+
+	// Nothing is deleted when archiving fails
+	manager.SetArchiver(func(string, *sql.DB, time.Time, map[string]int64) error {
+		return fmt.Errorf("disk full")
+	})
+	manager.ApplyRetention(now)
+	if n := count(); n != 2 {
+		t.Fatalf("Expected both records kept after a failed archive, got %d", n)
+	}
+
+	var archived []string
+	manager.SetArchiver(func(tenant string, conn *sql.DB, cutoff time.Time, upTo map[string]int64) error {
+		batch, err := ReadArchive(conn, SignalLogs, ReadOptions{Until: cutoff.UnixNano() - 1, UpToID: upTo[SignalLogs]})
+		if err != nil {
+			return err
+		}
+		for _, row := range batch.Rows {
+			archived = append(archived, row.Values[4].(string))
+		}
+		// A late record arriving during the archive is not deleted unseen
+		insert("late", old)
+		return nil
+	})
+	manager.ApplyRetention(now)
+	if len(archived) != 1 || archived[0] != `{"stringValue":"old"}` {
+		t.Errorf("Expected only the expired record to be archived, got %v", archived)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("Expected the new and late records to remain, got %d", n)
+	}
+}
@@ -4,11 +4,26 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 // InsertTraceData inserts trace telemetry data into the database
 func InsertTraceData(data map[string]interface{}) error {
-	tx, err := db.Begin()
+	return InsertTraceDataInto(db, data)
+}
+
+// InsertTraceDataInto inserts trace telemetry data into the given database
+func InsertTraceDataInto(conn *sql.DB, data map[string]interface{}) error {
+	return insertTraceData(conn, data, observeInsert)
+}
+
+// insertTraceData inserts trace data and reports the outcome to observe
+func insertTraceData(conn *sql.DB, data map[string]interface{}, observe insertObserver) (err error) {
+	var spanCount int64
+	start := time.Now()
+	defer func() { observe("traces", start, spanCount, err) }()
+
+	tx, err := conn.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -79,6 +94,7 @@ func InsertTraceData(data map[string]interface{}) error {
 				if err := InsertSpan(tx, span, resourceID, scopeID); err != nil {
 					return fmt.Errorf("failed to insert span: %w", err)
 				}
+				spanCount++
 			}
 		}
 	}
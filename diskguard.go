@@ -0,0 +1,114 @@
+package main
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/handlers"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+)
+
+// Emergency retention removes this fraction of the stored records per
+// pass, for at most emergencyMaxPasses passes per check
+const (
+	emergencyPurgeFraction = 0.1
+	emergencyMaxPasses     = 10
+)
+
+// diskGuard deletes the oldest telemetry when free disk space drops below
+// a floor, so the collector keeps accepting recent data instead of failing
+// every write
+type diskGuard struct {
+	dir     string
+	tenants *database.TenantManager
+	floor   uint64
+}
+
+// freeSpace returns the space available for new rows: free space on the
+// file system plus unused pages inside the databases
+func (g *diskGuard) freeSpace() (uint64, error) {
+	free, err := database.FreeSpace(g.dir)
+	if err != nil {
+		return 0, err
+	}
+	reusable, err := g.tenants.FreelistSize()
+	if err != nil {
+		return 0, err
+	}
+	return free + uint64(reusable), nil
+}
+
+// check runs emergency retention if free space is below the floor and
+// updates the degraded state
+func (g *diskGuard) check() {
+	free, err := g.freeSpace()
+	if err != nil {
+		logging.Warn("Failed to check free disk space: %v", err)
+		return
+	}
+	if free >= g.floor {
+		handlers.ClearDegraded(handlers.DegradedDisk)
+		return
+	}
+
+	handlers.SetDegraded(handlers.DegradedDisk, "free disk space is below the emergency floor")
+	logging.Warn("Only %d MB free, below the %d MB floor; deleting the oldest telemetry", free/(1024*1024), g.floor/(1024*1024))
+	for pass := 0; pass < emergencyMaxPasses && free < g.floor; pass++ {
+		if g.tenants.PurgeOldest(emergencyPurgeFraction) == 0 {
+			logging.Error("Free disk space is below the floor and there is no telemetry left to delete")
+			return
+		}
+		if free, err = g.freeSpace(); err != nil {
+			logging.Warn("Failed to check free disk space: %v", err)
+			return
+		}
+	}
+	if free >= g.floor {
+		logging.Info("Emergency retention freed space, %d MB now available", free/(1024*1024))
+		handlers.ClearDegraded(handlers.DegradedDisk)
+	}
+}
+
+// startDiskGuard checks free space now, every interval and whenever an
+// insert fails because storage is full, until the returned stop function
+// is called
+func startDiskGuard(dbPath string, tenants *database.TenantManager, floorMB int64, interval time.Duration) func() {
+	if floorMB <= 0 || interval <= 0 {
+		return func() {}
+	}
+	g := &diskGuard{dir: filepath.Dir(dbPath), tenants: tenants, floor: uint64(floorMB) * 1024 * 1024}
+
+	trigger := make(chan struct{}, 1)
+	handlers.SetStorageFullHook(func() {
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	})
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			g.check()
+			select {
+			case <-ticker.C:
+			case <-trigger:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	logging.Debug("Emergency retention keeps %d MB free, checked every %s", floorMB, interval)
+	return func() {
+		handlers.SetStorageFullHook(nil)
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/exporter"
+)
+
+// runExport implements the export subcommand
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s export [options]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Write stored telemetry as newline-delimited OTLP JSON.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	dbPath := fs.String("db", getDefaultDBPath(), "Path to the SQLite database to read")
+	output := fs.String("output", "-", "File to write, or - for stdout")
+	compress := fs.Bool("gzip", false, "Compress the output with gzip (implied when -output ends in .gz)")
+	maxSize := fs.Int64("max-file-size", 0, "Start a new numbered file after about this many MB (default: 0, one file)")
+	since := fs.String("since", "", "Only records at or after this time: RFC 3339 or a duration ago such as 2h or 7d")
+	until := fs.String("until", "", "Only records at or before this time: RFC 3339 or a duration ago")
+	service := fs.String("service", "", "Only records whose service.name resource attribute matches")
+	signals := fs.String("signal", "", "Comma separated signals to export: traces, metrics, logs (default: all)")
+	batchSize := fs.Int("batch-size", exporter.DefaultBatchSize, "Records per line")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+
+	read, list, code := parseReadFlags(fs, *since, *until, *service, *signals)
+	if code != 0 {
+		return code
+	}
+	if *batchSize <= 0 || *maxSize < 0 {
+		return usageError(fs, "-batch-size or -max-file-size", fmt.Errorf("must be positive"))
+	}
+	if *maxSize > 0 && *output == "-" {
+		return usageError(fs, "-max-file-size", fmt.Errorf("requires -output"))
+	}
+	read.Limit = *batchSize
+
+	files := &exportFiles{
+		path:     *output,
+		gzip:     *compress || strings.HasSuffix(*output, ".gz"),
+		maxBytes: *maxSize * 1024 * 1024,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	written, err := exportDB(ctx, *dbPath, list, read, files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	var counts []string
+	for _, signal := range list {
+		counts = append(counts, fmt.Sprintf("%d %s", written[signal], signal))
+	}
+	fmt.Fprintf(os.Stderr, "Exported %s to %s\n", strings.Join(counts, ", "), strings.Join(files.paths, ", "))
+	return 0
+}
+
+// parseReadFlags parses the filter flags shared by commands that read a
+// database. A non-zero status means a flag was invalid.
+func parseReadFlags(fs *flag.FlagSet, since, until, service, signals string) (database.ReadOptions, []string, int) {
+	read := database.ReadOptions{Service: service}
+	var err error
+	now := time.Now()
+	if read.Since, err = parseTimeArg(since, now); err != nil {
+		return read, nil, usageError(fs, "-since", err)
+	}
+	if read.Until, err = parseTimeArg(until, now); err != nil {
+		return read, nil, usageError(fs, "-until", err)
+	}
+	list, err := parseSignals(signals)
+	if err != nil {
+		return read, nil, usageError(fs, "-signal", err)
+	}
+	return read, list, 0
+}
+
+// exportDB writes the selected records of a database file to files
+func exportDB(ctx context.Context, dbPath string, signals []string, read database.ReadOptions, files *exportFiles) (map[string]int64, error) {
+	conn, err := database.OpenReadOnly(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := files.next(); err != nil {
+		return nil, err
+	}
+	written, err := exporter.WriteJSONLines(ctx, conn, signals, read, func(_ string, line []byte) error {
+		return files.writeLine(line)
+	})
+	if closeErr := files.close(); err == nil {
+		err = closeErr
+	}
+	return written, err
+}
+
+// exportFiles writes lines to a file or stdout, optionally compressed and
+// split into numbered files of about maxBytes each
+type exportFiles struct {
+	path     string
+	gzip     bool
+	maxBytes int64 // 0 writes a single file
+
+	paths []string
+	out   io.WriteCloser
+	gz    *gzip.Writer
+	count *countingWriter
+}
+
+// countingWriter counts the bytes written to the underlying writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeLine writes a line, first starting a new file when the line would
+// take the current one past maxBytes
+func (f *exportFiles) writeLine(line []byte) error {
+	if f.maxBytes > 0 && f.count.n > 0 && f.count.n+int64(len(line)) > f.maxBytes {
+		if err := f.close(); err != nil {
+			return err
+		}
+		if err := f.next(); err != nil {
+			return err
+		}
+	}
+	if f.gz == nil {
+		_, err := f.count.Write(line)
+		return err
+	}
+	if _, err := f.gz.Write(line); err != nil {
+		return err
+	}
+	// Flushing keeps the compressed size known for splitting
+	return f.gz.Flush()
+}
+
+// next opens the next output file
+func (f *exportFiles) next() error {
+	path := f.path
+	if f.maxBytes > 0 {
+		path = partPath(f.path, len(f.paths)+1)
+	}
+	if path == "-" {
+		f.out = nopCloser{os.Stdout}
+		path = "stdout"
+	} else {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		f.out = file
+	}
+	f.paths = append(f.paths, path)
+	f.count = &countingWriter{w: f.out}
+	f.gz = nil
+	if f.gzip {
+		f.gz = gzip.NewWriter(f.count)
+	}
+	return nil
+}
+
+// close finishes the current output file
+func (f *exportFiles) close() error {
+	var errs []error
+	if f.gz != nil {
+		errs = append(errs, f.gz.Close())
+	}
+	errs = append(errs, f.out.Close())
+	return errors.Join(errs...)
+}
+
+// partPath numbers a split output file, e.g. incident.jsonl.gz becomes
+// incident-001.jsonl.gz
+func partPath(path string, n int) string {
+	base, ext := path, ""
+	if strings.HasSuffix(base, ".gz") {
+		base, ext = strings.TrimSuffix(base, ".gz"), ".gz"
+	}
+	e := filepath.Ext(base)
+	base, ext = strings.TrimSuffix(base, e), e+ext
+	return fmt.Sprintf("%s-%03d%s", base, n, ext)
+}
+
+// nopCloser leaves stdout open when the export finishes
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
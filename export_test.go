@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+func TestExportSplitsCompressedFiles(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "incident.db")
+	if err := database.InitDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	var records []interface{}
+	for i := 0; i < 50; i++ {
+		body := fmt.Sprintf("%d %x", i, rand.Int63())
+		records = append(records, map[string]interface{}{
+			"timeUnixNano": "1700000000000000000",
+			"body":         map[string]interface{}{"stringValue": body},
+		})
+	}
+	err := database.InsertLogsData(map[string]interface{}{"resourceLogs": []interface{}{map[string]interface{}{
+		"scopeLogs": []interface{}{map[string]interface{}{"logRecords": records}},
+	}}})
+	database.CloseDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := &exportFiles{path: filepath.Join(dir, "out.jsonl.gz"), gzip: true, maxBytes: 1024}
+	written, err := exportDB(context.Background(), dbPath, database.Signals, database.ReadOptions{Limit: 5}, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written[database.SignalLogs] != 50 || len(files.paths) < 2 {
+		t.Fatalf("Expected 50 records split over several files, got %v in %v", written, files.paths)
+	}
+
+	total := 0
+	for i, path := range files.paths {
+		if want := filepath.Join(dir, fmt.Sprintf("out-%03d.jsonl.gz", i+1)); path != want {
+			t.Errorf("Expected part %d at %s, got %s", i+1, want, path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if info, _ := f.Stat(); info.Size() > files.maxBytes {
+			t.Errorf("%s is %d bytes, larger than the limit", path, info.Size())
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(gz)
+		for scanner.Scan() {
+			var req struct {
+				ResourceLogs []struct {
+					ScopeLogs []struct {
+						LogRecords []interface{} `json:"logRecords"`
+					} `json:"scopeLogs"`
+				} `json:"resourceLogs"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+				t.Fatal(err)
+			}
+			total += len(req.ResourceLogs[0].ScopeLogs[0].LogRecords)
+		}
+	}
+	if total != 50 {
+		t.Errorf("Expected 50 records across all files, got %d", total)
+	}
+}
+
+func TestPartPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"out.jsonl":         "out-002.jsonl",
+		"dir/out.jsonl.gz":  "dir/out-002.jsonl.gz",
+		"out":               "out-002",
+		"out.gz":            "out-002.gz",
+		"a.b/incident.json": "a.b/incident-002.json",
+	} {
+		if got := partPath(path, 2); got != want {
+			t.Errorf("partPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request encodings
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+)
+
+// Request compressions
+const (
+	CompressionGzip = "gzip"
+	CompressionNone = "none"
+)
+
+// DefaultTimeout bounds each export request
+const DefaultTimeout = 10 * time.Second
+
+// maxErrorBody is how much of an error response is kept in SendError
+const maxErrorBody = 1024
+
+// ClientOptions configures an OTLP/HTTP client
+type ClientOptions struct {
+	Endpoint    string            // Base URL; /v1/traces etc. is appended
+	Encoding    string            // json or protobuf (default: protobuf)
+	Compression string            // gzip or none (default: gzip)
+	Headers     map[string]string // Added to every request, e.g. authorization
+	Timeout     time.Duration     // Per request (default: 10s)
+}
+
+// Client sends OTLP export requests over HTTP
+type Client struct {
+	opts ClientOptions
+	http *http.Client
+}
+
+// NewClient validates opts and creates a client
+func NewClient(opts ClientOptions) (*Client, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint '%s' (expected an http or https URL)", opts.Endpoint)
+	}
+	switch opts.Encoding {
+	case "":
+		opts.Encoding = EncodingProtobuf
+	case EncodingJSON, EncodingProtobuf:
+	default:
+		return nil, fmt.Errorf("unknown encoding '%s' (expected json or protobuf)", opts.Encoding)
+	}
+	switch opts.Compression {
+	case "":
+		opts.Compression = CompressionGzip
+	case CompressionGzip, CompressionNone:
+	default:
+		return nil, fmt.Errorf("unknown compression '%s' (expected gzip or none)", opts.Compression)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	opts.Endpoint = strings.TrimRight(opts.Endpoint, "/")
+	return &Client{opts: opts, http: &http.Client{Timeout: opts.Timeout}}, nil
+}
+
+// SendError describes a failed export request
+type SendError struct {
+	StatusCode int           // HTTP status, 0 if no response was received
+	Retryable  bool          // Whether the request may succeed if sent again
+	RetryAfter time.Duration // Delay requested by the server, if any
+	Message    string
+}
+
+func (e *SendError) Error() string {
+	if e.StatusCode == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("upstream returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Send encodes payload and posts it to the signal's endpoint. header is
+// added to the configured headers and may be nil. Failures are returned
+// as *SendError.
+func (c *Client) Send(ctx context.Context, signal string, payload map[string]interface{}, header http.Header) error {
+	body, contentType, err := c.encode(signal, payload)
+	if err != nil {
+		return &SendError{Message: fmt.Sprintf("failed to encode %s: %v", signal, err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.opts.Endpoint+"/v1/"+signal, bytes.NewReader(body))
+	if err != nil {
+		return &SendError{Message: err.Error()}
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.opts.Compression == CompressionGzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range c.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, values := range header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return &SendError{Retryable: ctx.Err() == nil, Message: err.Error()}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return &SendError{
+		StatusCode: resp.StatusCode,
+		Retryable:  retryableStatus(resp.StatusCode),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Message:    strings.TrimSpace(string(msg)),
+	}
+}
+
+// encode serializes and optionally compresses a payload
+func (c *Client) encode(signal string, payload map[string]interface{}) ([]byte, string, error) {
+	var body []byte
+	var err error
+	contentType := "application/json"
+	if c.opts.Encoding == EncodingProtobuf {
+		contentType = "application/x-protobuf"
+		body, err = EncodeProto(signal, payload)
+	} else {
+		body, err = json.Marshal(payload)
+	}
+	if err != nil || c.opts.Compression != CompressionGzip {
+		return body, contentType, err
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(body); err != nil {
+		return nil, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), contentType, nil
+}
+
+// retryableStatus reports whether OTLP/HTTP allows retrying a response
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
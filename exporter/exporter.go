@@ -0,0 +1,490 @@
+// Package exporter forwards stored telemetry to an upstream OTLP/HTTP
+// endpoint such as a central OpenTelemetry Collector.
+//
+// Data is read back from SQLite after it has been committed, so the
+// database doubles as the export queue. Each exporter keeps a cursor per
+// signal in every database it forwards from; unsent records survive
+// restarts and upstream outages and are sent once the upstream is back.
+// Delivery is at least once.
+package exporter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+	"github.com/RedShiftVelocity/sqlite-otel/stats"
+)
+
+// Where a new exporter starts forwarding from
+const (
+	StartAtLatest = "latest" // only records stored after the exporter was added
+	StartAtOldest = "oldest" // everything already in the database
+)
+
+// Defaults for exporter options
+const (
+	DefaultBatchSize    = 1000
+	DefaultBatchDelay   = 200 * time.Millisecond
+	DefaultPollInterval = 10 * time.Second
+	DefaultMaxBackoff   = 30 * time.Second
+)
+
+// initialBackoff is the delay before the first retry of a failed request
+const initialBackoff = time.Second
+
+// Options configures an exporter
+type Options struct {
+	Name string // Identifies the exporter in cursors, metrics and logs
+	ClientOptions
+
+	Signals      []string      // Signals to forward (default: all)
+	TenantHeader string        // Header carrying the tenant name upstream (empty to omit)
+	BatchSize    int           // Maximum records per request
+	BatchDelay   time.Duration // How long to wait for more data after a commit
+	PollInterval time.Duration // How often to look for data written by other paths
+	MaxBackoff   time.Duration // Upper bound of the retry delay
+	StartAt      string        // latest or oldest (default: latest)
+}
+
+// Source provides the databases to forward from
+type Source interface {
+	Tenants() ([]string, error)
+	Acquire(tenant string) (*sql.DB, func(), error)
+}
+
+var (
+	sentRecords = stats.Default.NewCounterVec("sqlite_otel_exporter_sent_records_total",
+		"Records forwarded upstream, by exporter and signal.", "exporter", "signal")
+	droppedRecords = stats.Default.NewCounterVec("sqlite_otel_exporter_dropped_records_total",
+		"Records dropped because upstream rejected them permanently, by exporter and signal.", "exporter", "signal")
+	failedRequests = stats.Default.NewCounterVec("sqlite_otel_exporter_failed_requests_total",
+		"Failed export requests, by exporter and signal.", "exporter", "signal")
+)
+
+// running holds the started exporters for the lag metrics
+var (
+	runningMu sync.Mutex
+	running   = make(map[*Exporter]bool)
+)
+
+func init() {
+	stats.Default.NewFunc("sqlite_otel_exporter_pending_records", "Stored records not yet forwarded, by exporter and signal.", stats.TypeGauge, func() []stats.Sample {
+		return lagSamples(func(lags []lag, _ time.Time) float64 {
+			var total int64
+			for _, l := range lags {
+				total += l.pending
+			}
+			return float64(total)
+		})
+	})
+	stats.Default.NewFunc("sqlite_otel_exporter_lag_seconds", "Time since the exporter last had nothing pending, by exporter and signal.", stats.TypeGauge, func() []stats.Sample {
+		return lagSamples(func(lags []lag, now time.Time) float64 {
+			var oldest time.Duration
+			for _, l := range lags {
+				if d := now.Sub(l.caughtUp); l.pending > 0 && d > oldest {
+					oldest = d
+				}
+			}
+			return oldest.Seconds()
+		})
+	})
+}
+
+// lag is the backlog of one signal in one database
+type lag struct {
+	pending  int64
+	caughtUp time.Time // last time nothing was pending
+}
+
+// lagSamples aggregates the backlog of each running exporter per signal
+func lagSamples(aggregate func([]lag, time.Time) float64) []stats.Sample {
+	runningMu.Lock()
+	exporters := make([]*Exporter, 0, len(running))
+	for e := range running {
+		exporters = append(exporters, e)
+	}
+	runningMu.Unlock()
+
+	now := time.Now()
+	var samples []stats.Sample
+	for _, e := range exporters {
+		for _, signal := range e.opts.Signals {
+			samples = append(samples, stats.Sample{
+				Labels: []stats.Label{{Name: "exporter", Value: e.opts.Name}, {Name: "signal", Value: signal}},
+				Value:  aggregate(e.lags(signal), now),
+			})
+		}
+	}
+	return samples
+}
+
+// Exporter forwards the records of one or more databases upstream
+type Exporter struct {
+	opts    Options
+	client  *Client
+	source  Source
+	started time.Time
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	backlog map[[2]string]lag // by tenant and signal
+}
+
+// New validates opts and creates an exporter reading from source
+func New(opts Options, source Source) (*Exporter, error) {
+	if opts.Name == "" {
+		return nil, fmt.Errorf("exporter name is required")
+	}
+	client, err := NewClient(opts.ClientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("exporter %s: %w", opts.Name, err)
+	}
+	if len(opts.Signals) == 0 {
+		opts.Signals = database.Signals
+	}
+	for _, signal := range opts.Signals {
+		if _, err := requestMessage(signal); err != nil {
+			return nil, fmt.Errorf("exporter %s: %w", opts.Name, err)
+		}
+	}
+	switch opts.StartAt {
+	case "":
+		opts.StartAt = StartAtLatest
+	case StartAtLatest, StartAtOldest:
+	default:
+		return nil, fmt.Errorf("exporter %s: unknown start_at '%s' (expected latest or oldest)", opts.Name, opts.StartAt)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.BatchDelay <= 0 {
+		opts.BatchDelay = DefaultBatchDelay
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	return &Exporter{
+		opts:    opts,
+		client:  client,
+		source:  source,
+		wake:    make(chan struct{}, 1),
+		backlog: make(map[[2]string]lag),
+	}, nil
+}
+
+// Name returns the exporter's name
+func (e *Exporter) Name() string {
+	return e.opts.Name
+}
+
+// Start positions new cursors and begins forwarding in the background.
+// Databases without a cursor start at the end when StartAt is latest;
+// databases created later are always forwarded from their first record.
+func (e *Exporter) Start() error {
+	if e.opts.StartAt == StartAtLatest {
+		if err := e.forEachDB(e.initCursors); err != nil {
+			return fmt.Errorf("exporter %s: %w", e.opts.Name, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	e.started = time.Now()
+	runningMu.Lock()
+	running[e] = true
+	runningMu.Unlock()
+
+	go e.run(ctx)
+	logging.Info("Exporter %s forwarding %v to %s (%s)", e.opts.Name, e.opts.Signals, e.client.opts.Endpoint, e.client.opts.Encoding)
+	return nil
+}
+
+// Stop cancels any request in flight and waits for the exporter to exit.
+// Records of a cancelled request are sent again on the next start.
+func (e *Exporter) Stop() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	<-e.done
+	runningMu.Lock()
+	delete(running, e)
+	runningMu.Unlock()
+}
+
+// Notify tells the exporter new data of a signal has been committed
+func (e *Exporter) Notify(signal string) {
+	for _, s := range e.opts.Signals {
+		if s == signal {
+			select {
+			case e.wake <- struct{}{}:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// initCursors points missing cursors of one database at its last record
+func (e *Exporter) initCursors(_ string, conn *sql.DB) error {
+	for _, signal := range e.opts.Signals {
+		_, ok, err := database.ExportCursor(conn, e.opts.Name, signal)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		last, err := database.LastRowID(conn, signal)
+		if err != nil {
+			return err
+		}
+		if err := database.SetExportCursor(conn, e.opts.Name, signal, last); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachDB runs fn against every database of the source
+func (e *Exporter) forEachDB(fn func(tenant string, conn *sql.DB) error) error {
+	tenants, err := e.source.Tenants()
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		conn, release, err := e.source.Acquire(tenant)
+		if err != nil {
+			return err
+		}
+		err = fn(tenant, conn)
+		release()
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+	}
+	return nil
+}
+
+// retry is the backoff state of a tenant whose last export failed
+type retry struct {
+	backoff time.Duration
+	at      time.Time // no attempt before this time
+}
+
+// run forwards pending data whenever data is committed or the poll
+// interval passes. A tenant whose export fails is retried with exponential
+// backoff while the other tenants keep forwarding.
+func (e *Exporter) run(ctx context.Context) {
+	defer close(e.done)
+	ticker := time.NewTicker(e.opts.PollInterval)
+	defer ticker.Stop()
+
+	retries := make(map[string]*retry)
+	for {
+		e.exportAll(ctx, retries)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Wake up for the earliest retry that is due before the next poll
+		var retryC <-chan time.Time
+		var next time.Time
+		for _, r := range retries {
+			if next.IsZero() || r.at.Before(next) {
+				next = r.at
+			}
+		}
+		var retryTimer *time.Timer
+		if !next.IsZero() {
+			retryTimer = time.NewTimer(time.Until(next))
+			retryC = retryTimer.C
+		}
+
+		select {
+		case <-ticker.C:
+		case <-retryC:
+		case <-e.wake:
+			// Let concurrent commits join the batch
+			timer := time.NewTimer(e.opts.BatchDelay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+		case <-ctx.Done():
+		}
+		if retryTimer != nil {
+			retryTimer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// exportAll forwards the pending data of every database whose retry is
+// due, updating retries with the outcome
+func (e *Exporter) exportAll(ctx context.Context, retries map[string]*retry) {
+	tenants, err := e.source.Tenants()
+	if err != nil {
+		logging.Warn("Exporter %s: %v", e.opts.Name, err)
+		return
+	}
+
+	now := time.Now()
+	for _, tenant := range tenants {
+		r := retries[tenant]
+		if r != nil && now.Before(r.at) {
+			continue
+		}
+		conn, release, err := e.source.Acquire(tenant)
+		if err == nil {
+			err = e.exportDB(ctx, tenant, conn)
+			release()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			if r != nil {
+				logging.Info("Exporter %s recovered for tenant %s", e.opts.Name, tenant)
+				delete(retries, tenant)
+			}
+			continue
+		}
+		if r == nil {
+			r = &retry{}
+			retries[tenant] = r
+		}
+		r.backoff = nextBackoff(r.backoff, e.opts.MaxBackoff)
+		delay := r.backoff
+		var sendErr *SendError
+		if errors.As(err, &sendErr) && sendErr.RetryAfter > delay {
+			delay = sendErr.RetryAfter
+		}
+		r.at = time.Now().Add(delay)
+		logging.Warn("Exporter %s: tenant %s: %v; retrying in %s", e.opts.Name, tenant, err, delay.Round(time.Millisecond))
+	}
+}
+
+// exportDB sends every pending record of one database in batches
+func (e *Exporter) exportDB(ctx context.Context, tenant string, conn *sql.DB) error {
+	var header http.Header
+	if e.opts.TenantHeader != "" {
+		header = http.Header{}
+		header.Set(e.opts.TenantHeader, tenant)
+	}
+
+	for _, signal := range e.opts.Signals {
+		cursor, _, err := database.ExportCursor(conn, e.opts.Name, signal)
+		if err != nil {
+			return err
+		}
+		err = e.exportSignal(ctx, conn, signal, cursor, header)
+		e.updateLag(conn, tenant, signal, err)
+		if err != nil {
+			return fmt.Errorf("%s for tenant %s: %w", signal, tenant, err)
+		}
+	}
+	return nil
+}
+
+// exportSignal sends the records of one signal after cursor until none
+// are left, advancing the cursor after each accepted batch
+func (e *Exporter) exportSignal(ctx context.Context, conn *sql.DB, signal string, cursor int64, header http.Header) error {
+	for {
+		batch, err := database.ReadBatch(conn, signal, database.ReadOptions{AfterID: cursor, Limit: e.opts.BatchSize})
+		if err != nil {
+			return err
+		}
+		if batch.Records == 0 {
+			return nil
+		}
+
+		if err := e.client.Send(ctx, signal, batch.Payload, header); err != nil {
+			failedRequests.Inc(e.opts.Name, signal)
+			var sendErr *SendError
+			if ctx.Err() != nil || !errors.As(err, &sendErr) || sendErr.Retryable {
+				return err
+			}
+			// Sending the same records again would fail forever, so they
+			// are dropped like the OpenTelemetry Collector does
+			logging.Error("Exporter %s dropped %d %s: %v", e.opts.Name, batch.Records, signal, err)
+			droppedRecords.Add(float64(batch.Records), e.opts.Name, signal)
+		} else {
+			sentRecords.Add(float64(batch.Records), e.opts.Name, signal)
+		}
+
+		cursor = batch.LastID
+		if err := database.SetExportCursor(conn, e.opts.Name, signal, cursor); err != nil {
+			return err
+		}
+	}
+}
+
+// updateLag records the backlog of a signal after an export attempt
+func (e *Exporter) updateLag(conn *sql.DB, tenant, signal string, exportErr error) {
+	key := [2]string{tenant, signal}
+	e.mu.Lock()
+	l, ok := e.backlog[key]
+	e.mu.Unlock()
+	if !ok {
+		l.caughtUp = e.started
+	}
+
+	if exportErr == nil {
+		l.pending = 0
+		l.caughtUp = time.Now()
+	} else if cursor, _, err := database.ExportCursor(conn, e.opts.Name, signal); err == nil {
+		if pending, err := database.CountAfter(conn, signal, cursor); err == nil {
+			l.pending = pending
+		}
+	}
+
+	e.mu.Lock()
+	e.backlog[key] = l
+	e.mu.Unlock()
+}
+
+// lags returns the backlog of a signal in every database
+func (e *Exporter) lags(signal string) []lag {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var lags []lag
+	for key, l := range e.backlog {
+		if key[1] == signal {
+			lags = append(lags, l)
+		}
+	}
+	return lags
+}
+
+// nextBackoff doubles the retry delay up to max, with 20% jitter
+func nextBackoff(current, max time.Duration) time.Duration {
+	next := current * 2
+	if next < initialBackoff {
+		next = initialBackoff
+	}
+	if next > max {
+		next = max
+	}
+	jitter := time.Duration(rand.Int63n(int64(next)/5 + 1))
+	return next - next/10 + jitter
+}
@@ -0,0 +1,262 @@
+package exporter
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+// upstream is an OTLP/HTTP receiver that fails its first failures requests
+// and every request for the tenant named by down
+type upstream struct {
+	mu       sync.Mutex
+	failures int
+	down     string
+	requests int
+	records  []string
+	tenants  []string
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests++
+	if down := r.Header.Get("X-Tenant"); down != "" && down == u.down {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if u.failures > 0 {
+		u.failures--
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := gzip.NewReader(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		ResourceLogs []struct {
+			ScopeLogs []struct {
+				LogRecords []struct {
+					Body struct {
+						StringValue string `json:"stringValue"`
+					} `json:"body"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, rl := range req.ResourceLogs {
+		for _, sl := range rl.ScopeLogs {
+			for _, lr := range sl.LogRecords {
+				u.records = append(u.records, lr.Body.StringValue)
+			}
+		}
+	}
+	u.tenants = append(u.tenants, r.Header.Get("X-Tenant"))
+	w.Write([]byte(`{}`))
+}
+
+func (u *upstream) received() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.records...)
+}
+
+func insertLogs(t *testing.T, bodies ...string) {
+	t.Helper()
+	var records []interface{}
+	for _, b := range bodies {
+		records = append(records, map[string]interface{}{
+			"timeUnixNano": strconv.FormatInt(time.Now().UnixNano(), 10),
+			"body":         map[string]interface{}{"stringValue": b},
+		})
+	}
+	err := database.InsertLogsData(map[string]interface{}{"resourceLogs": []interface{}{map[string]interface{}{
+		"resource":  map[string]interface{}{},
+		"scopeLogs": []interface{}{map[string]interface{}{"logRecords": records}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// cursorAt reports whether an exporter has saved its logs cursor at the
+// last stored record
+func cursorAt(conn *sql.DB, name string) bool {
+	cursor, _, _ := database.ExportCursor(conn, name, database.SignalLogs)
+	last, _ := database.LastRowID(conn, database.SignalLogs)
+	return cursor == last
+}
+
+func TestExporterRetriesAndResumes(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := database.InitDB(filepath.Join(tmpDir, "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+	tenants := database.NewTenantManager(filepath.Join(tmpDir, "tenants"), 4)
+	defer tenants.Close()
+
+	up := &upstream{failures: 1}
+	srv := httptest.NewServer(up)
+	defer srv.Close()
+
+	insertLogs(t, "one", "two")
+	opts := Options{
+		Name:          "central",
+		ClientOptions: ClientOptions{Endpoint: srv.URL, Encoding: EncodingJSON},
+		Signals:       []string{database.SignalLogs},
+		TenantHeader:  "X-Tenant",
+		PollInterval:  20 * time.Millisecond,
+		StartAt:       StartAtOldest,
+	}
+	e, err := New(opts, tenants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the retried batch", func() bool { return len(up.received()) == 2 })
+	waitFor(t, "the cursor", func() bool { return cursorAt(database.DB(), "central") })
+	e.Stop()
+
+	up.mu.Lock()
+	if up.requests != 2 || up.tenants[0] != database.DefaultTenant {
+		t.Errorf("Expected one failed and one accepted request for the default tenant, got %d requests, tenants %v", up.requests, up.tenants)
+	}
+	up.mu.Unlock()
+
+	// Data stored while the exporter is down is sent after a restart
+	insertLogs(t, "three")
+	e, err = New(opts, tenants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Start(); err != nil {
+		t.Fatal(err)
+	}
+	e.Notify(database.SignalLogs)
+	waitFor(t, "the record stored during downtime", func() bool { return len(up.received()) == 3 })
+	waitFor(t, "the cursor", func() bool { return cursorAt(database.DB(), "central") })
+	e.Stop()
+	if got := up.received(); got[2] != "three" {
+		t.Errorf("Expected only the new record to be resent, got %v", got)
+	}
+
+	// A new exporter starting at the latest record skips existing data
+	cursorBefore, _, _ := database.ExportCursor(database.DB(), "late", database.SignalLogs)
+	late, err := New(Options{Name: "late", ClientOptions: ClientOptions{Endpoint: srv.URL}, StartAt: StartAtLatest}, tenants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := late.Start(); err != nil {
+		t.Fatal(err)
+	}
+	late.Stop()
+	cursor, ok, err := database.ExportCursor(database.DB(), "late", database.SignalLogs)
+	if err != nil || !ok || cursor <= cursorBefore {
+		t.Errorf("Expected the new exporter to start at the last record, got cursor %d (%v, %v)", cursor, ok, err)
+	}
+}
+
+func TestFailingTenantDoesNotBlockOthers(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := database.InitDB(filepath.Join(tmpDir, "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+	tenants := database.NewTenantManager(filepath.Join(tmpDir, "tenants"), 4)
+	defer tenants.Close()
+
+	// The default tenant is exported first and its upstream never accepts
+	up := &upstream{down: database.DefaultTenant}
+	srv := httptest.NewServer(up)
+	defer srv.Close()
+
+	insertLogs(t, "stuck")
+	insertAcme := func(body string) {
+		t.Helper()
+		conn, release, err := tenants.Acquire("acme")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+		err = database.InsertLogsDataInto(conn, map[string]interface{}{"resourceLogs": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{},
+			"scopeLogs": []interface{}{map[string]interface{}{"logRecords": []interface{}{
+				map[string]interface{}{"body": map[string]interface{}{"stringValue": body}},
+			}}},
+		}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	insertAcme("first")
+
+	e, err := New(Options{
+		Name:          "central",
+		ClientOptions: ClientOptions{Endpoint: srv.URL, Encoding: EncodingJSON},
+		Signals:       []string{database.SignalLogs},
+		TenantHeader:  "X-Tenant",
+		PollInterval:  20 * time.Millisecond,
+		StartAt:       StartAtOldest,
+	}, tenants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Stop()
+	waitFor(t, "the healthy tenant's record", func() bool { return len(up.received()) == 1 })
+
+	// Later data of the healthy tenant is not held back by the failing one
+	insertAcme("second")
+	e.Notify(database.SignalLogs)
+	waitFor(t, "the healthy tenant's second record", func() bool { return len(up.received()) == 2 })
+	if got := up.received(); got[0] != "first" || got[1] != "second" {
+		t.Errorf("Expected only acme's records, got %v", got)
+	}
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{Name: "", ClientOptions: ClientOptions{Endpoint: "http://localhost:4318"}},
+		{Name: "x", ClientOptions: ClientOptions{Endpoint: "localhost:4318"}},
+		{Name: "x", ClientOptions: ClientOptions{Endpoint: "http://localhost:4318", Encoding: "xml"}},
+		{Name: "x", ClientOptions: ClientOptions{Endpoint: "http://localhost:4318"}, Signals: []string{"profiles"}},
+		{Name: "x", ClientOptions: ClientOptions{Endpoint: "http://localhost:4318"}, StartAt: "yesterday"},
+	} {
+		if _, err := New(opts, nil); err == nil {
+			t.Errorf("Expected options %+v to be rejected", opts)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package exporter
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+// WriteJSONLines writes the records matching opts as newline-delimited OTLP
+// JSON: one ExportTraceServiceRequest, ExportMetricsServiceRequest or
+// ExportLogsServiceRequest of up to opts.Limit records per line, the format
+// of the OpenTelemetry Collector's file exporter and receiver. write is
+// called with each line including its newline. It returns the number of
+// records written per signal.
+func WriteJSONLines(ctx context.Context, conn *sql.DB, signals []string, opts database.ReadOptions, write func(signal string, line []byte) error) (map[string]int64, error) {
+	written := make(map[string]int64, len(signals))
+	for _, signal := range signals {
+		read := opts
+		for {
+			if err := ctx.Err(); err != nil {
+				return written, err
+			}
+			batch, err := database.ReadBatch(conn, signal, read)
+			if err != nil {
+				return written, err
+			}
+			if batch.Records == 0 {
+				break
+			}
+			line, err := json.Marshal(batch.Payload)
+			if err != nil {
+				return written, fmt.Errorf("failed to encode %s: %w", signal, err)
+			}
+			if err := write(signal, append(line, '\n')); err != nil {
+				return written, err
+			}
+			written[signal] += int64(batch.Records)
+			read.AfterID = batch.LastID
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,46 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+func TestWriteJSONLines(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+	insertLogs(t, "one", "two", "three")
+
+	var out bytes.Buffer
+	signals := map[string]int{}
+	written, err := WriteJSONLines(context.Background(), database.DB(), database.Signals, database.ReadOptions{Limit: 2},
+		func(signal string, line []byte) error {
+			signals[signal]++
+			out.Write(line)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written[database.SignalLogs] != 3 || written[database.SignalTraces] != 0 || signals[database.SignalLogs] != 2 {
+		t.Fatalf("Expected 3 log records on 2 lines, got %v on %v", written, signals)
+	}
+
+	// Each line is a complete export request
+	dec := json.NewDecoder(&out)
+	for i := 0; i < 2; i++ {
+		var req map[string][]interface{}
+		if err := dec.Decode(&req); err != nil || len(req["resourceLogs"]) != 1 {
+			t.Errorf("Line %d is not an ExportLogsServiceRequest: %v, %v", i, req, err)
+		}
+	}
+	if dec.More() {
+		t.Error("Expected exactly 2 lines")
+	}
+}
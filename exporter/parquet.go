@@ -0,0 +1,194 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/parquet"
+)
+
+// ParquetOptions configures WriteParquet
+type ParquetOptions struct {
+	Read         database.ReadOptions // Records to write; Limit is the rows read per query
+	Compression  string               // parquet.CompressionGzip (default) or parquet.CompressionNone
+	RowGroupSize int                  // Rows per row group (default: parquet.DefaultRowGroupSize)
+	UpToIDs      map[string]int64     // Per-signal Read.UpToID, overriding it where set
+}
+
+// parquetTypes maps archive column types to Parquet column types
+var parquetTypes = map[string]parquet.Type{
+	database.ColumnInt:  parquet.Int64,
+	database.ColumnReal: parquet.Double,
+	database.ColumnText: parquet.String,
+	database.ColumnTime: parquet.Timestamp,
+}
+
+// parquetFile is an output file being written under a temporary name
+type parquetFile struct {
+	path string
+	tmp  string
+	f    *os.File
+	buf  *bufio.Writer
+	w    *parquet.Writer
+}
+
+// WriteParquet writes the records matching opts to Parquet files under
+// dir, one per table and UTC day as <table>/date=YYYY-MM-DD/<name>.parquet.
+// Each row holds a span, log record or data point with its resource and
+// scope. Files appear under their final name only once every signal is
+// complete, so a failed run leaves none behind. It returns the number of
+// records written per signal and the files created.
+func WriteParquet(ctx context.Context, conn *sql.DB, dir string, signals []string, opts ParquetOptions) (map[string]int64, []string, error) {
+	written := make(map[string]int64, len(signals))
+	var pending []*parquetFile
+	abort := func(err error) (map[string]int64, []string, error) {
+		for _, pf := range pending {
+			pf.f.Close()
+			os.Remove(pf.tmp)
+		}
+		return make(map[string]int64), nil, err
+	}
+
+	name := "sqlite-otel-" + time.Now().UTC().Format("20060102T150405Z")
+	for _, signal := range signals {
+		files, n, err := writeParquetSignal(ctx, conn, dir, name, signal, opts)
+		pending = append(pending, files...)
+		if err != nil {
+			return abort(err)
+		}
+		written[signal] = n
+	}
+
+	paths := make([]string, 0, len(pending))
+	for len(pending) > 0 {
+		pf := pending[0]
+		pending = pending[1:]
+		if err := pf.finish(); err != nil {
+			for _, path := range paths {
+				os.Remove(path)
+			}
+			return abort(err)
+		}
+		paths = append(paths, pf.path)
+	}
+	return written, paths, nil
+}
+
+// writeParquetSignal writes the records of one signal to temporary files,
+// one per UTC day, and returns them for WriteParquet to finish
+func writeParquetSignal(ctx context.Context, conn *sql.DB, dir, name, signal string, opts ParquetOptions) ([]*parquetFile, int64, error) {
+	var columns []parquet.Column
+	for _, c := range database.ArchiveColumns(signal) {
+		columns = append(columns, parquet.Column{Name: c.Name, Type: parquetTypes[c.Type]})
+	}
+	if columns == nil {
+		return nil, 0, fmt.Errorf("unknown signal '%s'", signal)
+	}
+	table := database.ArchiveTable(signal)
+
+	open := make(map[string]*parquetFile)
+	var n int64
+	files := func() []*parquetFile {
+		dates := make([]string, 0, len(open))
+		for date := range open {
+			dates = append(dates, date)
+		}
+		sort.Strings(dates)
+		list := make([]*parquetFile, 0, len(dates))
+		for _, date := range dates {
+			list = append(list, open[date])
+		}
+		return list
+	}
+
+	read := opts.Read
+	if id, ok := opts.UpToIDs[signal]; ok {
+		read.UpToID = id
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return files(), n, err
+		}
+		batch, err := database.ReadArchive(conn, signal, read)
+		if err != nil {
+			return files(), n, err
+		}
+		if len(batch.Rows) == 0 {
+			break
+		}
+		for _, row := range batch.Rows {
+			date := time.Unix(0, row.Time).UTC().Format("2006-01-02")
+			pf, ok := open[date]
+			if !ok {
+				path := filepath.Join(dir, table, "date="+date, name+".parquet")
+				if pf, err = createParquetFile(path, columns, opts); err != nil {
+					return files(), n, err
+				}
+				open[date] = pf
+			}
+			if err := pf.w.Write(row.Values); err != nil {
+				return files(), n, fmt.Errorf("failed to write %s: %w", pf.path, err)
+			}
+			n++
+		}
+		read.AfterID = batch.LastID
+	}
+	return files(), n, nil
+}
+
+// createParquetFile starts a file that finish moves to path, or to a
+// numbered name next to it when path exists
+func createParquetFile(path string, columns []parquet.Column, opts ParquetOptions) (*parquetFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	base := path[:len(path)-len(".parquet")]
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		path = fmt.Sprintf("%s-%d.parquet", base, i)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".*.parquet.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive file: %w", err)
+	}
+	pf := &parquetFile{path: path, tmp: f.Name(), f: f, buf: bufio.NewWriter(f)}
+	pf.w, err = parquet.NewWriter(pf.buf, columns, parquet.Options{Compression: opts.Compression, RowGroupSize: opts.RowGroupSize})
+	if err != nil {
+		f.Close()
+		os.Remove(pf.tmp)
+		return nil, err
+	}
+	return pf, nil
+}
+
+// finish writes the footer, syncs the file and gives it its final name
+func (pf *parquetFile) finish() error {
+	err := pf.w.Close()
+	if err == nil {
+		err = pf.buf.Flush()
+	}
+	if err == nil {
+		err = pf.f.Sync()
+	}
+	if closeErr := pf.f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(pf.tmp, pf.path)
+	}
+	if err != nil {
+		os.Remove(pf.tmp)
+		return fmt.Errorf("failed to write %s: %w", pf.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+func TestWriteParquetPartitionsByDay(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+	var records []interface{}
+	for _, at := range []string{"2026-01-01T23:59:59Z", "2026-01-02T00:00:00Z", "2026-01-02T12:00:00Z"} {
+		ts, _ := time.Parse(time.RFC3339, at)
+		records = append(records, map[string]interface{}{
+			"timeUnixNano": strconv.FormatInt(ts.UnixNano(), 10),
+			"body":         map[string]interface{}{"stringValue": at},
+		})
+	}
+	err := database.InsertLogsData(map[string]interface{}{"resourceLogs": []interface{}{map[string]interface{}{
+		"resource":  map[string]interface{}{},
+		"scopeLogs": []interface{}{map[string]interface{}{"logRecords": records}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	written, paths, err := WriteParquet(context.Background(), database.DB(), dir, database.Signals,
+		ParquetOptions{Read: database.ReadOptions{Limit: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written[database.SignalLogs] != 3 || written[database.SignalTraces] != 0 || len(paths) != 2 {
+		t.Fatalf("Expected 3 log records in 2 files, got %v in %v", written, paths)
+	}
+	for i, date := range []string{"2026-01-01", "2026-01-02"} {
+		if want := filepath.Join(dir, "log_records", "date="+date); filepath.Dir(paths[i]) != want {
+			t.Errorf("Expected file %d under %s, got %s", i, want, paths[i])
+		}
+		data, err := os.ReadFile(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+			t.Errorf("%s is not a Parquet file", paths[i])
+		}
+	}
+
+	// A second run never replaces earlier files, and no temporary files
+	// are left behind
+	_, again, err := WriteParquet(context.Background(), database.DB(), dir, []string{database.SignalLogs}, ParquetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "log_records", "*", "*"))
+	if len(again) != 2 || again[0] == paths[0] || len(matches) != 4 {
+		t.Errorf("Expected 4 distinct files, got %v", matches)
+	}
+}
+
+func TestWriteParquetLeavesNoFilesOnFailure(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+	err := database.InsertLogsData(map[string]interface{}{"resourceLogs": []interface{}{map[string]interface{}{
+		"resource": map[string]interface{}{},
+		"scopeLogs": []interface{}{map[string]interface{}{"logRecords": []interface{}{
+			map[string]interface{}{"timeUnixNano": strconv.FormatInt(time.Now().UnixNano(), 10)},
+		}}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Logs are written before the second signal fails, and must not be
+	// left behind to be archived twice by a retry
+	dir := t.TempDir()
+	written, paths, err := WriteParquet(context.Background(), database.DB(), dir, []string{database.SignalLogs, "profiles"}, ParquetOptions{})
+	if err == nil {
+		t.Fatal("Expected an unknown signal to fail")
+	}
+	if written[database.SignalLogs] != 0 || len(paths) != 0 {
+		t.Errorf("Expected nothing reported written, got %v in %v", written, paths)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "log_records", "*", "*"))
+	if len(matches) != 0 {
+		t.Errorf("Expected no files after a failed run, got %v", matches)
+	}
+}
@@ -0,0 +1,445 @@
+package exporter
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Protobuf wire encodings of OTLP fields
+type fieldKind int
+
+const (
+	kindMessage  fieldKind = iota
+	kindString             // string
+	kindID                 // trace or span ID, hex in JSON and bytes on the wire
+	kindBytes              // bytes, base64 in JSON
+	kindBool               // bool
+	kindVarint             // int32, int64, uint32, uint64 and enums
+	kindSint32             // zigzag encoded sint32
+	kindFixed32            // fixed32
+	kindFixed64            // fixed64, a decimal string in JSON
+	kindSfixed64           // sfixed64, a decimal string in JSON
+	kindDouble             // double
+)
+
+// protoField maps a JSON field name to its protobuf field number and kind
+type protoField struct {
+	name string
+	num  int
+	kind fieldKind
+	msg  *protoMessage
+}
+
+// protoMessage lists the fields of a message in field number order
+type protoMessage struct {
+	fields []protoField
+}
+
+func message(fields ...protoField) *protoMessage {
+	return &protoMessage{fields: fields}
+}
+
+func scalar(name string, num int, kind fieldKind) protoField {
+	return protoField{name: name, num: num, kind: kind}
+}
+
+func nested(name string, num int, msg *protoMessage) protoField {
+	return protoField{name: name, num: num, kind: kindMessage, msg: msg}
+}
+
+// OTLP export request messages, from opentelemetry-proto v1
+var (
+	traceRequest   *protoMessage
+	metricsRequest *protoMessage
+	logsRequest    *protoMessage
+)
+
+func init() {
+	anyValue := &protoMessage{}
+	keyValue := message(scalar("key", 1, kindString), nested("value", 2, anyValue))
+	arrayValue := message(nested("values", 1, anyValue))
+	keyValueList := message(nested("values", 1, keyValue))
+	anyValue.fields = []protoField{
+		scalar("stringValue", 1, kindString),
+		scalar("boolValue", 2, kindBool),
+		scalar("intValue", 3, kindVarint),
+		scalar("doubleValue", 4, kindDouble),
+		nested("arrayValue", 5, arrayValue),
+		nested("kvlistValue", 6, keyValueList),
+		scalar("bytesValue", 7, kindBytes),
+	}
+	resource := message(
+		nested("attributes", 1, keyValue),
+		scalar("droppedAttributesCount", 2, kindVarint),
+	)
+	scope := message(
+		scalar("name", 1, kindString),
+		scalar("version", 2, kindString),
+		nested("attributes", 3, keyValue),
+		scalar("droppedAttributesCount", 4, kindVarint),
+	)
+	// envelope builds the Resource* and Scope* wrappers around the records
+	envelope := func(resourceKey, scopeKey, itemsKey string, item *protoMessage) *protoMessage {
+		scoped := message(nested("scope", 1, scope), nested(itemsKey, 2, item), scalar("schemaUrl", 3, kindString))
+		resourced := message(nested("resource", 1, resource), nested(scopeKey, 2, scoped), scalar("schemaUrl", 3, kindString))
+		return message(nested(resourceKey, 1, resourced))
+	}
+
+	event := message(
+		scalar("timeUnixNano", 1, kindFixed64),
+		scalar("name", 2, kindString),
+		nested("attributes", 3, keyValue),
+		scalar("droppedAttributesCount", 4, kindVarint),
+	)
+	link := message(
+		scalar("traceId", 1, kindID),
+		scalar("spanId", 2, kindID),
+		scalar("traceState", 3, kindString),
+		nested("attributes", 4, keyValue),
+		scalar("droppedAttributesCount", 5, kindVarint),
+		scalar("flags", 6, kindFixed32),
+	)
+	status := message(scalar("message", 2, kindString), scalar("code", 3, kindVarint))
+	span := message(
+		scalar("traceId", 1, kindID),
+		scalar("spanId", 2, kindID),
+		scalar("traceState", 3, kindString),
+		scalar("parentSpanId", 4, kindID),
+		scalar("name", 5, kindString),
+		scalar("kind", 6, kindVarint),
+		scalar("startTimeUnixNano", 7, kindFixed64),
+		scalar("endTimeUnixNano", 8, kindFixed64),
+		nested("attributes", 9, keyValue),
+		scalar("droppedAttributesCount", 10, kindVarint),
+		nested("events", 11, event),
+		scalar("droppedEventsCount", 12, kindVarint),
+		nested("links", 13, link),
+		scalar("droppedLinksCount", 14, kindVarint),
+		nested("status", 15, status),
+		scalar("flags", 16, kindFixed32),
+	)
+	traceRequest = envelope("resourceSpans", "scopeSpans", "spans", span)
+
+	logRecord := message(
+		scalar("timeUnixNano", 1, kindFixed64),
+		scalar("severityNumber", 2, kindVarint),
+		scalar("severityText", 3, kindString),
+		nested("body", 5, anyValue),
+		nested("attributes", 6, keyValue),
+		scalar("droppedAttributesCount", 7, kindVarint),
+		scalar("flags", 8, kindFixed32),
+		scalar("traceId", 9, kindID),
+		scalar("spanId", 10, kindID),
+		scalar("observedTimeUnixNano", 11, kindFixed64),
+		scalar("eventName", 12, kindString),
+	)
+	logsRequest = envelope("resourceLogs", "scopeLogs", "logRecords", logRecord)
+
+	exemplar := message(
+		scalar("timeUnixNano", 2, kindFixed64),
+		scalar("asDouble", 3, kindDouble),
+		scalar("spanId", 4, kindID),
+		scalar("traceId", 5, kindID),
+		scalar("asInt", 6, kindSfixed64),
+		nested("filteredAttributes", 7, keyValue),
+	)
+	numberPoint := message(
+		scalar("startTimeUnixNano", 2, kindFixed64),
+		scalar("timeUnixNano", 3, kindFixed64),
+		scalar("asDouble", 4, kindDouble),
+		nested("exemplars", 5, exemplar),
+		scalar("asInt", 6, kindSfixed64),
+		nested("attributes", 7, keyValue),
+		scalar("flags", 8, kindVarint),
+	)
+	histogramPoint := message(
+		scalar("startTimeUnixNano", 2, kindFixed64),
+		scalar("timeUnixNano", 3, kindFixed64),
+		scalar("count", 4, kindFixed64),
+		scalar("sum", 5, kindDouble),
+		scalar("bucketCounts", 6, kindFixed64),
+		scalar("explicitBounds", 7, kindDouble),
+		nested("exemplars", 8, exemplar),
+		nested("attributes", 9, keyValue),
+		scalar("flags", 10, kindVarint),
+		scalar("min", 11, kindDouble),
+		scalar("max", 12, kindDouble),
+	)
+	buckets := message(scalar("offset", 1, kindSint32), scalar("bucketCounts", 2, kindVarint))
+	expHistogramPoint := message(
+		nested("attributes", 1, keyValue),
+		scalar("startTimeUnixNano", 2, kindFixed64),
+		scalar("timeUnixNano", 3, kindFixed64),
+		scalar("count", 4, kindFixed64),
+		scalar("sum", 5, kindDouble),
+		scalar("scale", 6, kindSint32),
+		scalar("zeroCount", 7, kindFixed64),
+		nested("positive", 8, buckets),
+		nested("negative", 9, buckets),
+		scalar("flags", 10, kindVarint),
+		nested("exemplars", 11, exemplar),
+		scalar("min", 12, kindDouble),
+		scalar("max", 13, kindDouble),
+		scalar("zeroThreshold", 14, kindDouble),
+	)
+	quantile := message(scalar("quantile", 1, kindDouble), scalar("value", 2, kindDouble))
+	summaryPoint := message(
+		scalar("startTimeUnixNano", 2, kindFixed64),
+		scalar("timeUnixNano", 3, kindFixed64),
+		scalar("count", 4, kindFixed64),
+		scalar("sum", 5, kindDouble),
+		nested("quantileValues", 6, quantile),
+		nested("attributes", 7, keyValue),
+		scalar("flags", 8, kindVarint),
+	)
+	metric := message(
+		scalar("name", 1, kindString),
+		scalar("description", 2, kindString),
+		scalar("unit", 3, kindString),
+		nested("gauge", 5, message(nested("dataPoints", 1, numberPoint))),
+		nested("sum", 7, message(
+			nested("dataPoints", 1, numberPoint),
+			scalar("aggregationTemporality", 2, kindVarint),
+			scalar("isMonotonic", 3, kindBool),
+		)),
+		nested("histogram", 9, message(
+			nested("dataPoints", 1, histogramPoint),
+			scalar("aggregationTemporality", 2, kindVarint),
+		)),
+		nested("exponentialHistogram", 10, message(
+			nested("dataPoints", 1, expHistogramPoint),
+			scalar("aggregationTemporality", 2, kindVarint),
+		)),
+		nested("summary", 11, message(nested("dataPoints", 1, summaryPoint))),
+		nested("metadata", 12, keyValue),
+	)
+	metricsRequest = envelope("resourceMetrics", "scopeMetrics", "metrics", metric)
+}
+
+// requestMessage returns the export request message of a signal
+func requestMessage(signal string) (*protoMessage, error) {
+	switch signal {
+	case "traces":
+		return traceRequest, nil
+	case "metrics":
+		return metricsRequest, nil
+	case "logs":
+		return logsRequest, nil
+	}
+	return nil, fmt.Errorf("unknown signal '%s'", signal)
+}
+
+// EncodeProto converts an export request in OTLP JSON form to the
+// protobuf encoding. Unknown fields are skipped.
+func EncodeProto(signal string, payload map[string]interface{}) ([]byte, error) {
+	msg, err := requestMessage(signal)
+	if err != nil {
+		return nil, err
+	}
+	return msg.append(nil, payload)
+}
+
+// append encodes the fields of m found in data
+func (m *protoMessage) append(buf []byte, data map[string]interface{}) ([]byte, error) {
+	var err error
+	for _, f := range m.fields {
+		v, ok := data[f.name]
+		if !ok || v == nil {
+			continue
+		}
+		if buf, err = f.append(buf, v); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return buf, nil
+}
+
+// append encodes one field. Repeated messages are written as one field per
+// element and repeated numbers as a packed field.
+func (f protoField) append(buf []byte, v interface{}) ([]byte, error) {
+	list, repeated := v.([]interface{})
+	if f.kind == kindMessage {
+		if !repeated {
+			list = []interface{}{v}
+		}
+		for _, item := range list {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("expected an object, got %T", item)
+			}
+			inner, err := f.msg.append(nil, obj)
+			if err != nil {
+				return nil, err
+			}
+			buf = appendTag(buf, f.num, 2)
+			buf = appendVarint(buf, uint64(len(inner)))
+			buf = append(buf, inner...)
+		}
+		return buf, nil
+	}
+
+	if repeated {
+		var packed []byte
+		for _, item := range list {
+			var err error
+			if packed, err = appendScalar(packed, f.kind, item); err != nil {
+				return nil, err
+			}
+		}
+		buf = appendTag(buf, f.num, 2)
+		buf = appendVarint(buf, uint64(len(packed)))
+		return append(buf, packed...), nil
+	}
+
+	buf = appendTag(buf, f.num, wireType(f.kind))
+	return appendScalar(buf, f.kind, v)
+}
+
+// wireType returns the protobuf wire type of a scalar kind
+func wireType(kind fieldKind) int {
+	switch kind {
+	case kindBool, kindVarint, kindSint32:
+		return 0
+	case kindFixed64, kindSfixed64, kindDouble:
+		return 1
+	case kindFixed32:
+		return 5
+	}
+	return 2
+}
+
+// appendScalar encodes a scalar value without its tag
+func appendScalar(buf []byte, kind fieldKind, v interface{}) ([]byte, error) {
+	switch kind {
+	case kindString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string, got %T", v)
+		}
+		return appendBytes(buf, []byte(s)), nil
+	case kindID:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a hex ID, got %T", v)
+		}
+		id, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex ID '%s'", s)
+		}
+		return appendBytes(buf, id), nil
+	case kindBytes:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected base64 bytes, got %T", v)
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 value: %w", err)
+		}
+		return appendBytes(buf, b), nil
+	case kindBool:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected a bool, got %T", v)
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case kindDouble:
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f)), nil
+	}
+
+	n, err := toInt(v)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case kindSint32:
+		return appendVarint(buf, uint64(uint32((int32(n)<<1)^(int32(n)>>31)))), nil
+	case kindFixed32:
+		return binary.LittleEndian.AppendUint32(buf, uint32(n)), nil
+	case kindFixed64, kindSfixed64:
+		return binary.LittleEndian.AppendUint64(buf, uint64(n)), nil
+	}
+	return appendVarint(buf, uint64(n)), nil
+}
+
+// toInt converts a JSON number or decimal string to an integer. Unsigned
+// 64-bit values above MaxInt64 keep their bit pattern.
+func toInt(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case float64:
+		return int64(n), nil
+	case int:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case json.Number:
+		return parseInt(string(n))
+	case string:
+		return parseInt(n)
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
+
+func parseInt(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	u, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer '%s'", s)
+	}
+	return int64(u), nil
+}
+
+// toFloat converts a JSON number or string, including "NaN" and
+// "Infinity", to a float
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case json.Number:
+		return n.Float64()
+	case string:
+		switch n {
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		}
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number '%s'", n)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
+
+func appendTag(buf []byte, num, wire int) []byte {
+	return appendVarint(buf, uint64(num)<<3|uint64(wire))
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	return binary.AppendUvarint(buf, v)
+}
+
+func appendBytes(buf, b []byte) []byte {
+	buf = appendVarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
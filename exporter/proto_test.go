@@ -0,0 +1,59 @@
+package exporter
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestEncodeProto(t *testing.T) {
+	payload := map[string]interface{}{"resourceSpans": []interface{}{map[string]interface{}{
+		"resource": map[string]interface{}{"attributes": []interface{}{
+			map[string]interface{}{"key": "a", "value": map[string]interface{}{"stringValue": "b"}},
+		}},
+		"scopeSpans": []interface{}{map[string]interface{}{
+			"spans": []interface{}{map[string]interface{}{
+				"traceId": "01", "spanId": "02", "kind": float64(2), "startTimeUnixNano": "1",
+				"unknownField": "ignored",
+			}},
+		}},
+	}}}
+
+	got, err := EncodeProto("traces", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	span := "0a0101" + "120102" + "3002" + "390100000000000000"
+	scopeSpans := "1211" + span
+	resource := "0a08" + "0a0161" + "1203" + "0a0162"
+	want := "0a21" + "0a0a" + resource + "1213" + scopeSpans
+	if hex.EncodeToString(got) != want {
+		t.Errorf("Unexpected encoding\n got %x\nwant %s", got, want)
+	}
+
+	// Repeated numbers are packed
+	metrics := map[string]interface{}{"resourceMetrics": []interface{}{map[string]interface{}{
+		"scopeMetrics": []interface{}{map[string]interface{}{
+			"metrics": []interface{}{map[string]interface{}{
+				"name": "h",
+				"histogram": map[string]interface{}{"dataPoints": []interface{}{map[string]interface{}{
+					"explicitBounds": []interface{}{1.0}, "bucketCounts": []interface{}{"1", "2"},
+				}}},
+			}},
+		}},
+	}}}
+	got, err = EncodeProto("metrics", metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucketCounts := "3210" + "0100000000000000" + "0200000000000000"
+	if !strings.Contains(hex.EncodeToString(got), bucketCounts) {
+		t.Errorf("Expected packed bucket counts %s in %x", bucketCounts, got)
+	}
+
+	if _, err := EncodeProto("traces", map[string]interface{}{"resourceSpans": []interface{}{map[string]interface{}{
+		"scopeSpans": []interface{}{map[string]interface{}{"spans": []interface{}{map[string]interface{}{"traceId": "xyz"}}}},
+	}}}); err == nil {
+		t.Error("Expected an invalid trace ID to fail")
+	}
+}
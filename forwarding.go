@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/config"
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/exporter"
+	"github.com/RedShiftVelocity/sqlite-otel/handlers"
+)
+
+// forwardExporterName is the name of the exporter created by -forward-endpoint
+const forwardExporterName = "forward"
+
+// exporterOptions combines the -forward-endpoint shortcut with the
+// exporters of the configuration file
+func exporterOptions(opts *serverOptions, cfg *config.Config) ([]exporter.Options, error) {
+	var list []exporter.Options
+	if opts.forwardEndpoint != "" {
+		list = append(list, exporter.Options{
+			Name:          forwardExporterName,
+			ClientOptions: exporter.ClientOptions{Endpoint: opts.forwardEndpoint, Encoding: opts.forwardEncoding},
+		})
+	}
+
+	duration := func(d *config.Duration) time.Duration {
+		if d == nil {
+			return 0
+		}
+		return time.Duration(*d)
+	}
+	for _, ec := range cfg.Exporters {
+		list = append(list, exporter.Options{
+			Name: ec.Name,
+			ClientOptions: exporter.ClientOptions{
+				Endpoint:    ec.Endpoint,
+				Encoding:    ec.Encoding,
+				Compression: ec.Compression,
+				Headers:     ec.Headers,
+				Timeout:     duration(ec.Timeout),
+			},
+			Signals:      ec.Signals,
+			TenantHeader: ec.TenantHeader,
+			BatchSize:    ec.BatchSize,
+			BatchDelay:   duration(ec.BatchDelay),
+			PollInterval: duration(ec.PollInterval),
+			MaxBackoff:   duration(ec.MaxBackoff),
+			StartAt:      ec.StartAt,
+		})
+	}
+
+	seen := make(map[string]bool, len(list))
+	for _, o := range list {
+		if seen[o.Name] {
+			return nil, fmt.Errorf("exporter name '%s' is used more than once", o.Name)
+		}
+		seen[o.Name] = true
+	}
+	return list, nil
+}
+
+// startExporters starts an exporter for each option set and wakes them
+// whenever telemetry is committed. The returned function stops them all.
+func startExporters(list []exporter.Options, tenants *database.TenantManager) (func(), error) {
+	var exporters []*exporter.Exporter
+	stop := func() {
+		for _, e := range exporters {
+			e.Stop()
+		}
+	}
+	for _, o := range list {
+		e, err := exporter.New(o, tenants)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		if err := e.Start(); err != nil {
+			stop()
+			return nil, err
+		}
+		exporters = append(exporters, e)
+	}
+	if len(exporters) == 0 {
+		return func() {}, nil
+	}
+
+	removeHook := handlers.AddCommitHook(func(_, signal string, _ map[string]interface{}) {
+		for _, e := range exporters {
+			e.Notify(signal)
+		}
+	})
+	return func() {
+		removeHook()
+		stop()
+	}, nil
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+)
+
+// parseTimeParam parses a time bound given as RFC 3339, Unix nanoseconds or
+// a duration relative to now (e.g. "15m" meaning 15 minutes ago)
+func parseTimeParam(value string, now time.Time) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if nanos, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return nanos, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.UnixNano(), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d).UnixNano(), nil
+	}
+	return 0, fmt.Errorf("invalid time '%s': expected RFC 3339, Unix nanoseconds or a duration", value)
+}
+
+// queryParams holds the parameters shared by all query endpoints
+type queryParams struct {
+	service string
+	since   int64
+	until   int64
+	limit   int
+}
+
+// parseQueryParams parses the common query string parameters
+func parseQueryParams(r *http.Request) (queryParams, error) {
+	values := r.URL.Query()
+	now := time.Now()
+
+	var p queryParams
+	var err error
+	p.service = values.Get("service")
+	if p.since, err = parseTimeParam(values.Get("since"), now); err != nil {
+		return p, err
+	}
+	if p.until, err = parseTimeParam(values.Get("until"), now); err != nil {
+		return p, err
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if p.limit, err = strconv.Atoi(limit); err != nil || p.limit < 0 {
+			return p, fmt.Errorf("invalid limit '%s'", limit)
+		}
+	}
+	return p, nil
+}
+
+// serveQuery runs a tenant-scoped read query and writes the JSON response
+func serveQuery(w http.ResponseWriter, r *http.Request, query func(conn *sql.DB) (interface{}, error)) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var response map[string]interface{}
+	err := withTenantDB(r, func(tenant string, conn *sql.DB) error {
+		data, err := query(conn)
+		if err != nil {
+			return err
+		}
+		response = map[string]interface{}{"tenant": tenant, "data": data}
+		return nil
+	})
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// queryError writes the response for a failed tenant-scoped read
+func queryError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errInvalidTenant) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errUnknownTenant) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errForbiddenTenant) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	logging.Slog().Error("Query failed", "path", r.URL.Path, "client", clientIP(r), "error", err)
+	http.Error(w, "Query failed", http.StatusInternalServerError)
+}
+
+// HandleQuerySpans serves GET /api/v1/spans
+func HandleQuerySpans(w http.ResponseWriter, r *http.Request) {
+	p, err := parseQueryParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	values := r.URL.Query()
+	serveQuery(w, r, func(conn *sql.DB) (interface{}, error) {
+		return database.QuerySpans(conn, database.SpanQuery{
+			TraceID: values.Get("trace_id"),
+			Service: p.service,
+			Name:    values.Get("name"),
+			Since:   p.since,
+			Until:   p.until,
+			Limit:   p.limit,
+		})
+	})
+}
+
+// HandleQueryLogs serves GET /api/v1/logs
+func HandleQueryLogs(w http.ResponseWriter, r *http.Request) {
+	p, err := parseQueryParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	values := r.URL.Query()
+	var minSeverity int64
+	if s := values.Get("min_severity"); s != "" {
+		if minSeverity, err = strconv.ParseInt(s, 10, 64); err != nil {
+			http.Error(w, fmt.Sprintf("invalid min_severity '%s'", s), http.StatusBadRequest)
+			return
+		}
+	}
+	serveQuery(w, r, func(conn *sql.DB) (interface{}, error) {
+		return database.QueryLogs(conn, database.LogQuery{
+			TraceID:     values.Get("trace_id"),
+			Service:     p.service,
+			MinSeverity: minSeverity,
+			Search:      values.Get("search"),
+			Since:       p.since,
+			Until:       p.until,
+			Limit:       p.limit,
+		})
+	})
+}
+
+// HandleQueryMetrics serves GET /api/v1/metrics
+func HandleQueryMetrics(w http.ResponseWriter, r *http.Request) {
+	p, err := parseQueryParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	values := r.URL.Query()
+	serveQuery(w, r, func(conn *sql.DB) (interface{}, error) {
+		return database.QueryMetricPoints(conn, database.MetricQuery{
+			Name:    values.Get("name"),
+			Service: p.service,
+			Since:   p.since,
+			Until:   p.until,
+			Limit:   p.limit,
+		})
+	})
+}
+
+// HandleQueryTraces serves GET /api/v1/traces
+func HandleQueryTraces(w http.ResponseWriter, r *http.Request) {
+	p, err := parseQueryParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	values := r.URL.Query()
+	var minDuration time.Duration
+	if s := values.Get("min_duration"); s != "" {
+		if minDuration, err = time.ParseDuration(s); err != nil || minDuration < 0 {
+			http.Error(w, fmt.Sprintf("invalid min_duration '%s'", s), http.StatusBadRequest)
+			return
+		}
+	}
+	errorsOnly := false
+	if s := values.Get("errors"); s != "" {
+		if errorsOnly, err = strconv.ParseBool(s); err != nil {
+			http.Error(w, fmt.Sprintf("invalid errors '%s'", s), http.StatusBadRequest)
+			return
+		}
+	}
+	serveQuery(w, r, func(conn *sql.DB) (interface{}, error) {
+		return database.QueryTraces(conn, database.TraceQuery{
+			Service:     p.service,
+			Name:        values.Get("name"),
+			Since:       p.since,
+			Until:       p.until,
+			MinDuration: int64(minDuration),
+			ErrorsOnly:  errorsOnly,
+			Limit:       p.limit,
+		})
+	})
+}
+
+// HandleQueryServices serves GET /api/v1/services
+func HandleQueryServices(w http.ResponseWriter, r *http.Request) {
+	serveQuery(w, r, func(conn *sql.DB) (interface{}, error) {
+		return database.QueryServices(conn)
+	})
+}
+
+// HandleQueryMetricNames serves GET /api/v1/metric-names
+func HandleQueryMetricNames(w http.ResponseWriter, r *http.Request) {
+	service := r.URL.Query().Get("service")
+	serveQuery(w, r, func(conn *sql.DB) (interface{}, error) {
+		return database.QueryMetricNames(conn, service)
+	})
+}
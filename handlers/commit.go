@@ -0,0 +1,45 @@
+package handlers
+
+import "sync"
+
+// CommitHook is called after a payload has been committed to a tenant's
+// database. The payload is shared and must not be modified.
+type CommitHook func(tenant, signal string, data map[string]interface{})
+
+type commitHookEntry struct {
+	fn CommitHook
+}
+
+var (
+	commitHooksMu sync.RWMutex
+	commitHooks   []*commitHookEntry
+)
+
+// AddCommitHook registers fn to run after every committed payload and
+// returns a function that removes it again
+func AddCommitHook(fn CommitHook) func() {
+	entry := &commitHookEntry{fn: fn}
+	commitHooksMu.Lock()
+	commitHooks = append(commitHooks, entry)
+	commitHooksMu.Unlock()
+
+	return func() {
+		commitHooksMu.Lock()
+		defer commitHooksMu.Unlock()
+		for i, e := range commitHooks {
+			if e == entry {
+				commitHooks = append(commitHooks[:i:i], commitHooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// committed runs the commit hooks for a stored payload
+func committed(tenant, signal string, data map[string]interface{}) {
+	commitHooksMu.RLock()
+	defer commitHooksMu.RUnlock()
+	for _, e := range commitHooks {
+		e.fn(tenant, signal, data)
+	}
+}
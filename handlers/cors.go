@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCORSHeaders are the request headers allowed when none are configured
+var DefaultCORSHeaders = []string{"Content-Type", "Authorization", "X-API-Key", DefaultTenantHeader}
+
+// CORSOptions configures cross-origin access for browser based exporters
+type CORSOptions struct {
+	AllowedOrigins   []string      // Origins such as https://app.example.com, https://*.example.com or *
+	AllowedHeaders   []string      // Request headers browsers may send, or * for any
+	MaxAge           time.Duration // How long browsers may cache a preflight response
+	AllowCredentials bool          // Allow cookies and HTTP authentication
+}
+
+// Validate rejects allowing credentials from any origin, which would let
+// every site send authenticated requests
+func (o CORSOptions) Validate() error {
+	if !o.AllowCredentials {
+		return nil
+	}
+	for _, pattern := range o.AllowedOrigins {
+		if pattern == "*" {
+			return fmt.Errorf("credentials cannot be allowed for origin *; list the allowed origins instead")
+		}
+	}
+	return nil
+}
+
+// matchOrigin reports whether origin matches pattern, where each * in the
+// pattern matches any sequence of characters
+func matchOrigin(pattern, origin string) bool {
+	parts := strings.Split(strings.ToLower(pattern), "*")
+	origin = strings.ToLower(origin)
+	if len(parts) == 1 {
+		return origin == parts[0]
+	}
+	if !strings.HasPrefix(origin, parts[0]) {
+		return false
+	}
+	origin = origin[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(origin, part)
+		if i < 0 {
+			return false
+		}
+		origin = origin[i+len(part):]
+	}
+	return strings.HasSuffix(origin, parts[len(parts)-1])
+}
+
+// allowsOrigin reports whether any configured pattern matches origin
+func (o CORSOptions) allowsOrigin(origin string) bool {
+	for _, pattern := range o.AllowedOrigins {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS wraps an OTLP endpoint with CORS handling. Preflight requests are
+// answered directly, so they never reach authentication or the handler.
+func CORS(opts CORSOptions, next http.Handler) http.Handler {
+	if len(opts.AllowedHeaders) == 0 {
+		opts.AllowedHeaders = DefaultCORSHeaders
+	}
+	anyOrigin := false
+	for _, pattern := range opts.AllowedOrigins {
+		if pattern == "*" {
+			anyOrigin = true
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if !opts.allowsOrigin(origin) {
+			if preflight {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			// Let the request through without CORS headers; the browser blocks the response
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Browsers refuse credentials with a literal *, and echoing the
+		// origin instead would extend them to every site, so * never
+		// allows credentials
+		if anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+			if opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			h.Set("Access-Control-Expose-Headers", "Retry-After")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		if len(opts.AllowedHeaders) == 1 && opts.AllowedHeaders[0] == "*" {
+			if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+		} else {
+			h.Set("Access-Control-Allow-Headers", strings.Join(opts.AllowedHeaders, ", "))
+		}
+		if opts.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	cases := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"*", "https://anything.example", true},
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "https://app.example.com.evil.net", false},
+		{"https://*.example.com", "https://web.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"http://localhost:*", "http://localhost:3000", true},
+		{"http://localhost:*", "https://localhost:3000", false},
+	}
+	for _, c := range cases {
+		if got := matchOrigin(c.pattern, c.origin); got != c.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", c.pattern, c.origin, got, c.want)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	called := false
+	handler := CORS(CORSOptions{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		MaxAge:           10 * time.Minute,
+		AllowCredentials: true,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/v1/traces", nil)
+	req.Header.Set("Origin", "https://web.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent || called {
+		t.Fatalf("Expected preflight to be answered directly, got %d (handler called: %v)", rec.Code, called)
+	}
+	h := rec.Header()
+	if h.Get("Access-Control-Allow-Origin") != "https://web.example.com" {
+		t.Errorf("Unexpected Allow-Origin: %q", h.Get("Access-Control-Allow-Origin"))
+	}
+	if h.Get("Access-Control-Allow-Credentials") != "true" || h.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Unexpected preflight headers: %v", h)
+	}
+
+	req.Header.Set("Origin", "https://evil.net")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected disallowed origin to be rejected, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/traces", nil)
+	req.Header.Set("Origin", "https://web.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if !called || rec.Header().Get("Access-Control-Allow-Origin") == "" {
+		t.Error("Expected actual request to reach the handler with CORS headers")
+	}
+}
+
+func TestCORSAnyOriginNeverAllowsCredentials(t *testing.T) {
+	opts := CORSOptions{AllowedOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true}
+	if err := opts.Validate(); err == nil {
+		t.Error("Expected * with credentials to be rejected")
+	}
+
+	handler := CORS(opts, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", nil)
+	req.Header.Set("Origin", "https://evil.net")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	h := rec.Header()
+	if h.Get("Access-Control-Allow-Origin") != "*" || h.Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("Expected a literal * without credentials, got %v", h)
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+)
+
+// Sources of degraded storage
+const (
+	DegradedWrite = "write" // the last insert failed because storage is full
+	DegradedDisk  = "disk"  // free disk space is below the emergency floor
+)
+
+// Retry-After values for storage errors
+const (
+	busyRetryAfter = time.Second
+	fullRetryAfter = 30 * time.Second
+)
+
+var (
+	degradedMu      sync.Mutex
+	degradedReasons = make(map[string]string)
+	degradedCount   atomic.Int32
+	storageFullHook func()
+)
+
+// SetDegraded marks storage as degraded for a source. Transitions are logged.
+func SetDegraded(source, reason string) {
+	degradedMu.Lock()
+	defer degradedMu.Unlock()
+	if degradedReasons[source] == reason {
+		return
+	}
+	if _, ok := degradedReasons[source]; !ok {
+		logging.Warn("Storage degraded (%s): %s", source, reason)
+	}
+	degradedReasons[source] = reason
+	degradedCount.Store(int32(len(degradedReasons)))
+}
+
+// ClearDegraded removes the degraded state set by a source
+func ClearDegraded(source string) {
+	if degradedCount.Load() == 0 {
+		return
+	}
+	degradedMu.Lock()
+	defer degradedMu.Unlock()
+	if _, ok := degradedReasons[source]; !ok {
+		return
+	}
+	delete(degradedReasons, source)
+	degradedCount.Store(int32(len(degradedReasons)))
+	logging.Info("Storage recovered (%s)", source)
+}
+
+// Degraded returns the reasons storage is currently degraded, sorted by source
+func Degraded() []string {
+	degradedMu.Lock()
+	defer degradedMu.Unlock()
+	sources := make([]string, 0, len(degradedReasons))
+	for source := range degradedReasons {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	reasons := make([]string, len(sources))
+	for i, source := range sources {
+		reasons[i] = source + ": " + degradedReasons[source]
+	}
+	return reasons
+}
+
+// SetStorageFullHook registers a function called whenever an insert fails
+// because storage is full, e.g. to run emergency retention immediately
+func SetStorageFullHook(fn func()) {
+	degradedMu.Lock()
+	defer degradedMu.Unlock()
+	storageFullHook = fn
+}
+
+// storageFull records a failed insert caused by a full disk
+func storageFull(err error) {
+	SetDegraded(DegradedWrite, err.Error())
+	degradedMu.Lock()
+	hook := storageFullHook
+	degradedMu.Unlock()
+	if hook != nil {
+		hook()
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// drainRetryAfter is the Retry-After sent while the collector shuts down
+const drainRetryAfter = 5 * time.Second
+
+// draining is set once shutdown has begun
+var draining atomic.Bool
+
+// SetDraining marks the collector as shutting down. New ingest requests
+// are refused with 503 and /readyz fails, while requests already being
+// processed complete normally.
+func SetDraining(v bool) {
+	draining.Store(v)
+}
+
+// Draining reports whether the collector is shutting down
+func Draining() bool {
+	return draining.Load()
+}
+
+// writeUnavailable writes a 503 response telling the client when to retry
+func writeUnavailable(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	http.Error(w, message, http.StatusServiceUnavailable)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/exporter"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+)
+
+// exportBatchSize is the number of records per line of an export
+const exportBatchSize = 1000
+
+// parseSignalParam parses a comma separated signal list; empty means all
+func parseSignalParam(value string) ([]string, error) {
+	if value == "" {
+		return database.Signals, nil
+	}
+	var signals []string
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s != database.SignalTraces && s != database.SignalMetrics && s != database.SignalLogs {
+			return nil, fmt.Errorf("unknown signal '%s': expected traces, metrics or logs", s)
+		}
+		signals = append(signals, s)
+	}
+	return signals, nil
+}
+
+// HandleExport serves GET /api/v1/export, streaming the tenant's telemetry
+// as newline-delimited OTLP JSON. The signal, service, since and until
+// parameters select the data; compression=gzip compresses the download.
+func HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, err := parseQueryParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	values := r.URL.Query()
+	signals, err := parseSignalParam(values.Get("signal"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	compress := false
+	switch c := values.Get("compression"); c {
+	case "", "none":
+	case "gzip":
+		compress = true
+	default:
+		http.Error(w, fmt.Sprintf("unknown compression '%s': expected gzip or none", c), http.StatusBadRequest)
+		return
+	}
+
+	// Large exports take longer than the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	started := false
+	err = withTenantDB(r, func(tenant string, conn *sql.DB) error {
+		var out io.Writer = w
+		var gz *gzip.Writer
+		start := func() {
+			started = true
+			filename := fmt.Sprintf("sqlite-otel-%s-%s.jsonl", tenant, time.Now().UTC().Format("20060102T150405Z"))
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			if compress {
+				w.Header().Set("Content-Type", "application/gzip")
+				filename += ".gz"
+				gz = gzip.NewWriter(w)
+				out = gz
+			}
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		}
+
+		opts := database.ReadOptions{Service: p.service, Since: p.since, Until: p.until, Limit: exportBatchSize}
+		_, err := exporter.WriteJSONLines(r.Context(), conn, signals, opts, func(_ string, line []byte) error {
+			if !started {
+				start()
+			}
+			_, err := out.Write(line)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if !started {
+			start()
+		}
+		if gz != nil {
+			return gz.Close()
+		}
+		return nil
+	})
+	if err == nil {
+		return
+	}
+	if !started {
+		queryError(w, r, err)
+		return
+	}
+	// The status has been sent, so the connection is broken instead to
+	// keep clients from mistaking a partial download for a complete one
+	logging.Slog().Error("Export failed", "path", r.URL.Path, "client", clientIP(r), "error", err)
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+func TestExportStreamsOTLPJSONLines(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+	err := database.InsertLogsData(map[string]interface{}{"resourceLogs": []interface{}{map[string]interface{}{
+		"scopeLogs": []interface{}{map[string]interface{}{"logRecords": []interface{}{
+			map[string]interface{}{"timeUnixNano": "1700000000000000000", "body": map[string]interface{}{"stringValue": "hello"}},
+		}}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	HandleExport(rec, httptest.NewRequest(http.MethodGet, "/api/v1/export?signal=logs,traces&compression=gzip", nil))
+	if rec.Code != http.StatusOK || !strings.HasSuffix(rec.Header().Get("Content-Disposition"), `.jsonl.gz"`) {
+		t.Fatalf("Expected a gzipped download, got %d %v", rec.Code, rec.Header())
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Invalid line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 1 || lines[0]["resourceLogs"] == nil {
+		t.Errorf("Expected one ExportLogsServiceRequest line, got %v", lines)
+	}
+
+	rec = httptest.NewRecorder()
+	HandleExport(rec, httptest.NewRequest(http.MethodGet, "/api/v1/export?signal=profiles", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown signal, got %d", rec.Code)
+	}
+}
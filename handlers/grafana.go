@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+// maxGrafanaBody is the largest request body the Grafana endpoints accept
+const maxGrafanaBody = 1 << 20
+
+// defaultGrafanaPoints is the number of buckets a series is split into
+// when the request does not give an interval
+const defaultGrafanaPoints = 1000
+
+// errGrafanaRequest marks errors caused by the request rather than the store
+var errGrafanaRequest = errors.New("invalid request")
+
+// grafanaRange is the dashboard time range of a request
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// grafanaTarget is one query of a panel
+type grafanaTarget struct {
+	Target  string          `json:"target"`
+	RefID   string          `json:"refId"`
+	Type    string          `json:"type"`
+	Hide    bool            `json:"hide"`
+	Data    json.RawMessage `json:"data"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// grafanaTargetOptions are the per-target options, given as the target's
+// data or payload
+type grafanaTargetOptions struct {
+	Aggregation string            `json:"aggregation"`
+	Labels      map[string]string `json:"labels"`
+}
+
+// grafanaFilter is an ad hoc filter of the dashboard
+type grafanaFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// grafanaRequest is the body of the Grafana endpoints; each uses a subset
+type grafanaRequest struct {
+	Range         grafanaRange           `json:"range"`
+	IntervalMs    int64                  `json:"intervalMs"`
+	MaxDataPoints int64                  `json:"maxDataPoints"`
+	Targets       []grafanaTarget        `json:"targets"`
+	AdhocFilters  []grafanaFilter        `json:"adhocFilters"`
+	Target        string                 `json:"target"`
+	Key           string                 `json:"key"`
+	Annotation    map[string]interface{} `json:"annotation"`
+}
+
+// serveGrafana decodes a Grafana request and writes the tenant-scoped
+// result as bare JSON, the way the datasource expects it
+func serveGrafana(w http.ResponseWriter, r *http.Request, query func(conn *sql.DB, req grafanaRequest) (interface{}, error)) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req grafanaRequest
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxGrafanaBody+1))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxGrafanaBody {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid JSON body: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var response interface{}
+	err = withTenantDB(r, func(tenant string, conn *sql.DB) error {
+		data, err := query(conn, req)
+		response = data
+		return err
+	})
+	if errors.Is(err, errGrafanaRequest) || errors.Is(err, database.ErrTooManyPoints) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGrafanaRoot serves the datasource connection test at
+// /api/v1/grafana/, which also checks the tenant
+func HandleGrafanaRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v1/grafana/" && r.URL.Path != "/api/v1/grafana" {
+		http.NotFound(w, r)
+		return
+	}
+	serveGrafana(w, r, func(conn *sql.DB, req grafanaRequest) (interface{}, error) {
+		return map[string]string{"status": "ok"}, nil
+	})
+}
+
+// HandleGrafanaSearch serves /api/v1/grafana/search, listing metric names
+// containing the requested target
+func HandleGrafanaSearch(w http.ResponseWriter, r *http.Request) {
+	serveGrafana(w, r, func(conn *sql.DB, req grafanaRequest) (interface{}, error) {
+		metrics, err := database.QueryMetricNames(conn, "")
+		if err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for _, m := range metrics {
+			if strings.Contains(m.Name, req.Target) && (len(names) == 0 || names[len(names)-1] != m.Name) {
+				names = append(names, m.Name)
+			}
+		}
+		return names, nil
+	})
+}
+
+// HandleGrafanaQuery serves /api/v1/grafana/query, returning each target
+// metric as time series, or as a table for targets of type table
+func HandleGrafanaQuery(w http.ResponseWriter, r *http.Request) {
+	serveGrafana(w, r, func(conn *sql.DB, req grafanaRequest) (interface{}, error) {
+		since, until := req.Range.From.UnixNano(), req.Range.To.UnixNano()
+		if req.Range.From.IsZero() || req.Range.To.IsZero() || until < since {
+			return nil, fmt.Errorf("%w: expected a range with from before to", errGrafanaRequest)
+		}
+		step := req.IntervalMs * int64(time.Millisecond)
+		points := req.MaxDataPoints
+		if points <= 0 {
+			points = defaultGrafanaPoints
+		}
+		if minStep := (until - since + points - 1) / points; step < minStep {
+			step = minStep
+		}
+		filters := make(map[string]string)
+		for _, f := range req.AdhocFilters {
+			if f.Operator != "=" {
+				return nil, fmt.Errorf("%w: unsupported filter operator '%s', expected =", errGrafanaRequest, f.Operator)
+			}
+			filters[f.Key] = f.Value
+		}
+
+		response := []interface{}{}
+		for _, target := range req.Targets {
+			if target.Hide || target.Target == "" {
+				continue
+			}
+			opts, err := parseTargetOptions(target)
+			if err != nil {
+				return nil, err
+			}
+			if opts.Aggregation != "" && !database.ValidAggregation(opts.Aggregation) {
+				return nil, fmt.Errorf("%w: unknown aggregation '%s', expected avg, min, max, sum, count or last", errGrafanaRequest, opts.Aggregation)
+			}
+			labels := make(map[string]string)
+			for key, value := range filters {
+				labels[key] = value
+			}
+			for key, value := range opts.Labels {
+				labels[key] = value
+			}
+			series, err := database.QueryMetricSeries(conn, database.SeriesQuery{
+				Name:        target.Target,
+				Labels:      labels,
+				Since:       since,
+				Until:       until,
+				Step:        step,
+				Aggregation: opts.Aggregation,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if target.Type == "table" {
+				response = append(response, seriesTable(series))
+				continue
+			}
+			for _, s := range series {
+				datapoints := make([][2]float64, len(s.Points))
+				for i, p := range s.Points {
+					datapoints[i] = [2]float64{p.Value, float64(p.TimeUnixNano / int64(time.Millisecond))}
+				}
+				response = append(response, map[string]interface{}{"target": seriesName(s), "datapoints": datapoints})
+			}
+		}
+		return response, nil
+	})
+}
+
+// parseTargetOptions reads the options of a target. Grafana sends them as
+// an object or, from some datasource versions, as a JSON encoded string.
+func parseTargetOptions(target grafanaTarget) (grafanaTargetOptions, error) {
+	var opts grafanaTargetOptions
+	for _, raw := range []json.RawMessage{target.Data, target.Payload} {
+		var text string
+		if json.Unmarshal(raw, &text) == nil {
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			raw = json.RawMessage(text)
+		}
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(raw, &opts); err != nil {
+			return opts, fmt.Errorf("%w: invalid options of target '%s': %v", errGrafanaRequest, target.Target, err)
+		}
+	}
+	return opts, nil
+}
+
+// seriesName formats a series as name{key="value",...}
+func seriesName(s database.Series) string {
+	keys := make([]string, 0, len(s.Labels))
+	for key := range s.Labels {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return s.Name
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%q", key, s.Labels[key])
+	}
+	return s.Name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// seriesTable returns series as a Grafana table of time, series and value
+func seriesTable(series []database.Series) map[string]interface{} {
+	rows := [][]interface{}{}
+	for _, s := range series {
+		name := seriesName(s)
+		for _, p := range s.Points {
+			rows = append(rows, []interface{}{p.TimeUnixNano / int64(time.Millisecond), name, p.Value})
+		}
+	}
+	return map[string]interface{}{
+		"type": "table",
+		"columns": []map[string]string{
+			{"text": "Time", "type": "time"},
+			{"text": "Series", "type": "string"},
+			{"text": "Value", "type": "number"},
+		},
+		"rows": rows,
+	}
+}
+
+// HandleGrafanaTagKeys serves /api/v1/grafana/tag-keys, listing the labels
+// usable in ad hoc filters
+func HandleGrafanaTagKeys(w http.ResponseWriter, r *http.Request) {
+	serveGrafana(w, r, func(conn *sql.DB, req grafanaRequest) (interface{}, error) {
+		labels, err := database.QueryMetricLabels(conn)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(labels))
+		for key := range labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		response := make([]map[string]string, len(keys))
+		for i, key := range keys {
+			response[i] = map[string]string{"type": "string", "text": key}
+		}
+		return response, nil
+	})
+}
+
+// HandleGrafanaTagValues serves /api/v1/grafana/tag-values, listing the
+// values of one label
+func HandleGrafanaTagValues(w http.ResponseWriter, r *http.Request) {
+	serveGrafana(w, r, func(conn *sql.DB, req grafanaRequest) (interface{}, error) {
+		labels, err := database.QueryMetricLabels(conn)
+		if err != nil {
+			return nil, err
+		}
+		response := []map[string]string{}
+		for _, value := range labels[req.Key] {
+			response = append(response, map[string]string{"text": value})
+		}
+		return response, nil
+	})
+}
+
+// annotationQuery is a parsed annotation query such as
+// "logs service=checkout severity=warn"
+type annotationQuery struct {
+	logs, spans bool
+	service     string
+	minSeverity int64
+}
+
+// parseAnnotationQuery parses the query of an annotation. Without logs or
+// spans both are shown; logs default to severity error and above.
+func parseAnnotationQuery(query string) (annotationQuery, error) {
+	q := annotationQuery{minSeverity: 17}
+	for _, term := range strings.Fields(query) {
+		key, value, _ := strings.Cut(term, "=")
+		var err error
+		switch key {
+		case "logs":
+			q.logs = true
+		case "spans":
+			q.spans = true
+		case "service":
+			q.service = value
+		case "severity":
+			q.minSeverity, err = database.ParseSeverity(value)
+		default:
+			err = fmt.Errorf("unknown term '%s', expected logs, spans, service= or severity=", term)
+		}
+		if err != nil {
+			return q, fmt.Errorf("%w: %v", errGrafanaRequest, err)
+		}
+	}
+	if !q.logs && !q.spans {
+		q.logs, q.spans = true, true
+	}
+	return q, nil
+}
+
+// HandleGrafanaAnnotations serves /api/v1/grafana/annotations, marking
+// error logs and failed spans in the dashboard range
+func HandleGrafanaAnnotations(w http.ResponseWriter, r *http.Request) {
+	serveGrafana(w, r, func(conn *sql.DB, req grafanaRequest) (interface{}, error) {
+		text, _ := req.Annotation["query"].(string)
+		q, err := parseAnnotationQuery(text)
+		if err != nil {
+			return nil, err
+		}
+		since, until := req.Range.From.UnixNano(), req.Range.To.UnixNano()
+		if req.Range.From.IsZero() || req.Range.To.IsZero() {
+			since, until = 0, 0
+		}
+
+		annotations := []map[string]interface{}{}
+		if q.logs {
+			logs, err := database.QueryLogs(conn, database.LogQuery{
+				Service:     q.service,
+				MinSeverity: q.minSeverity,
+				Since:       since,
+				Until:       until,
+				Limit:       database.MaxQueryLimit,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, l := range logs {
+				stamp := l.TimeUnixNano
+				if stamp == 0 {
+					stamp = l.ObservedTimeUnixNano
+				}
+				severity := l.SeverityText
+				if severity == "" {
+					severity = database.SeverityName(l.SeverityNumber)
+				}
+				tags := []string{"log", strings.ToLower(severity)}
+				if l.ServiceName != "" {
+					tags = append(tags, l.ServiceName)
+				}
+				if l.TraceID != "" {
+					tags = append(tags, "trace_id:"+l.TraceID)
+				}
+				annotations = append(annotations, map[string]interface{}{
+					"annotation": req.Annotation,
+					"time":       stamp / int64(time.Millisecond),
+					"title":      strings.TrimSpace(strings.ToUpper(severity) + " " + l.ServiceName),
+					"text":       logBodyText(l.Body),
+					"tags":       tags,
+				})
+			}
+		}
+		if q.spans {
+			spans, err := database.QuerySpans(conn, database.SpanQuery{
+				Service:    q.service,
+				Since:      since,
+				Until:      until,
+				ErrorsOnly: true,
+				Limit:      database.MaxQueryLimit,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range spans {
+				tags := []string{"span", "error", "trace_id:" + s.TraceID}
+				if s.ServiceName != "" {
+					tags = append(tags, s.ServiceName)
+				}
+				annotations = append(annotations, map[string]interface{}{
+					"annotation": req.Annotation,
+					"time":       s.StartTimeUnixNano / int64(time.Millisecond),
+					"timeEnd":    s.EndTimeUnixNano / int64(time.Millisecond),
+					"isRegion":   s.EndTimeUnixNano > s.StartTimeUnixNano,
+					"title":      strings.TrimSpace(s.ServiceName + " " + s.Name + " failed"),
+					"text":       s.StatusMessage,
+					"tags":       tags,
+				})
+			}
+		}
+		return annotations, nil
+	})
+}
+
+// logBodyText returns the text of a stored log body
+func logBodyText(body json.RawMessage) string {
+	var value struct {
+		StringValue *string `json:"stringValue"`
+	}
+	if json.Unmarshal(body, &value) == nil && value.StringValue != nil {
+		return *value.StringValue
+	}
+	return string(body)
+}
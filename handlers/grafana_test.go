@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+// grafanaPost sends a JSON body to a Grafana handler and decodes the response
+func grafanaPost(t *testing.T, handler http.HandlerFunc, body string, response interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/grafana/x", strings.NewReader(body)))
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), response); err != nil {
+			t.Fatalf("Invalid response %s: %v", rec.Body, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestGrafanaQueryAndAnnotations(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+	if err := database.InsertLogsData(tailLogs("checkout", 9, 17)); err != nil {
+		t.Fatal(err)
+	}
+	err := database.InsertMetricsData(map[string]interface{}{"resourceMetrics": []interface{}{map[string]interface{}{
+		"resource": map[string]interface{}{"attributes": []interface{}{map[string]interface{}{
+			"key": "service.name", "value": map[string]interface{}{"stringValue": "worker"}}}},
+		"scopeMetrics": []interface{}{map[string]interface{}{"metrics": []interface{}{map[string]interface{}{
+			"name": "queue.depth",
+			"gauge": map[string]interface{}{"dataPoints": []interface{}{
+				map[string]interface{}{"timeUnixNano": "1700000000000000000", "asInt": "4"},
+				map[string]interface{}{"timeUnixNano": "1700000030000000000", "asInt": "6"},
+			}},
+		}}}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = database.InsertTraceData(map[string]interface{}{"resourceSpans": []interface{}{map[string]interface{}{
+		"resource": map[string]interface{}{},
+		"scopeSpans": []interface{}{map[string]interface{}{"spans": []interface{}{map[string]interface{}{
+			"traceId": "0102", "spanId": "01", "name": "charge", "startTimeUnixNano": "1700000000000000000",
+			"endTimeUnixNano": "1700000001000000000", "status": map[string]interface{}{"code": float64(2), "message": "declined"},
+		}}}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	if code := grafanaPost(t, HandleGrafanaSearch, `{"target":"queue"}`, &names); code != http.StatusOK || len(names) != 1 {
+		t.Errorf("Expected the metric to be found, got %d %v", code, names)
+	}
+
+	var series []struct {
+		Target     string       `json:"target"`
+		Datapoints [][2]float64 `json:"datapoints"`
+	}
+	query := `{"range":{"from":"2023-11-14T22:13:00Z","to":"2023-11-14T22:14:00Z"},"intervalMs":60000,
+		"targets":[{"target":"queue.depth","refId":"A","data":{"aggregation":"max"}}]}`
+	if code := grafanaPost(t, HandleGrafanaQuery, query, &series); code != http.StatusOK {
+		t.Fatalf("Query failed with %d", code)
+	}
+	if len(series) != 1 || series[0].Target != `queue.depth{service.name="worker"}` || len(series[0].Datapoints) != 1 ||
+		series[0].Datapoints[0] != [2]float64{6, 1699999980000} {
+		t.Errorf("Expected one bucket holding the maximum, got %+v", series)
+	}
+	if code := grafanaPost(t, HandleGrafanaQuery, `{"targets":[{"target":"queue.depth"}]}`, &series); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a range, got %d", code)
+	}
+
+	var annotations []struct {
+		Title    string   `json:"title"`
+		Text     string   `json:"text"`
+		IsRegion bool     `json:"isRegion"`
+		Tags     []string `json:"tags"`
+	}
+	if code := grafanaPost(t, HandleGrafanaAnnotations, `{"annotation":{"query":"service=checkout"}}`, &annotations); code != http.StatusOK {
+		t.Fatalf("Annotations failed with %d", code)
+	}
+	if len(annotations) != 1 || annotations[0].Title != "ERROR checkout" || annotations[0].Text != "message" {
+		t.Errorf("Expected the checkout error log, got %+v", annotations)
+	}
+	if code := grafanaPost(t, HandleGrafanaAnnotations, `{"annotation":{"query":"spans"}}`, &annotations); code != http.StatusOK {
+		t.Fatalf("Annotations failed with %d", code)
+	}
+	if len(annotations) != 1 || annotations[0].Title != "charge failed" || !annotations[0].IsRegion || annotations[0].Text != "declined" {
+		t.Errorf("Expected the failed span, got %+v", annotations)
+	}
+}
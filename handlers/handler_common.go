@@ -1,26 +1,48 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 	
+	"github.com/RedShiftVelocity/sqlite-otel/database"
 	"github.com/RedShiftVelocity/sqlite-otel/logging"
+	"github.com/RedShiftVelocity/sqlite-otel/ratelimit"
+	"github.com/RedShiftVelocity/sqlite-otel/stats"
 )
 
 // ProcessTelemetryRequest handles common logic for all telemetry endpoints
-func ProcessTelemetryRequest(w http.ResponseWriter, r *http.Request, telemetryType string, insertFunc func(data map[string]interface{}) error) {
+func ProcessTelemetryRequest(w http.ResponseWriter, r *http.Request, telemetryType string, insertFunc func(conn *sql.DB, data map[string]interface{}) error) {
+	start := time.Now()
+	rec, done := instrumentRequest(w, r, telemetryType)
+	defer done()
+	w = rec
+	reqLog := logging.Slog().With("signal", telemetryType, "client", clientIP(r))
+
 	if r.Method != http.MethodPost {
+		reject(telemetryType, "method_not_allowed")
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	// Refuse new work once shutdown has begun; exporters retry elsewhere or later
+	if Draining() {
+		reject(telemetryType, "draining")
+		w.Header().Set("Connection", "close")
+		writeUnavailable(w, drainRetryAfter, "Collector is shutting down")
+		return
+	}
+
 	// Check Content-Type header (support prefix matching for charset)
 	contentType := r.Header.Get("Content-Type")
 	if !strings.HasPrefix(contentType, "application/json") {
-		logging.Debug("Unsupported Content-Type for %s: %s", telemetryType, contentType)
+		reqLog.Debug("Unsupported Content-Type", "content_type", contentType)
+		reject(telemetryType, "unsupported_media_type")
 		http.Error(w, "Only application/json Content-Type is supported", http.StatusUnsupportedMediaType)
 		return
 	}
@@ -30,38 +52,131 @@ func ProcessTelemetryRequest(w http.ResponseWriter, r *http.Request, telemetryTy
 	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
 	defer r.Body.Close()
 
+	// Charge the request and its declared size before spending any time
+	// parsing it. Keying by service needs the payload, so that mode admits
+	// the request by client IP here and charges each service after decoding.
+	limiter := RateLimiter()
+	var keyBy, limitKey string
+	var admittedBytes int64
+	if limiter != nil {
+		keyBy = limiter.KeyBy()
+		limitKey = rateLimitKey(r, keyBy)
+		if r.ContentLength > 0 {
+			admittedBytes = r.ContentLength
+		}
+		if decision := limiter.Admit(ratelimit.Request{Key: limitKey, Bytes: admittedBytes}); !decision.Allowed {
+			throttle(w, reqLog, telemetryType, decision)
+			return
+		}
+	}
+
 	// Parse JSON body directly from stream to avoid memory allocation
 	var telemetryData map[string]interface{}
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&telemetryData); err != nil {
+	body := &countingReader{Reader: r.Body}
+	decoder := json.NewDecoder(body)
+	err := decoder.Decode(&telemetryData)
+	stats.RequestBytes.Add(float64(body.n), telemetryType)
+	if err != nil {
+		reject(telemetryType, "invalid_request")
 		if err == io.EOF {
-			logging.Error("Empty request body for %s", telemetryType)
+			reqLog.Error("Empty request body")
 			http.Error(w, "Request body cannot be empty", http.StatusBadRequest)
 			return
 		}
-		logging.Error("Error parsing %s JSON: %v", telemetryType, err)
+		reqLog.Error("Invalid JSON", "bytes", body.n, "error", err)
 		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
 
+	// Enforce per-client record limits before touching the database
+	if limiter != nil {
+		unadmitted := body.n - admittedBytes
+		if unadmitted < 0 {
+			unadmitted = 0
+		}
+		admitted := ratelimit.Request{Key: limitKey, Bytes: unadmitted}
+		var services []ratelimit.Request
+		if keyBy == ratelimit.KeyByService {
+			// Resources without a service name fall back to the admitted key
+			for _, req := range rateLimitRequests(r, keyBy, telemetryType, telemetryData, body.n) {
+				if req.Key == limitKey {
+					admitted.Records += req.Records
+				} else {
+					services = append(services, req)
+				}
+			}
+		} else {
+			admitted.Records = countPayloadRecords(telemetryType, telemetryData)
+		}
+		decision := limiter.AllowRecords(admitted)
+		if decision.Allowed && len(services) > 0 {
+			decision = limiter.Allow(services...)
+		}
+		if !decision.Allowed {
+			throttle(w, reqLog, telemetryType, decision)
+			return
+		}
+	}
+
+	// Record the TLS client identity with the data when configured. Without
+	// a verified certificate the attribute is stripped, so clients cannot
+	// claim an identity themselves.
+	identity := SourceIdentity(r)
+	if key := getIdentityAttribute(); key != "" {
+		setResourceAttribute(telemetryType, telemetryData, key, identity)
+	}
+
 	// Store telemetry data in database (SQLite only storage)
-	if err := insertFunc(telemetryData); err != nil {
-		logging.Error("Error storing %s in database: %v", telemetryType, err)
-		// Return 500 Internal Server Error as per OTLP/HTTP spec
-		http.Error(w, fmt.Sprintf("Failed to process %s data", telemetryType), http.StatusInternalServerError)
+	if err := storeTelemetry(r, telemetryType, telemetryData, insertFunc); err != nil {
+		switch {
+		case errors.Is(err, errInvalidTenant):
+			reject(telemetryType, "invalid_tenant")
+			reqLog.Error("Rejected telemetry", "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, errForbiddenTenant):
+			reject(telemetryType, "forbidden_tenant")
+			reqLog.Warn("Rejected telemetry", "error", err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, database.ErrTooManyTenants):
+			reject(telemetryType, "tenant_limit")
+			reqLog.Warn("Rejected telemetry", "error", err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, database.ErrQuotaExceeded):
+			reject(telemetryType, "quota_exceeded")
+			reqLog.Error("Rejected telemetry", "error", err)
+			// 507 is not retryable, so exporters drop data instead of hammering us
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		case database.IsBusy(err):
+			reject(telemetryType, "database_busy")
+			reqLog.Warn("Database busy", "error", err)
+			writeUnavailable(w, busyRetryAfter, "Database is busy, retry later")
+		case database.IsFull(err):
+			reject(telemetryType, "storage_full")
+			reqLog.Error("Storage full", "error", err)
+			storageFull(err)
+			writeUnavailable(w, fullRetryAfter, "Storage is full, retry later")
+		default:
+			reject(telemetryType, "storage_error")
+			reqLog.Error("Failed to store telemetry", "error", err)
+			// Return 500 Internal Server Error as per OTLP/HTTP spec
+			http.Error(w, fmt.Sprintf("Failed to process %s data", telemetryType), http.StatusInternalServerError)
+		}
 		return
 	}
+	ClearDegraded(DegradedWrite)
 
 	// Log request details (execution logging only, no telemetry data)
-	// Note: Content-Length may be -1 if not specified by client
-	contentLength := r.ContentLength
-	if contentLength > 0 {
-		logging.Debug("Received %s telemetry data, size: %d bytes", telemetryType, contentLength)
-	} else {
-		logging.Debug("Received %s telemetry data", telemetryType)
+	if logging.Enabled(logging.LevelInfo) {
+		fields := []interface{}{
+			"records", countPayloadRecords(telemetryType, telemetryData),
+			"bytes", body.n,
+			"duration", time.Since(start).Round(time.Microsecond),
+		}
+		if identity != "" {
+			fields = append(fields, "source", identity)
+		}
+		reqLog.Info("Stored telemetry", fields...)
 	}
-	logging.Info("Stored %s data in SQLite - Content-Type: %s", 
-		telemetryType, r.Header.Get("Content-Type"))
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/stats"
+)
+
+// HealthOptions configures the readiness checks and status report
+type HealthOptions struct {
+	DBPath       string
+	MinFreeBytes uint64 // Readiness fails below this much free disk space (0 disables)
+	MaxInFlight  int    // Readiness fails at this many in-flight ingest requests (0 disables)
+
+	Version, BuildTime, GitCommit string
+}
+
+var (
+	healthMu      sync.RWMutex
+	healthOptions HealthOptions
+)
+
+// SetHealthOptions configures /readyz and /status
+func SetHealthOptions(opts HealthOptions) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	healthOptions = opts
+}
+
+// getHealthOptions returns the current health options
+func getHealthOptions() HealthOptions {
+	healthMu.RLock()
+	defer healthMu.RUnlock()
+	return healthOptions
+}
+
+// summaryTTL is how long /status reuses a database summary. Counting rows
+// scans every table, which is too slow to repeat on each request.
+const summaryTTL = 30 * time.Second
+
+// statusSummary caches the database summary shown by /status
+var statusSummary struct {
+	sync.Mutex
+	conn    *sql.DB
+	at      time.Time
+	summary *database.Summary
+}
+
+// cachedSummary returns the summary of conn, computing it at most once per
+// summaryTTL. Concurrent requests wait for a single computation.
+func cachedSummary(ctx context.Context, conn *sql.DB) (*database.Summary, time.Time, error) {
+	c := &statusSummary
+	c.Lock()
+	defer c.Unlock()
+	if c.conn == conn && time.Since(c.at) < summaryTTL {
+		return c.summary, c.at, nil
+	}
+	summary, err := database.Summarize(ctx, conn)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	c.conn, c.at, c.summary = conn, time.Now(), summary
+	return summary, c.at, nil
+}
+
+// Check is the outcome of one readiness check
+type Check struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// readinessChecks runs every readiness check and reports whether all passed
+func readinessChecks(opts HealthOptions) (bool, []Check) {
+	var checks []Check
+	add := func(name string, err error) {
+		c := Check{Name: name, OK: err == nil}
+		if err != nil {
+			c.Message = err.Error()
+		}
+		checks = append(checks, c)
+	}
+
+	if Draining() {
+		add("draining", fmt.Errorf("collector is shutting down"))
+	}
+
+	if !database.SchemaReady() {
+		add("schema", fmt.Errorf("database schema is not initialized"))
+	} else {
+		add("schema", nil)
+		add("database_writable", database.CheckLastWrite())
+	}
+
+	if reasons := Degraded(); len(reasons) > 0 {
+		add("storage", fmt.Errorf("storage is degraded: %s", strings.Join(reasons, "; ")))
+	}
+
+	if opts.MinFreeBytes > 0 && opts.DBPath != "" {
+		free, err := database.FreeSpace(filepath.Dir(opts.DBPath))
+		if err == nil && free < opts.MinFreeBytes {
+			err = fmt.Errorf("%d MB free, need at least %d MB", free/(1024*1024), opts.MinFreeBytes/(1024*1024))
+		}
+		add("disk_space", err)
+	}
+
+	if opts.MaxInFlight > 0 {
+		var err error
+		if inFlight := int(stats.InFlightRequests.Value()); inFlight >= opts.MaxInFlight {
+			err = fmt.Errorf("%d ingest requests in flight, limit %d", inFlight, opts.MaxInFlight)
+		}
+		add("ingest_queue", err)
+	}
+
+	ready := true
+	for _, c := range checks {
+		ready = ready && c.OK
+	}
+	return ready, checks
+}
+
+// HandleLivez serves GET /livez. It succeeds while the process is able to
+// serve HTTP at all and never touches the database.
+func HandleLivez(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("OK"))
+}
+
+// HandleReadyz serves GET /readyz with 200 when the collector can accept
+// telemetry and 503 otherwise, listing each check in the JSON body
+func HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ready, checks := readinessChecks(getHealthOptions())
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"ready": ready, "checks": checks})
+}
+
+// statusResponse is the JSON body of /status
+type statusResponse struct {
+	Version   string   `json:"version"`
+	BuildTime string   `json:"build_time"`
+	GitCommit string   `json:"git_commit"`
+	GoVersion string   `json:"go_version"`
+	StartedAt string   `json:"started_at"`
+	Uptime    float64  `json:"uptime_seconds"`
+	Ready     bool     `json:"ready"`
+	Checks    []Check  `json:"checks"`
+	Degraded  []string `json:"degraded"`
+
+	Database struct {
+		Path         string                        `json:"path"`
+		SizeBytes    int64                         `json:"size_bytes"`
+		WALSizeBytes int64                         `json:"wal_size_bytes"`
+		FreeBytes    *uint64                       `json:"free_disk_bytes,omitempty"`
+		Rows         map[string]int64              `json:"rows,omitempty"`
+		Signals      map[string]database.TimeRange `json:"signals,omitempty"`
+		SummarizedAt string                        `json:"summarized_at,omitempty"`
+		Error        string                        `json:"error,omitempty"`
+	} `json:"database"`
+
+	LastWriteError *database.WriteError `json:"last_write_error"`
+}
+
+// HandleStatus serves GET /status with build information, database
+// contents and the most recent write error
+func HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	opts := getHealthOptions()
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var resp statusResponse
+	resp.Version, resp.BuildTime, resp.GitCommit = opts.Version, opts.BuildTime, opts.GitCommit
+	resp.GoVersion = runtime.Version()
+	resp.StartedAt = stats.StartTime().UTC().Format(time.RFC3339)
+	resp.Uptime = time.Since(stats.StartTime()).Seconds()
+	resp.Ready, resp.Checks = readinessChecks(opts)
+	resp.Degraded = Degraded()
+	resp.LastWriteError = database.LastWriteError()
+
+	resp.Database.Path = opts.DBPath
+	if info, err := os.Stat(opts.DBPath); err == nil {
+		resp.Database.SizeBytes = info.Size()
+	}
+	if info, err := os.Stat(opts.DBPath + "-wal"); err == nil {
+		resp.Database.WALSizeBytes = info.Size()
+	}
+	if free, err := database.FreeSpace(filepath.Dir(opts.DBPath)); err == nil {
+		resp.Database.FreeBytes = &free
+	}
+	if conn := database.DB(); conn != nil {
+		summary, at, err := cachedSummary(ctx, conn)
+		if err != nil {
+			resp.Database.Error = err.Error()
+		} else {
+			resp.Database.Rows, resp.Database.Signals = summary.Rows, summary.Signals
+			resp.Database.SummarizedAt = at.UTC().Format(time.RFC3339)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
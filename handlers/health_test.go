@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+func TestReadyzAndStatus(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "main.db")
+	SetHealthOptions(HealthOptions{DBPath: dbPath, MaxInFlight: 10, Version: "1.2.3"})
+	defer SetHealthOptions(HealthOptions{})
+
+	probe := func(handler http.HandlerFunc, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := probe(HandleLivez, "/livez"); rec.Code != http.StatusOK {
+		t.Errorf("/livez returned %d", rec.Code)
+	}
+	if rec := probe(HandleReadyz, "/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz before InitDB returned %d, want 503", rec.Code)
+	}
+
+	if err := database.InitDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+
+	rec := probe(HandleReadyz, "/readyz")
+	if rec.Code != http.StatusOK {
+		t.Errorf("/readyz returned %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = probe(HandleStatus, "/status")
+	var status struct {
+		Version  string `json:"version"`
+		Ready    bool   `json:"ready"`
+		Database struct {
+			Path string           `json:"path"`
+			Rows map[string]int64 `json:"rows"`
+		} `json:"database"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Invalid /status body %q: %v", rec.Body, err)
+	}
+	if status.Version != "1.2.3" || !status.Ready || status.Database.Path != dbPath {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+	if _, ok := status.Database.Rows["spans"]; !ok {
+		t.Errorf("Expected row counts per table, got %v", status.Database.Rows)
+	}
+
+	// Row counts are cached rather than recounted on every request
+	if _, err := database.DB().Exec(`INSERT INTO log_records (time_unix_nano, body) VALUES (1, 'x')`); err != nil {
+		t.Fatal(err)
+	}
+	rec = probe(HandleStatus, "/status")
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Database.Rows["log_records"] != 0 {
+		t.Errorf("Expected the cached row counts, got %v", status.Database.Rows)
+	}
+}
+
+func TestDrainingRejectsNewRequests(t *testing.T) {
+	SetDraining(true)
+	defer SetDraining(false)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/logs", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	HandleLogs(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After while draining, got %d %v", rec.Code, rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	HandleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"draining"`) {
+		t.Errorf("Expected /readyz to report draining, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestStorageFullReturnsRetryableError(t *testing.T) {
+	defer ClearDegraded(DegradedWrite)
+	hooked := false
+	SetStorageFullHook(func() { hooked = true })
+	defer SetStorageFullHook(nil)
+
+	post := func(insertErr error) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/logs", strings.NewReader(`{"resourceLogs":[]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		ProcessTelemetryRequest(rec, req, "logs", func(*sql.DB, map[string]interface{}) error { return insertErr })
+		return rec
+	}
+
+	rec := post(fmt.Errorf("failed to insert log record: %w", syscall.ENOSPC))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "30" {
+		t.Errorf("Expected 503 with Retry-After 30 on a full disk, got %d %v", rec.Code, rec.Header())
+	}
+	if !hooked {
+		t.Error("Expected the storage full hook to run")
+	}
+
+	rec = httptest.NewRecorder()
+	HandleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"storage"`) {
+		t.Errorf("Expected /readyz to report degraded storage, got %d %s", rec.Code, rec.Body)
+	}
+
+	// A successful write clears the degraded state
+	if rec := post(nil); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", rec.Code, rec.Body)
+	}
+	if reasons := Degraded(); len(reasons) != 0 {
+		t.Errorf("Expected storage to recover, still degraded: %v", reasons)
+	}
+}
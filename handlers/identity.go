@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+)
+
+var (
+	identityMu        sync.RWMutex
+	identityAttribute string
+)
+
+// SetIdentityAttribute configures the resource attribute used to record the
+// TLS client certificate subject with stored data. An empty key disables it.
+func SetIdentityAttribute(key string) {
+	identityMu.Lock()
+	defer identityMu.Unlock()
+	identityAttribute = key
+}
+
+// getIdentityAttribute returns the configured identity attribute key
+func getIdentityAttribute() string {
+	identityMu.RLock()
+	defer identityMu.RUnlock()
+	return identityAttribute
+}
+
+// SourceIdentity returns the subject of the verified TLS client certificate,
+// or an empty string when the request was not authenticated by certificate
+func SourceIdentity(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.String()
+}
+
+// resourceListKey returns the top-level OTLP field holding resources for a signal
+func resourceListKey(telemetryType string) string {
+	switch telemetryType {
+	case "traces":
+		return "resourceSpans"
+	case "metrics":
+		return "resourceMetrics"
+	case "logs":
+		return "resourceLogs"
+	}
+	return ""
+}
+
+// recordListKeys returns the OTLP fields holding the scopes of a resource
+// and the records of a scope for a signal
+func recordListKeys(telemetryType string) (scopeKey, recordKey string) {
+	switch telemetryType {
+	case "traces":
+		return "scopeSpans", "spans"
+	case "logs":
+		return "scopeLogs", "logRecords"
+	case "metrics":
+		return "scopeMetrics", "metrics"
+	}
+	return "", ""
+}
+
+// setResourceAttribute sets a string attribute on every resource in the
+// payload, replacing any value supplied by the client so it cannot be
+// spoofed. An empty value removes the attribute instead.
+func setResourceAttribute(telemetryType string, data map[string]interface{}, key, value string) {
+	resources, ok := data[resourceListKey(telemetryType)].([]interface{})
+	if !ok {
+		return
+	}
+
+	attribute := map[string]interface{}{
+		"key":   key,
+		"value": map[string]interface{}{"stringValue": value},
+	}
+
+	for _, entry := range resources {
+		resourceEntry, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resource, ok := resourceEntry["resource"].(map[string]interface{})
+		if !ok && value == "" {
+			continue
+		}
+		if !ok {
+			resource = make(map[string]interface{})
+			resourceEntry["resource"] = resource
+		}
+
+		var attributes []interface{}
+		switch existing := resource["attributes"].(type) {
+		case nil:
+			if value == "" {
+				continue
+			}
+		case []interface{}:
+			attributes = existing
+		default:
+			// Unknown attribute encoding, leave the resource untouched
+			continue
+		}
+
+		kept := attributes[:0]
+		for _, a := range attributes {
+			if attr, ok := a.(map[string]interface{}); !ok || attr["key"] != key {
+				kept = append(kept, a)
+			}
+		}
+		if value != "" {
+			kept = append(kept, attribute)
+		}
+		resource["attributes"] = kept
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSetResourceAttributeReplacesOrStrips(t *testing.T) {
+	payload := func() map[string]interface{} {
+		var data map[string]interface{}
+		json.Unmarshal([]byte(`{"resourceSpans":[{"resource":{"attributes":[
+			{"key":"service.name","value":{"stringValue":"api"}},
+			{"key":"client.identity","value":{"stringValue":"CN=spoofed"}}]}}]}`), &data)
+		return data
+	}
+	attributes := func(data map[string]interface{}) string {
+		resource := data["resourceSpans"].([]interface{})[0].(map[string]interface{})["resource"]
+		encoded, _ := json.Marshal(resource.(map[string]interface{})["attributes"])
+		return string(encoded)
+	}
+
+	data := payload()
+	setResourceAttribute("traces", data, "client.identity", "CN=checkout")
+	if got := attributes(data); got != `[{"key":"service.name","value":{"stringValue":"api"}},{"key":"client.identity","value":{"stringValue":"CN=checkout"}}]` {
+		t.Errorf("Expected the verified identity to replace the client's, got %s", got)
+	}
+
+	data = payload()
+	setResourceAttribute("traces", data, "client.identity", "")
+	if got := attributes(data); got != `[{"key":"service.name","value":{"stringValue":"api"}}]` {
+		t.Errorf("Expected the unverified identity to be stripped, got %s", got)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/selftelemetry"
+	"github.com/RedShiftVelocity/sqlite-otel/stats"
+)
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// instrumentRequest tracks an ingestion request in the collector's own
+// metrics. The returned function must be called when the request is done.
+func instrumentRequest(w http.ResponseWriter, r *http.Request, telemetryType string) (*statusRecorder, func()) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	stats.InFlightRequests.Add(1)
+	return rec, func() {
+		end := time.Now()
+		stats.InFlightRequests.Add(-1)
+		stats.RequestsTotal.Inc(telemetryType, strconv.Itoa(rec.status))
+		stats.RequestDuration.Observe(end.Sub(start).Seconds(), telemetryType)
+		selftelemetry.RecordSpan(selftelemetry.Span{
+			Name:  r.Method + " " + r.URL.Path,
+			Start: start,
+			End:   end,
+			Attributes: map[string]string{
+				"signal":                    telemetryType,
+				"http.request.method":       r.Method,
+				"http.route":                r.URL.Path,
+				"http.response.status_code": strconv.Itoa(rec.status),
+				"client.address":            clientIP(r),
+			},
+			Error: rec.status >= http.StatusInternalServerError,
+		})
+	}
+}
+
+// reject counts a batch that was refused before being stored
+func reject(telemetryType, reason string) {
+	stats.RejectedBatches.Inc(telemetryType, reason)
+}
@@ -7,5 +7,5 @@ import (
 )
 
 func HandleLogs(w http.ResponseWriter, r *http.Request) {
-	ProcessTelemetryRequest(w, r, "logs", database.InsertLogsData)
+	ProcessTelemetryRequest(w, r, "logs", database.InsertLogsDataInto)
 }
\ No newline at end of file
@@ -7,5 +7,5 @@ import (
 )
 
 func HandleMetrics(w http.ResponseWriter, r *http.Request) {
-	ProcessTelemetryRequest(w, r, "metrics", database.InsertMetricsData)
+	ProcessTelemetryRequest(w, r, "metrics", database.InsertMetricsDataInto)
 }
\ No newline at end of file
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/auth"
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/ratelimit"
+)
+
+var (
+	rateLimiterMu sync.RWMutex
+	rateLimiter   *ratelimit.Limiter
+)
+
+// SetRateLimiter enables per-client rate limiting of ingestion requests.
+// A nil limiter disables rate limiting.
+func SetRateLimiter(l *ratelimit.Limiter) {
+	rateLimiterMu.Lock()
+	defer rateLimiterMu.Unlock()
+	rateLimiter = l
+}
+
+// RateLimiter returns the current rate limiter, if any
+func RateLimiter() *ratelimit.Limiter {
+	rateLimiterMu.RLock()
+	defer rateLimiterMu.RUnlock()
+	return rateLimiter
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// clientIP returns the IP address of the connection that sent the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// countRecords returns the number of spans, log records or metric data
+// points in one resource entry of an OTLP payload
+func countRecords(telemetryType string, resourceEntry map[string]interface{}) int64 {
+	scopeKey, recordKey := recordListKeys(telemetryType)
+	if scopeKey == "" {
+		return 0
+	}
+
+	var count int64
+	scopes, _ := resourceEntry[scopeKey].([]interface{})
+	for _, s := range scopes {
+		scope, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		records, _ := scope[recordKey].([]interface{})
+		if telemetryType != "metrics" {
+			count += int64(len(records))
+			continue
+		}
+		// Metrics are charged per data point
+		for _, m := range records {
+			if metric, ok := m.(map[string]interface{}); ok {
+				count += database.CountDataPoints(metric)
+			}
+		}
+	}
+	return count
+}
+
+// countPayloadRecords returns the number of records in an OTLP payload
+func countPayloadRecords(telemetryType string, data map[string]interface{}) int64 {
+	var count int64
+	resources, _ := data[resourceListKey(telemetryType)].([]interface{})
+	for _, entry := range resources {
+		if resourceEntry, ok := entry.(map[string]interface{}); ok {
+			count += countRecords(telemetryType, resourceEntry)
+		}
+	}
+	return count
+}
+
+// rateLimitRequests builds the charges for one ingestion request. When
+// keying by service.name each service in the payload is charged for its own
+// records and an even share of the request bytes.
+func rateLimitRequests(r *http.Request, keyBy, telemetryType string, data map[string]interface{}, bytes int64) []ratelimit.Request {
+	resources, _ := data[resourceListKey(telemetryType)].([]interface{})
+
+	if keyBy == ratelimit.KeyByService {
+		records := make(map[string]int64)
+		for _, entry := range resources {
+			resourceEntry, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			resource, _ := resourceEntry["resource"].(map[string]interface{})
+			service := stringAttribute(resource["attributes"], "service.name")
+			if service == "" {
+				service = clientIP(r)
+			}
+			records[service] += countRecords(telemetryType, resourceEntry)
+		}
+		if len(records) > 0 {
+			keys := make([]string, 0, len(records))
+			for key := range records {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			requests := make([]ratelimit.Request, 0, len(keys))
+			share, rest := bytes/int64(len(keys)), bytes%int64(len(keys))
+			for i, key := range keys {
+				req := ratelimit.Request{Key: key, Bytes: share, Records: records[key]}
+				if int64(i) < rest {
+					req.Bytes++
+				}
+				requests = append(requests, req)
+			}
+			return requests
+		}
+	}
+
+	records := countPayloadRecords(telemetryType, data)
+	return []ratelimit.Request{{Key: rateLimitKey(r, keyBy), Bytes: bytes, Records: records}}
+}
+
+// rateLimitKey returns the key a request is charged to when it does not
+// depend on the payload
+func rateLimitKey(r *http.Request, keyBy string) string {
+	if keyBy == ratelimit.KeyByAPIKey {
+		if identity, ok := auth.FromContext(r.Context()); ok {
+			return identity.Name
+		}
+	}
+	return clientIP(r)
+}
+
+// throttle logs and rejects a request refused by the rate limiter
+func throttle(w http.ResponseWriter, reqLog *slog.Logger, telemetryType string, d ratelimit.Decision) {
+	reqLog.Info("Throttled request", "key", d.Key, "reason", d.Reason,
+		"retry_after", d.RetryAfter.Round(time.Millisecond))
+	reject(telemetryType, "rate_limited")
+	writeTooManyRequests(w, d)
+}
+
+// writeTooManyRequests sends a 429 response with a Retry-After header
+func writeTooManyRequests(w http.ResponseWriter, d ratelimit.Decision) {
+	seconds := int64((d.RetryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	http.Error(w, "Rate limit exceeded ("+d.Reason+")", http.StatusTooManyRequests)
+}
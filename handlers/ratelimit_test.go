@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RedShiftVelocity/sqlite-otel/ratelimit"
+)
+
+// unreadBody fails the test if the handler reads the request body
+type unreadBody struct{ t *testing.T }
+
+func (b unreadBody) Read(p []byte) (int, error) {
+	b.t.Error("Throttled request body was read")
+	return 0, io.EOF
+}
+
+func TestThrottledRequestIsNotParsed(t *testing.T) {
+	limiter, err := ratelimit.New(ratelimit.Config{Default: ratelimit.Limits{RequestsPerSecond: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetRateLimiter(limiter)
+	defer SetRateLimiter(nil)
+
+	post := func(req *http.Request) int {
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		ProcessTelemetryRequest(rec, req, "traces", func(*sql.DB, map[string]interface{}) error { return nil })
+		return rec.Code
+	}
+
+	// The first request is admitted, and charged even though it is invalid
+	if code := post(httptest.NewRequest(http.MethodPost, "/v1/traces", strings.NewReader("{"))); code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for invalid JSON, got %d", code)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", unreadBody{t})
+	req.ContentLength = 1 << 20
+	if code := post(req); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", code)
+	}
+}
+
+func TestServiceKeyedRequestsAreAdmittedByIP(t *testing.T) {
+	limiter, err := ratelimit.New(ratelimit.Config{KeyBy: ratelimit.KeyByService, Default: ratelimit.Limits{RequestsPerSecond: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetRateLimiter(limiter)
+	defer SetRateLimiter(nil)
+
+	post := func(req *http.Request) int {
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		ProcessTelemetryRequest(rec, req, "traces", func(*sql.DB, map[string]interface{}) error { return nil })
+		return rec.Code
+	}
+
+	body := `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"checkout"}}]}}]}`
+	if code := post(httptest.NewRequest(http.MethodPost, "/v1/traces", strings.NewReader(body))); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	// Naming another service does not get past the client's own limit
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", unreadBody{t})
+	req.ContentLength = 1 << 20
+	if code := post(req); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", code)
+	}
+}
+
+func TestServiceKeyedBytesAreSplit(t *testing.T) {
+	data := map[string]interface{}{"resourceLogs": []interface{}{
+		map[string]interface{}{"resource": map[string]interface{}{"attributes": []interface{}{
+			map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "a"}},
+		}}},
+		map[string]interface{}{"resource": map[string]interface{}{"attributes": []interface{}{
+			map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "b"}},
+		}}},
+	}}
+	requests := rateLimitRequests(httptest.NewRequest(http.MethodPost, "/v1/logs", nil), ratelimit.KeyByService, "logs", data, 101)
+	if len(requests) != 2 || requests[0].Bytes+requests[1].Bytes != 101 || requests[1].Bytes != 50 {
+		t.Errorf("Expected 101 bytes split across two services, got %+v", requests)
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/auth"
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+)
+
+// SQLOptions configures the SQL endpoint
+type SQLOptions struct {
+	DBPath   string        // Main database file, holding the default tenant
+	Timeout  time.Duration // Queries running longer are interrupted
+	MaxRows  int           // Results are truncated after this many rows
+	MaxBytes int64         // Results are truncated once their encoding reaches this size
+}
+
+// maxSQLLength is the longest query text accepted
+const maxSQLLength = 64 << 10
+
+// maxSQLQueries is the number of SQL queries that may run at once
+const maxSQLQueries = 4
+
+var (
+	sqlMu      sync.RWMutex
+	sqlOptions = SQLOptions{Timeout: 10 * time.Second, MaxRows: 10000, MaxBytes: 10 << 20}
+	sqlSlots   = make(chan struct{}, maxSQLQueries)
+)
+
+// SetSQLOptions configures /api/v1/sql
+func SetSQLOptions(opts SQLOptions) {
+	sqlMu.Lock()
+	defer sqlMu.Unlock()
+	sqlOptions = opts
+}
+
+// getSQLOptions returns the current SQL options
+func getSQLOptions() SQLOptions {
+	sqlMu.RLock()
+	defer sqlMu.RUnlock()
+	return sqlOptions
+}
+
+// sqlResult is the outcome of a SQL query
+type sqlResult struct {
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated"`
+}
+
+// HandleSQL serves /api/v1/sql, running one SELECT statement on a
+// read-only connection to the tenant's database. The statement is read
+// from the query parameter, a JSON body {"query": "..."} or a plain text
+// body; format=csv returns CSV instead of JSON.
+func HandleSQL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		http.Error(w, fmt.Sprintf("unknown format '%s': expected json or csv", format), http.StatusBadRequest)
+		return
+	}
+	query, err := readSQL(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query, err = database.CheckSelect(query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case sqlSlots <- struct{}{}:
+		defer func() { <-sqlSlots }()
+	default:
+		http.Error(w, "Too many SQL queries are running, retry later", http.StatusTooManyRequests)
+		return
+	}
+
+	opts := getSQLOptions()
+	tenant, dbPath, err := sqlTenantPath(r, opts)
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+	conn, err := database.OpenGuarded(dbPath)
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), opts.Timeout)
+	defer cancel()
+	start := time.Now()
+	result, err := runSQL(ctx, conn, query, opts)
+
+	key := ""
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		key = identity.Name
+	}
+	logging.Slog().Info("SQL query", "tenant", tenant, "key", key, "client", clientIP(r),
+		"rows", len(result.Rows), "duration", time.Since(start), "query", query, "error", err)
+
+	if err != nil {
+		switch {
+		case r.Context().Err() != nil:
+			// The client went away
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			http.Error(w, fmt.Sprintf("Query did not finish within %s", opts.Timeout), http.StatusGatewayTimeout)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("X-SQL-Truncated", strconv.FormatBool(result.Truncated))
+		writer := csv.NewWriter(w)
+		writer.Write(result.Columns)
+		record := make([]string, len(result.Columns))
+		for _, row := range result.Rows {
+			for i, value := range row {
+				record[i] = csvValue(value)
+			}
+			writer.Write(record)
+		}
+		writer.Flush()
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"tenant": tenant, "data": result})
+}
+
+// readSQL reads the statement of a SQL request
+func readSQL(r *http.Request) (string, error) {
+	if r.Method == http.MethodGet {
+		return r.URL.Query().Get("query"), nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSQLLength+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %w", err)
+	}
+	if len(body) > maxSQLLength {
+		return "", fmt.Errorf("query is longer than %d bytes", maxSQLLength)
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return string(body), nil
+	}
+	var request struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return "", fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return request.Query, nil
+}
+
+// sqlTenantPath resolves the tenant of a SQL request and its database file
+func sqlTenantPath(r *http.Request, opts SQLOptions) (string, string, error) {
+	manager, tenancy := getTenancy()
+	if manager == nil {
+		return database.DefaultTenant, opts.DBPath, nil
+	}
+	tenant, err := readTenant(r, tenancy)
+	if err != nil {
+		return "", "", err
+	}
+	if !manager.Exists(tenant) {
+		return "", "", fmt.Errorf("%w '%s'", errUnknownTenant, tenant)
+	}
+	if tenant == database.DefaultTenant {
+		return tenant, opts.DBPath, nil
+	}
+	return tenant, manager.Path(tenant), nil
+}
+
+// runSQL runs a query and collects its rows up to the row and byte caps
+func runSQL(ctx context.Context, conn *sql.DB, query string, opts SQLOptions) (sqlResult, error) {
+	result := sqlResult{Rows: [][]interface{}{}}
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	if result.Columns, err = rows.Columns(); err != nil {
+		return result, err
+	}
+	var size int64
+	for rows.Next() {
+		if opts.MaxRows > 0 && len(result.Rows) >= opts.MaxRows {
+			result.Truncated = true
+			break
+		}
+		row := make([]interface{}, len(result.Columns))
+		pointers := make([]interface{}, len(row))
+		for i := range row {
+			pointers[i] = &row[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return result, err
+		}
+		encoded, _ := json.Marshal(row)
+		size += int64(len(encoded))
+		if opts.MaxBytes > 0 && size > opts.MaxBytes {
+			result.Truncated = true
+			break
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+// csvValue formats a column value for CSV output
+func csvValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return base64.StdEncoding.EncodeToString(value)
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
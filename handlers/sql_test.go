@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+func TestSQLRunsGuardedSelects(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "main.db")
+	if err := database.InitDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+	if err := database.InsertLogsData(tailLogs("checkout", 9, 13, 17)); err != nil {
+		t.Fatal(err)
+	}
+	SetSQLOptions(SQLOptions{DBPath: dbPath, Timeout: time.Second, MaxRows: 2, MaxBytes: 1 << 20})
+
+	sqlRequest := func(method, query, format string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		target := "/api/v1/sql?format=" + format
+		var req *http.Request
+		if method == http.MethodGet {
+			req = httptest.NewRequest(method, target+"&query="+url.QueryEscape(query), nil)
+		} else {
+			req = httptest.NewRequest(method, target, strings.NewReader(`{"query":`+strconv.Quote(query)+`}`))
+			req.Header.Set("Content-Type", "application/json")
+		}
+		HandleSQL(rec, req)
+		return rec
+	}
+
+	rec := sqlRequest(http.MethodGet, "SELECT severity_number FROM log_records ORDER BY severity_number;", "json")
+	var response struct {
+		Data sqlResult `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected a JSON result, got %d %s", rec.Code, rec.Body)
+	}
+	if len(response.Data.Rows) != 2 || !response.Data.Truncated || response.Data.Columns[0] != "severity_number" {
+		t.Errorf("Expected two rows and truncation, got %+v", response.Data)
+	}
+
+	rec = sqlRequest(http.MethodPost, "SELECT count(*) AS n, 'a,b' AS s FROM log_records", "csv")
+	if rec.Code != http.StatusOK || rec.Body.String() != "n,s\n3,\"a,b\"\n" || rec.Header().Get("X-SQL-Truncated") != "false" {
+		t.Errorf("Unexpected CSV result %d %q", rec.Code, rec.Body)
+	}
+
+	for _, query := range []string{"DELETE FROM log_records", "SELECT 1; DELETE FROM log_records", "SELECT load_extension('x')"} {
+		if rec := sqlRequest(http.MethodPost, query, "json"); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected %q to be rejected, got %d", query, rec.Code)
+		}
+	}
+
+	SetSQLOptions(SQLOptions{DBPath: dbPath, Timeout: 50 * time.Millisecond, MaxRows: 1, MaxBytes: 1 << 20})
+	slow := "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT count(*) FROM n"
+	if rec := sqlRequest(http.MethodGet, slow, "json"); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected the query to time out, got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+)
+
+// tailBuffer is the number of events queued for a tail subscriber; events
+// arriving while its queue is full are dropped
+const tailBuffer = 256
+
+// tailPingInterval is how often an idle tail stream sends a comment so
+// proxies and clients do not time it out
+const tailPingInterval = 15 * time.Second
+
+// tailFilter selects the records a tail subscriber receives
+type tailFilter struct {
+	signals     []string
+	service     string
+	traceID     string
+	minSeverity int64 // 0 for none; otherwise only log records at or above it
+}
+
+// tailEvent is one record sent to tail subscribers
+type tailEvent struct {
+	Tenant     string      `json:"tenant"`
+	Signal     string      `json:"signal"`
+	Service    string      `json:"service,omitempty"`
+	Attributes interface{} `json:"resourceAttributes,omitempty"`
+	Scope      interface{} `json:"scope,omitempty"`
+	Record     interface{} `json:"record"`
+}
+
+// tailMessage is an encoded event waiting to be written to a subscriber
+type tailMessage struct {
+	signal string
+	data   []byte
+}
+
+// tailSubscriber is one open tail stream
+type tailSubscriber struct {
+	tenant  string
+	filter  tailFilter
+	events  chan tailMessage
+	dropped atomic.Int64
+	done    chan struct{} // Closed by CloseTails
+}
+
+var (
+	// tailMu serializes subscribing; publishing only loads tailSubscribers
+	// so it never waits on a stream being opened or closed
+	tailMu          sync.Mutex
+	tailSubscribers atomic.Pointer[[]*tailSubscriber]
+	removeTailHook  func()
+)
+
+// subscribeTail registers a subscriber, installing the commit hook for
+// the first one
+func subscribeTail(tenant string, filter tailFilter) *tailSubscriber {
+	sub := &tailSubscriber{
+		tenant: tenant,
+		filter: filter,
+		events: make(chan tailMessage, tailBuffer),
+		done:   make(chan struct{}),
+	}
+	tailMu.Lock()
+	defer tailMu.Unlock()
+	var subs []*tailSubscriber
+	if current := tailSubscribers.Load(); current != nil {
+		subs = append(subs, *current...)
+	}
+	subs = append(subs, sub)
+	tailSubscribers.Store(&subs)
+	if removeTailHook == nil {
+		removeTailHook = AddCommitHook(publishTail)
+	}
+	// A stream opened while CloseTails runs ends straight away
+	if Draining() {
+		close(sub.done)
+	}
+	return sub
+}
+
+// unsubscribeTail removes a subscriber, removing the commit hook with the
+// last one
+func unsubscribeTail(sub *tailSubscriber) {
+	tailMu.Lock()
+	defer tailMu.Unlock()
+	var subs []*tailSubscriber
+	if current := tailSubscribers.Load(); current != nil {
+		for _, s := range *current {
+			if s != sub {
+				subs = append(subs, s)
+			}
+		}
+	}
+	tailSubscribers.Store(&subs)
+	if len(subs) == 0 && removeTailHook != nil {
+		removeTailHook()
+		removeTailHook = nil
+	}
+}
+
+// CloseTails ends all open tail streams. It is called on shutdown because
+// the streams would otherwise keep the server from finishing its drain.
+func CloseTails() {
+	tailMu.Lock()
+	defer tailMu.Unlock()
+	if current := tailSubscribers.Load(); current != nil {
+		for _, s := range *current {
+			select {
+			case <-s.done:
+			default:
+				close(s.done)
+			}
+		}
+	}
+}
+
+// matches reports whether a record passes the subscriber's filter
+func (s *tailSubscriber) matches(tenant, signal, service string, record map[string]interface{}) bool {
+	if tenant != s.tenant {
+		return false
+	}
+	if s.filter.service != "" && service != s.filter.service {
+		return false
+	}
+	found := false
+	for _, want := range s.filter.signals {
+		found = found || want == signal
+	}
+	if !found {
+		return false
+	}
+	if s.filter.traceID != "" {
+		if id, _ := record["traceId"].(string); id != s.filter.traceID {
+			return false
+		}
+	}
+	if s.filter.minSeverity > 0 {
+		severity, _ := record["severityNumber"].(float64)
+		if signal != database.SignalLogs || int64(severity) < s.filter.minSeverity {
+			return false
+		}
+	}
+	return true
+}
+
+// publishTail is the commit hook feeding tail subscribers. It never
+// blocks: a subscriber whose queue is full misses the event.
+func publishTail(tenant, signal string, data map[string]interface{}) {
+	current := tailSubscribers.Load()
+	if current == nil || len(*current) == 0 {
+		return
+	}
+	subs := *current
+	scopeKey, recordKey := recordListKeys(signal)
+	resources, _ := data[resourceListKey(signal)].([]interface{})
+	for _, r := range resources {
+		resourceEntry, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resource, _ := resourceEntry["resource"].(map[string]interface{})
+		attributes := resource["attributes"]
+		service := stringAttribute(attributes, "service.name")
+		scopes, _ := resourceEntry[scopeKey].([]interface{})
+		for _, sc := range scopes {
+			scopeEntry, ok := sc.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			records, _ := scopeEntry[recordKey].([]interface{})
+			for _, rec := range records {
+				record, ok := rec.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				var encoded []byte
+				for _, sub := range subs {
+					if !sub.matches(tenant, signal, service, record) {
+						continue
+					}
+					// Encode once, for the first subscriber that wants the record
+					if encoded == nil {
+						var err error
+						encoded, err = json.Marshal(tailEvent{
+							Tenant:     tenant,
+							Signal:     signal,
+							Service:    service,
+							Attributes: attributes,
+							Scope:      scopeEntry["scope"],
+							Record:     record,
+						})
+						if err != nil {
+							logging.Warn("Failed to encode tail event: %v", err)
+							break
+						}
+					}
+					select {
+					case sub.events <- tailMessage{signal: signal, data: encoded}:
+					default:
+						sub.dropped.Add(1)
+					}
+				}
+			}
+		}
+	}
+}
+
+// tailTenant returns the tenant a tail request watches. Unlike queries it
+// may name a tenant that has not written data yet.
+func tailTenant(r *http.Request) (string, error) {
+	manager, opts := getTenancy()
+	if manager == nil {
+		return database.DefaultTenant, nil
+	}
+	return readTenant(r, opts)
+}
+
+// HandleTail serves GET /api/v1/tail, streaming records of the tenant as
+// Server-Sent Events as they are stored. The signal, service, trace_id and
+// min_severity parameters filter the stream; min_severity limits it to log
+// records. A client that reads too slowly misses events and is sent a
+// dropped event with their number.
+func HandleTail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if Draining() {
+		writeUnavailable(w, drainRetryAfter, "Server is shutting down")
+		return
+	}
+	values := r.URL.Query()
+	signals, err := parseSignalParam(values.Get("signal"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := tailFilter{signals: signals, service: values.Get("service"), traceID: values.Get("trace_id")}
+	if s := values.Get("min_severity"); s != "" {
+		if filter.minSeverity, err = database.ParseSeverity(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	tenant, err := tailTenant(r)
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+
+	// Subscribe before answering so no record stored after the client sees
+	// the stream open is missed
+	sub := subscribeTail(tenant, filter)
+	defer unsubscribeTail(sub)
+
+	// The stream stays open far longer than the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil || rc.Flush() != nil {
+		return
+	}
+
+	ping := time.NewTicker(tailPingInterval)
+	defer ping.Stop()
+
+	var reported int64
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.done:
+			return
+		case msg := <-sub.events:
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.signal, msg.data)
+		case <-ping.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		}
+		if dropped := sub.dropped.Load(); err == nil && dropped > reported {
+			_, err = fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", dropped-reported)
+			reported = dropped
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+// tailLogs builds a logs payload of one service with a record per severity
+func tailLogs(service string, severities ...float64) map[string]interface{} {
+	var records []interface{}
+	for _, s := range severities {
+		records = append(records, map[string]interface{}{"severityNumber": s,
+			"body": map[string]interface{}{"stringValue": "message"}})
+	}
+	return map[string]interface{}{"resourceLogs": []interface{}{map[string]interface{}{
+		"resource": map[string]interface{}{"attributes": []interface{}{map[string]interface{}{
+			"key": "service.name", "value": map[string]interface{}{"stringValue": service}}}},
+		"scopeLogs": []interface{}{map[string]interface{}{"logRecords": records}},
+	}}}
+}
+
+func TestTailStreamsFilteredRecords(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(HandleTail))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/tail?signal=logs&service=checkout&min_severity=warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %v", resp.StatusCode, resp.Header)
+	}
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != ": connected\n" {
+		t.Fatalf("Expected the stream to open, got %q, %v", line, err)
+	}
+	reader.ReadString('\n')
+
+	committed(database.DefaultTenant, "logs", tailLogs("cart", 21))
+	committed(database.DefaultTenant, "traces", map[string]interface{}{})
+	committed(database.DefaultTenant, "logs", tailLogs("checkout", 9, 17))
+
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	if lines[0] != "event: logs" || lines[2] != "" {
+		t.Fatalf("Expected one logs event, got %q", lines)
+	}
+	var event struct {
+		Service string                 `json:"service"`
+		Record  map[string]interface{} `json:"record"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Service != "checkout" || event.Record["severityNumber"] != float64(17) {
+		t.Errorf("Expected only the checkout error, got %+v", event)
+	}
+
+	rec := httptest.NewRecorder()
+	HandleTail(rec, httptest.NewRequest(http.MethodGet, "/api/v1/tail?min_severity=loud", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown severity, got %d", rec.Code)
+	}
+}
+
+func TestTailDropsForSlowSubscribers(t *testing.T) {
+	sub := subscribeTail(database.DefaultTenant, tailFilter{signals: database.Signals})
+	defer unsubscribeTail(sub)
+
+	severities := make([]float64, tailBuffer+10)
+	committed(database.DefaultTenant, "logs", tailLogs("checkout", severities...))
+	if len(sub.events) != tailBuffer || sub.dropped.Load() != 10 {
+		t.Errorf("Expected %d queued and 10 dropped, got %d and %d", tailBuffer, len(sub.events), sub.dropped.Load())
+	}
+
+	CloseTails()
+	select {
+	case <-sub.done:
+	case <-time.After(time.Second):
+		t.Error("Expected CloseTails to end the subscription")
+	}
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/RedShiftVelocity/sqlite-otel/auth"
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+// Tenant resolution sources, tried in the configured order
+const (
+	TenantSourceHeader    = "header"    // request header such as X-Scope-OrgID
+	TenantSourceKey       = "key"       // tenant bound to the authenticated API key
+	TenantSourceIdentity  = "identity"  // common name of the TLS client certificate
+	TenantSourceAttribute = "attribute" // resource attribute on each resource
+)
+
+// DefaultTenantHeader is the header read by the header tenant source
+const DefaultTenantHeader = "X-Scope-OrgID"
+
+// errInvalidTenant is returned when a resolved tenant name is not usable
+var errInvalidTenant = errors.New("invalid tenant")
+
+// errUnknownTenant is returned when reading from a tenant without data
+var errUnknownTenant = errors.New("unknown tenant")
+
+// errForbiddenTenant is returned when an API key bound to one tenant
+// addresses another
+var errForbiddenTenant = errors.New("forbidden tenant")
+
+// TenantOptions configures how requests are mapped to tenants
+type TenantOptions struct {
+	Sources   []string // Resolution sources in priority order
+	Header    string   // Header for the header source
+	Attribute string   // Resource attribute for the attribute source
+}
+
+// ParseTenantSources parses a comma separated list of tenant sources
+func ParseTenantSources(value string) ([]string, error) {
+	var sources []string
+	for _, source := range strings.Split(value, ",") {
+		source = strings.TrimSpace(source)
+		switch source {
+		case "":
+			continue
+		case TenantSourceHeader, TenantSourceKey, TenantSourceIdentity, TenantSourceAttribute:
+			sources = append(sources, source)
+		default:
+			return nil, fmt.Errorf("unknown tenant source '%s'", source)
+		}
+	}
+	return sources, nil
+}
+
+var (
+	tenantMu      sync.RWMutex
+	tenantManager *database.TenantManager
+	tenantOptions TenantOptions
+)
+
+// SetTenancy enables per-tenant databases. A nil manager disables tenancy
+// and stores everything in the main database.
+func SetTenancy(manager *database.TenantManager, opts TenantOptions) {
+	if opts.Header == "" {
+		opts.Header = DefaultTenantHeader
+	}
+	tenantMu.Lock()
+	defer tenantMu.Unlock()
+	tenantManager = manager
+	tenantOptions = opts
+}
+
+// getTenancy returns the current tenant manager and options
+func getTenancy() (*database.TenantManager, TenantOptions) {
+	tenantMu.RLock()
+	defer tenantMu.RUnlock()
+	return tenantManager, tenantOptions
+}
+
+// requestTenant resolves the tenant from request-level sources only.
+// The attribute source is skipped since it depends on the payload.
+func requestTenant(r *http.Request, opts TenantOptions) string {
+	return resolveTenant(r, opts, nil)
+}
+
+// readTenant resolves the tenant a read request addresses and checks that
+// the caller may access it
+func readTenant(r *http.Request, opts TenantOptions) (string, error) {
+	tenant := requestTenant(r, opts)
+	if !database.ValidTenantName(tenant) {
+		return "", fmt.Errorf("%w '%s'", errInvalidTenant, tenant)
+	}
+	if err := checkTenantAccess(r, tenant); err != nil {
+		return "", err
+	}
+	return tenant, nil
+}
+
+// checkTenantAccess rejects a tenant other than the one bound to the
+// request's API key, whatever source named it. Keys without a tenant may
+// address any tenant.
+func checkTenantAccess(r *http.Request, tenant string) error {
+	identity, ok := auth.FromContext(r.Context())
+	if !ok || identity.Tenant == "" || identity.Tenant == tenant {
+		return nil
+	}
+	return fmt.Errorf("%w: key '%s' may not access tenant '%s'", errForbiddenTenant, identity.Name, tenant)
+}
+
+// resolveTenant returns the first tenant found by the configured sources,
+// or the default tenant when none of them yields a value
+func resolveTenant(r *http.Request, opts TenantOptions, resource map[string]interface{}) string {
+	for _, source := range opts.Sources {
+		var tenant string
+		switch source {
+		case TenantSourceHeader:
+			tenant = strings.TrimSpace(r.Header.Get(opts.Header))
+		case TenantSourceKey:
+			if identity, ok := auth.FromContext(r.Context()); ok {
+				tenant = identity.Tenant
+			}
+		case TenantSourceIdentity:
+			if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+				tenant = r.TLS.VerifiedChains[0][0].Subject.CommonName
+			}
+		case TenantSourceAttribute:
+			if resource != nil {
+				tenant = stringAttribute(resource["attributes"], opts.Attribute)
+			}
+		}
+		if tenant != "" {
+			return tenant
+		}
+	}
+	return database.DefaultTenant
+}
+
+// stringAttribute returns the string value of key in an OTLP attribute list
+func stringAttribute(attributes interface{}, key string) string {
+	list, ok := attributes.([]interface{})
+	if !ok {
+		return ""
+	}
+	for _, a := range list {
+		attr, ok := a.(map[string]interface{})
+		if !ok || attr["key"] != key {
+			continue
+		}
+		if value, ok := attr["value"].(map[string]interface{}); ok {
+			s, _ := value["stringValue"].(string)
+			return s
+		}
+	}
+	return ""
+}
+
+// splitByTenant groups the resources of a payload by their tenant
+func splitByTenant(r *http.Request, opts TenantOptions, telemetryType string, data map[string]interface{}) map[string]map[string]interface{} {
+	listKey := resourceListKey(telemetryType)
+	usesAttribute := false
+	for _, source := range opts.Sources {
+		if source == TenantSourceAttribute {
+			usesAttribute = true
+		}
+	}
+
+	resources, ok := data[listKey].([]interface{})
+	if !usesAttribute || !ok {
+		return map[string]map[string]interface{}{requestTenant(r, opts): data}
+	}
+
+	grouped := make(map[string][]interface{})
+	for _, entry := range resources {
+		var resource map[string]interface{}
+		if resourceEntry, ok := entry.(map[string]interface{}); ok {
+			resource, _ = resourceEntry["resource"].(map[string]interface{})
+		}
+		tenant := resolveTenant(r, opts, resource)
+		grouped[tenant] = append(grouped[tenant], entry)
+	}
+
+	payloads := make(map[string]map[string]interface{}, len(grouped))
+	for tenant, entries := range grouped {
+		payloads[tenant] = map[string]interface{}{listKey: entries}
+	}
+	return payloads
+}
+
+// storeTelemetry writes a payload to the database of each tenant it belongs to
+func storeTelemetry(r *http.Request, telemetryType string, data map[string]interface{}, insertFunc func(conn *sql.DB, data map[string]interface{}) error) error {
+	manager, opts := getTenancy()
+	if manager == nil {
+		if err := insertFunc(database.DB(), data); err != nil {
+			return err
+		}
+		committed(database.DefaultTenant, telemetryType, data)
+		return nil
+	}
+
+	payloads := splitByTenant(r, opts, telemetryType, data)
+	tenants := make([]string, 0, len(payloads))
+	for tenant := range payloads {
+		if !database.ValidTenantName(tenant) {
+			return fmt.Errorf("%w '%s'", errInvalidTenant, tenant)
+		}
+		if err := checkTenantAccess(r, tenant); err != nil {
+			return err
+		}
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	for _, tenant := range tenants {
+		if err := storeTenantTelemetry(manager, tenant, payloads[tenant], insertFunc); err != nil {
+			return err
+		}
+		committed(tenant, telemetryType, payloads[tenant])
+	}
+	return nil
+}
+
+// storeTenantTelemetry enforces the tenant quota and inserts the payload
+func storeTenantTelemetry(manager *database.TenantManager, tenant string, data map[string]interface{}, insertFunc func(conn *sql.DB, data map[string]interface{}) error) error {
+	conn, release, err := manager.Acquire(tenant)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := manager.CheckQuota(tenant, conn); err != nil {
+		return err
+	}
+	if err := insertFunc(conn, data); err != nil {
+		return fmt.Errorf("tenant '%s': %w", tenant, err)
+	}
+	return nil
+}
+
+// withTenantDB resolves the request tenant and runs fn against its database
+func withTenantDB(r *http.Request, fn func(tenant string, conn *sql.DB) error) error {
+	manager, opts := getTenancy()
+	if manager == nil {
+		return fn(database.DefaultTenant, database.DB())
+	}
+
+	tenant, err := readTenant(r, opts)
+	if err != nil {
+		return err
+	}
+	// Reading must not create databases for tenants that never wrote data
+	if !manager.Exists(tenant) {
+		return fmt.Errorf("%w '%s'", errUnknownTenant, tenant)
+	}
+	conn, release, err := manager.Acquire(tenant)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn(tenant, conn)
+}
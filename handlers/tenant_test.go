@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RedShiftVelocity/sqlite-otel/auth"
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+func TestBoundKeyCannotAddressOtherTenants(t *testing.T) {
+	dir := t.TempDir()
+	if err := database.InitDB(filepath.Join(dir, "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+	manager := database.NewTenantManager(filepath.Join(dir, "tenants"), 4)
+	defer manager.Close()
+	SetTenancy(manager, TenantOptions{Sources: []string{TenantSourceHeader, TenantSourceKey}})
+	defer SetTenancy(nil, TenantOptions{})
+
+	store, err := auth.NewStore([]auth.Key{
+		{Name: "payments", Hash: auth.HashToken("payments-token"), Permissions: []string{"*"}, Tenant: "payments"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(handler http.HandlerFunc, method, path, tenant, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer payments-token")
+		req.Header.Set("Content-Type", "application/json")
+		if tenant != "" {
+			req.Header.Set(DefaultTenantHeader, tenant)
+		}
+		rec := httptest.NewRecorder()
+		store.Require(auth.PermRead, handler).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	logs := `{"resourceLogs":[{"resource":{},"scopeLogs":[{"logRecords":[{"body":{"stringValue":"hi"}}]}]}]}`
+	if code := send(HandleLogs, http.MethodPost, "/v1/logs", "", logs); code != http.StatusOK {
+		t.Fatalf("Expected the key to write its own tenant, got %d", code)
+	}
+	if code := send(HandleLogs, http.MethodPost, "/v1/logs", "checkout", logs); code != http.StatusForbidden {
+		t.Errorf("Expected 403 writing another tenant, got %d", code)
+	}
+	if code := send(HandleQueryLogs, http.MethodGet, "/api/v1/logs", "payments", ""); code != http.StatusOK {
+		t.Errorf("Expected the key to read its own tenant, got %d", code)
+	}
+	for _, tenant := range []string{"checkout", database.DefaultTenant} {
+		if code := send(HandleQueryLogs, http.MethodGet, "/api/v1/logs", tenant, ""); code != http.StatusForbidden {
+			t.Errorf("Expected 403 reading tenant %s, got %d", tenant, code)
+		}
+	}
+}
+
+func TestNewTenantsBeyondLimitAreRejected(t *testing.T) {
+	dir := t.TempDir()
+	if err := database.InitDB(filepath.Join(dir, "main.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+	manager := database.NewTenantManager(filepath.Join(dir, "tenants"), 4)
+	defer manager.Close()
+	manager.SetMaxTenants(1)
+	SetTenancy(manager, TenantOptions{Sources: []string{TenantSourceHeader}})
+	defer SetTenancy(nil, TenantOptions{})
+
+	send := func(tenant string) int {
+		logs := `{"resourceLogs":[{"resource":{},"scopeLogs":[{"logRecords":[{"body":{"stringValue":"hi"}}]}]}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/logs", strings.NewReader(logs))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(DefaultTenantHeader, tenant)
+		rec := httptest.NewRecorder()
+		HandleLogs(rec, req)
+		return rec.Code
+	}
+	if code := send("checkout"); code != http.StatusOK {
+		t.Fatalf("Expected the first tenant to be created, got %d", code)
+	}
+	if code := send("random-1"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a tenant beyond the limit, got %d", code)
+	}
+	if code := send("checkout"); code != http.StatusOK {
+		t.Errorf("Expected the existing tenant to stay writable, got %d", code)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/importer"
+)
+
+// runImport implements the import subcommand
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import [options] FILE...\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Load OTLP JSON, Jaeger JSON or Zipkin JSON files, optionally gzipped, into a database.")
+		fmt.Fprintln(fs.Output(), "Use - to read standard input.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	dbPath := fs.String("db", getDefaultDBPath(), "Path to the SQLite database to write, created if missing")
+	format := fs.String("format", importer.FormatAuto, "File format: auto, otlp, jaeger or zipkin")
+	batchSize := fs.Int("batch-size", importer.DefaultBatchSize, "Zipkin spans per transaction")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		return usageError(fs, "arguments", fmt.Errorf("no files given"))
+	}
+
+	if err := database.InitDB(*dbPath); err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		return 1
+	}
+	defer database.CloseDB()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	opts := importer.Options{Format: *format, BatchSize: *batchSize}
+	code := 0
+	for _, path := range fs.Args() {
+		result, err := importFile(ctx, path, opts)
+		if result != nil && (err == nil || len(result.Accepted)+len(result.Rejected) > 0) {
+			printImportResult(os.Stdout, path, result)
+			for _, n := range result.Rejected {
+				if n > 0 {
+					code = 1
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "import: %s: %v\n", path, err)
+			code = 1
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return code
+}
+
+// importFile imports one file, or standard input for -
+func importFile(ctx context.Context, path string, opts importer.Options) (*importer.Result, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return importer.Import(ctx, database.DB(), r, opts)
+}
+
+// printImportResult writes the accepted and rejected counts of a file
+func printImportResult(w io.Writer, path string, result *importer.Result) {
+	fmt.Fprintf(w, "%s (%s):\n", path, result.Format)
+	signals := make(map[string]bool)
+	for s := range result.Accepted {
+		signals[s] = true
+	}
+	for s := range result.Rejected {
+		signals[s] = true
+	}
+	var names []string
+	for s := range signals {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		fmt.Fprintln(w, "  no records")
+	}
+	for _, s := range names {
+		fmt.Fprintf(w, "  %s: %d accepted, %d rejected\n", s, result.Accepted[s], result.Rejected[s])
+	}
+	for _, e := range result.Errors {
+		fmt.Fprintf(w, "  rejected: %s\n", e)
+	}
+}
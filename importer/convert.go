@@ -0,0 +1,185 @@
+package importer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OTLP span kinds and status codes
+const (
+	kindUnspecified = 0
+	kindInternal    = 1
+	kindServer      = 2
+	kindClient      = 3
+	kindProducer    = 4
+	kindConsumer    = 5
+
+	statusOK    = 1
+	statusError = 2
+)
+
+// spanKinds maps span.kind tag values and Zipkin kinds to OTLP span kinds
+var spanKinds = map[string]float64{
+	"internal": kindInternal,
+	"server":   kindServer,
+	"client":   kindClient,
+	"producer": kindProducer,
+	"consumer": kindConsumer,
+}
+
+// normalizeID validates a hex trace or span ID and left pads it to size
+// bytes, since Jaeger and Zipkin allow 64-bit trace IDs and drop leading
+// zeros
+func normalizeID(id string, size int) (string, error) {
+	id = strings.ToLower(id)
+	if len(id) > 2*size || len(id) == 0 {
+		return "", fmt.Errorf("invalid ID '%s': expected up to %d hex digits", id, 2*size)
+	}
+	id = strings.Repeat("0", 2*size-len(id)) + id
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", fmt.Errorf("invalid ID '%s': not hex", id)
+	}
+	return id, nil
+}
+
+// microsToNano converts a microsecond timestamp to an OTLP JSON string
+func microsToNano(us int64) string {
+	return strconv.FormatInt(us*1000, 10)
+}
+
+// attributes builds OTLP key-value attributes in key order
+func attributes(values map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, map[string]interface{}{"key": k, "value": anyValue(values[k])})
+	}
+	return attrs
+}
+
+// base64Value is a base64 encoded bytes attribute value
+type base64Value string
+
+// anyValue converts a Go value to an OTLP JSON AnyValue
+func anyValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	case base64Value:
+		return map[string]interface{}{"bytesValue": string(v)}
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+}
+
+// takeStatus removes the tags that describe a span's status, including
+// the error tag Jaeger and Zipkin use to mark failed spans, and returns
+// the OTLP status, or nil when unset
+func takeStatus(tags map[string]interface{}) map[string]interface{} {
+	status := map[string]interface{}{}
+	if v, ok := tags["error"]; ok {
+		delete(tags, "error")
+		switch v := v.(type) {
+		case bool:
+			if v {
+				status["code"] = float64(statusError)
+			}
+		case string:
+			// Zipkin puts the error message in the tag
+			if v != "false" {
+				status["code"] = float64(statusError)
+				if v != "" && v != "true" {
+					status["message"] = v
+				}
+			}
+		}
+	}
+	if v, ok := tags["otel.status_code"].(string); ok {
+		delete(tags, "otel.status_code")
+		switch strings.ToUpper(v) {
+		case "OK":
+			status["code"] = float64(statusOK)
+		case "ERROR":
+			status["code"] = float64(statusError)
+		}
+	}
+	if v, ok := tags["otel.status_description"].(string); ok {
+		delete(tags, "otel.status_description")
+		status["message"] = v
+	}
+	if len(status) == 0 {
+		return nil
+	}
+	return status
+}
+
+// takeScope removes the tags naming the instrumentation scope and returns
+// the OTLP scope
+func takeScope(tags map[string]interface{}) map[string]interface{} {
+	scope := map[string]interface{}{}
+	for _, prefix := range []string{"otel.library.", "otel.scope."} {
+		if v, ok := tags[prefix+"name"].(string); ok {
+			delete(tags, prefix+"name")
+			scope["name"] = v
+		}
+		if v, ok := tags[prefix+"version"].(string); ok {
+			delete(tags, prefix+"version")
+			scope["version"] = v
+		}
+	}
+	return scope
+}
+
+// spanGrouper builds an OTLP traces request, grouping spans by resource
+// and scope in the order they are first seen
+type spanGrouper struct {
+	resources []interface{}
+	byKey     map[string]map[string]interface{} // Resource entries
+	scopes    map[string]map[string]interface{} // Scope entries by resource and scope
+}
+
+func newSpanGrouper() *spanGrouper {
+	return &spanGrouper{
+		byKey:  make(map[string]map[string]interface{}),
+		scopes: make(map[string]map[string]interface{}),
+	}
+}
+
+// add appends a span under a resource identified by resourceKey
+func (g *spanGrouper) add(resourceKey string, resource, scope, span map[string]interface{}) {
+	scopeName, _ := scope["name"].(string)
+	scopeVersion, _ := scope["version"].(string)
+	key := resourceKey + "\x00" + scopeName + "\x00" + scopeVersion
+	sm, ok := g.scopes[key]
+	if !ok {
+		rm, ok := g.byKey[resourceKey]
+		if !ok {
+			rm = map[string]interface{}{"resource": resource, "scopeSpans": []interface{}{}}
+			g.byKey[resourceKey] = rm
+			g.resources = append(g.resources, rm)
+		}
+		sm = map[string]interface{}{"scope": scope, "spans": []interface{}{}}
+		g.scopes[key] = sm
+		rm["scopeSpans"] = append(rm["scopeSpans"].([]interface{}), sm)
+	}
+	sm["spans"] = append(sm["spans"].([]interface{}), span)
+}
+
+// request returns the grouped spans as an export request
+func (g *spanGrouper) request() map[string]interface{} {
+	return map[string]interface{}{"resourceSpans": g.resources}
+}
@@ -0,0 +1,342 @@
+// Package importer loads telemetry files into the database through the
+// same insert path as the OTLP receiver. It reads OTLP JSON as written by
+// the OpenTelemetry Collector file exporter, traces downloaded as JSON from
+// the Jaeger UI, and Zipkin v2 JSON from /api/v2/trace or /api/v2/traces.
+package importer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+// File formats
+const (
+	FormatAuto   = "auto"
+	FormatOTLP   = "otlp"
+	FormatJaeger = "jaeger"
+	FormatZipkin = "zipkin"
+)
+
+// DefaultBatchSize is the number of Zipkin spans inserted per transaction
+const DefaultBatchSize = 1000
+
+// maxErrors is the number of rejection reasons kept in a Result
+const maxErrors = 10
+
+// Options configures an import
+type Options struct {
+	Format    string // One of the Format constants (default: auto)
+	BatchSize int    // Zipkin spans per transaction (default: 1000)
+}
+
+// Result reports what an import stored
+type Result struct {
+	Format   string
+	Accepted map[string]int64 // Records stored, by signal
+	Rejected map[string]int64 // Records that could not be converted or stored, by signal
+	Errors   []string         // The first rejection reasons
+}
+
+// reject counts records that were not stored
+func (r *Result) reject(signal string, n int64, err error) {
+	r.Rejected[signal] += n
+	if len(r.Errors) < maxErrors {
+		r.Errors = append(r.Errors, err.Error())
+	}
+}
+
+// importer holds the state of one import
+type importer struct {
+	ctx    context.Context
+	conn   *sql.DB
+	opts   Options
+	result *Result
+}
+
+// Import reads a file in the given format, gzip compressed or not, and
+// inserts its records into conn. Invalid records are counted in the
+// result; an error means the file itself could not be read or the
+// database is busy or full, and the result covers what was stored so far.
+func Import(ctx context.Context, conn *sql.DB, r io.Reader, opts Options) (*Result, error) {
+	if opts.Format == "" {
+		opts.Format = FormatAuto
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	switch opts.Format {
+	case FormatAuto, FormatOTLP, FormatJaeger, FormatZipkin:
+	default:
+		return nil, fmt.Errorf("unknown format '%s' (expected auto, otlp, jaeger or zipkin)", opts.Format)
+	}
+
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip data: %w", err)
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+
+	im := &importer{ctx: ctx, conn: conn, opts: opts, result: &Result{
+		Accepted: make(map[string]int64),
+		Rejected: make(map[string]int64),
+	}}
+	dec := json.NewDecoder(br)
+	format, firstKey, err := detect(dec)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Format != FormatAuto && opts.Format != format {
+		return nil, fmt.Errorf("file looks like %s, not %s", format, opts.Format)
+	}
+	im.result.Format = format
+
+	switch format {
+	case FormatOTLP:
+		err = im.readOTLP(dec, firstKey)
+	case FormatJaeger:
+		err = im.readJaeger(dec, firstKey)
+	case FormatZipkin:
+		err = im.readZipkin(dec)
+	}
+	return im.result, err
+}
+
+// detect reads the opening of the file and decides its format. For JSON
+// objects the first key has been consumed and is returned.
+func detect(dec *json.Decoder) (string, string, error) {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return "", "", fmt.Errorf("file is empty")
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("invalid JSON: %w", err)
+	}
+	switch tok {
+	case json.Delim('['):
+		return FormatZipkin, "", nil
+	case json.Delim('{'):
+		tok, err := dec.Token()
+		if err != nil {
+			return "", "", fmt.Errorf("invalid JSON: %w", err)
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return "", "", fmt.Errorf("file contains an empty object")
+		}
+		if strings.HasPrefix(key, "resource") {
+			return FormatOTLP, key, nil
+		}
+		return FormatJaeger, key, nil
+	}
+	return "", "", fmt.Errorf("unrecognized file: expected a JSON object or array")
+}
+
+// readObject decodes the rest of an object whose opening brace and first
+// key have been read
+func readObject(dec *json.Decoder, firstKey string) (map[string]interface{}, error) {
+	obj := make(map[string]interface{})
+	key := firstKey
+	for {
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		obj[key] = value
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		if tok == json.Delim('}') {
+			return obj, nil
+		}
+		if key, _ = tok.(string); key == "" {
+			return nil, fmt.Errorf("invalid JSON: expected an object key")
+		}
+	}
+}
+
+// readOTLP inserts a stream of OTLP JSON export requests, one per line
+// or simply one after another
+func (im *importer) readOTLP(dec *json.Decoder, firstKey string) error {
+	req, err := readObject(dec, firstKey)
+	for err == nil {
+		if err := im.insertRequest(req); err != nil {
+			return err
+		}
+		req = nil
+		err = dec.Decode(&req)
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return fmt.Errorf("invalid JSON: %w", err)
+}
+
+// insertRequest inserts one OTLP export request of any signal
+func (im *importer) insertRequest(req map[string]interface{}) error {
+	for _, signal := range database.Signals {
+		if _, ok := req[requestKeys[signal][0]]; ok {
+			return im.insert(signal, req)
+		}
+	}
+	im.result.reject("unknown", 1, fmt.Errorf("object is not an OTLP export request"))
+	return nil
+}
+
+// requestKeys are the JSON field names of each signal's export request
+var requestKeys = map[string][3]string{
+	database.SignalTraces:  {"resourceSpans", "scopeSpans", "spans"},
+	database.SignalMetrics: {"resourceMetrics", "scopeMetrics", "metrics"},
+	database.SignalLogs:    {"resourceLogs", "scopeLogs", "logRecords"},
+}
+
+// insertFuncs store an export request of each signal
+var insertFuncs = map[string]func(*sql.DB, map[string]interface{}) error{
+	database.SignalTraces:  database.InsertTraceDataInto,
+	database.SignalMetrics: database.InsertMetricsDataInto,
+	database.SignalLogs:    database.InsertLogsDataInto,
+}
+
+// insert stores an export request in one transaction. When that fails
+// its records are inserted one by one so only the invalid ones are
+// rejected. A busy or full database fails every record alike, so the
+// import stops instead.
+func (im *importer) insert(signal string, req map[string]interface{}) error {
+	if err := im.ctx.Err(); err != nil {
+		return err
+	}
+	normalize(signal, req)
+	n := countRecords(signal, req)
+	if n == 0 {
+		return nil
+	}
+	err := insertFuncs[signal](im.conn, req)
+	if err == nil {
+		im.result.Accepted[signal] += n
+		return nil
+	}
+	if database.IsBusy(err) || database.IsFull(err) {
+		return fmt.Errorf("failed to store %s: %w", signal, err)
+	}
+	if n == 1 {
+		im.result.reject(signal, 1, err)
+		return nil
+	}
+	for _, single := range splitRecords(signal, req) {
+		if err := im.insert(signal, single); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalize adds the empty resource the insert functions require when a
+// request leaves it out, which OTLP allows
+func normalize(signal string, req map[string]interface{}) {
+	resources, _ := req[requestKeys[signal][0]].([]interface{})
+	for _, r := range resources {
+		if rm, ok := r.(map[string]interface{}); ok && rm["resource"] == nil {
+			rm["resource"] = map[string]interface{}{}
+		}
+	}
+}
+
+// eachRecord calls fn for every record of a request with the resource and
+// scope entries it belongs to. For metrics a record is a data point.
+func eachRecord(signal string, req map[string]interface{}, fn func(resource, scope, record map[string]interface{})) {
+	keys := requestKeys[signal]
+	resources, _ := req[keys[0]].([]interface{})
+	for _, r := range resources {
+		rm, _ := r.(map[string]interface{})
+		scopes, _ := rm[keys[1]].([]interface{})
+		for _, s := range scopes {
+			sm, _ := s.(map[string]interface{})
+			records, _ := sm[keys[2]].([]interface{})
+			for _, rec := range records {
+				if recMap, ok := rec.(map[string]interface{}); ok {
+					fn(rm, sm, recMap)
+				}
+			}
+		}
+	}
+}
+
+// metricDataKeys are the metric fields holding data points
+var metricDataKeys = []string{"gauge", "sum", "histogram", "exponentialHistogram", "summary"}
+
+// eachDataPoint calls fn for every data point of a metric with the field
+// holding it
+func eachDataPoint(metric map[string]interface{}, fn func(key string, data, point map[string]interface{})) {
+	for _, key := range metricDataKeys {
+		data, _ := metric[key].(map[string]interface{})
+		points, _ := data["dataPoints"].([]interface{})
+		for _, p := range points {
+			if pm, ok := p.(map[string]interface{}); ok {
+				fn(key, data, pm)
+			}
+		}
+	}
+}
+
+// countRecords counts the spans, log records or data points of a request
+func countRecords(signal string, req map[string]interface{}) int64 {
+	var n int64
+	eachRecord(signal, req, func(_, _, record map[string]interface{}) {
+		if signal != database.SignalMetrics {
+			n++
+			return
+		}
+		eachDataPoint(record, func(string, map[string]interface{}, map[string]interface{}) { n++ })
+	})
+	return n
+}
+
+// splitRecords turns a request into one request per record
+func splitRecords(signal string, req map[string]interface{}) []map[string]interface{} {
+	keys := requestKeys[signal]
+	var out []map[string]interface{}
+	add := func(resource, scope, record map[string]interface{}) {
+		rm := shallowCopy(resource)
+		sm := shallowCopy(scope)
+		sm[keys[2]] = []interface{}{record}
+		rm[keys[1]] = []interface{}{sm}
+		out = append(out, map[string]interface{}{keys[0]: []interface{}{rm}})
+	}
+	eachRecord(signal, req, func(resource, scope, record map[string]interface{}) {
+		if signal != database.SignalMetrics {
+			add(resource, scope, record)
+			return
+		}
+		eachDataPoint(record, func(key string, data, point map[string]interface{}) {
+			d := shallowCopy(data)
+			d["dataPoints"] = []interface{}{point}
+			m := shallowCopy(record)
+			for _, k := range metricDataKeys {
+				delete(m, k)
+			}
+			m[key] = d
+			add(resource, scope, m)
+		})
+	})
+	return out
+}
+
+func shallowCopy(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
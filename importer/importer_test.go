@@ -0,0 +1,186 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	if err := database.InitDB(filepath.Join(t.TempDir(), "import.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.CloseDB() })
+	return database.DB()
+}
+
+func importString(t *testing.T, conn *sql.DB, data string) *Result {
+	t.Helper()
+	result, err := Import(context.Background(), conn, strings.NewReader(data), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func querySpans(t *testing.T, conn *sql.DB, traceID string) map[string]database.SpanRecord {
+	t.Helper()
+	spans, err := database.QuerySpans(conn, database.SpanQuery{TraceID: traceID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]database.SpanRecord)
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+	return byName
+}
+
+func TestImportOTLPLines(t *testing.T) {
+	conn := openTestDB(t)
+	lines := `{"resourceSpans":[{"resource":{},"scopeSpans":[{"spans":[` +
+		`{"traceId":"0102030405060708090a0b0c0d0e0f10","spanId":"0000000000000001","name":"a"},` +
+		`{"traceId":"0102030405060708090a0b0c0d0e0f10","spanId":"0000000000000002","name":"b"}]}]}]}
+{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"body":{"stringValue":"hi"}}]}]}]}
+`
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(lines))
+	w.Close()
+	result, err := Import(context.Background(), conn, &gz, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Format != FormatOTLP || result.Accepted["traces"] != 2 || result.Accepted["logs"] != 1 {
+		t.Fatalf("Unexpected result for gzipped OTLP lines: %+v", result)
+	}
+
+	// Spans already stored are rejected one by one, new ones still go in
+	again := strings.Replace(lines, `"0000000000000002","name":"b"`, `"0000000000000003","name":"c"`, 1)
+	result = importString(t, conn, again)
+	if result.Accepted["traces"] != 1 || result.Rejected["traces"] != 1 || result.Accepted["logs"] != 1 {
+		t.Errorf("Expected the duplicate span alone to be rejected, got %+v", result)
+	}
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "UNIQUE") {
+		t.Errorf("Expected the rejection reason to be reported, got %v", result.Errors)
+	}
+}
+
+func TestImportStopsWhenDatabaseIsBusy(t *testing.T) {
+	defer database.SetBusyTimeout(database.BusyTimeout)
+	database.SetBusyTimeout(10 * time.Millisecond)
+	path := filepath.Join(t.TempDir(), "import.db")
+	if err := database.InitDB(path); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+
+	// Hold the write lock from another connection
+	holder, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+	tx, err := holder.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM resources WHERE 0"); err != nil {
+		t.Fatal(err)
+	}
+
+	data := `{"resourceSpans":[{"resource":{},"scopeSpans":[{"spans":[` +
+		`{"traceId":"0102030405060708090a0b0c0d0e0f10","spanId":"0000000000000001","name":"a"},` +
+		`{"traceId":"0102030405060708090a0b0c0d0e0f10","spanId":"0000000000000002","name":"b"}]}]}]}`
+	result, err := Import(context.Background(), database.DB(), strings.NewReader(data), Options{})
+	if !database.IsBusy(err) {
+		t.Fatalf("Expected the import to stop with a busy error, got %v", err)
+	}
+	if result.Rejected["traces"] != 0 {
+		t.Errorf("Expected no records rejected one by one, got %+v", result)
+	}
+}
+
+func TestImportJaeger(t *testing.T) {
+	conn := openTestDB(t)
+	result := importString(t, conn, `{
+  "data": [{
+    "traceID": "a1b2c3d4e5f60718",
+    "spans": [
+      {"traceID": "a1b2c3d4e5f60718", "spanID": "1", "operationName": "GET /cart",
+       "references": [], "startTime": 1700000000000000, "duration": 2000, "processID": "p1",
+       "tags": [{"key": "span.kind", "type": "string", "value": "server"},
+                {"key": "http.status_code", "type": "int64", "value": 500},
+                {"key": "error", "type": "bool", "value": true}],
+       "logs": [{"timestamp": 1700000000001000, "fields": [{"key": "event", "type": "string", "value": "retry"}]}]},
+      {"traceID": "a1b2c3d4e5f60718", "spanID": "2", "operationName": "SELECT",
+       "references": [{"refType": "CHILD_OF", "traceID": "a1b2c3d4e5f60718", "spanID": "1"}],
+       "startTime": 1700000000000500, "duration": 500, "processID": "p2", "tags": []},
+      {"traceID": "a1b2c3d4e5f60718", "spanID": "3", "operationName": "orphan", "processID": "p9"}
+    ],
+    "processes": {
+      "p1": {"serviceName": "cart", "tags": [{"key": "host.name", "type": "string", "value": "web-1"}]},
+      "p2": {"serviceName": "db", "tags": []}
+    }
+  }],
+  "total": 0, "limit": 0, "offset": 0, "errors": null
+}`)
+	if result.Format != FormatJaeger || result.Accepted["traces"] != 2 || result.Rejected["traces"] != 1 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	spans := querySpans(t, conn, "0000000000000000a1b2c3d4e5f60718")
+	root, child := spans["GET /cart"], spans["SELECT"]
+	if root.ServiceName != "cart" || root.Kind != 2 || root.StatusCode != 2 || root.EndTimeUnixNano-root.StartTimeUnixNano != 2000000 {
+		t.Errorf("Unexpected root span: %+v", root)
+	}
+	if !strings.Contains(string(root.Attributes), `"intValue":"500"`) || !strings.Contains(string(root.Events), `"retry"`) {
+		t.Errorf("Expected tags and logs to be kept, got %s %s", root.Attributes, root.Events)
+	}
+	if child.ServiceName != "db" || child.ParentSpanID != "0000000000000001" {
+		t.Errorf("Unexpected child span: %+v", child)
+	}
+}
+
+func TestImportZipkin(t *testing.T) {
+	conn := openTestDB(t)
+	result := importString(t, conn, `[[
+  {"traceId": "5af7183fb1d4cf5f", "id": "6b221d5bc9e6496c", "name": "get /api", "kind": "SERVER",
+   "timestamp": 1700000000000000, "duration": 1500,
+   "localEndpoint": {"serviceName": "frontend"}, "remoteEndpoint": {"ipv4": "10.0.0.7", "port": 8080},
+   "tags": {"error": "connection refused", "http.method": "GET"},
+   "annotations": [{"timestamp": 1700000000000100, "value": "wire send"}]},
+  {"traceId": "5af7183fb1d4cf5f", "id": "not-hex", "name": "broken"}
+]]`)
+	if result.Format != FormatZipkin || result.Accepted["traces"] != 1 || result.Rejected["traces"] != 1 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	span := querySpans(t, conn, "00000000000000005af7183fb1d4cf5f")["get /api"]
+	if span.ServiceName != "frontend" || span.Kind != 2 || span.StatusCode != 2 || span.StatusMessage != "connection refused" {
+		t.Errorf("Unexpected span: %+v", span)
+	}
+	if !strings.Contains(string(span.Attributes), `"network.peer.address"`) || !strings.Contains(string(span.Events), `"wire send"`) {
+		t.Errorf("Expected endpoint attributes and annotations, got %s %s", span.Attributes, span.Events)
+	}
+}
+
+func TestImportRejectsUnknownFiles(t *testing.T) {
+	conn := openTestDB(t)
+	for _, data := range []string{"", "42", "{}", `{"name": "x"}`} {
+		if _, err := Import(context.Background(), conn, strings.NewReader(data), Options{}); err == nil {
+			t.Errorf("Expected %q to be rejected", data)
+		}
+	}
+	if _, err := Import(context.Background(), conn, strings.NewReader("[]"), Options{Format: FormatJaeger}); err == nil {
+		t.Error("Expected a format mismatch to be reported")
+	}
+}
@@ -0,0 +1,263 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+// jaegerTrace is a trace in the JSON format of the Jaeger UI and query API
+type jaegerTrace struct {
+	TraceID   string                   `json:"traceID"`
+	Spans     []jaegerSpan             `json:"spans"`
+	Processes map[string]jaegerProcess `json:"processes"`
+}
+
+type jaegerSpan struct {
+	TraceID       string            `json:"traceID"`
+	SpanID        string            `json:"spanID"`
+	OperationName string            `json:"operationName"`
+	References    []jaegerReference `json:"references"`
+	StartTime     int64             `json:"startTime"` // Microseconds
+	Duration      int64             `json:"duration"`  // Microseconds
+	Tags          []jaegerKeyValue  `json:"tags"`
+	Logs          []jaegerLog       `json:"logs"`
+	ProcessID     string            `json:"processID"`
+	Process       *jaegerProcess    `json:"process"` // Set instead of processID by some tools
+}
+
+type jaegerReference struct {
+	RefType string `json:"refType"`
+	TraceID string `json:"traceID"`
+	SpanID  string `json:"spanID"`
+}
+
+type jaegerKeyValue struct {
+	Key   string      `json:"key"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type jaegerLog struct {
+	Timestamp int64            `json:"timestamp"` // Microseconds
+	Fields    []jaegerKeyValue `json:"fields"`
+}
+
+type jaegerProcess struct {
+	ServiceName string           `json:"serviceName"`
+	Tags        []jaegerKeyValue `json:"tags"`
+}
+
+// jaegerEnvelopeKeys are the fields of a query API response
+var jaegerEnvelopeKeys = map[string]bool{"data": true, "total": true, "limit": true, "offset": true, "errors": true}
+
+// readJaeger inserts the traces of a Jaeger JSON file, either the
+// {"data": [trace, ...]} response of the UI download and query API or a
+// single trace object
+func (im *importer) readJaeger(dec *json.Decoder, firstKey string) error {
+	if !jaegerEnvelopeKeys[firstKey] {
+		obj, err := readObject(dec, firstKey)
+		if err != nil {
+			return err
+		}
+		if _, ok := obj["spans"]; !ok {
+			return fmt.Errorf("unrecognized file: not OTLP, Jaeger or Zipkin JSON")
+		}
+		var trace jaegerTrace
+		if err := remarshal(obj, &trace); err != nil {
+			return fmt.Errorf("invalid Jaeger trace: %w", err)
+		}
+		return im.insertJaegerTrace(trace)
+	}
+
+	key := firstKey
+	for {
+		if key == "data" {
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+				return fmt.Errorf("invalid Jaeger file: data is not an array")
+			}
+			for dec.More() {
+				var trace jaegerTrace
+				if err := dec.Decode(&trace); err != nil {
+					return fmt.Errorf("invalid Jaeger trace: %w", err)
+				}
+				if err := im.insertJaegerTrace(trace); err != nil {
+					return err
+				}
+			}
+			if _, err := dec.Token(); err != nil {
+				return fmt.Errorf("invalid JSON: %w", err)
+			}
+		} else {
+			// total, limit, offset and errors are not needed
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("invalid JSON: %w", err)
+			}
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+		if tok == json.Delim('}') {
+			return nil
+		}
+		key, _ = tok.(string)
+	}
+}
+
+// remarshal converts a decoded JSON value into a typed value
+func remarshal(v interface{}, out interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// insertJaegerTrace converts and stores one Jaeger trace
+func (im *importer) insertJaegerTrace(trace jaegerTrace) error {
+	g := newSpanGrouper()
+	for _, s := range trace.Spans {
+		process := s.Process
+		var resourceKey string
+		if process != nil {
+			key, _ := json.Marshal(process)
+			resourceKey = string(key)
+		} else {
+			p, ok := trace.Processes[s.ProcessID]
+			if !ok {
+				im.result.reject(database.SignalTraces, 1, fmt.Errorf("span %s: unknown process '%s'", s.SpanID, s.ProcessID))
+				continue
+			}
+			process, resourceKey = &p, s.ProcessID
+		}
+		span, scope, err := convertJaegerSpan(s)
+		if err != nil {
+			im.result.reject(database.SignalTraces, 1, err)
+			continue
+		}
+		g.add(resourceKey, jaegerResource(process), scope, span)
+	}
+	return im.insert(database.SignalTraces, g.request())
+}
+
+// jaegerResource converts a Jaeger process to an OTLP resource
+func jaegerResource(p *jaegerProcess) map[string]interface{} {
+	values := jaegerTags(p.Tags)
+	values["service.name"] = p.ServiceName
+	return map[string]interface{}{"attributes": attributes(values)}
+}
+
+// convertJaegerSpan converts a Jaeger span to an OTLP span and its scope
+func convertJaegerSpan(s jaegerSpan) (map[string]interface{}, map[string]interface{}, error) {
+	traceID, err := normalizeID(s.TraceID, 16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("span %s: %w", s.SpanID, err)
+	}
+	spanID, err := normalizeID(s.SpanID, 8)
+	if err != nil {
+		return nil, nil, fmt.Errorf("span %s: %w", s.SpanID, err)
+	}
+	span := map[string]interface{}{
+		"traceId":           traceID,
+		"spanId":            spanID,
+		"name":              s.OperationName,
+		"kind":              float64(kindUnspecified),
+		"startTimeUnixNano": microsToNano(s.StartTime),
+		"endTimeUnixNano":   microsToNano(s.StartTime + s.Duration),
+	}
+
+	var links []interface{}
+	for _, ref := range s.References {
+		refTrace, err1 := normalizeID(ref.TraceID, 16)
+		refSpan, err2 := normalizeID(ref.SpanID, 8)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		// The first CHILD_OF reference in the same trace is the parent
+		if ref.RefType == "CHILD_OF" && refTrace == traceID && span["parentSpanId"] == nil {
+			span["parentSpanId"] = refSpan
+			continue
+		}
+		links = append(links, map[string]interface{}{"traceId": refTrace, "spanId": refSpan})
+	}
+	if len(links) > 0 {
+		span["links"] = links
+	}
+
+	tags := jaegerTags(s.Tags)
+	if kind, ok := tags["span.kind"].(string); ok {
+		delete(tags, "span.kind")
+		span["kind"] = spanKinds[strings.ToLower(kind)]
+	}
+	if status := takeStatus(tags); status != nil {
+		span["status"] = status
+	}
+	scope := takeScope(tags)
+	if len(tags) > 0 {
+		span["attributes"] = attributes(tags)
+	}
+
+	var events []interface{}
+	for _, l := range s.Logs {
+		fields := jaegerTags(l.Fields)
+		name, _ := fields["event"].(string)
+		delete(fields, "event")
+		event := map[string]interface{}{"timeUnixNano": microsToNano(l.Timestamp), "name": name}
+		if len(fields) > 0 {
+			event["attributes"] = attributes(fields)
+		}
+		events = append(events, event)
+	}
+	if len(events) > 0 {
+		span["events"] = events
+	}
+	return span, scope, nil
+}
+
+// jaegerTags converts typed Jaeger tags to Go values
+func jaegerTags(tags []jaegerKeyValue) map[string]interface{} {
+	values := make(map[string]interface{}, len(tags))
+	for _, t := range tags {
+		switch strings.ToLower(t.Type) {
+		case "bool":
+			switch v := t.Value.(type) {
+			case bool:
+				values[t.Key] = v
+			case string:
+				values[t.Key] = v == "true"
+			}
+		case "int64":
+			switch v := t.Value.(type) {
+			case float64:
+				values[t.Key] = int64(v)
+			case string:
+				if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+					values[t.Key] = n
+				}
+			}
+		case "float64":
+			switch v := t.Value.(type) {
+			case float64:
+				values[t.Key] = v
+			case string:
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					values[t.Key] = f
+				}
+			}
+		case "binary":
+			// Already base64 encoded, as OTLP JSON bytes are
+			values[t.Key] = base64Value(fmt.Sprint(t.Value))
+		default:
+			values[t.Key] = fmt.Sprint(t.Value)
+		}
+		if _, ok := values[t.Key]; !ok {
+			values[t.Key] = fmt.Sprint(t.Value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,155 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+// zipkinSpan is a span in the Zipkin v2 JSON format
+type zipkinSpan struct {
+	TraceID        string             `json:"traceId"`
+	ID             string             `json:"id"`
+	ParentID       string             `json:"parentId"`
+	Name           string             `json:"name"`
+	Kind           string             `json:"kind"`
+	Timestamp      int64              `json:"timestamp"` // Microseconds
+	Duration       int64              `json:"duration"`  // Microseconds
+	LocalEndpoint  *zipkinEndpoint    `json:"localEndpoint"`
+	RemoteEndpoint *zipkinEndpoint    `json:"remoteEndpoint"`
+	Annotations    []zipkinAnnotation `json:"annotations"`
+	Tags           map[string]string  `json:"tags"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+	IPv4        string `json:"ipv4"`
+	IPv6        string `json:"ipv6"`
+	Port        int    `json:"port"`
+}
+
+type zipkinAnnotation struct {
+	Timestamp int64  `json:"timestamp"` // Microseconds
+	Value     string `json:"value"`
+}
+
+// readZipkin inserts the spans of a Zipkin JSON array, either a list of
+// spans as returned by /api/v2/trace/{id} or a list of traces as returned
+// by /api/v2/traces. The opening bracket has been read.
+func (im *importer) readZipkin(dec *json.Decoder) error {
+	var batch []zipkinSpan
+	flush := func() error {
+		err := im.insertZipkinSpans(batch)
+		batch = batch[:0]
+		return err
+	}
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+		var spans []zipkinSpan
+		if strings.HasPrefix(string(raw), "[") {
+			if err := json.Unmarshal(raw, &spans); err != nil {
+				return fmt.Errorf("invalid Zipkin trace: %w", err)
+			}
+		} else {
+			var span zipkinSpan
+			if err := json.Unmarshal(raw, &span); err != nil {
+				return fmt.Errorf("invalid Zipkin span: %w", err)
+			}
+			spans = append(spans, span)
+		}
+		batch = append(batch, spans...)
+		if len(batch) >= im.opts.BatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return flush()
+}
+
+// insertZipkinSpans converts and stores Zipkin spans in one request
+func (im *importer) insertZipkinSpans(spans []zipkinSpan) error {
+	g := newSpanGrouper()
+	for _, s := range spans {
+		span, err := convertZipkinSpan(s)
+		if err != nil {
+			im.result.reject(database.SignalTraces, 1, err)
+			continue
+		}
+		var service string
+		if s.LocalEndpoint != nil {
+			service = s.LocalEndpoint.ServiceName
+		}
+		resource := map[string]interface{}{"attributes": attributes(map[string]interface{}{"service.name": service})}
+		g.add(service, resource, map[string]interface{}{}, span)
+	}
+	return im.insert(database.SignalTraces, g.request())
+}
+
+// convertZipkinSpan converts a Zipkin span to an OTLP span
+func convertZipkinSpan(s zipkinSpan) (map[string]interface{}, error) {
+	traceID, err := normalizeID(s.TraceID, 16)
+	if err != nil {
+		return nil, fmt.Errorf("span %s: %w", s.ID, err)
+	}
+	spanID, err := normalizeID(s.ID, 8)
+	if err != nil {
+		return nil, fmt.Errorf("span %s: %w", s.ID, err)
+	}
+	span := map[string]interface{}{
+		"traceId":           traceID,
+		"spanId":            spanID,
+		"name":              s.Name,
+		"kind":              spanKinds[strings.ToLower(s.Kind)],
+		"startTimeUnixNano": microsToNano(s.Timestamp),
+		"endTimeUnixNano":   microsToNano(s.Timestamp + s.Duration),
+	}
+	if s.ParentID != "" {
+		parent, err := normalizeID(s.ParentID, 8)
+		if err != nil {
+			return nil, fmt.Errorf("span %s: parent %w", s.ID, err)
+		}
+		span["parentSpanId"] = parent
+	}
+
+	tags := make(map[string]interface{}, len(s.Tags)+3)
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	if status := takeStatus(tags); status != nil {
+		span["status"] = status
+	}
+	if e := s.RemoteEndpoint; e != nil {
+		if e.ServiceName != "" {
+			tags["peer.service"] = e.ServiceName
+		}
+		if e.IPv4 != "" {
+			tags["network.peer.address"] = e.IPv4
+		} else if e.IPv6 != "" {
+			tags["network.peer.address"] = e.IPv6
+		}
+		if e.Port != 0 {
+			tags["network.peer.port"] = int64(e.Port)
+		}
+	}
+	if len(tags) > 0 {
+		span["attributes"] = attributes(tags)
+	}
+
+	var events []interface{}
+	for _, a := range s.Annotations {
+		events = append(events, map[string]interface{}{"timeUnixNano": microsToNano(a.Timestamp), "name": a.Value})
+	}
+	if len(events) > 0 {
+		span["events"] = events
+	}
+	return span, nil
+}
@@ -0,0 +1,210 @@
+package logging
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for asynchronous logging
+const (
+	DefaultBufferSize    = 8192        // queued log lines
+	DefaultFlushInterval = time.Second // how often buffered file output is flushed
+)
+
+// fileBufferSize is the size of the buffered writer in front of the log file
+const fileBufferSize = 64 * 1024
+
+// entry is one queued log line
+type entry struct {
+	time  time.Time
+	level slog.Level
+	msg   string
+	attrs []slog.Attr
+}
+
+// asyncWriter queues log lines in a bounded ring buffer and writes them on
+// a background goroutine, so callers never wait on disk or socket I/O.
+// When the buffer is full the oldest queued line is dropped.
+type asyncWriter struct {
+	mu     sync.Mutex
+	buf    []entry
+	head   int // index of the oldest queued line
+	count  int
+	closed bool
+
+	dropped  atomic.Uint64 // lines dropped since the writer started
+	reported uint64        // drops already reported in the log
+
+	notify   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func newAsyncWriter(size int) *asyncWriter {
+	return &asyncWriter{
+		buf:    make([]entry, size),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// enqueue adds a line to the buffer, dropping the oldest one if it is full.
+// It returns false once the writer has stopped.
+func (a *asyncWriter) enqueue(e entry) bool {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return false
+	}
+	if a.count == len(a.buf) {
+		a.buf[a.head] = entry{}
+		a.head = (a.head + 1) % len(a.buf)
+		a.count--
+		a.dropped.Add(1)
+	}
+	a.buf[(a.head+a.count)%len(a.buf)] = e
+	a.count++
+	a.mu.Unlock()
+
+	select {
+	case a.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// take removes and returns every queued line
+func (a *asyncWriter) take() []entry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	batch := make([]entry, a.count)
+	for i := range batch {
+		idx := (a.head + i) % len(a.buf)
+		batch[i] = a.buf[idx]
+		a.buf[idx] = entry{}
+	}
+	a.head, a.count = 0, 0
+	return batch
+}
+
+// startAsync switches the logger to asynchronous writes with a buffer of
+// size lines. File output is buffered and flushed every interval.
+func (l *Logger) startAsync(size int, interval time.Duration) {
+	if size <= 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+
+	l.mu.Lock()
+	if l.file != nil {
+		l.fileBuf = bufio.NewWriterSize(l.file, fileBufferSize)
+		l.fileLogger.SetOutput(l.fileBuf)
+	}
+	l.mu.Unlock()
+
+	a := newAsyncWriter(size)
+	l.async = a
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.notify:
+				l.drain()
+			case <-ticker.C:
+				l.drain()
+				l.flush()
+			case <-a.done:
+				l.drain()
+				l.flush()
+				return
+			}
+		}
+	}()
+}
+
+// stopAsync writes everything still queued and stops the writer goroutine
+func (l *Logger) stopAsync() {
+	a := l.async
+	if a == nil {
+		return
+	}
+	a.stopOnce.Do(func() {
+		close(a.done)
+		a.wg.Wait()
+		a.mu.Lock()
+		a.closed = true
+		a.mu.Unlock()
+		// Lines queued while the goroutine was exiting
+		l.drain()
+	})
+}
+
+// drain writes every queued line and reports new drops
+func (l *Logger) drain() {
+	a := l.async
+	for _, e := range a.take() {
+		l.writeEntry(e)
+	}
+	if dropped := a.dropped.Load(); dropped > a.reported {
+		l.writeEntry(entry{
+			time:  time.Now(),
+			level: LevelWarn,
+			msg:   "Dropped log lines because the log buffer was full",
+			attrs: []slog.Attr{slog.Uint64("dropped", dropped-a.reported)},
+		})
+		a.reported = dropped
+	}
+}
+
+// flush writes buffered file output to the log file
+func (l *Logger) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushLocked()
+}
+
+// flushLocked writes buffered file output. Must be called with l.mu held
+func (l *Logger) flushLocked() {
+	if l.fileBuf == nil {
+		return
+	}
+	if err := l.fileBuf.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to flush log file: %v\n", err)
+	}
+}
+
+// setFileLocked directs file output to a newly opened log file.
+// Must be called with l.mu held, after flushLocked
+func (l *Logger) setFileLocked(file *os.File) {
+	l.file = file
+	if l.fileBuf != nil {
+		l.fileBuf.Reset(file)
+		return
+	}
+	l.fileLogger.SetOutput(file)
+}
+
+// Dropped returns the number of log lines dropped because the buffer was full
+func (l *Logger) Dropped() uint64 {
+	if l.async == nil {
+		return 0
+	}
+	return l.async.dropped.Load()
+}
+
+// Dropped returns the number of lines the global logger has dropped
+func Dropped() uint64 {
+	return GetLogger().Dropped()
+}
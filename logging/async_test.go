@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsyncWritesQueuedLinesOnClose(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	logger, err := newLoggerWithRotation(logPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A long interval shows Close flushes without waiting for the ticker
+	logger.startAsync(1024, time.Hour)
+
+	for i := 0; i < 500; i++ {
+		logger.Info("message %d", i)
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(logPath)
+	if lines := strings.Count(string(content), "\n"); lines != 500 {
+		t.Errorf("Expected 500 lines after Close, got %d", lines)
+	}
+	if !strings.Contains(string(content), "message 499") {
+		t.Error("Last queued line missing after Close")
+	}
+
+	// Lines written after Close are not queued forever
+	if logger.async.enqueue(entry{msg: "late"}) {
+		t.Error("Expected enqueue to fail after Close")
+	}
+}
+
+func TestAsyncDropsOldestWhenFull(t *testing.T) {
+	a := newAsyncWriter(3)
+	for i := 0; i < 5; i++ {
+		a.enqueue(entry{msg: fmt.Sprint(i)})
+	}
+	if a.dropped.Load() != 2 {
+		t.Errorf("Expected 2 dropped lines, got %d", a.dropped.Load())
+	}
+	var got []string
+	for _, e := range a.take() {
+		got = append(got, e.msg)
+	}
+	if strings.Join(got, ",") != "2,3,4" {
+		t.Errorf("Expected the newest lines to be kept, got %v", got)
+	}
+	if len(a.take()) != 0 {
+		t.Error("Expected the buffer to be empty after take")
+	}
+}
+
+func TestAsyncReportsDrops(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	logger, err := newLoggerWithRotation(logPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	// No writer goroutine, so the buffer fills up
+	logger.async = newAsyncWriter(2)
+
+	for i := 0; i < 4; i++ {
+		logger.Info("message %d", i)
+	}
+	logger.drain()
+
+	content, _ := os.ReadFile(logPath)
+	if !strings.Contains(string(content), "[WARN] Dropped log lines because the log buffer was full dropped=2") {
+		t.Errorf("Expected a drop report, got: %s", content)
+	}
+	if logger.Dropped() != 2 {
+		t.Errorf("Dropped() = %d, want 2", logger.Dropped())
+	}
+}
+
+func benchmarkLogger(b *testing.B, async bool) {
+	logPath := filepath.Join(b.TempDir(), "bench.log")
+	logger, err := newLoggerWithOutputs(OutputConfig{Outputs: []string{OutputFile}, FilePath: logPath}, DefaultRotationConfig())
+	if err != nil {
+		b.Fatal(err)
+	}
+	if async {
+		logger.startAsync(DefaultBufferSize, DefaultFlushInterval)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Info("Stored telemetry signal=%s records=%d", "traces", 42)
+		}
+	})
+	b.StopTimer()
+	logger.Close()
+	if logger.Dropped() > 0 {
+		b.ReportMetric(float64(logger.Dropped())/float64(b.N), "dropped/op")
+	}
+}
+
+func BenchmarkLogSync(b *testing.B) {
+	benchmarkLogger(b, false)
+}
+
+func BenchmarkLogAsync(b *testing.B) {
+	benchmarkLogger(b, true)
+}
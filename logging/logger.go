@@ -1,9 +1,10 @@
 package logging
 
 import (
+	"bufio"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
@@ -17,16 +18,33 @@ var (
 	}
 	loggerMu sync.RWMutex
 	initOnce sync.Once
+
+	// hook receives every log line in addition to the configured outputs
+	hook   func(level slog.Level, message string, attrs []slog.Attr)
+	hookMu sync.RWMutex
 )
 
+// SetHook registers a function that receives each written log line's level,
+// message and fields. A nil hook disables it. The hook must not log.
+func SetHook(fn func(level slog.Level, message string, attrs []slog.Attr)) {
+	hookMu.Lock()
+	defer hookMu.Unlock()
+	hook = fn
+}
+
 // Logger handles application logging
 type Logger struct {
 	file           *os.File
-	fileLogger     *log.Logger
-	stdLogger      *log.Logger
+	fileLogger     *log.Logger // file output, nil when disabled
+	stdLogger      *log.Logger // stdout output, nil when disabled
+	sinks          []sink      // journald and syslog outputs
 	mu             sync.Mutex
 	logPath        string
 	rotationConfig *RotationConfig
+	nextRotation   time.Time // next scheduled rotation, zero when unscheduled
+	background     sync.WaitGroup // compression and cleanup after rotation
+	async          *asyncWriter   // queue for asynchronous writes, nil when synchronous
+	fileBuf        *bufio.Writer  // buffered file output in asynchronous mode
 }
 
 // Init initializes the logger with the given log file path
@@ -36,11 +54,20 @@ func Init(logFilePath string) error {
 
 // InitWithRotation initializes the logger with rotation configuration
 func InitWithRotation(logFilePath string, config *RotationConfig) error {
+	return InitWithOutputs(OutputConfig{
+		Outputs:  []string{OutputStdout, OutputFile},
+		FilePath: logFilePath,
+	}, config)
+}
+
+// InitWithOutputs initializes the logger with the selected outputs
+func InitWithOutputs(outputs OutputConfig, config *RotationConfig) error {
 	var err error
 	initOnce.Do(func() {
 		var newL *Logger
-		newL, err = newLoggerWithRotation(logFilePath, config)
+		newL, err = newLoggerWithOutputs(outputs, config)
 		if err == nil {
+			newL.startAsync(outputs.BufferSize, outputs.FlushInterval)
 			loggerMu.Lock()
 			globalLogger = newL
 			loggerMu.Unlock()
@@ -56,13 +83,50 @@ func newLogger(logFilePath string) (*Logger, error) {
 
 // newLoggerWithRotation creates a new logger instance with rotation support
 func newLoggerWithRotation(logFilePath string, config *RotationConfig) (*Logger, error) {
+	return newLoggerWithOutputs(OutputConfig{
+		Outputs:  []string{OutputStdout, OutputFile},
+		FilePath: logFilePath,
+	}, config)
+}
+
+// newLoggerWithOutputs creates a logger writing to the selected outputs
+func newLoggerWithOutputs(outputs OutputConfig, config *RotationConfig) (*Logger, error) {
+	logFilePath := outputs.FilePath
 	l := &Logger{
-		stdLogger:      log.New(os.Stdout, "", log.LstdFlags),
-		logPath:        logFilePath,
 		rotationConfig: config,
 	}
+	if config != nil {
+		if err := config.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	useFile := false
+	for _, output := range resolveOutputs(outputs.Outputs) {
+		switch output {
+		case OutputStdout:
+			l.stdLogger = log.New(os.Stdout, "", log.LstdFlags)
+		case OutputFile:
+			useFile = logFilePath != ""
+		case OutputJournald:
+			s, err := newJournaldSink()
+			if err != nil {
+				l.closeSinks()
+				return nil, err
+			}
+			l.sinks = append(l.sinks, s)
+		case OutputSyslog:
+			s, err := newSyslogSink(outputs.SyslogAddress)
+			if err != nil {
+				l.closeSinks()
+				return nil, err
+			}
+			l.sinks = append(l.sinks, s)
+		}
+	}
 
-	if logFilePath != "" {
+	if useFile {
+		l.logPath = logFilePath
 		// Ensure directory exists
 		logDir := filepath.Dir(logFilePath)
 		if err := os.MkdirAll(logDir, 0755); err != nil {
@@ -76,14 +140,39 @@ func newLoggerWithRotation(logFilePath string, config *RotationConfig) (*Logger,
 		}
 
 		l.file = file
-		// Create multi-writer to write to both stdout and file
-		multiWriter := io.MultiWriter(os.Stdout, file)
-		l.fileLogger = log.New(multiWriter, "", log.LstdFlags)
+		l.fileLogger = log.New(file, "", log.LstdFlags)
+
+		if config != nil {
+			// A file last written in an earlier period is rotated on the
+			// first write, so restarts do not stretch a day's log
+			opened := time.Now()
+			if stat, err := file.Stat(); err == nil && stat.Size() > 0 {
+				opened = stat.ModTime()
+			}
+			l.nextRotation = config.nextRotation(opened)
+			// Backups left uncompressed by an interrupted run are found now,
+			// before any rotation of our own, and finished in the background
+			l.background.Add(1)
+			go l.compressAndCleanup(l.leftoverBackups()...)
+		}
+	}
+
+	// Never lose log lines entirely
+	if l.stdLogger == nil && l.fileLogger == nil && len(l.sinks) == 0 {
+		l.stdLogger = log.New(os.Stdout, "", log.LstdFlags)
 	}
 
 	return l, nil
 }
 
+// closeSinks closes the journald and syslog connections
+func (l *Logger) closeSinks() {
+	for _, s := range l.sinks {
+		s.close()
+	}
+	l.sinks = nil
+}
+
 // GetLogger returns the global logger instance
 func GetLogger() *Logger {
 	loggerMu.RLock()
@@ -91,8 +180,36 @@ func GetLogger() *Logger {
 	return globalLogger
 }
 
-// log is the internal logging method
-func (l *Logger) log(level, format string, v ...interface{}) {
+// log formats a printf style message and writes it if level is enabled
+func (l *Logger) log(level slog.Level, format string, v ...interface{}) {
+	if !Enabled(level) {
+		return
+	}
+	l.write(level, fmt.Sprintf(format, v...), nil)
+}
+
+// write outputs one log line with optional structured fields. In
+// asynchronous mode the line is queued and written in the background.
+func (l *Logger) write(level slog.Level, msg string, attrs []slog.Attr) {
+	// The hook runs on the caller's goroutine so it sees lines in order
+	// and can recognise lines it caused itself
+	hookMu.RLock()
+	fn := hook
+	hookMu.RUnlock()
+	if fn != nil {
+		fn(level, msg, attrs)
+	}
+
+	e := entry{time: time.Now(), level: level, msg: msg, attrs: attrs}
+	if l.async != nil && l.async.enqueue(e) {
+		return
+	}
+	l.writeEntry(e)
+}
+
+// writeEntry writes one log line to every output
+func (l *Logger) writeEntry(e entry) {
+	level, msg, attrs := e.level, e.msg, e.attrs
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	
@@ -104,27 +221,48 @@ func (l *Logger) log(level, format string, v ...interface{}) {
 		}
 	}
 	
-	msg := fmt.Sprintf(level+" "+format, v...)
-	if l.fileLogger != nil {
-		l.fileLogger.Println(msg)
+	now := e.time
+	var line string
+	if getFormat() == FormatJSON {
+		line = formatJSON(now, level, msg, attrs)
 	} else {
-		l.stdLogger.Println(msg)
+		line = formatText(level, msg, attrs)
+	}
+	for _, out := range []*log.Logger{l.stdLogger, l.fileLogger} {
+		if out == nil {
+			continue
+		}
+		if getFormat() == FormatJSON {
+			fmt.Fprintln(out.Writer(), line)
+		} else {
+			out.Println(line)
+		}
+	}
+	for _, s := range l.sinks {
+		if err := s.write(now, level, msg, attrs); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write log line: %v\n", err)
+		}
 	}
 }
 
 // Info logs an info message
 func (l *Logger) Info(format string, v ...interface{}) {
-	l.log("[INFO]", format, v...)
+	l.log(LevelInfo, format, v...)
+}
+
+// Warn logs a warning message
+func (l *Logger) Warn(format string, v ...interface{}) {
+	l.log(LevelWarn, format, v...)
 }
 
 // Error logs an error message
 func (l *Logger) Error(format string, v ...interface{}) {
-	l.log("[ERROR]", format, v...)
+	l.log(LevelError, format, v...)
 }
 
 // Debug logs a debug message
 func (l *Logger) Debug(format string, v ...interface{}) {
-	l.log("[DEBUG]", format, v...)
+	l.log(LevelDebug, format, v...)
 }
 
 // LogStartup logs application startup information
@@ -142,11 +280,36 @@ func (l *Logger) LogShutdown() {
 	l.Info("Stopped at: %s", time.Now().Format(time.RFC3339))
 }
 
-// Close closes the log file if open
+// Reopen closes and reopens the log file at its configured path. It is used
+// after an external tool such as logrotate has renamed the file.
+func (l *Logger) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil || l.logPath == "" {
+		return nil
+	}
+	file, err := os.OpenFile(l.logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		// Keep writing to the old file rather than losing log lines
+		return fmt.Errorf("failed to reopen log file: %w", err)
+	}
+	l.flushLocked()
+	old := l.file
+	l.setFileLocked(file)
+	return old.Close()
+}
+
+// Close writes any queued lines, waits for background compression and
+// closes the log file if open
 func (l *Logger) Close() error {
+	l.stopAsync()
+	l.background.Wait()
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	
+	l.flushLocked()
+	l.closeSinks()
 	if l.file != nil {
 		return l.file.Close()
 	}
@@ -171,11 +334,21 @@ func Close() error {
 	return err
 }
 
+// Reopen reopens the global logger's log file
+func Reopen() error {
+	return GetLogger().Reopen()
+}
+
 // Info logs an info message using the global logger
 func Info(format string, v ...interface{}) {
 	GetLogger().Info(format, v...)
 }
 
+// Warn logs a warning message using the global logger
+func Warn(format string, v ...interface{}) {
+	GetLogger().Warn(format, v...)
+}
+
 // Error logs an error message using the global logger
 func Error(format string, v ...interface{}) {
 	GetLogger().Error(format, v...)
@@ -0,0 +1,262 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output backends
+const (
+	OutputAuto     = "auto"     // journald under systemd, otherwise stdout and file
+	OutputStdout   = "stdout"   // formatted lines on standard output
+	OutputFile     = "file"     // formatted lines in the log file, with rotation
+	OutputJournald = "journald" // native journal protocol with structured fields
+	OutputSyslog   = "syslog"   // RFC 5424 over a Unix or UDP socket
+)
+
+// DefaultSyslogAddress is the local syslog socket
+const DefaultSyslogAddress = "unix:///dev/log"
+
+// journalSocket is where journald accepts native protocol datagrams
+var journalSocket = "/run/systemd/journal/socket"
+
+// Identifier is the application name sent to journald and syslog
+var Identifier = "sqlite-otel-collector"
+
+// OutputConfig selects where log lines are written
+type OutputConfig struct {
+	Outputs       []string // Any of auto, stdout, file, journald, syslog
+	FilePath      string   // Log file for the file output
+	SyslogAddress string   // unix:///dev/log, udp://host:514 or a socket path
+
+	BufferSize    int           // Lines queued for asynchronous writing, 0 writes synchronously
+	FlushInterval time.Duration // How often buffered file output is flushed (default: 1s)
+}
+
+// ParseOutputs validates a comma separated list of outputs
+func ParseOutputs(value string) ([]string, error) {
+	var outputs []string
+	for _, output := range strings.Split(value, ",") {
+		output = strings.TrimSpace(output)
+		switch output {
+		case "":
+			continue
+		case OutputAuto, OutputStdout, OutputFile, OutputJournald, OutputSyslog:
+			outputs = append(outputs, output)
+		default:
+			return nil, fmt.Errorf("unknown log output '%s' (expected auto, stdout, file, journald or syslog)", output)
+		}
+	}
+	return outputs, nil
+}
+
+// UnderJournald reports whether standard output is connected to the
+// journal and the native journal socket is available
+func UnderJournald() bool {
+	if os.Getenv("JOURNAL_STREAM") == "" {
+		return false
+	}
+	_, err := os.Stat(journalSocket)
+	return err == nil
+}
+
+// resolveOutputs expands auto and removes duplicates
+func resolveOutputs(outputs []string) []string {
+	if len(outputs) == 0 {
+		outputs = []string{OutputAuto}
+	}
+	seen := make(map[string]bool)
+	var resolved []string
+	add := func(o string) {
+		if !seen[o] {
+			seen[o] = true
+			resolved = append(resolved, o)
+		}
+	}
+	for _, o := range outputs {
+		if o != OutputAuto {
+			add(o)
+			continue
+		}
+		if UnderJournald() {
+			add(OutputJournald)
+		} else {
+			add(OutputStdout)
+			add(OutputFile)
+		}
+	}
+	return resolved
+}
+
+// sink is a log destination that receives structured records
+type sink interface {
+	write(t time.Time, level slog.Level, msg string, attrs []slog.Attr) error
+	close() error
+}
+
+// syslogSeverity maps a level to the syslog severity used by journald and syslog
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= LevelError:
+		return 3 // err
+	case level >= LevelWarn:
+		return 4 // warning
+	case level >= LevelInfo:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
+
+// journaldSink writes to journald using its native datagram protocol
+type journaldSink struct {
+	conn *net.UnixConn
+}
+
+func newJournaldSink() (*journaldSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %w", err)
+	}
+	return &journaldSink{conn: conn}, nil
+}
+
+// journalFieldName converts an attribute key to a valid journal field name
+func journalFieldName(key string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(key) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	name := strings.TrimLeft(b.String(), "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// appendJournalField encodes one field, using the length-prefixed form for
+// values containing newlines
+func appendJournalField(buf *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(name + "=" + value + "\n")
+		return
+	}
+	buf.WriteString(name + "\n")
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
+
+func (s *journaldSink) write(_ time.Time, level slog.Level, msg string, attrs []slog.Attr) error {
+	var buf bytes.Buffer
+	appendJournalField(&buf, "MESSAGE", msg)
+	appendJournalField(&buf, "PRIORITY", strconv.Itoa(syslogSeverity(level)))
+	appendJournalField(&buf, "SYSLOG_IDENTIFIER", Identifier)
+	for _, a := range attrs {
+		name := journalFieldName(a.Key)
+		if name == "" || name == "MESSAGE" || name == "PRIORITY" {
+			continue
+		}
+		appendJournalField(&buf, name, a.Value.Resolve().String())
+	}
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+func (s *journaldSink) close() error {
+	return s.conn.Close()
+}
+
+// syslogSink writes RFC 5424 messages to a syslog socket
+type syslogSink struct {
+	conn     net.Conn
+	hostname string
+}
+
+// syslogFacility is the daemon facility
+const syslogFacility = 3
+
+func newSyslogSink(address string) (*syslogSink, error) {
+	if address == "" {
+		address = DefaultSyslogAddress
+	}
+	network, addr := "unixgram", address
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		addr = strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "udp://"):
+		network, addr = "udp", strings.TrimPrefix(address, "udp://")
+	case filepath.IsAbs(address):
+	default:
+		return nil, fmt.Errorf("unsupported syslog address '%s' (expected unix:///path or udp://host:port)", address)
+	}
+
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog at %s: %w", address, err)
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &syslogSink{conn: conn, hostname: hostname}, nil
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// sdParamName converts an attribute key to a valid SD-PARAM name
+func sdParamName(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		if r > 32 && r < 127 && r != '=' && r != ']' && r != '"' {
+			b.WriteRune(r)
+		}
+	}
+	name := b.String()
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
+
+// formatSyslog renders a record as an RFC 5424 message
+func formatSyslog(t time.Time, level slog.Level, msg string, attrs []slog.Attr, hostname string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - ", syslogFacility*8+syslogSeverity(level),
+		t.Format("2006-01-02T15:04:05.000000Z07:00"), hostname, Identifier, os.Getpid())
+
+	var params []string
+	for _, a := range attrs {
+		if name := sdParamName(a.Key); name != "" {
+			params = append(params, name+`="`+sdEscaper.Replace(a.Value.Resolve().String())+`"`)
+		}
+	}
+	if len(params) > 0 {
+		// 32473 is the enterprise number reserved for documentation
+		b.WriteString("[fields@32473 " + strings.Join(params, " ") + "]")
+	} else {
+		b.WriteString("-")
+	}
+	b.WriteString(" " + msg)
+	return b.String()
+}
+
+func (s *syslogSink) write(t time.Time, level slog.Level, msg string, attrs []slog.Attr) error {
+	_, err := s.conn.Write([]byte(formatSyslog(t, level, msg, attrs, s.hostname)))
+	return err
+}
+
+func (s *syslogSink) close() error {
+	return s.conn.Close()
+}
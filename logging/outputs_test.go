@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveOutputs(t *testing.T) {
+	t.Setenv("JOURNAL_STREAM", "")
+	got := resolveOutputs([]string{OutputAuto, OutputStdout, OutputSyslog})
+	want := []string{OutputStdout, OutputFile, OutputSyslog}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("resolveOutputs = %v, want %v", got, want)
+	}
+
+	if _, err := ParseOutputs("stdout,kafka"); err == nil {
+		t.Error("Expected unknown output to be rejected")
+	}
+}
+
+func TestJournaldSink(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "journal.socket")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets unavailable: %v", err)
+	}
+	defer server.Close()
+
+	original := journalSocket
+	journalSocket = socket
+	defer func() { journalSocket = original }()
+
+	sink, err := newJournaldSink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.close()
+
+	attrs := []slog.Attr{slog.String("signal", "traces"), slog.String("error", "line one\nline two")}
+	if err := sink.write(time.Now(), LevelError, "Failed to store telemetry", attrs); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	server.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	datagram := buf[:n]
+	for _, want := range []string{"MESSAGE=Failed to store telemetry\n", "PRIORITY=3\n", "SIGNAL=traces\n"} {
+		if !bytes.Contains(datagram, []byte(want)) {
+			t.Errorf("Missing %q in %q", want, datagram)
+		}
+	}
+
+	// Multi-line values use the length-prefixed encoding
+	var multiline bytes.Buffer
+	multiline.WriteString("ERROR\n")
+	binary.Write(&multiline, binary.LittleEndian, uint64(len("line one\nline two")))
+	multiline.WriteString("line one\nline two\n")
+	if !bytes.Contains(datagram, multiline.Bytes()) {
+		t.Errorf("Multi-line field not length-prefixed: %q", datagram)
+	}
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	sink, err := newSyslogSink("udp://" + server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.close()
+
+	attrs := []slog.Attr{slog.String("signal", "logs"), slog.String("client", `a"b]`)}
+	if err := sink.write(time.Now(), LevelWarn, "Throttled request", attrs); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	server.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := server.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	// daemon facility (3) * 8 + warning (4)
+	if !strings.HasPrefix(msg, "<28>1 ") {
+		t.Errorf("Unexpected header: %q", msg)
+	}
+	if !strings.Contains(msg, ` sqlite-otel-collector `) || !strings.HasSuffix(msg, "] Throttled request") {
+		t.Errorf("Unexpected message: %q", msg)
+	}
+	if !strings.Contains(msg, `[fields@32473 signal="logs" client="a\"b\]"]`) {
+		t.Errorf("Structured data not escaped: %q", msg)
+	}
+}
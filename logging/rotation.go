@@ -7,16 +7,32 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// Rotation schedules
+const (
+	RotateDaily  = "daily"  // rotate at local midnight
+	RotateHourly = "hourly" // rotate at the start of every hour
+)
+
+// backupTimeFormat is the timestamp in backup file names. Older releases
+// used second resolution, which is still recognised during cleanup.
+const (
+	backupTimeFormat       = "20060102-150405.000"
+	legacyBackupTimeFormat = "20060102-150405"
+)
+
 // RotationConfig defines log rotation parameters
 type RotationConfig struct {
-	MaxSize    int64 // Maximum file size in bytes before rotation (default: 100MB)
-	MaxBackups int   // Maximum number of backup files to keep (default: 7)
-	MaxAge     int   // Maximum age in days to keep backup files (default: 30)
-	Compress   bool  // Whether to compress rotated files (default: true)
+	MaxSize      int64  // Maximum file size in bytes before rotation (default: 100MB, 0 disables)
+	MaxBackups   int    // Maximum number of backup files to keep (default: 7)
+	MaxAge       int    // Maximum age in days to keep backup files (default: 30)
+	MaxTotalSize int64  // Maximum combined size of backup files in bytes (default: 0, unlimited)
+	Compress     bool   // Whether to compress rotated files (default: true)
+	Schedule     string // Rotate daily or hourly in addition to MaxSize (default: "", size only)
 }
 
 // DefaultRotationConfig returns default rotation configuration
@@ -29,6 +45,28 @@ func DefaultRotationConfig() *RotationConfig {
 	}
 }
 
+// validate checks the rotation schedule
+func (c *RotationConfig) validate() error {
+	switch c.Schedule {
+	case "", RotateDaily, RotateHourly:
+		return nil
+	}
+	return fmt.Errorf("unknown log rotation schedule '%s' (expected daily or hourly)", c.Schedule)
+}
+
+// nextRotation returns the first scheduled rotation after t, or the zero
+// time when rotation is size based only
+func (c *RotationConfig) nextRotation(t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch c.Schedule {
+	case RotateDaily:
+		return time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+	case RotateHourly:
+		return time.Date(year, month, day, t.Hour()+1, 0, 0, 0, t.Location())
+	}
+	return time.Time{}
+}
+
 // needsRotationLocked checks if the current log file needs rotation
 // Must be called with l.mu held
 func (l *Logger) needsRotationLocked() bool {
@@ -42,7 +80,19 @@ func (l *Logger) needsRotationLocked() bool {
 		return false
 	}
 
-	return stat.Size() >= l.rotationConfig.MaxSize
+	size := stat.Size()
+	if l.fileBuf != nil {
+		size += int64(l.fileBuf.Buffered())
+	}
+
+	if !l.nextRotation.IsZero() && !time.Now().Before(l.nextRotation) {
+		if size > 0 {
+			return true
+		}
+		// Nothing was written this period, so there is nothing to keep
+		l.nextRotation = l.rotationConfig.nextRotation(time.Now())
+	}
+	return l.rotationConfig.MaxSize > 0 && size >= l.rotationConfig.MaxSize
 }
 
 // rotateLocked performs log file rotation
@@ -53,13 +103,12 @@ func (l *Logger) rotateLocked() error {
 	}
 
 	// Close current file
+	l.flushLocked()
 	if err := l.file.Close(); err != nil {
 		return fmt.Errorf("failed to close log file: %w", err)
 	}
 
-	// Generate backup filename with timestamp for uniqueness
-	timestamp := time.Now().Format("20060102-150405")
-	backupPath := fmt.Sprintf("%s.%s", l.logPath, timestamp)
+	backupPath := l.backupPath(time.Now())
 
 	// Rename current log file to backup
 	if err := os.Rename(l.logPath, backupPath); err != nil {
@@ -72,26 +121,68 @@ func (l *Logger) rotateLocked() error {
 		return fmt.Errorf("failed to open new log file: %w", err)
 	}
 
-	l.file = file
-	// Update multi-writer
-	multiWriter := io.MultiWriter(os.Stdout, file)
-	l.fileLogger.SetOutput(multiWriter)
+	l.setFileLocked(file)
+	l.nextRotation = l.rotationConfig.nextRotation(time.Now())
 
 	// Perform slow operations in the background
+	l.background.Add(1)
 	go l.compressAndCleanup(backupPath)
 
 	return nil
 }
 
+// backupPath returns an unused backup file name for a rotation at t.
+// A sequence suffix is added if a backup with the same timestamp exists.
+func (l *Logger) backupPath(t time.Time) string {
+	base := fmt.Sprintf("%s.%s", l.logPath, t.Format(backupTimeFormat))
+	path := base
+	for seq := 1; fileExists(path) || fileExists(path+".gz"); seq++ {
+		path = fmt.Sprintf("%s-%d", base, seq)
+	}
+	return path
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// leftoverBackups removes partial compression output and returns the
+// uncompressed backups that still need compressing
+func (l *Logger) leftoverBackups() []string {
+	if l.logPath == "" || l.rotationConfig == nil {
+		return nil
+	}
+	backups, err := l.listBackups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list log backups: %v\n", err)
+		return nil
+	}
+
+	var pending []string
+	for _, b := range backups {
+		switch {
+		case strings.HasSuffix(b.path, ".gz.tmp"):
+			os.Remove(b.path)
+		case l.rotationConfig.Compress && !strings.HasSuffix(b.path, ".gz"):
+			pending = append(pending, b.path)
+		}
+	}
+	return pending
+}
+
 // compressAndCleanup runs compression and cleanup in the background
-func (l *Logger) compressAndCleanup(backupPath string) {
+func (l *Logger) compressAndCleanup(backupPaths ...string) {
+	defer l.background.Done()
 	if l.rotationConfig != nil && l.rotationConfig.Compress {
-		if err := compressFile(backupPath); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to compress log file %s: %v\n", backupPath, err)
-		} else {
-			// Remove uncompressed file after successful compression
-			if err := os.Remove(backupPath); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to remove uncompressed log file %s: %v\n", backupPath, err)
+		for _, backupPath := range backupPaths {
+			if err := compressFile(backupPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to compress log file %s: %v\n", backupPath, err)
+			} else {
+				// Remove uncompressed file after successful compression
+				if err := os.Remove(backupPath); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to remove uncompressed log file %s: %v\n", backupPath, err)
+				}
 			}
 		}
 	}
@@ -106,95 +197,111 @@ func (l *Logger) compressAndCleanup(backupPath string) {
 type backupFile struct {
 	path string
 	ts   time.Time
+	seq  int
+	size int64
 }
 
-// cleanupOldBackups removes old backup files based on MaxBackups and MaxAge
-// This version is safe to run in a goroutine
-func (l *Logger) cleanupOldBackups() error {
-	if l.logPath == "" || l.rotationConfig == nil {
-		return nil
+// parseBackupName extracts the timestamp and sequence number from the part
+// of a backup file name after the log file name
+func parseBackupName(suffix string) (time.Time, int, bool) {
+	suffix = strings.TrimSuffix(strings.TrimSuffix(suffix, ".tmp"), ".gz")
+	for _, layout := range []string{backupTimeFormat, legacyBackupTimeFormat} {
+		if ts, err := time.ParseInLocation(layout, suffix, time.Local); err == nil {
+			return ts, 0, true
+		}
+	}
+	i := strings.LastIndex(suffix, "-")
+	if i < 0 {
+		return time.Time{}, 0, false
 	}
+	seq, err := strconv.Atoi(suffix[i+1:])
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	ts, err := time.ParseInLocation(backupTimeFormat, suffix[:i], time.Local)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	return ts, seq, true
+}
 
+// listBackups returns the backups of the log file, newest first
+func (l *Logger) listBackups() ([]backupFile, error) {
 	dir := filepath.Dir(l.logPath)
-	base := filepath.Base(l.logPath)
-	expectedPrefix := base + "."
+	expectedPrefix := filepath.Base(l.logPath) + "."
 
 	// Read directory entries
 	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return fmt.Errorf("failed to read log directory: %w", err)
+		return nil, fmt.Errorf("failed to read log directory: %w", err)
 	}
 
 	var backups []backupFile
-	now := time.Now()
-
-	// Find and parse backup files
 	for _, entry := range entries {
 		name := entry.Name()
-		if !strings.HasPrefix(name, expectedPrefix) {
+		if entry.IsDir() || !strings.HasPrefix(name, expectedPrefix) {
 			continue
 		}
-
-		// Parse timestamp from filename
-		timestampPart := strings.TrimPrefix(name, expectedPrefix)
-		if strings.HasSuffix(timestampPart, ".gz") {
-			timestampPart = strings.TrimSuffix(timestampPart, ".gz")
-		}
-
-		// Parse timestamp (second precision)
-		ts, err := time.Parse("20060102-150405", timestampPart)
-		if err != nil {
+		ts, seq, ok := parseBackupName(strings.TrimPrefix(name, expectedPrefix))
+		if !ok {
 			continue // Not a valid backup file format
 		}
-		backups = append(backups, backupFile{path: filepath.Join(dir, name), ts: ts})
+		var size int64
+		if info, err := entry.Info(); err == nil {
+			size = info.Size()
+		}
+		backups = append(backups, backupFile{path: filepath.Join(dir, name), ts: ts, seq: seq, size: size})
 	}
 
-	// Sort backups by timestamp, newest first
 	sort.Slice(backups, func(i, j int) bool {
-		return backups[i].ts.After(backups[j].ts)
+		if !backups[i].ts.Equal(backups[j].ts) {
+			return backups[i].ts.After(backups[j].ts)
+		}
+		return backups[i].seq > backups[j].seq
 	})
+	return backups, nil
+}
 
-	// Determine which files to delete
-	var toDelete []string
-
-	// Apply MaxBackups policy
-	if l.rotationConfig.MaxBackups > 0 && len(backups) > l.rotationConfig.MaxBackups {
-		for i := l.rotationConfig.MaxBackups; i < len(backups); i++ {
-			toDelete = append(toDelete, backups[i].path)
-		}
+// cleanupOldBackups removes old backup files based on MaxBackups, MaxAge
+// and MaxTotalSize. This version is safe to run in a goroutine
+func (l *Logger) cleanupOldBackups() error {
+	if l.logPath == "" || l.rotationConfig == nil {
+		return nil
 	}
 
-	// Apply MaxAge policy
-	if l.rotationConfig.MaxAge > 0 {
-		cutoff := now.AddDate(0, 0, -l.rotationConfig.MaxAge)
-		for _, backup := range backups {
-			if backup.ts.Before(cutoff) {
-				// Check if already marked for deletion
-				alreadyMarked := false
-				for _, path := range toDelete {
-					if path == backup.path {
-						alreadyMarked = true
-						break
-					}
-				}
-				if !alreadyMarked {
-					toDelete = append(toDelete, backup.path)
-				}
-			}
+	all, err := l.listBackups()
+	if err != nil {
+		return err
+	}
+	// Compression output still being written is not a backup yet
+	var backups []backupFile
+	for _, b := range all {
+		if !strings.HasSuffix(b.path, ".tmp") {
+			backups = append(backups, b)
 		}
 	}
 
-	// Delete identified files
-	for _, path := range toDelete {
-		if err := os.Remove(path); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to remove old backup %s: %v\n", path, err)
+	cutoff := time.Now().AddDate(0, 0, -l.rotationConfig.MaxAge)
+	var total int64
+	for i, backup := range backups {
+		total += backup.size
+		remove := (l.rotationConfig.MaxBackups > 0 && i >= l.rotationConfig.MaxBackups) ||
+			(l.rotationConfig.MaxAge > 0 && backup.ts.Before(cutoff)) ||
+			(l.rotationConfig.MaxTotalSize > 0 && total > l.rotationConfig.MaxTotalSize)
+		if !remove {
+			continue
+		}
+		if err := os.Remove(backup.path); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove old backup %s: %v\n", backup.path, err)
 		}
 	}
 
 	return nil
 }
 
-// compressFile compresses a file using gzip
+// compressFile compresses a file using gzip. The output is written to a
+// temporary file and renamed so an interrupted run never leaves a truncated
+// .gz behind.
 func compressFile(path string) error {
 	source, err := os.Open(path)
 	if err != nil {
@@ -202,21 +309,24 @@ func compressFile(path string) error {
 	}
 	defer source.Close()
 
-	destPath := path + ".gz"
-	dest, err := os.Create(destPath)
+	tmpPath := path + ".gz.tmp"
+	dest, err := os.Create(tmpPath)
 	if err != nil {
 		return err
 	}
-	defer dest.Close()
 
 	gz := gzip.NewWriter(dest)
-	defer gz.Close()
-
-	// Copy file contents
-	if _, err := io.Copy(gz, source); err != nil {
-		os.Remove(destPath) // Clean up on error
+	_, err = io.Copy(gz, source)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath) // Clean up on error
 		return err
 	}
 
-	return nil
-}
\ No newline at end of file
+	return os.Rename(tmpPath, path+".gz")
+}
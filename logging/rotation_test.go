@@ -280,4 +280,180 @@ func TestLogRotationWithCompression(t *testing.T) {
 	if !compressedFound {
 		t.Error("No compressed backup files found")
 	}
-}
\ No newline at end of file
+}
+
+func TestReopenAfterExternalRename(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "test.log")
+
+	// External rotation disables the built-in size check
+	logger, err := newLoggerWithRotation(logPath, nil)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	logger.Info("before rotation")
+	rotated := logPath + ".1"
+	if err := os.Rename(logPath, rotated); err != nil {
+		t.Fatal(err)
+	}
+	// Until the file is reopened, lines still go to the renamed file
+	logger.Info("still old file")
+	if err := logger.Reopen(); err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	logger.Info("after rotation")
+
+	old, _ := os.ReadFile(rotated)
+	current, _ := os.ReadFile(logPath)
+	if !strings.Contains(string(old), "before rotation") || !strings.Contains(string(old), "still old file") {
+		t.Errorf("Renamed file missing earlier lines: %s", old)
+	}
+	if strings.Contains(string(old), "after rotation") {
+		t.Error("Line written after Reopen went to the renamed file")
+	}
+	if !strings.Contains(string(current), "after rotation") {
+		t.Errorf("New log file missing line written after Reopen: %s", current)
+	}
+}
+
+func TestNextRotation(t *testing.T) {
+	at := time.Date(2024, 3, 31, 23, 15, 0, 0, time.UTC)
+	tests := []struct {
+		schedule string
+		want     time.Time
+	}{
+		{"", time.Time{}},
+		{RotateHourly, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{RotateDaily, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got := (&RotationConfig{Schedule: tt.schedule}).nextRotation(at)
+		if !got.Equal(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.schedule, got, tt.want)
+		}
+	}
+	if (&RotationConfig{Schedule: RotateHourly}).nextRotation(at.Add(-time.Hour)).Hour() != 23 {
+		t.Error("Hourly rotation should happen at the start of the next hour")
+	}
+	if err := (&RotationConfig{Schedule: "weekly"}).validate(); err == nil {
+		t.Error("Expected error for unknown schedule")
+	}
+}
+
+func TestScheduledRotation(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "test.log")
+
+	logger, err := newLoggerWithRotation(logPath, &RotationConfig{Schedule: RotateHourly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	logger.Info("first period")
+	logger.mu.Lock()
+	logger.nextRotation = time.Now().Add(-time.Second)
+	logger.mu.Unlock()
+	logger.Info("second period")
+
+	backups, err := logger.listBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("Expected one backup after the scheduled rotation, got %d", len(backups))
+	}
+	old, _ := os.ReadFile(backups[0].path)
+	current, _ := os.ReadFile(logPath)
+	if !strings.Contains(string(old), "first period") || !strings.Contains(string(current), "second period") {
+		t.Errorf("Unexpected contents: backup %q, current %q", old, current)
+	}
+	if !logger.nextRotation.After(time.Now()) {
+		t.Error("Next rotation was not rescheduled")
+	}
+}
+
+func TestRapidRotationsDoNotCollide(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "test.log")
+
+	logger, err := newLoggerWithRotation(logPath, &RotationConfig{MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	// Every line exceeds MaxSize, so each write after the first rotates
+	for i := 0; i < 10; i++ {
+		logger.Info("message %d", i)
+	}
+
+	backups, err := logger.listBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 9 {
+		t.Errorf("Expected 9 distinct backups, got %d", len(backups))
+	}
+
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+	first := logger.backupPath(at)
+	os.WriteFile(first, nil, 0644)
+	if second := logger.backupPath(at); second == first || !strings.HasSuffix(second, "-1") {
+		t.Errorf("Expected a sequence suffix for a colliding name, got %s", second)
+	}
+}
+
+func TestMaxTotalSizeRetention(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "test.log")
+
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		name := logPath + "." + base.Add(time.Duration(i)*time.Minute).Format(backupTimeFormat)
+		if err := os.WriteFile(name, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logger := &Logger{logPath: logPath, rotationConfig: &RotationConfig{MaxTotalSize: 250}}
+	if err := logger.cleanupOldBackups(); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := logger.listBackups()
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups within 250 bytes, got %d", len(backups))
+	}
+	if !backups[0].ts.Equal(base.Add(4*time.Minute).Truncate(time.Millisecond)) {
+		t.Errorf("Expected the newest backups to be kept, got %v", backups[0].ts)
+	}
+}
+
+func TestStartupCompressesLeftoverBackups(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "test.log")
+
+	// Simulate a run interrupted while compressing a backup
+	leftover := logPath + "." + time.Now().Add(-time.Minute).Format(backupTimeFormat)
+	os.WriteFile(leftover, []byte("interrupted\n"), 0644)
+	os.WriteFile(leftover+".gz.tmp", []byte("partial"), 0644)
+
+	logger, err := newLoggerWithRotation(logPath, &RotationConfig{MaxSize: 1 << 20, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for fileExists(leftover) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if fileExists(leftover) || fileExists(leftover+".gz.tmp") {
+		t.Error("Leftover backup was not compressed on startup")
+	}
+	if !fileExists(leftover + ".gz") {
+		t.Error("Expected compressed backup")
+	}
+}
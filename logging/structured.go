@@ -0,0 +1,192 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Log levels, shared with log/slog
+const (
+	LevelDebug = slog.LevelDebug
+	LevelInfo  = slog.LevelInfo
+	LevelWarn  = slog.LevelWarn
+	LevelError = slog.LevelError
+)
+
+// Output formats
+const (
+	FormatText = "text" // [LEVEL] message key=value
+	FormatJSON = "json" // one JSON object per line
+)
+
+var (
+	// minLevel filters out messages below the configured level
+	minLevel slog.LevelVar
+	// outputFormat holds FormatText or FormatJSON
+	outputFormat atomic.Value
+)
+
+func init() {
+	outputFormat.Store(FormatText)
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level '%s' (expected debug, info, warn or error)", s)
+	}
+	return level, nil
+}
+
+// SetLevel sets the minimum level that is written
+func SetLevel(level slog.Level) {
+	minLevel.Set(level)
+}
+
+// Enabled reports whether messages at level are written
+func Enabled(level slog.Level) bool {
+	return level >= minLevel.Level()
+}
+
+// SetFormat selects the text or JSON output format
+func SetFormat(format string) error {
+	switch format {
+	case FormatText, FormatJSON:
+		outputFormat.Store(format)
+		return nil
+	}
+	return fmt.Errorf("unknown log format '%s' (expected text or json)", format)
+}
+
+// getFormat returns the current output format
+func getFormat() string {
+	return outputFormat.Load().(string)
+}
+
+// formatText renders a message followed by key=value fields
+func formatText(level slog.Level, msg string, attrs []slog.Attr) string {
+	var b strings.Builder
+	b.WriteString("[" + level.String() + "] " + msg)
+	for _, a := range attrs {
+		value := a.Value.Resolve().String()
+		if a.Value.Kind() == slog.KindDuration {
+			value = a.Value.Duration().String()
+		}
+		if value == "" || strings.ContainsAny(value, " \t\"=") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(" " + a.Key + "=" + value)
+	}
+	return b.String()
+}
+
+// formatJSON renders a message and its fields as a single JSON object
+func formatJSON(t time.Time, level slog.Level, msg string, attrs []slog.Attr) string {
+	var b strings.Builder
+	writeField := func(key string, value interface{}) {
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		b.WriteByte(',')
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+
+	b.WriteString(`{"time":"` + t.Format(time.RFC3339Nano) + `"`)
+	writeField("level", level.String())
+	writeField("msg", msg)
+	for _, a := range attrs {
+		v := a.Value.Resolve()
+		switch v.Kind() {
+		case slog.KindDuration:
+			writeField(a.Key, v.Duration().String())
+		case slog.KindTime:
+			writeField(a.Key, v.Time().Format(time.RFC3339Nano))
+		default:
+			if err, ok := v.Any().(error); ok {
+				writeField(a.Key, err.Error())
+			} else {
+				writeField(a.Key, v.Any())
+			}
+		}
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// handler bridges log/slog to the global logger. It looks up the global
+// logger on every record so it keeps working across Init and Close.
+type handler struct {
+	attrs  []slog.Attr
+	prefix string // group prefix for keys added later
+}
+
+// Handler returns a slog.Handler that writes through the global logger
+func Handler() slog.Handler {
+	return &handler{}
+}
+
+// Slog returns a slog.Logger that writes through the global logger
+func Slog() *slog.Logger {
+	return slog.New(Handler())
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return Enabled(level)
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	attrs := make([]slog.Attr, 0, len(h.attrs)+r.NumAttrs())
+	attrs = append(attrs, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, flatten(h.prefix, a)...)
+		return true
+	})
+	GetLogger().write(r.Level, r.Message, attrs)
+	return nil
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := &handler{prefix: h.prefix, attrs: append([]slog.Attr(nil), h.attrs...)}
+	for _, a := range attrs {
+		next.attrs = append(next.attrs, flatten(h.prefix, a)...)
+	}
+	return next
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &handler{attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+// flatten expands group attributes into dotted keys
+func flatten(prefix string, a slog.Attr) []slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		if a.Key == "" {
+			return nil
+		}
+		return []slog.Attr{{Key: prefix + a.Key, Value: a.Value}}
+	}
+	groupPrefix := prefix
+	if a.Key != "" {
+		groupPrefix += a.Key + "."
+	}
+	var out []slog.Attr
+	for _, ga := range a.Value.Group() {
+		out = append(out, flatten(groupPrefix, ga)...)
+	}
+	return out
+}
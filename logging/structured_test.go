@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevelFilterAndFields(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "test.log")
+
+	logger, err := newLoggerWithRotation(logPath, nil)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	SetLevel(LevelWarn)
+	defer SetLevel(LevelInfo)
+
+	logger.Info("filtered out")
+	logger.write(LevelWarn, "Stored telemetry", nil)
+
+	content, _ := os.ReadFile(logPath)
+	if strings.Contains(string(content), "filtered out") {
+		t.Error("Info message written below the configured level")
+	}
+	if !strings.Contains(string(content), "[WARN] Stored telemetry") {
+		t.Errorf("Expected warning in log, got: %s", content)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	line := formatJSON(ts, LevelInfo, "Stored telemetry", flatten("", slogAttrs(
+		"signal", "traces", "records", 3, "duration", 1500*time.Microsecond, "error", errors.New("boom"),
+	)))
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+		t.Fatalf("Invalid JSON %q: %v", line, err)
+	}
+	want := map[string]interface{}{
+		"time": "2024-01-02T03:04:05Z", "level": "INFO", "msg": "Stored telemetry",
+		"signal": "traces", "records": float64(3), "duration": "1.5ms", "error": "boom",
+	}
+	for key, value := range want {
+		if decoded[key] != value {
+			t.Errorf("%s = %v, want %v", key, decoded[key], value)
+		}
+	}
+}
+
+func TestFormatText(t *testing.T) {
+	line := formatText(LevelError, "Rejected telemetry", flatten("", slogAttrs("error", "tenant quota exceeded", "signal", "logs")))
+	want := `[ERROR] Rejected telemetry error="tenant quota exceeded" signal=logs`
+	if line != want {
+		t.Errorf("got %q, want %q", line, want)
+	}
+}
+
+// slogAttrs converts alternating keys and values to a group attribute
+func slogAttrs(args ...interface{}) slog.Attr {
+	return slog.Group("", args...)
+}
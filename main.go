@@ -2,20 +2,32 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/RedShiftVelocity/sqlite-otel/auth"
+	"github.com/RedShiftVelocity/sqlite-otel/config"
 	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/exporter"
 	"github.com/RedShiftVelocity/sqlite-otel/handlers"
 	"github.com/RedShiftVelocity/sqlite-otel/logging"
+	"github.com/RedShiftVelocity/sqlite-otel/ratelimit"
+	"github.com/RedShiftVelocity/sqlite-otel/selftelemetry"
+	"github.com/RedShiftVelocity/sqlite-otel/stats"
+	"github.com/RedShiftVelocity/sqlite-otel/tlsconfig"
+	"github.com/RedShiftVelocity/sqlite-otel/ui"
 )
 
 // Build-time variables (set by ldflags)
@@ -25,7 +37,48 @@ var (
 	GitCommit = "unknown"
 )
 
+// serverOptions holds the settings for the OTLP receiver
+type serverOptions struct {
+	port              int
+	dbPath            string
+	tls               tlsconfig.Options
+	identityAttribute string
+	authKeysFile      string
+	authToken         string
+	configFile        string
+	cfg               *config.Config
+	tenantSources     []string
+	tenantHeader      string
+	tenantAttribute   string
+	tenantMaxOpen     int
+	maxTenants        int
+	retention         time.Duration
+	retentionInterval time.Duration
+	archiveDir        string
+	maxDBSizeMB       int64
+	adminAddr         string
+	shutdownTimeout   time.Duration
+	shutdownDelay     time.Duration
+	readyMinFreeMB    int64
+	minFreeDiskMB     int64
+	diskCheckInterval time.Duration
+	forwardEndpoint   string
+	forwardEncoding   string
+	readyMaxInFlight  int
+	selfTelemetry     bool
+	ui                bool
+	selfInterval      time.Duration
+	cors              handlers.CORSOptions
+	sql               handlers.SQLOptions
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+
 	// Define command-line flags
 	port := flag.Int("port", 4318, "Port to listen on (default: 4318, OTLP/HTTP standard)")
 	
@@ -42,6 +95,80 @@ func main() {
 	logMaxBackups := flag.Int("log-max-backups", 7, "Maximum number of old log files to keep (default: 7)")
 	logMaxAge := flag.Int("log-max-age", 30, "Maximum number of days to keep old log files (default: 30)")
 	logCompress := flag.Bool("log-compress", true, "Compress rotated log files (default: true)")
+	logMaxTotalSize := flag.Int64("log-max-total-size", 0, "Maximum combined size of rotated log files in MB (default: 0, unlimited)")
+	logRotationSchedule := flag.String("log-rotation-schedule", "", "Also rotate the log file on a schedule: daily or hourly (default: size only)")
+	logRotation := flag.String("log-rotation", "builtin", "Log rotation mode: builtin, or external when logrotate renames the file and sends SIGHUP (default: builtin)")
+	logLevel := flag.String("log-level", "info", "Minimum log level: debug, info, warn or error (default: info)")
+	logFormat := flag.String("log-format", logging.FormatText, "Log output format: text or json (default: text)")
+	logOutput := flag.String("log-output", logging.OutputAuto, "Comma separated log outputs: auto, stdout, file, journald, syslog (default: auto, journald under systemd, otherwise stdout and file)")
+	logBufferSize := flag.Int("log-buffer-size", logging.DefaultBufferSize, "Log lines queued for background writing, oldest dropped when full; 0 writes synchronously (default: 8192)")
+	logFlushInterval := flag.Duration("log-flush-interval", logging.DefaultFlushInterval, "How often buffered log file output is flushed (default: 1s)")
+	syslogAddress := flag.String("syslog-address", logging.DefaultSyslogAddress, "Syslog socket for the syslog output: unix:///path or udp://host:port (default: "+logging.DefaultSyslogAddress+")")
+	
+	// TLS flags
+	tlsCert := flag.String("tls-cert", "", "Path to PEM encoded TLS certificate (enables HTTPS)")
+	tlsKey := flag.String("tls-key", "", "Path to PEM encoded TLS private key")
+	tlsClientCA := flag.String("tls-client-ca", "", "Path to PEM encoded CA bundle for verifying client certificates")
+	tlsRequireClientCert := flag.Bool("tls-require-client-cert", false, "Reject clients without a valid certificate (requires -tls-client-ca)")
+	tlsMinVersion := flag.String("tls-min-version", "1.2", "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3 (default: 1.2)")
+	tlsReloadInterval := flag.Duration("tls-reload-interval", tlsconfig.DefaultReloadInterval, "How often to check certificate files for changes (default: 30s)")
+	tlsIdentityAttribute := flag.String("tls-identity-attribute", "", "Resource attribute used to record the client certificate subject (empty disables)")
+	
+	// Authentication flags
+	authKeysFile := flag.String("auth-keys-file", "", "Path to JSON file of hashed API keys and their permissions (enables authentication)")
+	authToken := flag.String("auth-token", "", "Static bearer token granting all permissions except admin (enables authentication)")
+	
+	// Configuration file for structured settings
+	configFile := flag.String("config", "", "Path to JSON configuration file with per-tenant settings")
+	
+	// Multi-tenancy and retention flags
+	tenantSources := flag.String("tenant-sources", "", "Comma separated tenant resolution order: header, key, identity, attribute (empty disables multi-tenancy)")
+	tenantHeader := flag.String("tenant-header", handlers.DefaultTenantHeader, "Request header carrying the tenant ID (default: "+handlers.DefaultTenantHeader+")")
+	tenantAttribute := flag.String("tenant-attribute", "tenant.id", "Resource attribute carrying the tenant ID (default: tenant.id)")
+	tenantMaxOpen := flag.Int("tenant-max-open", 16, "Maximum number of idle tenant databases kept open (default: 16)")
+	maxTenants := flag.Int("max-tenants", 100, "Maximum number of tenant databases created, so unknown tenant names cannot fill the disk (default: 100, 0 for unlimited)")
+	retention := flag.String("retention", "0", "Delete telemetry older than this, e.g. 72h or 30d (default: 0, keep forever)")
+	retentionInterval := flag.Duration("retention-interval", 10*time.Minute, "How often expired data is purged (default: 10m)")
+	archiveDir := flag.String("archive-dir", "", "Write expired telemetry to Parquet files under this directory before retention deletes it (empty disables)")
+	maxDBSize := flag.Int64("max-db-size", 0, "Per-tenant database size quota in MB (default: 0, unlimited)")
+	
+	// Storage pressure flags
+	busyTimeout := flag.Duration("db-busy-timeout", database.BusyTimeout, "How long a write waits for a locked database before failing with 503 (default: 5s)")
+	minFreeDisk := flag.Int64("min-free-disk", 0, "Delete the oldest telemetry when free disk space drops below this, in MB (default: 0, disabled)")
+	diskCheckInterval := flag.Duration("disk-check-interval", 30*time.Second, "How often free disk space is checked (default: 30s)")
+	
+	// Readiness thresholds
+	readyMinFreeDisk := flag.Int64("ready-min-free-disk", 100, "Report not ready when the database file system has less free space than this, in MB (default: 100, 0 disables)")
+	readyMaxInFlight := flag.Int("ready-max-in-flight", 512, "Report not ready at this many in-flight ingest requests (default: 512, 0 disables)")
+	
+	// Shutdown flags
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "How long to wait for in-flight requests on shutdown (default: 30s)")
+	shutdownDelay := flag.Duration("shutdown-delay", 0, "How long to fail /readyz before stopping the listener on shutdown (default: 0)")
+	
+	// Forwarding to an upstream OTLP endpoint
+	forwardEndpoint := flag.String("forward-endpoint", "", "Forward stored telemetry to this OTLP/HTTP base URL, e.g. http://otel-collector:4318 (empty disables)")
+	forwardEncoding := flag.String("forward-encoding", exporter.EncodingProtobuf, "Encoding of forwarded requests: protobuf or json (default: protobuf)")
+	
+	// Admin listener for the collector's own metrics
+	adminAddr := flag.String("admin-addr", "", "Address for a separate admin listener serving /metrics, e.g. 127.0.0.1:9464 (default: serve /metrics on the main port)")
+	
+	// Self-telemetry flags
+	selfTelemetry := flag.Bool("self-telemetry", false, "Store the collector's own metrics, log lines and ingest spans in its database")
+	selfInterval := flag.Duration("self-telemetry-interval", selftelemetry.DefaultInterval, "How often self-telemetry is written (default: 30s)")
+	
+	// CORS flags for browser based exporters
+	corsOrigins := flag.String("cors-allowed-origins", "", "Comma separated origins allowed to send OTLP data from a browser, * wildcards allowed (empty disables CORS)")
+	corsHeaders := flag.String("cors-allowed-headers", "", "Comma separated request headers allowed in CORS requests, or * (default: Content-Type, Authorization, X-API-Key and the tenant header)")
+	corsMaxAge := flag.Duration("cors-max-age", 10*time.Minute, "How long browsers may cache CORS preflight responses (default: 10m)")
+	corsAllowCredentials := flag.Bool("cors-allow-credentials", false, "Allow credentials (cookies, HTTP authentication) in CORS requests")
+
+	// Web UI
+	webUI := flag.Bool("ui", true, "Serve the web UI for browsing stored telemetry at /ui/")
+
+	// SQL endpoint limits, the endpoint needs authentication and an admin key
+	sqlTimeout := flag.Duration("sql-timeout", 10*time.Second, "How long a query of /api/v1/sql may run (default: 10s)")
+	sqlMaxRows := flag.Int("sql-max-rows", 10000, "Maximum rows returned by /api/v1/sql (default: 10000)")
+	sqlMaxBytes := flag.Int64("sql-max-bytes", 10, "Maximum size in MB of a /api/v1/sql result (default: 10)")
 	
 	showVersion := flag.Bool("version", false, "Show version information")
 	
@@ -57,23 +184,167 @@ func main() {
 
 	// Initialize logging with rotation configuration
 	rotationConfig := &logging.RotationConfig{
-		MaxSize:    *logMaxSize * 1024 * 1024, // Convert MB to bytes
-		MaxBackups: *logMaxBackups,
-		MaxAge:     *logMaxAge,
-		Compress:   *logCompress,
+		MaxSize:      *logMaxSize * 1024 * 1024, // Convert MB to bytes
+		MaxBackups:   *logMaxBackups,
+		MaxAge:       *logMaxAge,
+		MaxTotalSize: *logMaxTotalSize * 1024 * 1024,
+		Compress:     *logCompress,
+		Schedule:     *logRotationSchedule,
+	}
+	switch *logRotation {
+	case "builtin":
+	case "external":
+		// An external tool renames the file; SIGHUP reopens it
+		rotationConfig = nil
+	default:
+		log.Fatalf("Invalid -log-rotation: unknown mode '%s' (expected builtin or external)", *logRotation)
+	}
+	
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("Invalid -log-level: %v", err)
+	}
+	logging.SetLevel(level)
+	if err := logging.SetFormat(*logFormat); err != nil {
+		log.Fatalf("Invalid -log-format: %v", err)
+	}
+	
+	// Validate the remaining flags while log.Fatalf still writes to stderr;
+	// once logging is set up it goes through the asynchronous logger
+	sources, err := handlers.ParseTenantSources(*tenantSources)
+	if err != nil {
+		log.Fatalf("Invalid -tenant-sources: %v", err)
+	}
+	retentionPeriod, err := config.ParseDuration(*retention)
+	if err != nil {
+		log.Fatalf("Invalid -retention: %v", err)
+	}
+	if *sqlTimeout <= 0 || *sqlMaxRows <= 0 || *sqlMaxBytes <= 0 {
+		log.Fatalf("Invalid SQL limits: -sql-timeout, -sql-max-rows and -sql-max-bytes must be positive")
+	}
+	corsOptions := handlers.CORSOptions{
+		AllowedOrigins:   splitList(*corsOrigins),
+		AllowedHeaders:   splitList(*corsHeaders),
+		MaxAge:           *corsMaxAge,
+		AllowCredentials: *corsAllowCredentials,
+	}
+	if err := corsOptions.Validate(); err != nil {
+		log.Fatalf("Invalid -cors-allow-credentials: %v", err)
+	}
+
+	// The configuration file is read first since it may select log outputs
+	cfg := &config.Config{}
+	if *configFile != "" {
+		if cfg, err = config.Load(*configFile); err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
 	}
 	
-	if err := logging.InitWithRotation(*logFile, rotationConfig); err != nil {
+	outputs, err := logging.ParseOutputs(*logOutput)
+	if err != nil {
+		log.Fatalf("Invalid -log-output: %v", err)
+	}
+	outputConfig := logging.OutputConfig{
+		Outputs:       outputs,
+		FilePath:      *logFile,
+		SyslogAddress: *syslogAddress,
+		BufferSize:    *logBufferSize,
+		FlushInterval: *logFlushInterval,
+	}
+	if cfg.Logging != nil {
+		// Explicit flags take precedence over the configuration file
+		setFlags := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+		if len(cfg.Logging.Outputs) > 0 && !setFlags["log-output"] {
+			if outputConfig.Outputs, err = logging.ParseOutputs(strings.Join(cfg.Logging.Outputs, ",")); err != nil {
+				log.Fatalf("Invalid logging outputs in configuration: %v", err)
+			}
+		}
+		if cfg.Logging.SyslogAddress != "" && !setFlags["syslog-address"] {
+			outputConfig.SyslogAddress = cfg.Logging.SyslogAddress
+		}
+	}
+	
+	if err := logging.InitWithOutputs(outputConfig, rotationConfig); err != nil {
 		log.Fatalf("Failed to initialize logging: %v", err)
 	}
 	defer logging.Close()
+	// Route log/slog and the standard log package through the same logger
+	slog.SetDefault(logging.Slog())
+	database.SetBusyTimeout(*busyTimeout)
 
-	if err := run(*port, *dbPath); err != nil {
-		log.Fatalf("Application error: %v", err)
+	opts := &serverOptions{
+		port:   *port,
+		dbPath: *dbPath,
+		tls: tlsconfig.Options{
+			CertFile:          *tlsCert,
+			KeyFile:           *tlsKey,
+			ClientCAFile:      *tlsClientCA,
+			RequireClientCert: *tlsRequireClientCert,
+			MinVersion:        *tlsMinVersion,
+			ReloadInterval:    *tlsReloadInterval,
+		},
+		identityAttribute: *tlsIdentityAttribute,
+		authKeysFile:      *authKeysFile,
+		authToken:         *authToken,
+		configFile:        *configFile,
+		cfg:               cfg,
+		tenantSources:     sources,
+		tenantHeader:      *tenantHeader,
+		tenantAttribute:   *tenantAttribute,
+		tenantMaxOpen:     *tenantMaxOpen,
+		maxTenants:        *maxTenants,
+		retention:         retentionPeriod,
+		retentionInterval: *retentionInterval,
+		archiveDir:        *archiveDir,
+		maxDBSizeMB:       *maxDBSize,
+		adminAddr:         *adminAddr,
+		shutdownTimeout:   *shutdownTimeout,
+		shutdownDelay:     *shutdownDelay,
+		readyMinFreeMB:    *readyMinFreeDisk,
+		minFreeDiskMB:     *minFreeDisk,
+		diskCheckInterval: *diskCheckInterval,
+		forwardEndpoint:   *forwardEndpoint,
+		forwardEncoding:   *forwardEncoding,
+		readyMaxInFlight:  *readyMaxInFlight,
+		selfTelemetry:     *selfTelemetry,
+		selfInterval:      *selfInterval,
+		ui:                *webUI,
+		cors:              corsOptions,
+		sql: handlers.SQLOptions{
+			Timeout:  *sqlTimeout,
+			MaxRows:  *sqlMaxRows,
+			MaxBytes: *sqlMaxBytes * 1024 * 1024,
+		},
+	}
+	if len(opts.cors.AllowedHeaders) == 0 {
+		opts.cors.AllowedHeaders = append([]string{}, handlers.DefaultCORSHeaders...)
+		if !strings.EqualFold(opts.tenantHeader, handlers.DefaultTenantHeader) {
+			opts.cors.AllowedHeaders = append(opts.cors.AllowedHeaders, opts.tenantHeader)
+		}
+	}
+
+	if err := run(opts); err != nil {
+		code := 1
+		if errors.Is(err, errUncleanShutdown) {
+			code = exitUncleanShutdown
+		}
+		// Log through the logger and close it so queued lines are written
+		logging.Error("Application error: %v", err)
+		logging.Close()
+		os.Exit(code)
 	}
 }
 
-func run(port int, dbPath string) error {
+// exitUncleanShutdown is the exit status when shutdown did not complete
+// cleanly, for example because requests were still running at the deadline
+const exitUncleanShutdown = 2
+
+// errUncleanShutdown marks errors that happened while draining
+var errUncleanShutdown = errors.New("unclean shutdown")
+
+func run(opts *serverOptions) (err error) {
+	port, dbPath := opts.port, opts.dbPath
 	logger := logging.GetLogger()
 	logger.LogStartup(port, dbPath)
 	// Ensure directory exists
@@ -88,10 +359,98 @@ func run(port int, dbPath string) error {
 		logger.Error("Failed to initialize database: %v", err)
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
-	defer database.CloseDB()
+	defer func() {
+		if closeErr := database.CloseDB(); closeErr != nil && err == nil {
+			err = fmt.Errorf("%w: %v", errUncleanShutdown, closeErr)
+		}
+	}()
 
 	logger.Info("SQLite database initialized at: %s", dbPath)
 
+	if opts.selfTelemetry {
+		recorder := selftelemetry.New(opts.selfInterval, Version)
+		recorder.Start()
+		defer recorder.Stop()
+		logger.Info("Self-telemetry enabled (service.name=%s, interval %s)", selftelemetry.ServiceName, opts.selfInterval)
+	}
+
+	cfg := opts.cfg
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	if opts.configFile != "" {
+		logger.Info("Loaded configuration from %s", opts.configFile)
+	}
+
+	// Tenant databases live next to the main database
+	tenants := database.NewTenantManager(filepath.Join(dbDir, "tenants"), opts.tenantMaxOpen)
+	defer func() {
+		if closeErr := tenants.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("%w: %v", errUncleanShutdown, closeErr)
+		}
+	}()
+	tenants.SetPolicies(tenantPolicies(opts, cfg))
+	tenants.SetMaxTenants(opts.maxTenants)
+	if len(opts.tenantSources) > 0 {
+		handlers.SetTenancy(tenants, handlers.TenantOptions{
+			Sources:   opts.tenantSources,
+			Header:    opts.tenantHeader,
+			Attribute: opts.tenantAttribute,
+		})
+		logger.Info("Multi-tenancy enabled (sources: %s), tenant databases in %s",
+			strings.Join(opts.tenantSources, ","), filepath.Join(dbDir, "tenants"))
+	}
+	if opts.archiveDir != "" {
+		tenants.SetArchiver(retentionArchiver(opts.archiveDir))
+		logger.Info("Expired telemetry is archived to Parquet files under %s", opts.archiveDir)
+	}
+	stopRetention := startRetention(tenants, opts.retentionInterval)
+	defer stopRetention()
+	stopDiskGuard := startDiskGuard(dbPath, tenants, opts.minFreeDiskMB, opts.diskCheckInterval)
+	defer stopDiskGuard()
+
+	exporterList, err := exporterOptions(opts, cfg)
+	if err != nil {
+		logger.Error("Invalid exporter configuration: %v", err)
+		return fmt.Errorf("invalid exporter configuration: %w", err)
+	}
+	stopExporters, err := startExporters(exporterList, tenants)
+	if err != nil {
+		logger.Error("Failed to start exporters: %v", err)
+		return fmt.Errorf("failed to start exporters: %w", err)
+	}
+	defer stopExporters()
+
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimits != nil {
+		var err error
+		limiter, err = ratelimit.New(*cfg.RateLimits)
+		if err != nil {
+			logger.Error("Failed to configure rate limits: %v", err)
+			return fmt.Errorf("failed to configure rate limits: %w", err)
+		}
+		handlers.SetRateLimiter(limiter)
+		logger.Info("Rate limiting enabled (keyed by %s)", limiter.KeyBy())
+	}
+
+	// Load TLS material before binding so misconfiguration fails fast
+	var tlsReloader *tlsconfig.Reloader
+	if opts.tls.Enabled() || opts.tls.ClientCAFile != "" {
+		var err error
+		tlsReloader, err = tlsconfig.New(opts.tls)
+		if err != nil {
+			logger.Error("Failed to configure TLS: %v", err)
+			return fmt.Errorf("failed to configure TLS: %w", err)
+		}
+	}
+	handlers.SetIdentityAttribute(opts.identityAttribute)
+
+	authStore, err := newAuthStore(opts)
+	if err != nil {
+		logger.Error("Failed to configure authentication: %v", err)
+		return fmt.Errorf("failed to configure authentication: %w", err)
+	}
+
 	// Create a listener on specified port
 	address := fmt.Sprintf(":%d", port)
 	listener, err := net.Listen("tcp", address)
@@ -110,15 +469,119 @@ func run(port int, dbPath string) error {
 		return fmt.Errorf("listener address is not TCP")
 	}
 	actualPort := tcpAddr.Port
-	logger.Info("OTLP/HTTP receiver listening on port %d", actualPort)
+	if tlsReloader != nil {
+		listener = tls.NewListener(listener, tlsReloader.TLSConfig())
+		clientAuth := "disabled"
+		if opts.tls.ClientCAFile != "" {
+			clientAuth = "optional"
+			if opts.tls.RequireClientCert {
+				clientAuth = "required"
+			}
+		}
+		logger.Info("OTLP/HTTPS receiver listening on port %d (TLS >= %s, client certificates: %s)",
+			actualPort, opts.tls.MinVersion, clientAuth)
+	} else {
+		logger.Info("OTLP/HTTP receiver listening on port %d", actualPort)
+	}
 	
 	// Create HTTP mux and register OTLP endpoints
 	mux := http.NewServeMux()
 	
-	// Register OTLP endpoints
-	mux.HandleFunc("/v1/traces", handlers.HandleTraces)
-	mux.HandleFunc("/v1/metrics", handlers.HandleMetrics)
-	mux.HandleFunc("/v1/logs", handlers.HandleLogs)
+	// Register OTLP endpoints, behind authentication when configured
+	protect := func(permission string, handler http.HandlerFunc) http.Handler {
+		if authStore == nil {
+			return handler
+		}
+		return authStore.Require(permission, handler)
+	}
+	// CORS wraps authentication so preflight requests need no credentials
+	otlp := func(permission string, handler http.HandlerFunc) http.Handler {
+		if len(opts.cors.AllowedOrigins) == 0 {
+			return protect(permission, handler)
+		}
+		return handlers.CORS(opts.cors, protect(permission, handler))
+	}
+	mux.Handle("/v1/traces", otlp(auth.PermTraces, handlers.HandleTraces))
+	mux.Handle("/v1/metrics", otlp(auth.PermMetrics, handlers.HandleMetrics))
+	mux.Handle("/v1/logs", otlp(auth.PermLogs, handlers.HandleLogs))
+	if len(opts.cors.AllowedOrigins) > 0 {
+		logger.Info("CORS enabled for origins: %s", strings.Join(opts.cors.AllowedOrigins, ", "))
+	}
+	
+	// Register tenant-scoped query endpoints
+	mux.Handle("/api/v1/spans", protect(auth.PermRead, handlers.HandleQuerySpans))
+	mux.Handle("/api/v1/logs", protect(auth.PermRead, handlers.HandleQueryLogs))
+	mux.Handle("/api/v1/metrics", protect(auth.PermRead, handlers.HandleQueryMetrics))
+	mux.Handle("/api/v1/export", protect(auth.PermRead, handlers.HandleExport))
+	mux.Handle("/api/v1/tail", protect(auth.PermRead, handlers.HandleTail))
+	mux.Handle("/api/v1/traces", protect(auth.PermRead, handlers.HandleQueryTraces))
+	mux.Handle("/api/v1/services", protect(auth.PermRead, handlers.HandleQueryServices))
+	mux.Handle("/api/v1/metric-names", protect(auth.PermRead, handlers.HandleQueryMetricNames))
+
+	// Grafana JSON datasource
+	mux.Handle("/api/v1/grafana/", protect(auth.PermRead, handlers.HandleGrafanaRoot))
+	mux.Handle("/api/v1/grafana/search", protect(auth.PermRead, handlers.HandleGrafanaSearch))
+	mux.Handle("/api/v1/grafana/query", protect(auth.PermRead, handlers.HandleGrafanaQuery))
+	mux.Handle("/api/v1/grafana/annotations", protect(auth.PermRead, handlers.HandleGrafanaAnnotations))
+	mux.Handle("/api/v1/grafana/tag-keys", protect(auth.PermRead, handlers.HandleGrafanaTagKeys))
+	mux.Handle("/api/v1/grafana/tag-values", protect(auth.PermRead, handlers.HandleGrafanaTagValues))
+
+	// Arbitrary SQL is never served without authentication
+	if authStore != nil {
+		opts.sql.DBPath = dbPath
+		handlers.SetSQLOptions(opts.sql)
+		mux.Handle("/api/v1/sql", protect(auth.PermAdmin, handlers.HandleSQL))
+	} else {
+		logger.Info("SQL endpoint disabled: it requires -auth-keys-file with an admin key")
+	}
+
+	// The web UI holds no data itself; it reads through the endpoints above
+	if opts.ui {
+		mux.Handle("/ui/", http.StripPrefix("/ui", ui.Handler()))
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			http.Redirect(w, r, "/ui/", http.StatusFound)
+		})
+		logger.Info("Web UI available at /ui/")
+	}
+	
+	handlers.SetHealthOptions(handlers.HealthOptions{
+		DBPath:       dbPath,
+		MinFreeBytes: uint64(opts.readyMinFreeMB) * 1024 * 1024,
+		MaxInFlight:  opts.readyMaxInFlight,
+		Version:      Version,
+		BuildTime:    BuildTime,
+		GitCommit:    GitCommit,
+	})
+	// Expose the collector's own metrics, on the admin listener when configured
+	registerServerStats(dbPath, authStore)
+	var adminServer *http.Server
+	if opts.adminAddr != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/metrics", stats.Handler())
+		adminMux.HandleFunc("/livez", handlers.HandleLivez)
+		adminMux.HandleFunc("/readyz", handlers.HandleReadyz)
+		adminMux.HandleFunc("/status", handlers.HandleStatus)
+		adminServer, err = startAdminServer(opts.adminAddr, adminMux)
+		if err != nil {
+			logger.Error("Failed to start admin listener on %s: %v", opts.adminAddr, err)
+			listener.Close()
+			return fmt.Errorf("failed to start admin listener: %w", err)
+		}
+	} else {
+		mux.Handle("/metrics", protect(auth.PermRead, stats.Handler().ServeHTTP))
+	}
+	
+	// Register probe and status endpoints. /status reveals paths and
+	// counts, so it needs read access unless served on the admin listener
+	mux.HandleFunc("/livez", handlers.HandleLivez)
+	mux.HandleFunc("/readyz", handlers.HandleReadyz)
+	if adminServer == nil {
+		mux.Handle("/status", protect(auth.PermRead, handlers.HandleStatus))
+	}
 	
 	// Register health endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -146,7 +609,8 @@ func run(port int, dbPath string) error {
 	
 	// Channel to listen for interrupt signals and server errors
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	reloads := &reloader{opts: opts, tenants: tenants, authStore: authStore, tls: tlsReloader}
 	
 	errChan := make(chan error, 1)
 	
@@ -159,29 +623,93 @@ func run(port int, dbPath string) error {
 		close(errChan)
 	}()
 	
-	// Wait for interrupt signal or server error
-	select {
-	case err := <-errChan:
-		return fmt.Errorf("server failed: %w", err)
-	case <-sigChan:
-		logger.Info("Received shutdown signal")
-		logger.LogShutdown()
+	// Wait for interrupt signal or server error, reloading on SIGHUP
+	for shutdown := false; !shutdown; {
+		select {
+		case err := <-errChan:
+			return fmt.Errorf("server failed: %w", err)
+		case sig := <-sigChan:
+			if sig == syscall.SIGHUP {
+				logger.Info("Received SIGHUP, reopening log file and reloading configuration")
+				reloads.reload()
+				continue
+			}
+			logger.Info("Received shutdown signal")
+			logger.LogShutdown()
+			shutdown = true
+		}
+	}
+	
+	// Drain: fail readiness and refuse new requests while in-flight
+	// inserts complete, then close the databases via the deferred calls
+	handlers.SetDraining(true)
+	handlers.CloseTails()
+	logger.Info("Draining, waiting up to %s for in-flight requests", opts.shutdownTimeout)
+	if opts.shutdownDelay > 0 {
+		// Give load balancers time to notice /readyz failing
+		time.Sleep(opts.shutdownDelay)
 	}
 	
-	// Create a deadline for shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), opts.shutdownTimeout)
 	defer cancel()
 	
-	// Shutdown the server gracefully
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Error("Server shutdown error: %v", err)
-		return fmt.Errorf("server shutdown error: %w", err)
+	// Shutdown the server gracefully; the admin listener goes last so
+	// /readyz keeps reporting the drain
+	shutdownErr := server.Shutdown(ctx)
+	if shutdownErr != nil {
+		logger.Error("Requests still running after %s, closing connections: %v", opts.shutdownTimeout, shutdownErr)
+		server.Close()
+	}
+	if adminServer != nil {
+		adminServer.Shutdown(ctx)
+	}
+	if shutdownErr != nil {
+		return fmt.Errorf("%w: server shutdown: %v", errUncleanShutdown, shutdownErr)
 	}
 	
 	logger.Info("Server stopped successfully")
 	return nil
 }
 
+// newAuthStore builds the credential store from the options, or returns nil
+// when authentication is not configured
+func newAuthStore(opts *serverOptions) (*auth.Store, error) {
+	if opts.authKeysFile == "" && opts.authToken == "" {
+		return nil, nil
+	}
+
+	var store *auth.Store
+	var err error
+	if opts.authKeysFile != "" {
+		store, err = auth.LoadFile(opts.authKeysFile)
+	} else {
+		store, err = auth.NewStore(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.authToken != "" {
+		if err := store.AddToken("static-token", opts.authToken, auth.PermAll); err != nil {
+			return nil, err
+		}
+	}
+
+	logging.Info("Authentication enabled for ingestion endpoints")
+	return store, nil
+}
+
+// splitList splits a comma separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // getDefaultDBPath returns the default database path following XDG Base Directory specification
 func getDefaultDBPath() string {
 	// Detect if running in service mode (no home directory or systemd)
@@ -0,0 +1,110 @@
+package parquet
+
+import "encoding/binary"
+
+// The file metadata and page headers of a Parquet file are Thrift structs
+// in the compact protocol. Only the parts needed to write them are here:
+// a struct is a list of fields in ascending ID order whose values are
+// bool, int16, int32, int64, string, []byte, list or another struct.
+
+// Compact protocol type IDs
+const (
+	compactTrue   = 1
+	compactFalse  = 2
+	compactI16    = 4
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// field is one field of a Thrift struct
+type field struct {
+	id    int16
+	value interface{}
+}
+
+// tstruct is a Thrift struct
+type tstruct []field
+
+// tlist is a Thrift list whose elements all have the given type
+type tlist struct {
+	elem   byte
+	values []interface{}
+}
+
+// encodeStruct appends the compact encoding of s to buf
+func encodeStruct(buf []byte, s tstruct) []byte {
+	var last int16
+	for _, f := range s {
+		typ := compactType(f.value)
+		if b, ok := f.value.(bool); ok && !b {
+			typ = compactFalse
+		}
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			buf = append(buf, byte(delta)<<4|typ)
+		} else {
+			buf = append(buf, typ)
+			buf = binary.AppendVarint(buf, int64(f.id))
+		}
+		last = f.id
+		if typ != compactTrue && typ != compactFalse {
+			buf = encodeValue(buf, f.value)
+		}
+	}
+	return append(buf, 0)
+}
+
+// encodeValue appends a value without its field header
+func encodeValue(buf []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case int16:
+		return binary.AppendVarint(buf, int64(v))
+	case int32:
+		return binary.AppendVarint(buf, int64(v))
+	case int64:
+		return binary.AppendVarint(buf, v)
+	case string:
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		return append(buf, v...)
+	case []byte:
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		return append(buf, v...)
+	case tlist:
+		if n := len(v.values); n < 15 {
+			buf = append(buf, byte(n)<<4|v.elem)
+		} else {
+			buf = append(buf, 0xf0|v.elem)
+			buf = binary.AppendUvarint(buf, uint64(n))
+		}
+		for _, e := range v.values {
+			buf = encodeValue(buf, e)
+		}
+		return buf
+	case tstruct:
+		return encodeStruct(buf, v)
+	}
+	panic("parquet: unsupported thrift value")
+}
+
+// compactType returns the compact protocol type of a value
+func compactType(v interface{}) byte {
+	switch v.(type) {
+	case bool:
+		return compactTrue
+	case int16:
+		return compactI16
+	case int32:
+		return compactI32
+	case int64:
+		return compactI64
+	case string, []byte:
+		return compactBinary
+	case tlist:
+		return compactList
+	case tstruct:
+		return compactStruct
+	}
+	panic("parquet: unsupported thrift value")
+}
@@ -0,0 +1,421 @@
+// Package parquet writes flat Apache Parquet files without external
+// dependencies. Every column is optional and PLAIN encoded in a single
+// data page per row group, which DuckDB, pandas, Spark and the other
+// common readers all accept.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Type is the type of a column
+type Type int
+
+// Column types
+const (
+	Int64     Type = iota // INT64
+	Double                // DOUBLE
+	String                // BYTE_ARRAY annotated as UTF-8
+	Timestamp             // INT64 nanoseconds since the Unix epoch, UTC
+)
+
+// Compression codecs
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
+// DefaultRowGroupSize is the number of rows per row group when none is
+// given
+const DefaultRowGroupSize = 100000
+
+// maxRowGroupBytes starts a new row group once the buffered values reach
+// this size, keeping pages well below the 2 GB format limit
+const maxRowGroupBytes = 64 * 1024 * 1024
+
+// createdBy is recorded in the file metadata
+const createdBy = "sqlite-otel-collector"
+
+// magic starts and ends every Parquet file
+var magic = []byte("PAR1")
+
+// Parquet physical types, encodings, codecs and page types
+const (
+	physicalInt64     = 2
+	physicalDouble    = 5
+	physicalByteArray = 6
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecUncompressed = 0
+	codecGzip         = 2
+
+	pageData = 0
+
+	repetitionOptional = 1
+	convertedUTF8      = 0
+)
+
+// Column describes a column of a file
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Options configures a Writer
+type Options struct {
+	Compression  string // CompressionNone or CompressionGzip (default: gzip)
+	RowGroupSize int    // Rows per row group (default: DefaultRowGroupSize)
+}
+
+// Writer writes rows to a Parquet file. Rows are buffered in memory per
+// row group; Close must be called to write the file footer.
+type Writer struct {
+	out       *countingWriter
+	columns   []Column
+	codec     int32
+	groupSize int
+
+	buffers   []*columnBuffer
+	rows      int   // Rows in the current row group
+	numRows   int64 // Rows in finished row groups
+	rowGroups []interface{}
+	err       error
+}
+
+// columnBuffer holds the values of one column in the current row group
+type columnBuffer struct {
+	values   bytes.Buffer // PLAIN encoded non-null values
+	defined  []bool       // Definition level of each row
+	nulls    int64
+	min, max interface{} // For Int64, Timestamp and Double columns
+}
+
+// countingWriter tracks the offset in the file
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewWriter starts a Parquet file with the given columns on w
+func NewWriter(w io.Writer, columns []Column, opts Options) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns")
+	}
+	pw := &Writer{out: &countingWriter{w: w}, columns: columns, groupSize: opts.RowGroupSize}
+	switch opts.Compression {
+	case "", CompressionGzip:
+		pw.codec = codecGzip
+	case CompressionNone:
+		pw.codec = codecUncompressed
+	default:
+		return nil, fmt.Errorf("unknown compression '%s' (expected gzip or none)", opts.Compression)
+	}
+	if pw.groupSize <= 0 {
+		pw.groupSize = DefaultRowGroupSize
+	}
+	for range columns {
+		pw.buffers = append(pw.buffers, &columnBuffer{})
+	}
+	if _, err := pw.out.Write(magic); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// Write adds a row with one value per column: nil for null, int64 for
+// Int64 and Timestamp columns, float64 for Double and string for String
+func (w *Writer) Write(row []interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("row has %d values, expected %d", len(row), len(w.columns))
+	}
+	for i, v := range row {
+		if err := checkValue(w.columns[i], v); err != nil {
+			return err
+		}
+	}
+	var size int
+	for i, v := range row {
+		b := w.buffers[i]
+		b.add(v)
+		size += b.values.Len()
+	}
+	w.rows++
+	if w.rows >= w.groupSize || size >= maxRowGroupBytes {
+		w.err = w.flush()
+	}
+	return w.err
+}
+
+// checkValue reports a value that does not match its column type
+func checkValue(c Column, v interface{}) error {
+	var ok bool
+	switch v.(type) {
+	case nil:
+		ok = true
+	case int64:
+		ok = c.Type == Int64 || c.Type == Timestamp
+	case float64:
+		ok = c.Type == Double
+	case string:
+		ok = c.Type == String
+	}
+	if !ok {
+		return fmt.Errorf("column %s: unexpected value of type %T", c.Name, v)
+	}
+	return nil
+}
+
+// add appends a value, nil for null
+func (b *columnBuffer) add(v interface{}) {
+	if v == nil {
+		b.defined = append(b.defined, false)
+		b.nulls++
+		return
+	}
+	b.defined = append(b.defined, true)
+	var scratch [8]byte
+	switch v := v.(type) {
+	case int64:
+		binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+		b.values.Write(scratch[:])
+		if b.min == nil || v < b.min.(int64) {
+			b.min = v
+		}
+		if b.max == nil || v > b.max.(int64) {
+			b.max = v
+		}
+	case float64:
+		binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+		b.values.Write(scratch[:])
+		if math.IsNaN(v) {
+			return
+		}
+		if b.min == nil || v < b.min.(float64) {
+			b.min = v
+		}
+		if b.max == nil || v > b.max.(float64) {
+			b.max = v
+		}
+	case string:
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(len(v)))
+		b.values.Write(scratch[:4])
+		b.values.WriteString(v)
+	}
+}
+
+// reset empties the buffer for the next row group
+func (b *columnBuffer) reset() {
+	b.values.Reset()
+	b.defined = b.defined[:0]
+	b.nulls = 0
+	b.min, b.max = nil, nil
+}
+
+// flush writes the buffered rows as a row group
+func (w *Writer) flush() error {
+	if w.rows == 0 {
+		return nil
+	}
+	start := w.out.n
+	var chunks []interface{}
+	var totalSize int64
+	for i, c := range w.columns {
+		chunk, size, err := w.writeChunk(c, w.buffers[i])
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, chunk)
+		totalSize += size
+		w.buffers[i].reset()
+	}
+	w.rowGroups = append(w.rowGroups, tstruct{
+		{1, tlist{compactStruct, chunks}},
+		{2, totalSize},
+		{3, int64(w.rows)},
+		{5, start},
+		{6, w.out.n - start},
+	})
+	w.numRows += int64(w.rows)
+	w.rows = 0
+	return nil
+}
+
+// writeChunk writes a column of the current row group as one data page
+// and returns its column chunk metadata and uncompressed size
+func (w *Writer) writeChunk(c Column, b *columnBuffer) (tstruct, int64, error) {
+	page := encodeLevels(b.defined)
+	page = append(page, b.values.Bytes()...)
+	body := page
+	if w.codec == codecGzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(page)
+		if err := gz.Close(); err != nil {
+			return nil, 0, err
+		}
+		body = buf.Bytes()
+	}
+
+	header := encodeStruct(nil, tstruct{
+		{1, int32(pageData)},
+		{2, int32(len(page))},
+		{3, int32(len(body))},
+		{5, tstruct{
+			{1, int32(len(b.defined))},
+			{2, int32(encodingPlain)},
+			{3, int32(encodingRLE)},
+			{4, int32(encodingRLE)},
+		}},
+	})
+	offset := w.out.n
+	if _, err := w.out.Write(header); err != nil {
+		return nil, 0, err
+	}
+	if _, err := w.out.Write(body); err != nil {
+		return nil, 0, err
+	}
+
+	uncompressed := int64(len(header) + len(page))
+	meta := tstruct{
+		{1, physicalType(c.Type)},
+		{2, tlist{compactI32, []interface{}{int32(encodingPlain), int32(encodingRLE)}}},
+		{3, tlist{compactBinary, []interface{}{c.Name}}},
+		{4, w.codec},
+		{5, int64(len(b.defined))},
+		{6, uncompressed},
+		{7, int64(len(header) + len(body))},
+		{9, offset},
+		{12, statistics(b)},
+	}
+	return tstruct{{2, offset}, {3, meta}}, uncompressed, nil
+}
+
+// encodeLevels encodes definition levels with a bit width of one in the
+// RLE/bit-packing hybrid, as runs, prefixed by their length
+func encodeLevels(defined []bool) []byte {
+	buf := make([]byte, 4, 16)
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		buf = binary.AppendUvarint(buf, uint64(j-i)<<1)
+		if defined[i] {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		i = j
+	}
+	binary.LittleEndian.PutUint32(buf, uint32(len(buf)-4))
+	return buf
+}
+
+// statistics returns the null count and, for numeric columns, the
+// minimum and maximum values of a column chunk
+func statistics(b *columnBuffer) tstruct {
+	stats := tstruct{{3, b.nulls}}
+	if b.min == nil {
+		return stats
+	}
+	encode := func(v interface{}) []byte {
+		buf := make([]byte, 8)
+		switch v := v.(type) {
+		case int64:
+			binary.LittleEndian.PutUint64(buf, uint64(v))
+		case float64:
+			binary.LittleEndian.PutUint64(buf, math.Float64bits(v))
+		}
+		return buf
+	}
+	return append(stats, field{5, encode(b.max)}, field{6, encode(b.min)})
+}
+
+// physicalType returns the Parquet type storing a column type
+func physicalType(t Type) int32 {
+	switch t {
+	case Double:
+		return physicalDouble
+	case String:
+		return physicalByteArray
+	}
+	return physicalInt64
+}
+
+// schema returns the schema elements of the file: a root followed by one
+// optional column each
+func (w *Writer) schema() tlist {
+	elements := []interface{}{tstruct{{4, "schema"}, {5, int32(len(w.columns))}}}
+	for _, c := range w.columns {
+		e := tstruct{
+			{1, physicalType(c.Type)},
+			{3, int32(repetitionOptional)},
+			{4, c.Name},
+		}
+		switch c.Type {
+		case String:
+			e = append(e, field{6, int32(convertedUTF8)}, field{10, tstruct{{1, tstruct{}}}})
+		case Timestamp:
+			unit := tstruct{{3, tstruct{}}} // NANOS
+			e = append(e, field{10, tstruct{{8, tstruct{{1, true}, {2, unit}}}}})
+		}
+		elements = append(elements, e)
+	}
+	return tlist{compactStruct, elements}
+}
+
+// columnOrders declares that min and max statistics follow the natural
+// order of each column's type
+func (w *Writer) columnOrders() tlist {
+	orders := make([]interface{}, len(w.columns))
+	for i := range orders {
+		orders[i] = tstruct{{1, tstruct{}}}
+	}
+	return tlist{compactStruct, orders}
+}
+
+// Rows returns the number of rows written so far
+func (w *Writer) Rows() int64 {
+	return w.numRows + int64(w.rows)
+}
+
+// Close writes the remaining rows and the file footer. It does not close
+// the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.flush(); err != nil {
+		w.err = err
+		return err
+	}
+	footer := encodeStruct(nil, tstruct{
+		{1, int32(1)},
+		{2, w.schema()},
+		{3, w.numRows},
+		{4, tlist{compactStruct, w.rowGroups}},
+		{6, createdBy},
+		{7, w.columnOrders()},
+	})
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, magic...)
+	_, err := w.out.Write(footer)
+	w.err = fmt.Errorf("writer is closed")
+	return err
+}
@@ -0,0 +1,238 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// thriftReader decodes compact protocol structs into maps by field ID
+type thriftReader struct {
+	t   *testing.T
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		r.t.Fatalf("invalid varint at %d", r.pos)
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	v, n := binary.Varint(r.buf[r.pos:])
+	if n <= 0 {
+		r.t.Fatalf("invalid varint at %d", r.pos)
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	s := make(map[int16]interface{})
+	var last int16
+	for {
+		b := r.buf[r.pos]
+		r.pos++
+		if b == 0 {
+			return s
+		}
+		typ := b & 0x0f
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			id = int16(r.varint())
+		}
+		last = id
+		switch typ {
+		case compactTrue:
+			s[id] = true
+		case compactFalse:
+			s[id] = false
+		default:
+			s[id] = r.readValue(typ)
+		}
+	}
+}
+
+func (r *thriftReader) readValue(typ byte) interface{} {
+	switch typ {
+	case compactI16, compactI32, compactI64:
+		return r.varint()
+	case compactBinary:
+		n := int(r.uvarint())
+		v := r.buf[r.pos : r.pos+n]
+		r.pos += n
+		return v
+	case compactList:
+		b := r.buf[r.pos]
+		r.pos++
+		n := int(b >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			values[i] = r.readValue(b & 0x0f)
+		}
+		return values
+	case compactStruct:
+		return r.readStruct()
+	}
+	r.t.Fatalf("unexpected thrift type %d", typ)
+	return nil
+}
+
+// readFile decodes a file written by Writer into its rows and footer
+func readFile(t *testing.T, data []byte) ([][]interface{}, map[int16]interface{}) {
+	t.Helper()
+	if !bytes.Equal(data[:4], magic) || !bytes.Equal(data[len(data)-4:], magic) {
+		t.Fatal("Missing PAR1 magic")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - size
+	r := &thriftReader{t: t, buf: data, pos: footerStart}
+	meta := r.readStruct()
+	if r.pos != len(data)-8 {
+		t.Fatalf("Footer length %d does not match its encoding", size)
+	}
+
+	schema := meta[2].([]interface{})
+	types := make([]int64, len(schema)-1)
+	for i, e := range schema[1:] {
+		types[i] = e.(map[int16]interface{})[1].(int64)
+	}
+	var rows [][]interface{}
+	for _, g := range meta[4].([]interface{}) {
+		group := g.(map[int16]interface{})
+		numRows := int(group[3].(int64))
+		groupRows := make([][]interface{}, numRows)
+		for i := range groupRows {
+			groupRows[i] = make([]interface{}, len(types))
+		}
+		for col, c := range group[1].([]interface{}) {
+			cm := c.(map[int16]interface{})[3].(map[int16]interface{})
+			r := &thriftReader{t: t, buf: data, pos: int(cm[9].(int64))}
+			header := r.readStruct()
+			body := data[r.pos : r.pos+int(header[3].(int64))]
+			if cm[4].(int64) == codecGzip {
+				gz, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body, err = io.ReadAll(gz); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(body) != int(header[2].(int64)) {
+				t.Fatalf("Column %d: page is %d bytes, header says %d", col, len(body), header[2])
+			}
+
+			// Definition levels as RLE runs, then PLAIN values
+			levels := &thriftReader{t: t, buf: body, pos: 4}
+			var defined []bool
+			for levels.pos < 4+int(binary.LittleEndian.Uint32(body)) {
+				run := levels.uvarint()
+				if run&1 != 0 {
+					t.Fatal("Unexpected bit-packed run")
+				}
+				value := body[levels.pos] == 1
+				levels.pos++
+				for i := uint64(0); i < run>>1; i++ {
+					defined = append(defined, value)
+				}
+			}
+			values := body[levels.pos:]
+			for i, d := range defined {
+				if !d {
+					continue
+				}
+				switch types[col] {
+				case physicalInt64:
+					groupRows[i][col] = int64(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case physicalDouble:
+					groupRows[i][col] = math.Float64frombits(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case physicalByteArray:
+					n := binary.LittleEndian.Uint32(values)
+					groupRows[i][col] = string(values[4 : 4+n])
+					values = values[4+n:]
+				}
+			}
+		}
+		rows = append(rows, groupRows...)
+	}
+	return rows, meta
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	columns := []Column{
+		{Name: "time", Type: Timestamp},
+		{Name: "count", Type: Int64},
+		{Name: "value", Type: Double},
+		{Name: "name", Type: String},
+	}
+	rows := [][]interface{}{
+		{int64(1700000000000000000), int64(-3), 1.5, "a"},
+		{nil, int64(7), nil, ""},
+		{int64(1700000000000000001), nil, 2.25, nil},
+	}
+	// 17 more rows spread the data over three row groups of 8
+	for i := int64(0); i < 17; i++ {
+		rows = append(rows, []interface{}{i, i, float64(i), "row"})
+	}
+
+	for _, compression := range []string{CompressionNone, CompressionGzip} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, columns, Options{Compression: compression, RowGroupSize: 8})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			if err := w.Write(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		got, meta := readFile(t, buf.Bytes())
+		if !reflect.DeepEqual(got, rows) {
+			t.Fatalf("%s: rows differ after reading back:\n got %v\nwant %v", compression, got, rows)
+		}
+		if meta[3].(int64) != int64(len(rows)) || len(meta[4].([]interface{})) != 3 {
+			t.Errorf("%s: expected %d rows in 3 row groups, got %v", compression, len(rows), meta[3])
+		}
+
+		// The timestamp column is annotated as UTC nanoseconds
+		ts := meta[2].([]interface{})[1].(map[int16]interface{})
+		unit := ts[10].(map[int16]interface{})[8].(map[int16]interface{})
+		if unit[1] != true || unit[2].(map[int16]interface{})[3] == nil {
+			t.Errorf("%s: unexpected timestamp logical type %v", compression, unit)
+		}
+	}
+}
+
+func TestWriterRejectsInvalidRows(t *testing.T) {
+	w, err := NewWriter(io.Discard, []Column{{Name: "n", Type: Int64}}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write([]interface{}{"x"}); err == nil {
+		t.Error("Expected a string in an Int64 column to be rejected")
+	}
+	if err := w.Write([]interface{}{int64(1), int64(2)}); err == nil {
+		t.Error("Expected a row with too many values to be rejected")
+	}
+	if _, err := NewWriter(io.Discard, []Column{{Name: "n"}}, Options{Compression: "snappy"}); err == nil {
+		t.Error("Expected an unsupported codec to be rejected")
+	}
+}
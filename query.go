@@ -0,0 +1,504 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/config"
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+// Output formats of the query subcommand
+const (
+	formatTable  = "table"
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+// maxTableCell is the width at which table cells are cut off
+const maxTableCell = 80
+
+// spanKindNames and statusCodeNames name OTLP enum values
+var (
+	spanKindNames   = []string{"UNSPECIFIED", "INTERNAL", "SERVER", "CLIENT", "PRODUCER", "CONSUMER"}
+	statusCodeNames = []string{"UNSET", "OK", "ERROR"}
+)
+
+// queryOptions holds the parsed arguments of the query subcommand
+type queryOptions struct {
+	kind   string // spans, logs, metrics or sql
+	format string
+	spans  database.SpanQuery
+	logs   database.LogQuery
+	points database.MetricQuery
+	sql    string
+	limit  int // Rows of an sql query, 0 for all
+}
+
+// queryResult is a table of decoded values: time.Time, string, int64,
+// float64, bool, nil, or decoded JSON
+type queryResult struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+// runQuery implements the query subcommand
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s query spans|logs|metrics [options]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s query sql [options] STATEMENT\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Print stored telemetry as a table, CSV or NDJSON. The database is opened")
+		fmt.Fprintln(fs.Output(), "read-only, so queries are safe while the collector is running.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	dbPath := fs.String("db", getDefaultDBPath(), "Path to the SQLite database to read")
+	format := fs.String("format", formatTable, "Output format: table, csv or ndjson")
+	since := fs.String("since", "", "Only records at or after this time: RFC 3339 or a duration ago such as 2h or 7d")
+	until := fs.String("until", "", "Only records at or before this time: RFC 3339 or a duration ago")
+	service := fs.String("service", "", "Only records whose service.name resource attribute matches")
+	limit := fs.Int("limit", database.DefaultQueryLimit, fmt.Sprintf("Maximum number of rows, up to %d (sql: 0 for all)", database.MaxQueryLimit))
+	traceID := fs.String("trace-id", "", "spans, logs: only records of this trace")
+	name := fs.String("name", "", "spans: span name; metrics: metric name")
+	minDuration := fs.String("min-duration", "", "spans: only spans lasting at least this long, e.g. 500ms")
+	severity := fs.String("severity", "", "logs: minimum severity: trace, debug, info, warn, error, fatal or a number")
+	search := fs.String("search", "", "logs: only records whose body contains this text")
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			fs.Usage()
+			return 0
+		}
+		return usageError(fs, "arguments", fmt.Errorf("expected spans, logs, metrics or sql"))
+	}
+	opts := queryOptions{kind: args[0]}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+
+	switch *format {
+	case formatTable, formatCSV, formatNDJSON:
+		opts.format = *format
+	default:
+		return usageError(fs, "-format", fmt.Errorf("expected table, csv or ndjson"))
+	}
+	now := time.Now()
+	sinceNano, err := parseTimeArg(*since, now)
+	if err != nil {
+		return usageError(fs, "-since", err)
+	}
+	untilNano, err := parseTimeArg(*until, now)
+	if err != nil {
+		return usageError(fs, "-until", err)
+	}
+	if *limit < 0 {
+		return usageError(fs, "-limit", fmt.Errorf("must not be negative"))
+	}
+
+	switch opts.kind {
+	case "spans":
+		var minDur time.Duration
+		if *minDuration != "" {
+			if minDur, err = config.ParseDuration(*minDuration); err != nil || minDur < 0 {
+				return usageError(fs, "-min-duration", fmt.Errorf("invalid duration '%s'", *minDuration))
+			}
+		}
+		opts.spans = database.SpanQuery{TraceID: *traceID, Service: *service, Name: *name,
+			Since: sinceNano, Until: untilNano, MinDuration: int64(minDur), Limit: *limit}
+	case "logs":
+		var minSeverity int64
+		if *severity != "" {
+			if minSeverity, err = database.ParseSeverity(*severity); err != nil {
+				return usageError(fs, "-severity", err)
+			}
+		}
+		opts.logs = database.LogQuery{TraceID: *traceID, Service: *service, MinSeverity: minSeverity,
+			Search: *search, Since: sinceNano, Until: untilNano, Limit: *limit}
+	case "metrics":
+		opts.points = database.MetricQuery{Name: *name, Service: *service,
+			Since: sinceNano, Until: untilNano, Limit: *limit}
+	case "sql":
+		if fs.NArg() != 1 {
+			return usageError(fs, "arguments", fmt.Errorf("expected one SQL statement"))
+		}
+		opts.sql = fs.Arg(0)
+		opts.limit = *limit
+	default:
+		return usageError(fs, "arguments", fmt.Errorf("unknown query '%s' (expected spans, logs, metrics or sql)", opts.kind))
+	}
+	if opts.kind != "sql" && fs.NArg() > 0 {
+		return usageError(fs, "arguments", fmt.Errorf("unexpected argument '%s'", fs.Arg(0)))
+	}
+
+	conn, err := database.OpenReadOnly(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "query: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+	if err := runQueryOn(conn, opts, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "query: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runQueryOn runs a query against conn and writes the result to w
+func runQueryOn(conn *sql.DB, opts queryOptions, w io.Writer) error {
+	var res *queryResult
+	var err error
+	switch opts.kind {
+	case "spans":
+		res, err = spanRows(conn, opts.spans)
+	case "logs":
+		res, err = logRows(conn, opts.logs)
+	case "metrics":
+		res, err = metricRows(conn, opts.points)
+	case "sql":
+		res, err = sqlRows(conn, opts.sql, opts.limit)
+	}
+	if err != nil {
+		return err
+	}
+	switch opts.format {
+	case formatCSV:
+		return writeCSV(w, res)
+	case formatNDJSON:
+		return writeNDJSON(w, res)
+	}
+	return writeTable(w, res)
+}
+
+// spanRows queries spans
+func spanRows(conn *sql.DB, q database.SpanQuery) (*queryResult, error) {
+	spans, err := database.QuerySpans(conn, q)
+	if err != nil {
+		return nil, err
+	}
+	res := &queryResult{columns: []string{"time", "duration_ms", "service", "name", "kind", "status",
+		"trace_id", "span_id", "parent_span_id", "attributes"}}
+	for _, s := range spans {
+		status := enumName(statusCodeNames, s.StatusCode)
+		if s.StatusMessage != "" {
+			status += ": " + s.StatusMessage
+		}
+		var duration interface{}
+		if s.EndTimeUnixNano >= s.StartTimeUnixNano && s.StartTimeUnixNano > 0 {
+			duration = math.Round(float64(s.EndTimeUnixNano-s.StartTimeUnixNano)/1e3) / 1e3
+		}
+		res.rows = append(res.rows, []interface{}{nanoTime(s.StartTimeUnixNano), duration, s.ServiceName,
+			s.Name, enumName(spanKindNames, s.Kind), status, s.TraceID, s.SpanID, emptyNil(s.ParentSpanID),
+			decodeAttributes(s.Attributes)})
+	}
+	return res, nil
+}
+
+// logRows queries log records
+func logRows(conn *sql.DB, q database.LogQuery) (*queryResult, error) {
+	records, err := database.QueryLogs(conn, q)
+	if err != nil {
+		return nil, err
+	}
+	res := &queryResult{columns: []string{"time", "service", "severity", "body", "trace_id", "span_id", "attributes"}}
+	for _, l := range records {
+		t := l.TimeUnixNano
+		if t == 0 {
+			t = l.ObservedTimeUnixNano
+		}
+		severity := l.SeverityText
+		if severity == "" {
+			severity = database.SeverityName(l.SeverityNumber)
+		}
+		var body interface{}
+		var anyValue map[string]interface{}
+		if json.Unmarshal(l.Body, &anyValue) == nil && anyValue != nil {
+			body = decodeAnyValue(anyValue)
+		}
+		res.rows = append(res.rows, []interface{}{nanoTime(t), l.ServiceName, emptyNil(severity), body,
+			emptyNil(l.TraceID), emptyNil(l.SpanID), decodeAttributes(l.Attributes)})
+	}
+	return res, nil
+}
+
+// metricRows queries metric data points
+func metricRows(conn *sql.DB, q database.MetricQuery) (*queryResult, error) {
+	points, err := database.QueryMetricPoints(conn, q)
+	if err != nil {
+		return nil, err
+	}
+	res := &queryResult{columns: []string{"time", "service", "name", "type", "value", "unit", "attributes"}}
+	for _, p := range points {
+		var value interface{}
+		if p.Value != nil {
+			value = *p.Value
+		}
+		res.rows = append(res.rows, []interface{}{nanoTime(p.TimeUnixNano), p.ServiceName, p.Name,
+			p.MetricType, value, emptyNil(p.Unit), decodeAttributes(p.Attributes)})
+	}
+	return res, nil
+}
+
+// sqlRows runs an ad-hoc statement. Columns ending in unix_nano are shown
+// as times and OTLP attribute arrays are decoded.
+func sqlRows(conn *sql.DB, stmt string, limit int) (*queryResult, error) {
+	rows, err := conn.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	res := &queryResult{columns: columns}
+	raw := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	for rows.Next() && (limit == 0 || len(res.rows) < limit) {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make([]interface{}, len(columns))
+		for i, v := range raw {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			switch v := v.(type) {
+			case int64:
+				if strings.HasSuffix(strings.ToLower(columns[i]), "unix_nano") {
+					row[i] = nanoTime(v)
+					continue
+				}
+			case string:
+				if strings.HasPrefix(v, `[{"key"`) {
+					if attrs, ok := decodeAttributes(json.RawMessage(v)).(map[string]interface{}); ok {
+						row[i] = attrs
+						continue
+					}
+				}
+			}
+			row[i] = v
+		}
+		res.rows = append(res.rows, row)
+	}
+	return res, rows.Err()
+}
+
+// enumName names an OTLP enum value, or returns the number when unknown
+func enumName(names []string, v int64) string {
+	if v >= 0 && v < int64(len(names)) {
+		return names[v]
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// nanoTime converts Unix nanoseconds to a time, or nil for 0
+func nanoTime(n int64) interface{} {
+	if n == 0 {
+		return nil
+	}
+	return time.Unix(0, n)
+}
+
+// emptyNil returns nil for an empty string
+func emptyNil(s interface{}) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// decodeAttributes turns OTLP JSON key-value attributes into a map of
+// plain values, or nil when there are none
+func decodeAttributes(raw json.RawMessage) interface{} {
+	var kvs []struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &kvs); err != nil || len(kvs) == 0 {
+		return nil
+	}
+	attrs := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		attrs[kv.Key] = decodeAnyValue(kv.Value)
+	}
+	return attrs
+}
+
+// decodeAnyValue turns an OTLP JSON AnyValue into a plain value
+func decodeAnyValue(v map[string]interface{}) interface{} {
+	if s, ok := v["stringValue"].(string); ok {
+		return s
+	}
+	if b, ok := v["boolValue"].(bool); ok {
+		return b
+	}
+	switch n := v["intValue"].(type) {
+	case string:
+		if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+			return i
+		}
+	case float64:
+		return int64(n)
+	}
+	if f, ok := v["doubleValue"].(float64); ok {
+		return f
+	}
+	if b, ok := v["bytesValue"].(string); ok {
+		return b
+	}
+	if arr, ok := v["arrayValue"].(map[string]interface{}); ok {
+		values, _ := arr["values"].([]interface{})
+		out := make([]interface{}, 0, len(values))
+		for _, e := range values {
+			m, _ := e.(map[string]interface{})
+			out = append(out, decodeAnyValue(m))
+		}
+		return out
+	}
+	if kv, ok := v["kvlistValue"].(map[string]interface{}); ok {
+		values, _ := kv["values"].([]interface{})
+		out := make(map[string]interface{}, len(values))
+		for _, e := range values {
+			m, _ := e.(map[string]interface{})
+			key, _ := m["key"].(string)
+			value, _ := m["value"].(map[string]interface{})
+			out[key] = decodeAnyValue(value)
+		}
+		return out
+	}
+	return nil
+}
+
+// formatCell renders a value as text. Tables use local time and key=value
+// pairs; CSV uses RFC 3339 UTC times and JSON for structured values.
+func formatCell(v interface{}, table bool) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		if table {
+			return v.Local().Format("2006-01-02 15:04:05.000")
+		}
+		return v.UTC().Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}:
+		if !table {
+			data, _ := json.Marshal(v)
+			return string(data)
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = k + "=" + formatCell(v[k], false)
+		}
+		return strings.Join(pairs, " ")
+	case []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
+
+// writeTable writes aligned columns, cutting off long cells
+func writeTable(w io.Writer, res *queryResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := make([]string, len(res.columns))
+	for i, c := range res.columns {
+		header[i] = strings.ToUpper(c)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range res.rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			cell := strings.Join(strings.Fields(formatCell(v, true)), " ")
+			if r := []rune(cell); len(r) > maxTableCell {
+				cell = string(r[:maxTableCell-1]) + "…"
+			}
+			cells[i] = cell
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// writeCSV writes a header row and one record per row
+func writeCSV(w io.Writer, res *queryResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write(res.columns)
+	for _, row := range res.rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			cells[i] = formatCell(v, false)
+		}
+		cw.Write(cells)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeNDJSON writes one JSON object per row with keys in column order.
+// Null values are left out.
+func writeNDJSON(w io.Writer, res *queryResult) error {
+	for _, row := range res.rows {
+		var b strings.Builder
+		b.WriteByte('{')
+		first := true
+		for i, v := range row {
+			if v == nil {
+				continue
+			}
+			switch t := v.(type) {
+			case time.Time:
+				v = t.UTC().Format(time.RFC3339Nano)
+			case float64:
+				// JSON has no NaN or infinities
+				if math.IsNaN(t) || math.IsInf(t, 0) {
+					v = formatCell(t, false)
+				}
+			}
+			key, _ := json.Marshal(res.columns[i])
+			value, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if !first {
+				b.WriteByte(',')
+			}
+			first = false
+			b.Write(key)
+			b.WriteByte(':')
+			b.Write(value)
+		}
+		b.WriteString("}\n")
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+func TestQueryOutputs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "query.db")
+	if err := database.InitDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	resource := map[string]interface{}{"attributes": []interface{}{map[string]interface{}{
+		"key": "service.name", "value": map[string]interface{}{"stringValue": "checkout"}}}}
+	span := func(id, name, start, end string) map[string]interface{} {
+		return map[string]interface{}{
+			"traceId": "0102030405060708090a0b0c0d0e0f10", "spanId": id, "name": name, "kind": float64(2),
+			"startTimeUnixNano": start, "endTimeUnixNano": end,
+			"status": map[string]interface{}{"code": float64(2), "message": "timeout"},
+			"attributes": []interface{}{map[string]interface{}{
+				"key": "http.status_code", "value": map[string]interface{}{"intValue": "504"}}},
+		}
+	}
+	err := database.InsertTraceData(map[string]interface{}{"resourceSpans": []interface{}{map[string]interface{}{
+		"resource": resource,
+		"scopeSpans": []interface{}{map[string]interface{}{"spans": []interface{}{
+			span("0000000000000001", "slow", "1700000000000000000", "1700000000750000000"),
+			span("0000000000000002", "fast", "1700000000000000000", "1700000000010000000"),
+		}}},
+	}}})
+	if err == nil {
+		err = database.InsertLogsData(map[string]interface{}{"resourceLogs": []interface{}{map[string]interface{}{
+			"resource": resource,
+			"scopeLogs": []interface{}{map[string]interface{}{"logRecords": []interface{}{
+				map[string]interface{}{"timeUnixNano": "1700000000000000000", "severityNumber": float64(17),
+					"body": map[string]interface{}{"stringValue": "payment failed"}},
+				map[string]interface{}{"timeUnixNano": "1700000000000000000", "severityNumber": float64(9),
+					"body": map[string]interface{}{"stringValue": "all good"}},
+			}}},
+		}}})
+	}
+	database.CloseDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := database.OpenReadOnly(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	run := func(opts queryOptions) string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := runQueryOn(conn, opts, &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	out := run(queryOptions{kind: "spans", format: formatCSV,
+		spans: database.SpanQuery{MinDuration: int64(500 * time.Millisecond)}})
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2023-11-14T22:13:20Z", "750", "checkout", "slow", "SERVER", "ERROR: timeout",
+		"0102030405060708090a0b0c0d0e0f10", "0000000000000001", "", `{"http.status_code":504}`}
+	if len(records) != 2 || strings.Join(records[1], "|") != strings.Join(want, "|") {
+		t.Errorf("Expected only the slow span, decoded, got %q", records)
+	}
+
+	out = run(queryOptions{kind: "logs", format: formatNDJSON, logs: database.LogQuery{MinSeverity: 17}})
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &record); err != nil {
+		t.Fatalf("Expected one JSON line, got %q: %v", out, err)
+	}
+	if record["body"] != "payment failed" || record["severity"] != "ERROR" || record["trace_id"] != nil {
+		t.Errorf("Unexpected log line: %v", record)
+	}
+
+	out = run(queryOptions{kind: "sql", format: formatTable,
+		sql: "SELECT name, start_time_unix_nano FROM spans ORDER BY name"})
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[0], "NAME") ||
+		!strings.Contains(lines[1], "2023-11-1") {
+		t.Errorf("Expected a table of two spans with readable times, got:\n%s", out)
+	}
+
+	// The connection cannot write
+	if err := runQueryOn(conn, queryOptions{kind: "sql", sql: "DELETE FROM spans"}, &bytes.Buffer{}); err == nil {
+		t.Error("Expected a write statement to fail on the read-only connection")
+	}
+}
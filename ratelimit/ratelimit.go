@@ -0,0 +1,357 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Ways of identifying the client a request is charged to
+const (
+	KeyByIP      = "ip"      // client IP address
+	KeyByAPIKey  = "key"     // authenticated API key name (falls back to IP)
+	KeyByService = "service" // service.name resource attribute (falls back to IP)
+)
+
+// Reasons reported when a request is throttled
+const (
+	ReasonRequests   = "requests"
+	ReasonBytes      = "bytes"
+	ReasonRecords    = "records"
+	ReasonDailyQuota = "daily_quota"
+)
+
+// idleExpiry is how long an unused client state is kept in memory
+const idleExpiry = 10 * time.Minute
+
+// maxThrottledSeries bounds the key and reason pairs counted by Throttled.
+// Keys can come from the payload, so further keys are counted as OtherKey.
+const maxThrottledSeries = 1000
+
+// maxClients bounds the keys with their own state. Further keys share the
+// state of OtherKey until idle keys are swept, so clients cannot escape
+// their limits or exhaust memory by rotating keys.
+const maxClients = 10000
+
+// OtherKey counts throttled requests of keys beyond maxThrottledSeries and
+// holds the shared state of keys beyond maxClients
+const OtherKey = "_other"
+
+// phase selects the limits checked and charged by one call
+type phase int
+
+const (
+	phaseAll     phase = iota // Every limit at once
+	phaseAdmit                // Request rate and bytes, before the body is parsed
+	phaseRecords              // Records and daily quota, once they are counted
+)
+
+// Limits are the rate limits and quota applied to a single client key.
+// A zero value disables the corresponding limit.
+type Limits struct {
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
+	BytesPerSecond    float64 `json:"bytes_per_second,omitempty"`
+	RecordsPerSecond  float64 `json:"records_per_second,omitempty"`
+	DailyRecords      int64   `json:"daily_records,omitempty"` // Records per UTC day
+}
+
+// Config is the rate limiting section of the configuration file
+type Config struct {
+	KeyBy   string            `json:"key_by"`  // ip, key or service
+	Default Limits            `json:"default"` // Limits for keys without an entry in Keys
+	Keys    map[string]Limits `json:"keys"`    // Per-key overrides
+}
+
+// Validate checks the configuration for unknown values
+func (c *Config) Validate() error {
+	switch c.KeyBy {
+	case "", KeyByIP, KeyByAPIKey, KeyByService:
+	default:
+		return fmt.Errorf("unknown rate limit key_by '%s' (expected ip, key or service)", c.KeyBy)
+	}
+	limits := []Limits{c.Default}
+	for _, l := range c.Keys {
+		limits = append(limits, l)
+	}
+	for _, l := range limits {
+		if l.RequestsPerSecond < 0 || l.BytesPerSecond < 0 || l.RecordsPerSecond < 0 || l.DailyRecords < 0 {
+			return fmt.Errorf("rate limits must not be negative")
+		}
+	}
+	return nil
+}
+
+// limitsFor returns the limits that apply to key
+func (c *Config) limitsFor(key string) Limits {
+	if l, ok := c.Keys[key]; ok {
+		return l
+	}
+	return c.Default
+}
+
+// bucket is a token bucket holding up to one second worth of tokens.
+// A single cost larger than the capacity is admitted when the bucket is
+// full and leaves the bucket in debt, so large batches are never starved.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens accumulated since the last update
+func (b *bucket) refill(rate float64, now time.Time) {
+	if b.last.IsZero() {
+		b.tokens = rate
+	} else {
+		b.tokens = math.Min(rate, b.tokens+rate*now.Sub(b.last).Seconds())
+	}
+	b.last = now
+}
+
+// wait returns how long until cost can be admitted (0 if it can be now)
+func (b *bucket) wait(rate, cost float64) time.Duration {
+	needed := math.Min(cost, rate)
+	if b.tokens >= needed {
+		return 0
+	}
+	return time.Duration((needed - b.tokens) / rate * float64(time.Second))
+}
+
+// clientState tracks the buckets and daily usage of one client key
+type clientState struct {
+	requests   bucket
+	bytes      bucket
+	records    bucket
+	day        string
+	dayRecords int64
+	lastSeen   time.Time
+}
+
+// Request describes the cost of one request charged to a client key
+type Request struct {
+	Key     string
+	Bytes   int64
+	Records int64
+}
+
+// Decision is the result of a rate limit check
+type Decision struct {
+	Allowed    bool
+	Key        string        // The key that was throttled
+	Reason     string        // Which limit was hit
+	RetryAfter time.Duration // When the client may retry
+}
+
+// Limiter enforces per-key token bucket rate limits and daily record quotas
+type Limiter struct {
+	mu        sync.Mutex
+	cfg       Config
+	clients   map[string]*clientState
+	throttled map[[2]string]uint64
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New creates a limiter from the given configuration
+func New(cfg Config) (*Limiter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.KeyBy == "" {
+		cfg.KeyBy = KeyByIP
+	}
+	return &Limiter{
+		cfg:       cfg,
+		clients:   make(map[string]*clientState),
+		throttled: make(map[[2]string]uint64),
+		now:       time.Now,
+	}, nil
+}
+
+// KeyBy returns how clients are identified
+func (l *Limiter) KeyBy() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cfg.KeyBy
+}
+
+// SetConfig replaces the limits. Existing bucket state is kept.
+func (l *Limiter) SetConfig(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if cfg.KeyBy == "" {
+		cfg.KeyBy = KeyByIP
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	return nil
+}
+
+// Allow checks whether all requests can be admitted and, if so, charges
+// them. Either every request is charged or none is.
+func (l *Limiter) Allow(requests ...Request) Decision {
+	return l.allow(phaseAll, requests)
+}
+
+// Admit checks and charges the request rate and byte limits of a request
+// before its body is parsed, so throttled clients cost no decoding. Its
+// records are charged afterwards with AllowRecords.
+func (l *Limiter) Admit(req Request) Decision {
+	return l.allow(phaseAdmit, []Request{req})
+}
+
+// AllowRecords checks and charges the record limits of a request accepted
+// by Admit. Bytes not known at admission, such as a chunked body, are
+// charged without being checked.
+func (l *Limiter) AllowRecords(req Request) Decision {
+	return l.allow(phaseRecords, []Request{req})
+}
+
+// allow checks the limits of a phase for all requests and charges them if
+// every one is admitted
+func (l *Limiter) allow(p phase, requests []Request) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweepLocked(now)
+	day := now.UTC().Format("2006-01-02")
+
+	states := make([]*clientState, len(requests))
+	for i, req := range requests {
+		state, ok := l.clients[req.Key]
+		if !ok && len(l.clients) >= maxClients {
+			req.Key = OtherKey
+			state, ok = l.clients[OtherKey]
+		}
+		if !ok {
+			state = &clientState{}
+			l.clients[req.Key] = state
+		}
+		state.lastSeen = now
+		if state.day != day {
+			state.day = day
+			state.dayRecords = 0
+		}
+		states[i] = state
+
+		limits := l.cfg.limitsFor(req.Key)
+		if d := checkLocked(state, limits, req, p, now); !d.Allowed {
+			d.Key = req.Key
+			l.countThrottledLocked(req.Key, d.Reason)
+			return d
+		}
+	}
+
+	for i, req := range requests {
+		state := states[i]
+		if p != phaseRecords {
+			state.requests.tokens--
+		}
+		state.bytes.tokens -= float64(req.Bytes)
+		state.records.tokens -= float64(req.Records)
+		state.dayRecords += req.Records
+	}
+	return Decision{Allowed: true}
+}
+
+// checkLocked evaluates the limits of a phase for one request without
+// charging it
+func checkLocked(state *clientState, limits Limits, req Request, p phase, now time.Time) Decision {
+	if p != phaseAdmit && limits.DailyRecords > 0 && state.dayRecords+req.Records > limits.DailyRecords {
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return Decision{Reason: ReasonDailyQuota, RetryAfter: midnight.Sub(now)}
+	}
+
+	checks := []struct {
+		b      *bucket
+		rate   float64
+		cost   float64
+		reason string
+		check  bool
+	}{
+		{&state.requests, limits.RequestsPerSecond, 1, ReasonRequests, p != phaseRecords},
+		{&state.bytes, limits.BytesPerSecond, float64(req.Bytes), ReasonBytes, p != phaseRecords},
+		{&state.records, limits.RecordsPerSecond, float64(req.Records), ReasonRecords, p != phaseAdmit},
+	}
+	for _, c := range checks {
+		if !c.check {
+			continue
+		}
+		if c.rate <= 0 {
+			// Keep unlimited buckets from accumulating debt
+			c.b.tokens, c.b.last = math.Inf(1), now
+			continue
+		}
+		c.b.refill(c.rate, now)
+		if wait := c.b.wait(c.rate, c.cost); wait > 0 {
+			return Decision{Reason: c.reason, RetryAfter: wait}
+		}
+	}
+	return Decision{Allowed: true}
+}
+
+// sweepLocked drops client state that has been idle for a while.
+// Must be called with l.mu held.
+func (l *Limiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	today := now.UTC().Format("2006-01-02")
+	for key, state := range l.clients {
+		if now.Sub(state.lastSeen) <= idleExpiry {
+			continue
+		}
+		// Keep today's usage for keys with a daily quota
+		if l.cfg.limitsFor(key).DailyRecords > 0 && state.day == today {
+			continue
+		}
+		delete(l.clients, key)
+	}
+	// Throttle counts go with the state of their key
+	for k := range l.throttled {
+		if _, ok := l.clients[k[0]]; !ok && k[0] != OtherKey {
+			delete(l.throttled, k)
+		}
+	}
+}
+
+// countThrottledLocked counts a throttled request.
+// Must be called with l.mu held.
+func (l *Limiter) countThrottledLocked(key, reason string) {
+	k := [2]string{key, reason}
+	if _, ok := l.throttled[k]; !ok && len(l.throttled) >= maxThrottledSeries {
+		k[0] = OtherKey
+	}
+	l.throttled[k]++
+}
+
+// ThrottleCount is the number of throttled requests for a key and reason
+type ThrottleCount struct {
+	Key    string
+	Reason string
+	Count  uint64
+}
+
+// Throttled returns the number of throttled requests per key and reason.
+// Counts of keys idle long enough to be forgotten are dropped.
+func (l *Limiter) Throttled() []ThrottleCount {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counts := make([]ThrottleCount, 0, len(l.throttled))
+	for k, count := range l.throttled {
+		counts = append(counts, ThrottleCount{Key: k[0], Reason: k[1], Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Key != counts[j].Key {
+			return counts[i].Key < counts[j].Key
+		}
+		return counts[i].Reason < counts[j].Reason
+	})
+	return counts
+}
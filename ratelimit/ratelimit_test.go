@@ -0,0 +1,183 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(t *testing.T, cfg Config) (*Limiter, *time.Time) {
+	t.Helper()
+	l, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestRequestRateLimit(t *testing.T) {
+	l, now := newTestLimiter(t, Config{Default: Limits{RequestsPerSecond: 2}})
+
+	for i := 0; i < 2; i++ {
+		if d := l.Allow(Request{Key: "10.0.0.1"}); !d.Allowed {
+			t.Fatalf("Request %d should be allowed", i)
+		}
+	}
+	d := l.Allow(Request{Key: "10.0.0.1"})
+	if d.Allowed || d.Reason != ReasonRequests {
+		t.Fatalf("Expected request limit, got %+v", d)
+	}
+	if d.RetryAfter <= 0 || d.RetryAfter > time.Second {
+		t.Errorf("Unexpected retry after: %v", d.RetryAfter)
+	}
+
+	// Other keys have their own bucket
+	if d := l.Allow(Request{Key: "10.0.0.2"}); !d.Allowed {
+		t.Error("Other key should not be throttled")
+	}
+
+	*now = now.Add(time.Second)
+	if d := l.Allow(Request{Key: "10.0.0.1"}); !d.Allowed {
+		t.Error("Bucket should refill after one second")
+	}
+
+	counts := l.Throttled()
+	if len(counts) != 1 || counts[0].Key != "10.0.0.1" || counts[0].Count != 1 {
+		t.Errorf("Unexpected throttle counts: %+v", counts)
+	}
+}
+
+func TestLargeBatchAdmittedWithDebt(t *testing.T) {
+	l, now := newTestLimiter(t, Config{Default: Limits{RecordsPerSecond: 100}})
+
+	if d := l.Allow(Request{Key: "svc", Records: 500}); !d.Allowed {
+		t.Fatal("Batch larger than the bucket should be admitted when full")
+	}
+	d := l.Allow(Request{Key: "svc", Records: 1})
+	if d.Allowed || d.Reason != ReasonRecords {
+		t.Fatalf("Expected records limit, got %+v", d)
+	}
+	// 400 records of debt plus one record at 100/s
+	if d.RetryAfter < 4*time.Second {
+		t.Errorf("Retry after should cover the debt, got %v", d.RetryAfter)
+	}
+	*now = now.Add(5 * time.Second)
+	if d := l.Allow(Request{Key: "svc", Records: 1}); !d.Allowed {
+		t.Error("Debt should be repaid after five seconds")
+	}
+}
+
+func TestDailyQuotaAndOverrides(t *testing.T) {
+	l, now := newTestLimiter(t, Config{
+		KeyBy:   KeyByService,
+		Default: Limits{DailyRecords: 10},
+		Keys:    map[string]Limits{"checkout": {DailyRecords: 100}},
+	})
+
+	if d := l.Allow(Request{Key: "frontend", Records: 8}); !d.Allowed {
+		t.Fatal("First batch should be allowed")
+	}
+	d := l.Allow(Request{Key: "frontend", Records: 5})
+	if d.Allowed || d.Reason != ReasonDailyQuota {
+		t.Fatalf("Expected daily quota, got %+v", d)
+	}
+	if d.RetryAfter != 12*time.Hour {
+		t.Errorf("Expected retry at midnight UTC, got %v", d.RetryAfter)
+	}
+	if d := l.Allow(Request{Key: "checkout", Records: 50}); !d.Allowed {
+		t.Error("Override should allow a larger quota")
+	}
+
+	// A rejected multi-key request charges nothing
+	if d := l.Allow(Request{Key: "checkout", Records: 10}, Request{Key: "frontend", Records: 5}); d.Allowed {
+		t.Fatal("Expected combined request to be rejected")
+	}
+	if d := l.Allow(Request{Key: "checkout", Records: 50}); !d.Allowed {
+		t.Error("Rejected request must not consume quota")
+	}
+
+	*now = now.Add(12 * time.Hour)
+	if d := l.Allow(Request{Key: "frontend", Records: 5}); !d.Allowed {
+		t.Error("Quota should reset at midnight UTC")
+	}
+}
+
+func TestAdmitBeforeRecords(t *testing.T) {
+	l, _ := newTestLimiter(t, Config{Default: Limits{RequestsPerSecond: 1, BytesPerSecond: 1000, RecordsPerSecond: 10}})
+
+	if d := l.Admit(Request{Key: "10.0.0.1", Bytes: 400}); !d.Allowed {
+		t.Fatal("First request should be admitted")
+	}
+	// Admission already charged the request, so counting records must not
+	if d := l.AllowRecords(Request{Key: "10.0.0.1", Records: 10}); !d.Allowed {
+		t.Fatalf("Records of an admitted request should be allowed, got %+v", d)
+	}
+	if d := l.Admit(Request{Key: "10.0.0.1"}); d.Allowed || d.Reason != ReasonRequests {
+		t.Fatalf("Expected request limit, got %+v", d)
+	}
+
+	// Bytes learned after admission are charged without being checked
+	if d := l.Admit(Request{Key: "10.0.0.2"}); !d.Allowed {
+		t.Fatal("Other key should be admitted")
+	}
+	if d := l.AllowRecords(Request{Key: "10.0.0.2", Bytes: 5000, Records: 1}); !d.Allowed {
+		t.Fatalf("Unchecked bytes should not throttle, got %+v", d)
+	}
+	l.SetConfig(Config{Default: Limits{BytesPerSecond: 1000}})
+	if d := l.Admit(Request{Key: "10.0.0.2", Bytes: 1}); d.Allowed || d.Reason != ReasonBytes {
+		t.Fatalf("Expected bytes limit from the charged debt, got %+v", d)
+	}
+}
+
+func TestThrottledCountsAreBounded(t *testing.T) {
+	l, now := newTestLimiter(t, Config{Default: Limits{DailyRecords: 1}})
+
+	for i := 0; i < maxThrottledSeries+10; i++ {
+		key := fmt.Sprintf("svc-%d", i)
+		l.Allow(Request{Key: key, Records: 2})
+	}
+	counts := l.Throttled()
+	if len(counts) != maxThrottledSeries+1 {
+		t.Fatalf("Expected %d series, got %d", maxThrottledSeries+1, len(counts))
+	}
+	if counts[0].Key != OtherKey || counts[0].Count != 10 {
+		t.Errorf("Expected overflow counted as %s, got %+v", OtherKey, counts[0])
+	}
+
+	// Counts are forgotten with the state of idle keys
+	*now = now.Add(24 * time.Hour)
+	l.Allow(Request{Key: "svc-0"})
+	counts = l.Throttled()
+	if len(counts) != 1 || counts[0].Key != OtherKey {
+		t.Errorf("Expected only the overflow count after idle keys expire, got %d series", len(counts))
+	}
+}
+
+func TestTrackedClientsAreBounded(t *testing.T) {
+	l, _ := newTestLimiter(t, Config{Default: Limits{RequestsPerSecond: 1}})
+
+	for i := 0; i < maxClients; i++ {
+		l.Allow(Request{Key: fmt.Sprintf("svc-%d", i)})
+	}
+	// New keys share one state instead of getting a fresh bucket each
+	if d := l.Allow(Request{Key: "rotated-1"}); !d.Allowed {
+		t.Fatalf("First overflow key should be admitted, got %+v", d)
+	}
+	if d := l.Allow(Request{Key: "rotated-2"}); d.Allowed || d.Key != OtherKey {
+		t.Errorf("Expected overflow keys throttled as %s, got %+v", OtherKey, d)
+	}
+	if len(l.clients) != maxClients+1 {
+		t.Errorf("Expected %d tracked clients, got %d", maxClients+1, len(l.clients))
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	if _, err := New(Config{KeyBy: "tenant"}); err == nil {
+		t.Error("Expected unknown key_by to be rejected")
+	}
+	if _, err := New(Config{Default: Limits{BytesPerSecond: -1}}); err == nil {
+		t.Error("Expected negative limit to be rejected")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/RedShiftVelocity/sqlite-otel/auth"
+	"github.com/RedShiftVelocity/sqlite-otel/config"
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/handlers"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+	"github.com/RedShiftVelocity/sqlite-otel/ratelimit"
+	"github.com/RedShiftVelocity/sqlite-otel/tlsconfig"
+)
+
+// reloader applies the settings that can change without a restart when
+// the process receives SIGHUP
+type reloader struct {
+	opts      *serverOptions
+	tenants   *database.TenantManager
+	authStore *auth.Store
+	tls       *tlsconfig.Reloader
+}
+
+// reload reopens the log file, then re-reads the configuration file, keys
+// file and certificates. A setting that fails to load keeps its previous
+// value so a bad edit never takes the collector down.
+func (r *reloader) reload() {
+	if err := logging.Reopen(); err != nil {
+		logging.Error("Failed to reopen log file: %v", err)
+	} else {
+		logging.Info("Reopened log file")
+	}
+
+	if r.opts.configFile != "" {
+		cfg, err := config.Load(r.opts.configFile)
+		if err == nil {
+			err = r.applyConfig(cfg)
+		}
+		if err != nil {
+			logging.Error("Failed to reload configuration, keeping previous settings: %v", err)
+		} else {
+			logging.Info("Reloaded configuration from %s", r.opts.configFile)
+		}
+	}
+
+	if r.authStore != nil && r.opts.authKeysFile != "" {
+		if err := r.authStore.ReloadFile(r.opts.authKeysFile); err != nil {
+			logging.Error("Failed to reload keys file, keeping previous keys: %v", err)
+		} else {
+			logging.Info("Reloaded keys from %s", r.opts.authKeysFile)
+		}
+	}
+
+	if r.tls != nil {
+		if err := r.tls.Reload(); err != nil {
+			logging.Error("Failed to reload TLS certificates, keeping previous ones: %v", err)
+		} else {
+			logging.Info("Reloaded TLS certificates from %s", r.opts.tls.CertFile)
+		}
+	}
+}
+
+// applyConfig installs tenant policies and rate limits from a freshly
+// loaded configuration. Logging outputs are only read at startup. The rate
+// limits are checked first, so an invalid file changes nothing.
+func (r *reloader) applyConfig(cfg *config.Config) error {
+	if cfg.RateLimits != nil {
+		if err := cfg.RateLimits.Validate(); err != nil {
+			return fmt.Errorf("invalid rate limits: %w", err)
+		}
+	}
+	r.tenants.SetPolicies(tenantPolicies(r.opts, cfg))
+	r.opts.cfg = cfg
+
+	limiter := handlers.RateLimiter()
+	keyBy := ratelimit.KeyByIP
+	if cfg.RateLimits != nil && cfg.RateLimits.KeyBy != "" {
+		keyBy = cfg.RateLimits.KeyBy
+	}
+	switch {
+	case cfg.RateLimits == nil:
+		if limiter != nil {
+			handlers.SetRateLimiter(nil)
+			logging.Info("Rate limiting disabled")
+		}
+	case limiter != nil && limiter.KeyBy() == keyBy:
+		if err := limiter.SetConfig(*cfg.RateLimits); err != nil {
+			return fmt.Errorf("invalid rate limits: %w", err)
+		}
+	default:
+		// A new limiter is needed when limiting is first enabled or the
+		// client key changes, since existing buckets are keyed differently
+		limiter, err := ratelimit.New(*cfg.RateLimits)
+		if err != nil {
+			return fmt.Errorf("invalid rate limits: %w", err)
+		}
+		handlers.SetRateLimiter(limiter)
+		logging.Info("Rate limiting enabled (keyed by %s)", limiter.KeyBy())
+	}
+	return nil
+}
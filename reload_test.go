@@ -0,0 +1,105 @@
+//go:build !windows
+
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/handlers"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+)
+
+func TestSIGHUPReopensLogAndReloadsConfig(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "collector.log")
+	if err := logging.InitWithOutputs(logging.OutputConfig{Outputs: []string{logging.OutputFile}, FilePath: logPath}, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer logging.Close()
+
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tenants := database.NewTenantManager(filepath.Join(dir, "tenants"), 1)
+	defer tenants.Close()
+	defer handlers.SetRateLimiter(nil)
+	r := &reloader{opts: &serverOptions{configFile: configPath}, tenants: tenants}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	logging.Info("before rotation")
+	if err := os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(configPath, []byte(`{"rate_limits": {"default": {"requests_per_second": 5}}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sigChan:
+		r.reload()
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGHUP not delivered")
+	}
+	logging.Info("after rotation")
+
+	current, _ := os.ReadFile(logPath)
+	if !strings.Contains(string(current), "after rotation") {
+		t.Errorf("Log file not reopened after SIGHUP: %s", current)
+	}
+	if old, _ := os.ReadFile(logPath + ".1"); strings.Contains(string(old), "after rotation") {
+		t.Error("Line written after SIGHUP went to the renamed file")
+	}
+	if handlers.RateLimiter() == nil {
+		t.Error("Rate limits from the reloaded configuration were not applied")
+	}
+}
+
+func TestReloadRejectsInvalidRateLimits(t *testing.T) {
+	dir := t.TempDir()
+	var mu sync.Mutex
+	var messages []string
+	logging.SetHook(func(level slog.Level, message string, attrs []slog.Attr) {
+		mu.Lock()
+		defer mu.Unlock()
+		messages = append(messages, message)
+	})
+	defer logging.SetHook(nil)
+
+	configPath := filepath.Join(dir, "config.json")
+	err := os.WriteFile(configPath, []byte(`{"rate_limits": {"default": {"requests_per_second": -1}}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants := database.NewTenantManager(filepath.Join(dir, "tenants"), 1)
+	defer tenants.Close()
+	defer handlers.SetRateLimiter(nil)
+	r := &reloader{opts: &serverOptions{configFile: configPath}, tenants: tenants}
+
+	r.reload()
+	mu.Lock()
+	logged := strings.Join(messages, "\n")
+	mu.Unlock()
+	if strings.Contains(logged, "Reloaded configuration") || !strings.Contains(logged, "Failed to reload configuration") {
+		t.Errorf("Expected the reload to be reported as failed: %s", logged)
+	}
+	if handlers.RateLimiter() != nil || r.opts.cfg != nil {
+		t.Error("Invalid configuration was partly applied")
+	}
+}
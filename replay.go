@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/exporter"
+)
+
+// replayOptions configures a replay run
+type replayOptions struct {
+	dbPath    string
+	client    exporter.ClientOptions
+	header    http.Header
+	read      database.ReadOptions // Filters; AfterID and Limit are managed by replay
+	signals   []string
+	timeShift bool
+	rate      float64 // Records per second, 0 for unlimited
+	batchSize int
+	retries   int
+}
+
+// runReplay implements the replay subcommand
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s replay -endpoint URL [options]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Send telemetry stored in a database to an OTLP/HTTP endpoint.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	dbPath := fs.String("db", getDefaultDBPath(), "Path to the SQLite database to read")
+	endpoint := fs.String("endpoint", "", "OTLP/HTTP base URL to send to, e.g. http://otel-collector:4318 (required)")
+	encoding := fs.String("encoding", exporter.EncodingProtobuf, "Request encoding: protobuf or json")
+	compression := fs.String("compression", exporter.CompressionGzip, "Request compression: gzip or none")
+	timeout := fs.Duration("timeout", exporter.DefaultTimeout, "Timeout for each request")
+	header := headerFlag{}
+	fs.Var(header, "header", "Request header as 'Name: value', may be repeated")
+	since := fs.String("since", "", "Only records at or after this time: RFC 3339 or a duration ago such as 2h or 7d")
+	until := fs.String("until", "", "Only records at or before this time: RFC 3339 or a duration ago")
+	service := fs.String("service", "", "Only records whose service.name resource attribute matches")
+	signals := fs.String("signal", "", "Comma separated signals to send: traces, metrics, logs (default: all)")
+	timeShift := fs.Bool("time-shift", false, "Shift timestamps so the newest replayed record is at the current time")
+	rate := fs.Float64("rate", 0, "Maximum records sent per second (default: 0, unlimited)")
+	batchSize := fs.Int("batch-size", exporter.DefaultBatchSize, "Records per request")
+	retries := fs.Int("retries", 5, "Attempts per request when the endpoint is unavailable")
+	quiet := fs.Bool("quiet", false, "Do not print progress")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+
+	opts := replayOptions{
+		dbPath: *dbPath,
+		client: exporter.ClientOptions{
+			Endpoint:    *endpoint,
+			Encoding:    *encoding,
+			Compression: *compression,
+			Timeout:     *timeout,
+		},
+		header:    http.Header(header),
+		timeShift: *timeShift,
+		rate:      *rate,
+		batchSize: *batchSize,
+		retries:   *retries,
+	}
+	var code int
+	if opts.read, opts.signals, code = parseReadFlags(fs, *since, *until, *service, *signals); code != 0 {
+		return code
+	}
+	if *endpoint == "" {
+		return usageError(fs, "-endpoint", fmt.Errorf("an endpoint is required"))
+	}
+	if opts.rate < 0 || opts.batchSize <= 0 || opts.retries <= 0 {
+		return usageError(fs, "-rate, -batch-size or -retries", fmt.Errorf("must be positive"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var progress io.Writer = os.Stderr
+	if *quiet {
+		progress = io.Discard
+	}
+	if err := replay(ctx, opts, progress); err != nil {
+		fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// usageError reports an invalid flag value
+func usageError(fs *flag.FlagSet, name string, err error) int {
+	fmt.Fprintf(fs.Output(), "Invalid %s: %v\n", name, err)
+	return exitUsage
+}
+
+// parseSignals parses a comma separated signal list; empty means all
+func parseSignals(s string) ([]string, error) {
+	list := splitList(s)
+	if len(list) == 0 {
+		return database.Signals, nil
+	}
+	for _, signal := range list {
+		if signal != database.SignalTraces && signal != database.SignalMetrics && signal != database.SignalLogs {
+			return nil, fmt.Errorf("unknown signal '%s' (expected traces, metrics or logs)", signal)
+		}
+	}
+	return list, nil
+}
+
+// replay sends the records selected by opts, one signal after another,
+// writing progress to w
+func replay(ctx context.Context, opts replayOptions, w io.Writer) error {
+	client, err := exporter.NewClient(opts.client)
+	if err != nil {
+		return err
+	}
+	conn, err := database.OpenReadOnly(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	extents := make(map[string]database.Extent, len(opts.signals))
+	var newest int64
+	for _, signal := range opts.signals {
+		e, err := database.ReadExtent(conn, signal, opts.read)
+		if err != nil {
+			return err
+		}
+		extents[signal] = e
+		newest = max(newest, e.Newest)
+	}
+	var shift int64
+	if opts.timeShift && newest > 0 {
+		shift = time.Now().UnixNano() - newest
+		fmt.Fprintf(w, "Shifting timestamps by %s\n", time.Duration(shift).Round(time.Second))
+	}
+
+	limiter := newRecordLimiter(opts.rate)
+	for _, signal := range opts.signals {
+		start := time.Now()
+		p := &replayProgress{w: w, signal: signal, total: extents[signal].Records, start: start, printed: start}
+		read := opts.read
+		read.Limit = opts.batchSize
+		if opts.rate > 0 && float64(read.Limit) > opts.rate {
+			// Smaller requests keep the rate smooth
+			read.Limit = max(1, int(opts.rate))
+		}
+		for {
+			batch, err := database.ReadBatch(conn, signal, read)
+			if err != nil {
+				return err
+			}
+			if batch.Records == 0 {
+				break
+			}
+			if shift != 0 {
+				shiftTimestamps(batch.Payload, shift)
+			}
+			if err := limiter.wait(ctx, batch.Records); err != nil {
+				return err
+			}
+			if err := sendWithRetry(ctx, client, signal, batch, opts); err != nil {
+				p.done()
+				return err
+			}
+			read.AfterID = batch.LastID
+			p.add(batch.Records)
+		}
+		p.done()
+	}
+	return nil
+}
+
+// sendWithRetry sends a batch, retrying with exponential backoff while the
+// endpoint reports a retryable error
+func sendWithRetry(ctx context.Context, client *exporter.Client, signal string, batch *database.Batch, opts replayOptions) error {
+	delay := time.Second
+	for attempt := 1; ; attempt++ {
+		err := client.Send(ctx, signal, batch.Payload, opts.header)
+		if err == nil {
+			return nil
+		}
+		var sendErr *exporter.SendError
+		if attempt >= opts.retries || ctx.Err() != nil || !errors.As(err, &sendErr) || !sendErr.Retryable {
+			return fmt.Errorf("failed to send %d %s: %w", batch.Records, signal, err)
+		}
+		wait := max(delay, sendErr.RetryAfter)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay = min(2*delay, 30*time.Second)
+	}
+}
+
+// shiftTimestamps adds shift nanoseconds to every non-zero *UnixNano field
+// of an OTLP JSON payload, including span events and exemplars
+func shiftTimestamps(v interface{}, shift int64) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if !strings.HasSuffix(key, "UnixNano") {
+				shiftTimestamps(value, shift)
+				continue
+			}
+			var n int64
+			switch value := value.(type) {
+			case string:
+				n, _ = strconv.ParseInt(value, 10, 64)
+			case json.Number:
+				n, _ = value.Int64()
+			case float64:
+				n = int64(value)
+			}
+			if n > 0 {
+				v[key] = strconv.FormatInt(n+shift, 10)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			shiftTimestamps(item, shift)
+		}
+	}
+}
+
+// recordLimiter paces sends to a number of records per second
+type recordLimiter struct {
+	rate  float64
+	start time.Time
+	sent  int
+}
+
+func newRecordLimiter(rate float64) *recordLimiter {
+	return &recordLimiter{rate: rate, start: time.Now()}
+}
+
+// wait blocks until n more records may be sent
+func (l *recordLimiter) wait(ctx context.Context, n int) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	// The batch may go once the previous records have used their share
+	due := l.start.Add(time.Duration(float64(l.sent) / l.rate * float64(time.Second)))
+	l.sent += n
+	if d := time.Until(due); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// replayProgress prints how much of a signal has been sent
+type replayProgress struct {
+	w       io.Writer
+	signal  string
+	total   int64
+	sent    int64
+	start   time.Time
+	printed time.Time
+}
+
+// progressInterval is how often progress is printed during a replay
+const progressInterval = 2 * time.Second
+
+func (p *replayProgress) add(n int) {
+	p.sent += int64(n)
+	if time.Since(p.printed) >= progressInterval {
+		p.print()
+	}
+}
+
+func (p *replayProgress) done() {
+	p.print()
+}
+
+func (p *replayProgress) print() {
+	p.printed = time.Now()
+	if p.total == 0 {
+		fmt.Fprintf(p.w, "%s: nothing to send\n", p.signal)
+		return
+	}
+	elapsed := time.Since(p.start)
+	percent := float64(p.sent) * 100 / float64(p.total)
+	fmt.Fprintf(p.w, "%s: %d/%d records (%.0f%%) in %s, %.0f records/s\n", p.signal, p.sent, p.total, percent,
+		elapsed.Round(time.Millisecond), float64(p.sent)/max(elapsed.Seconds(), 0.001))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/exporter"
+)
+
+func TestReplayFiltersAndShiftsTimestamps(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "incident.db")
+	if err := database.InitDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	hourAgo := time.Now().Add(-time.Hour).UnixNano()
+	span := func(service, name, spanID string, start int64) map[string]interface{} {
+		return map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": []interface{}{map[string]interface{}{
+				"key": "service.name", "value": map[string]interface{}{"stringValue": service}}}},
+			"scopeSpans": []interface{}{map[string]interface{}{"spans": []interface{}{map[string]interface{}{
+				"traceId":           "0102030405060708090a0b0c0d0e0f10",
+				"spanId":            spanID,
+				"name":              name,
+				"startTimeUnixNano": strconv.FormatInt(start, 10),
+				"endTimeUnixNano":   strconv.FormatInt(start+1000, 10),
+				"events": []interface{}{map[string]interface{}{
+					"name": "retry", "timeUnixNano": strconv.FormatInt(start+500, 10)}},
+			}}}},
+		}
+	}
+	err := database.InsertTraceData(map[string]interface{}{"resourceSpans": []interface{}{
+		span("checkout", "old", "0000000000000001", hourAgo-int64(time.Minute)),
+		span("checkout", "new", "0000000000000002", hourAgo),
+		span("cart", "other", "0000000000000003", hourAgo),
+	}})
+	database.CloseDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var spans []map[string]interface{}
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []map[string]interface{} `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/v1/traces" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	opts := replayOptions{
+		dbPath:    dbPath,
+		client:    exporter.ClientOptions{Endpoint: srv.URL, Encoding: exporter.EncodingJSON, Compression: exporter.CompressionNone},
+		read:      database.ReadOptions{Service: "checkout"},
+		signals:   database.Signals,
+		timeShift: true,
+		batchSize: 1,
+		retries:   1,
+	}
+	if err := replay(context.Background(), opts, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(spans) != 2 || requests != 2 {
+		t.Fatalf("Expected 2 checkout spans in 2 requests, got %d spans in %d requests", len(spans), requests)
+	}
+	nano := func(v interface{}) int64 {
+		n, _ := strconv.ParseInt(v.(string), 10, 64)
+		return n
+	}
+	newest := spans[1]
+	if newest["name"] != "new" {
+		t.Fatalf("Expected spans in insertion order, got %v", newest["name"])
+	}
+	start := nano(newest["startTimeUnixNano"])
+	if d := time.Since(time.Unix(0, start)); d < 0 || d > time.Minute {
+		t.Errorf("Expected the newest span to be shifted to now, got %s ago", d)
+	}
+	event := newest["events"].([]interface{})[0].(map[string]interface{})
+	if nano(newest["endTimeUnixNano"])-start != 1000 || nano(event["timeUnixNano"])-start != 500 {
+		t.Errorf("Expected relative timings to be kept, got %v", newest)
+	}
+	if start-nano(spans[0]["startTimeUnixNano"]) != int64(time.Minute) {
+		t.Errorf("Expected the spacing between spans to be kept")
+	}
+}
+
+func TestParseTimeArg(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for arg, want := range map[string]time.Time{
+		"":                     {},
+		"2h":                   now.Add(-2 * time.Hour),
+		"1d":                   now.Add(-24 * time.Hour),
+		"2024-04-30T08:00:00Z": time.Date(2024, 4, 30, 8, 0, 0, 0, time.UTC),
+	} {
+		got, err := parseTimeArg(arg, now)
+		if err != nil {
+			t.Errorf("parseTimeArg(%q): %v", arg, err)
+			continue
+		}
+		if (want.IsZero() && got != 0) || (!want.IsZero() && got != want.UnixNano()) {
+			t.Errorf("parseTimeArg(%q) = %d, want %v", arg, got, want)
+		}
+	}
+	if _, err := parseTimeArg("yesterday", now); err == nil {
+		t.Error("Expected an invalid time to be rejected")
+	}
+}
@@ -0,0 +1,320 @@
+// Package selftelemetry stores the collector's own metrics, log lines and
+// ingest spans in its database under the sqlite-otel-collector service.
+//
+// Everything is buffered in memory and written directly through the
+// database package in one transaction per signal and interval. Those
+// writes never pass through the HTTP ingestion path and are left out of the
+// ingest statistics, so they do not create spans, request metrics or log
+// lines of their own and cannot amplify.
+package selftelemetry
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+	"github.com/RedShiftVelocity/sqlite-otel/stats"
+)
+
+// ServiceName is the service.name of the collector's own telemetry
+const ServiceName = "sqlite-otel-collector"
+
+// DefaultInterval is how often buffered telemetry is written
+const DefaultInterval = 30 * time.Second
+
+// maxBuffered bounds the number of buffered log lines and spans each
+const maxBuffered = 10000
+
+// The logger attribute marks log lines written by the recorder itself,
+// which are not fed back into the buffer
+const loggerKey, loggerName = "logger", "selftelemetry"
+
+// Dropped counts telemetry discarded because the buffer was full
+var Dropped = stats.Default.NewCounterVec("sqlite_otel_self_telemetry_dropped_total",
+	"Self-telemetry records dropped because the buffer was full.", "signal")
+
+// Span describes one ingest request handled by the collector
+type Span struct {
+	Name       string
+	Start, End time.Time
+	Attributes map[string]string
+	Error      bool
+}
+
+// Recorder buffers the collector's own telemetry and writes it periodically
+type Recorder struct {
+	interval time.Duration
+	resource map[string]interface{}
+	scope    map[string]interface{}
+
+	mu    sync.Mutex
+	logs  []interface{}
+	spans []interface{}
+
+	log *slog.Logger // Marks the recorder's own log lines
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a recorder that flushes every interval
+func New(interval time.Duration, version string) *Recorder {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Recorder{
+		interval: interval,
+		resource: map[string]interface{}{
+			"attributes": []interface{}{
+				stringAttr("service.name", ServiceName),
+				stringAttr("service.version", version),
+			},
+		},
+		scope: map[string]interface{}{
+			"name":    "github.com/RedShiftVelocity/sqlite-otel/selftelemetry",
+			"version": version,
+		},
+		log:  logging.Slog().With(loggerKey, loggerName),
+		done: make(chan struct{}),
+	}
+}
+
+// active is the recorder fed by RecordSpan, if any
+var active atomic.Pointer[Recorder]
+
+// Start begins periodic flushing and captures log lines and ingest spans
+func (r *Recorder) Start() {
+	active.Store(r)
+	logging.SetHook(r.RecordLog)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Flush()
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop detaches the recorder and writes whatever is still buffered
+func (r *Recorder) Stop() {
+	logging.SetHook(nil)
+	active.CompareAndSwap(r, nil)
+	close(r.done)
+	r.wg.Wait()
+	r.Flush()
+}
+
+// RecordSpan buffers an ingest span when self-telemetry is enabled
+func RecordSpan(s Span) {
+	if r := active.Load(); r != nil {
+		r.RecordSpan(s)
+	}
+}
+
+// RecordLog buffers one execution log line. It is installed as the
+// logging hook and therefore must never log itself.
+func (r *Recorder) RecordLog(level slog.Level, message string, attrs []slog.Attr) {
+	for _, a := range attrs {
+		if a.Key == loggerKey && a.Value.String() == loggerName {
+			return
+		}
+	}
+	attributes := make([]interface{}, 0, len(attrs))
+	for _, a := range attrs {
+		attributes = append(attributes, stringAttr(a.Key, a.Value.Resolve().String()))
+	}
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	record := map[string]interface{}{
+		"timeUnixNano":         now,
+		"observedTimeUnixNano": now,
+		"severityNumber":       float64(severityNumber(level)),
+		"severityText":         level.String(),
+		"body":                 map[string]interface{}{"stringValue": message},
+		"attributes":           attributes,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.logs) >= maxBuffered {
+		Dropped.Inc("logs")
+		return
+	}
+	r.logs = append(r.logs, record)
+}
+
+// RecordSpan buffers one ingest span
+func (r *Recorder) RecordSpan(s Span) {
+	attributes := make([]interface{}, 0, len(s.Attributes))
+	for key, value := range s.Attributes {
+		attributes = append(attributes, stringAttr(key, value))
+	}
+	status := map[string]interface{}{"code": float64(1)} // STATUS_CODE_OK
+	if s.Error {
+		status["code"] = float64(2) // STATUS_CODE_ERROR
+	}
+	span := map[string]interface{}{
+		"traceId":           randomHex(16),
+		"spanId":            randomHex(8),
+		"name":              s.Name,
+		"kind":              float64(2), // SPAN_KIND_SERVER
+		"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+		"attributes":        attributes,
+		"status":            status,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.spans) >= maxBuffered {
+		Dropped.Inc("traces")
+		return
+	}
+	r.spans = append(r.spans, span)
+}
+
+// Flush writes the buffered log lines and spans and a snapshot of the
+// collector's metrics to the main database
+func (r *Recorder) Flush() {
+	r.mu.Lock()
+	logs, spans := r.logs, r.spans
+	r.logs, r.spans = nil, nil
+	r.mu.Unlock()
+
+	conn := database.DB()
+	if conn == nil {
+		return
+	}
+	if len(logs) > 0 {
+		r.report("logs", database.InsertUnobserved(conn, database.SignalLogs, map[string]interface{}{
+			"resourceLogs": []interface{}{map[string]interface{}{
+				"resource":  r.resource,
+				"scopeLogs": []interface{}{map[string]interface{}{"scope": r.scope, "logRecords": logs}},
+			}},
+		}))
+	}
+	if len(spans) > 0 {
+		r.report("traces", database.InsertUnobserved(conn, database.SignalTraces, map[string]interface{}{
+			"resourceSpans": []interface{}{map[string]interface{}{
+				"resource":   r.resource,
+				"scopeSpans": []interface{}{map[string]interface{}{"scope": r.scope, "spans": spans}},
+			}},
+		}))
+	}
+	metrics := metricsSnapshot(stats.Default.Gather(), time.Now())
+	if len(metrics) > 0 {
+		r.report("metrics", database.InsertUnobserved(conn, database.SignalMetrics, map[string]interface{}{
+			"resourceMetrics": []interface{}{map[string]interface{}{
+				"resource":     r.resource,
+				"scopeMetrics": []interface{}{map[string]interface{}{"scope": r.scope, "metrics": metrics}},
+			}},
+		}))
+	}
+}
+
+// report logs a failed flush without capturing the log line itself
+func (r *Recorder) report(signal string, err error) {
+	if err != nil {
+		r.log.Error("Failed to store self-telemetry", "signal", signal, "error", err)
+	}
+}
+
+// metricsSnapshot converts gathered metric families to OTLP metrics
+func metricsSnapshot(families []stats.Family, now time.Time) []interface{} {
+	start := strconv.FormatInt(stats.StartTime().UnixNano(), 10)
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+
+	var metrics []interface{}
+	for _, f := range families {
+		if len(f.Samples) == 0 {
+			continue
+		}
+		points := make([]interface{}, 0, len(f.Samples))
+		for _, s := range f.Samples {
+			attributes := make([]interface{}, 0, len(s.Labels))
+			for _, l := range s.Labels {
+				attributes = append(attributes, stringAttr(l.Name, l.Value))
+			}
+			point := map[string]interface{}{
+				"attributes":        attributes,
+				"startTimeUnixNano": start,
+				"timeUnixNano":      timestamp,
+			}
+			if f.Type == stats.TypeHistogram {
+				// OTLP bucket counts are per bucket, not cumulative
+				counts := make([]interface{}, 0, len(s.Buckets)+1)
+				bounds := make([]interface{}, 0, len(f.Bounds))
+				var previous uint64
+				for i, cumulative := range s.Buckets {
+					counts = append(counts, strconv.FormatUint(cumulative-previous, 10))
+					bounds = append(bounds, f.Bounds[i])
+					previous = cumulative
+				}
+				counts = append(counts, strconv.FormatUint(s.Count-previous, 10))
+				point["count"] = strconv.FormatUint(s.Count, 10)
+				point["sum"] = s.Sum
+				point["bucketCounts"] = counts
+				point["explicitBounds"] = bounds
+			} else {
+				point["asDouble"] = s.Value
+			}
+			points = append(points, point)
+		}
+
+		metric := map[string]interface{}{"name": f.Name, "description": f.Help}
+		switch f.Type {
+		case stats.TypeCounter:
+			metric["sum"] = map[string]interface{}{
+				"dataPoints":             points,
+				"aggregationTemporality": float64(2), // CUMULATIVE
+				"isMonotonic":            true,
+			}
+		case stats.TypeHistogram:
+			metric["histogram"] = map[string]interface{}{
+				"dataPoints":             points,
+				"aggregationTemporality": float64(2),
+			}
+		default:
+			metric["gauge"] = map[string]interface{}{"dataPoints": points}
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// severityNumber maps a log level to the OTLP severity number
+func severityNumber(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 17
+	case level >= slog.LevelWarn:
+		return 13
+	case level >= slog.LevelInfo:
+		return 9
+	default:
+		return 5 // DEBUG
+	}
+}
+
+func stringAttr(key, value string) map[string]interface{} {
+	return map[string]interface{}{"key": key, "value": map[string]interface{}{"stringValue": value}}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
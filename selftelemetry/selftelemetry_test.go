@@ -0,0 +1,97 @@
+package selftelemetry
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+	"github.com/RedShiftVelocity/sqlite-otel/stats"
+)
+
+func TestRecorderFlush(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "self.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+
+	stats.RecordsStored.Add(3, "traces")
+
+	r := New(time.Hour, "test")
+	r.Start()
+	logging.Info("hello from the collector")
+	RecordSpan(Span{Name: "POST /v1/traces", Start: time.Now(), End: time.Now(), Attributes: map[string]string{"signal": "traces"}})
+	r.Stop()
+
+	// Logging after Stop must not be captured
+	logging.Info("not captured")
+	r.Flush()
+
+	conn := database.DB()
+	queries := map[string]string{
+		"log_records": `SELECT COUNT(*) FROM log_records l JOIN resources r ON r.id = l.resource_id
+			WHERE r.attributes LIKE '%sqlite-otel-collector%' AND l.body LIKE '%hello from the collector%'`,
+		"spans": `SELECT COUNT(*) FROM spans s JOIN resources r ON r.id = s.resource_id
+			WHERE r.attributes LIKE '%sqlite-otel-collector%' AND s.name = 'POST /v1/traces'`,
+		"metrics": `SELECT COUNT(*) FROM metrics WHERE name = 'sqlite_otel_records_stored_total'`,
+	}
+	for table, query := range queries {
+		var count int
+		if err := conn.QueryRow(query).Scan(&count); err != nil {
+			t.Fatalf("%s: %v", table, err)
+		}
+		if count < 1 {
+			t.Errorf("Expected self-telemetry in %s", table)
+		}
+	}
+
+	var captured int
+	conn.QueryRow(`SELECT COUNT(*) FROM log_records WHERE body LIKE '%not captured%'`).Scan(&captured)
+	if captured != 0 {
+		t.Error("Log line after Stop was captured")
+	}
+}
+
+func TestRecorderSkipsOnlyItsOwnLogsAndStats(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "self.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+
+	stored := func() float64 {
+		for _, f := range stats.Default.Gather() {
+			if f.Name != "sqlite_otel_records_stored_total" {
+				continue
+			}
+			var total float64
+			for _, s := range f.Samples {
+				total += s.Value
+			}
+			return total
+		}
+		return 0
+	}
+
+	r := New(time.Hour, "test")
+	r.Start()
+	r.report("logs", errors.New("disk on fire"))
+	logging.Info("logged elsewhere")
+	before := stored()
+	r.Stop()
+
+	if after := stored(); after != before {
+		t.Errorf("Self-telemetry inserts counted as ingested records: %v -> %v", before, after)
+	}
+	conn := database.DB()
+	var own, other int
+	conn.QueryRow(`SELECT COUNT(*) FROM log_records WHERE body LIKE '%Failed to store self-telemetry%'`).Scan(&own)
+	conn.QueryRow(`SELECT COUNT(*) FROM log_records WHERE body LIKE '%logged elsewhere%'`).Scan(&other)
+	if own != 0 {
+		t.Error("Recorder's own log line was captured")
+	}
+	if other != 1 {
+		t.Errorf("Expected the other log line to be captured once, got %d", other)
+	}
+}
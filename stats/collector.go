@@ -0,0 +1,96 @@
+package stats
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// Default is the registry holding the collector's own metrics
+var Default = NewRegistry()
+
+// Metrics instrumented by the ingestion path
+var (
+	RequestsTotal = Default.NewCounterVec("sqlite_otel_http_requests_total",
+		"OTLP ingestion requests by signal and HTTP status code.", "signal", "code")
+	RequestDuration = Default.NewHistogramVec("sqlite_otel_http_request_duration_seconds",
+		"Time spent handling OTLP ingestion requests.", DefaultBuckets, "signal")
+	RequestBytes = Default.NewCounterVec("sqlite_otel_http_request_bytes_total",
+		"Request body bytes received by signal.", "signal")
+	RejectedBatches = Default.NewCounterVec("sqlite_otel_rejected_batches_total",
+		"Ingestion requests rejected before being stored, by signal and reason.", "signal", "reason")
+	InFlightRequests = Default.NewGauge("sqlite_otel_in_flight_requests",
+		"Ingestion requests currently being processed or waiting for the database.")
+
+	RecordsStored = Default.NewCounterVec("sqlite_otel_records_stored_total",
+		"Spans, log records and metric data points committed to SQLite.", "signal")
+	Inserts = Default.NewCounterVec("sqlite_otel_db_inserts_total",
+		"Database insert transactions by signal and status (ok or error).", "signal", "status")
+	InsertDuration = Default.NewHistogramVec("sqlite_otel_db_insert_duration_seconds",
+		"Duration of database insert transactions.", DefaultBuckets, "signal", "status")
+)
+
+// startTime is when the process started collecting metrics
+var startTime = time.Now()
+
+// StartTime returns when the process started collecting metrics
+func StartTime() time.Time {
+	return startTime
+}
+
+func init() {
+	Default.NewGaugeFunc("process_start_time_seconds", "Start time of the process since the Unix epoch in seconds.", func() float64 {
+		return float64(startTime.UnixNano()) / 1e9
+	})
+	Default.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	Default.NewFunc("go_info", "Information about the Go environment.", TypeGauge, func() []Sample {
+		return []Sample{{Labels: []Label{{"version", runtime.Version()}}, Value: 1}}
+	})
+
+	memStats := func(fn func(m *runtime.MemStats) float64) func() float64 {
+		return func() float64 {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			return fn(&m)
+		}
+	}
+	Default.NewGaugeFunc("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.",
+		memStats(func(m *runtime.MemStats) float64 { return float64(m.Alloc) }))
+	Default.NewGaugeFunc("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.",
+		memStats(func(m *runtime.MemStats) float64 { return float64(m.HeapInuse) }))
+	Default.NewGaugeFunc("go_memstats_sys_bytes", "Number of bytes obtained from the system.",
+		memStats(func(m *runtime.MemStats) float64 { return float64(m.Sys) }))
+	Default.NewFunc("go_gc_cycles_total", "Number of completed GC cycles.", TypeCounter, func() []Sample {
+		return []Sample{{Value: memStats(func(m *runtime.MemStats) float64 { return float64(m.NumGC) })()}}
+	})
+	Default.NewFunc("go_gc_pause_seconds_total", "Total time spent in GC stop-the-world pauses.", TypeCounter, func() []Sample {
+		return []Sample{{Value: memStats(func(m *runtime.MemStats) float64 { return float64(m.PauseTotalNs) / 1e9 })()}}
+	})
+}
+
+// ObserveInsert records the outcome of one database insert transaction
+func ObserveInsert(signal string, start time.Time, records int64, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	Inserts.Inc(signal, status)
+	InsertDuration.Observe(time.Since(start).Seconds(), signal, status)
+	if err == nil {
+		RecordsStored.Add(float64(records), signal)
+	}
+}
+
+// Handler serves the default registry in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.WriteText(w)
+	})
+}
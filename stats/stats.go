@@ -0,0 +1,325 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types as written in the Prometheus text format
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefaultBuckets are the upper bounds in seconds used for latency histograms
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Label is a single label name and value
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one labelled value of a metric family. Histogram samples carry
+// cumulative bucket counts, the observation count and the sum.
+type Sample struct {
+	Labels  []Label
+	Value   float64
+	Buckets []uint64 // Cumulative counts per upper bound (histograms only)
+	Count   uint64   // Number of observations (histograms only)
+	Sum     float64  // Sum of observations (histograms only)
+}
+
+// Family is a metric with all of its samples
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Bounds  []float64 // Histogram upper bounds
+	Samples []Sample
+}
+
+// collector produces a metric family when the registry is gathered
+type collector interface {
+	gather() Family
+}
+
+// Registry holds metric families in registration order
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// register adds a collector, panicking on duplicate names like flag does
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("stats: metric %s registered twice", name))
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// Gather returns a snapshot of every registered metric family
+func (r *Registry) Gather() []Family {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	families := make([]Family, 0, len(collectors))
+	for _, c := range collectors {
+		f := c.gather()
+		sort.Slice(f.Samples, func(i, j int) bool {
+			return labelKey(f.Samples[i].Labels) < labelKey(f.Samples[j].Labels)
+		})
+		families = append(families, f)
+	}
+	return families
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.Gather() {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, f.Type)
+		for _, s := range f.Samples {
+			if f.Type != TypeHistogram {
+				fmt.Fprintf(bw, "%s%s %s\n", f.Name, formatLabels(s.Labels), formatValue(s.Value))
+				continue
+			}
+			for i, bound := range f.Bounds {
+				labels := append(append([]Label(nil), s.Labels...), Label{"le", formatValue(bound)})
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", f.Name, formatLabels(labels), s.Buckets[i])
+			}
+			labels := append(append([]Label(nil), s.Labels...), Label{"le", "+Inf"})
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", f.Name, formatLabels(labels), s.Count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", f.Name, formatLabels(s.Labels), formatValue(s.Sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", f.Name, formatLabels(s.Labels), s.Count)
+		}
+	}
+	return bw.Flush()
+}
+
+// labelKey joins label values into a map key
+func labelKey(labels []Label) string {
+	values := make([]string, len(labels))
+	for i, l := range labels {
+		values[i] = l.Value
+	}
+	return strings.Join(values, "\xff")
+}
+
+// makeLabels pairs label names with values
+func makeLabels(names, values []string) []Label {
+	if len(names) != len(values) {
+		panic(fmt.Sprintf("stats: expected %d label values, got %d", len(names), len(values)))
+	}
+	labels := make([]Label, len(names))
+	for i := range names {
+		labels[i] = Label{names[i], values[i]}
+	}
+	return labels
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = l.Name + `="` + escapeLabel(l.Value) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+// CounterVec is a monotonically increasing value per label combination
+type CounterVec struct {
+	name, help string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]*Sample
+}
+
+// NewCounterVec registers a counter with the given label names
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labelNames: labelNames, values: make(map[string]*Sample)}
+	r.register(name, c)
+	return c
+}
+
+// Add increases the counter for the label values by v
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	labels := makeLabels(c.labelNames, labelValues)
+	key := labelKey(labels)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.values[key]
+	if !ok {
+		s = &Sample{Labels: labels}
+		c.values[key] = s
+	}
+	s.Value += v
+}
+
+// Inc increases the counter for the label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) gather() Family {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := Family{Name: c.name, Help: c.help, Type: TypeCounter}
+	for _, s := range c.values {
+		f.Samples = append(f.Samples, *s)
+	}
+	return f
+}
+
+// Gauge is a single value that can go up and down
+type Gauge struct {
+	name, help string
+
+	mu    sync.Mutex
+	value float64
+}
+
+// NewGauge registers a gauge without labels
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	r.register(name, g)
+	return g
+}
+
+// Add changes the gauge by v
+func (g *Gauge) Add(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value += v
+}
+
+// Set replaces the gauge value
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = v
+}
+
+// Value returns the current gauge value
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+func (g *Gauge) gather() Family {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return Family{Name: g.name, Help: g.help, Type: TypeGauge, Samples: []Sample{{Value: g.value}}}
+}
+
+// HistogramVec counts observations into buckets per label combination
+type HistogramVec struct {
+	name, help string
+	labelNames []string
+	bounds     []float64
+
+	mu     sync.Mutex
+	values map[string]*Sample
+}
+
+// NewHistogramVec registers a histogram with the given upper bounds
+func (r *Registry) NewHistogramVec(name, help string, bounds []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labelNames: labelNames, bounds: bounds, values: make(map[string]*Sample)}
+	r.register(name, h)
+	return h
+}
+
+// Observe records one observation for the label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	labels := makeLabels(h.labelNames, labelValues)
+	key := labelKey(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.values[key]
+	if !ok {
+		s = &Sample{Labels: labels, Buckets: make([]uint64, len(h.bounds))}
+		h.values[key] = s
+	}
+	for i, bound := range h.bounds {
+		if v <= bound {
+			s.Buckets[i]++
+		}
+	}
+	s.Count++
+	s.Sum += v
+}
+
+func (h *HistogramVec) gather() Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f := Family{Name: h.name, Help: h.help, Type: TypeHistogram, Bounds: h.bounds}
+	for _, s := range h.values {
+		copied := *s
+		copied.Buckets = append([]uint64(nil), s.Buckets...)
+		f.Samples = append(f.Samples, copied)
+	}
+	return f
+}
+
+// funcCollector computes its samples when gathered
+type funcCollector struct {
+	name, help, typ string
+	fn              func() []Sample
+}
+
+func (c *funcCollector) gather() Family {
+	return Family{Name: c.name, Help: c.help, Type: c.typ, Samples: c.fn()}
+}
+
+// NewFunc registers a counter or gauge whose samples are computed by fn at
+// collection time
+func (r *Registry) NewFunc(name, help, typ string, fn func() []Sample) {
+	r.register(name, &funcCollector{name: name, help: help, typ: typ, fn: fn})
+}
+
+// NewGaugeFunc registers an unlabelled gauge computed by fn
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.NewFunc(name, help, TypeGauge, func() []Sample {
+		return []Sample{{Value: fn()}}
+	})
+}
@@ -0,0 +1,51 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests.", "signal", "code")
+	latency := r.NewHistogramVec("test_duration_seconds", "Latency.", []float64{0.1, 1}, "signal")
+	r.NewGaugeFunc("test_size_bytes", "Size.", func() float64 { return 42 })
+
+	requests.Inc("traces", "200")
+	requests.Inc("traces", "200")
+	requests.Inc("logs", "429")
+	latency.Observe(0.05, "traces")
+	latency.Observe(0.5, "traces")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{signal="logs",code="429"} 1` + "\n",
+		`test_requests_total{signal="traces",code="200"} 2` + "\n",
+		`test_duration_seconds_bucket{signal="traces",le="0.1"} 1` + "\n",
+		`test_duration_seconds_bucket{signal="traces",le="1"} 2` + "\n",
+		`test_duration_seconds_bucket{signal="traces",le="+Inf"} 2` + "\n",
+		`test_duration_seconds_sum{signal="traces"} 0.55` + "\n",
+		`test_duration_seconds_count{signal="traces"} 2` + "\n",
+		"test_size_bytes 42\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Missing %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_total", "Test.", "key").Inc("a\"b\\c\nd")
+
+	var b strings.Builder
+	r.WriteText(&b)
+	if !strings.Contains(b.String(), `test_total{key="a\"b\\c\nd"} 1`) {
+		t.Errorf("Label value not escaped:\n%s", b.String())
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+)
+
+// tailRetryDelay is the wait before reconnecting a dropped tail stream
+const tailRetryDelay = 2 * time.Second
+
+// maxTailEvent is the largest event the tail client accepts
+const maxTailEvent = 16 << 20
+
+// ANSI colours used by the tail client
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorGreen  = "\033[32m"
+	colorBlue   = "\033[34m"
+	colorCyan   = "\033[36m"
+	colorGray   = "\033[90m"
+)
+
+// tailOptions holds the parsed arguments of the tail subcommand
+type tailOptions struct {
+	url    string // Full URL of the tail endpoint including the filters
+	header http.Header
+	color  bool
+	raw    bool // Print event JSON instead of formatted lines
+}
+
+// tailRecord is an event of the tail endpoint
+type tailRecord struct {
+	Tenant  string          `json:"tenant"`
+	Signal  string          `json:"signal"`
+	Service string          `json:"service"`
+	Record  json.RawMessage `json:"record"`
+}
+
+// runTail implements the tail subcommand
+func runTail(args []string) int {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s tail [options]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Print telemetry as a running collector stores it.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	endpoint := fs.String("endpoint", "http://localhost:4318", "Base URL of the collector")
+	header := headerFlag{}
+	fs.Var(header, "header", "Request header as 'Name: value', may be repeated")
+	signals := fs.String("signal", "", "Comma separated signals to show: traces, metrics, logs (default: all)")
+	service := fs.String("service", "", "Only records whose service.name resource attribute matches")
+	traceID := fs.String("trace-id", "", "Only spans and logs of this trace")
+	severity := fs.String("severity", "", "Only logs at or above this severity: trace, debug, info, warn, error, fatal or a number")
+	noColor := fs.Bool("no-color", false, "Do not color the output (default when it is not a terminal or NO_COLOR is set)")
+	raw := fs.Bool("json", false, "Print each event as a JSON line")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+
+	list, err := parseSignals(*signals)
+	if err != nil {
+		return usageError(fs, "-signal", err)
+	}
+	if *severity != "" {
+		if _, err := database.ParseSeverity(*severity); err != nil {
+			return usageError(fs, "-severity", err)
+		}
+	}
+	base, err := url.Parse(*endpoint)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return usageError(fs, "-endpoint", fmt.Errorf("expected an http or https URL"))
+	}
+	query := url.Values{}
+	query.Set("signal", strings.Join(list, ","))
+	for name, value := range map[string]string{"service": *service, "trace_id": *traceID, "min_severity": *severity} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/api/v1/tail"
+	base.RawQuery = query.Encode()
+
+	opts := tailOptions{
+		url:    base.String(),
+		header: http.Header(header),
+		color:  !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout),
+		raw:    *raw,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := tail(ctx, opts, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "tail: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// tail prints events until ctx is done, reconnecting when the stream ends
+// or the collector is unavailable. Errors the collector will keep
+// returning, such as a rejected token, end the command.
+func tail(ctx context.Context, opts tailOptions, w io.Writer) error {
+	connected := false
+	for {
+		err := tailOnce(ctx, opts, w, func() {
+			fmt.Fprintf(os.Stderr, "Connected to %s\n", opts.url)
+			connected = true
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		var status *tailStatusError
+		if errors.As(err, &status) && status.code != http.StatusServiceUnavailable && status.code != http.StatusTooManyRequests {
+			return err
+		}
+		if connected {
+			fmt.Fprintf(os.Stderr, "Stream ended, reconnecting: %v\n", err)
+		}
+		connected = false
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(tailRetryDelay):
+		}
+	}
+}
+
+// tailStatusError is an error response of the tail endpoint
+type tailStatusError struct {
+	code    int
+	message string
+}
+
+func (e *tailStatusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.code, http.StatusText(e.code), e.message)
+}
+
+// tailOnce reads one stream until it ends
+func tailOnce(ctx context.Context, opts tailOptions, w io.Writer, onConnect func()) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, opts.url, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range opts.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &tailStatusError{code: resp.StatusCode, message: strings.TrimSpace(string(body))}
+	}
+	onConnect()
+	err = readEvents(resp.Body, func(event string, data []byte) error {
+		return printTailEvent(w, event, data, opts)
+	})
+	if err == nil {
+		err = errors.New("the collector closed the stream")
+	}
+	return err
+}
+
+// readEvents parses a Server-Sent Events stream, calling fn for each event
+func readEvents(r io.Reader, fn func(event string, data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxTailEvent)
+	event := ""
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() > 0 {
+				if event == "" {
+					event = "message"
+				}
+				if err := fn(event, bytes.TrimSuffix(data.Bytes(), []byte("\n"))); err != nil {
+					return err
+				}
+			}
+			event = ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// Comment, sent to keep the connection alive
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				data.WriteString(value)
+				data.WriteByte('\n')
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// printTailEvent writes one event as a line
+func printTailEvent(w io.Writer, event string, data []byte, opts tailOptions) error {
+	if event == "dropped" {
+		var dropped struct {
+			Dropped int64 `json:"dropped"`
+		}
+		json.Unmarshal(data, &dropped)
+		fmt.Fprintf(os.Stderr, "Missed %d events because output was too slow\n", dropped.Dropped)
+		return nil
+	}
+	if opts.raw {
+		_, err := fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	var rec tailRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return fmt.Errorf("invalid event: %w", err)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(rec.Record, &record); err != nil {
+		return fmt.Errorf("invalid event: %w", err)
+	}
+
+	var stamp int64
+	var label, color, text string
+	switch rec.Signal {
+	case database.SignalLogs:
+		stamp = jsonNano(record["timeUnixNano"])
+		if stamp == 0 {
+			stamp = jsonNano(record["observedTimeUnixNano"])
+		}
+		number := jsonNano(record["severityNumber"])
+		label, _ = record["severityText"].(string)
+		if label == "" {
+			label = database.SeverityName(number)
+		}
+		label = strings.ToUpper(label)
+		color = severityColor(number)
+		body, _ := record["body"].(map[string]interface{})
+		text = formatCell(decodeAnyValue(body), true)
+	case database.SignalTraces:
+		stamp = jsonNano(record["startTimeUnixNano"])
+		label, color = "SPAN", colorCyan
+		name, _ := record["name"].(string)
+		duration := time.Duration(jsonNano(record["endTimeUnixNano"]) - stamp)
+		text = fmt.Sprintf("%s %s", name, duration)
+		if status, ok := record["status"].(map[string]interface{}); ok && jsonNano(status["code"]) == 2 {
+			color = colorRed
+			text += " ERROR"
+			if message, _ := status["message"].(string); message != "" {
+				text += ": " + message
+			}
+		}
+	case database.SignalMetrics:
+		label, color = "METRIC", colorBlue
+		stamp, text = metricSummary(record)
+	default:
+		label, color = strings.ToUpper(rec.Signal), ""
+	}
+
+	when := time.Now()
+	if stamp > 0 {
+		when = time.Unix(0, stamp)
+	}
+	if raw, ok := record["attributes"]; ok {
+		encoded, _ := json.Marshal(raw)
+		if attrs := decodeAttributes(encoded); attrs != nil {
+			text += " " + formatCell(attrs, true)
+		}
+	}
+	if id, _ := record["traceId"].(string); id != "" {
+		text += " trace_id=" + id
+	}
+	service := rec.Service
+	if rec.Tenant != "" && rec.Tenant != database.DefaultTenant {
+		service = rec.Tenant + "/" + service
+	}
+
+	line := fmt.Sprintf("%s %-6s %s %s", when.Local().Format("15:04:05.000"), label, service, text)
+	if opts.color && color != "" {
+		line = color + line + colorReset
+	}
+	_, err := fmt.Fprintln(w, line)
+	return err
+}
+
+// severityColor picks the color of a log line
+func severityColor(n int64) string {
+	switch {
+	case n >= 17:
+		return colorRed
+	case n >= 13:
+		return colorYellow
+	case n >= 9:
+		return colorGreen
+	case n > 0:
+		return colorGray
+	}
+	return ""
+}
+
+// metricSummary describes the latest data point of a metric
+func metricSummary(metric map[string]interface{}) (int64, string) {
+	name, _ := metric["name"].(string)
+	for _, kind := range []string{"gauge", "sum", "histogram", "exponentialHistogram", "summary"} {
+		body, ok := metric[kind].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		points, _ := body["dataPoints"].([]interface{})
+		if len(points) == 0 {
+			return 0, fmt.Sprintf("%s %s", name, kind)
+		}
+		point, _ := points[len(points)-1].(map[string]interface{})
+		var value string
+		switch {
+		case point["asDouble"] != nil:
+			value = fmt.Sprint(point["asDouble"])
+		case point["asInt"] != nil:
+			value = fmt.Sprint(point["asInt"])
+		default:
+			value = fmt.Sprintf("count=%v sum=%v", point["count"], point["sum"])
+		}
+		text := fmt.Sprintf("%s %s %s", name, kind, value)
+		if len(points) > 1 {
+			text += fmt.Sprintf(" (%d points)", len(points))
+		}
+		return jsonNano(point["timeUnixNano"]), text
+	}
+	return 0, name
+}
+
+// jsonNano reads an OTLP JSON integer, which may be encoded as a string
+func jsonNano(v interface{}) int64 {
+	switch n := v.(type) {
+	case float64:
+		return int64(n)
+	case string:
+		i, _ := strconv.ParseInt(n, 10, 64)
+		return i
+	}
+	return 0
+}
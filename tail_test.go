@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTailPrintsEvents(t *testing.T) {
+	stream := strings.Join([]string{
+		": connected",
+		"",
+		"event: logs",
+		`data: {"tenant":"default","signal":"logs","service":"checkout","record":{"timeUnixNano":"1700000000000000000",`,
+		`data: "severityNumber":17,"body":{"stringValue":"payment failed"},"traceId":"0102"}}`,
+		"",
+		": ping",
+		"",
+		"event: traces",
+		`data: {"tenant":"payments","signal":"traces","service":"api","record":{"name":"GET /","startTimeUnixNano":"1700000000000000000",`,
+		`data: "endTimeUnixNano":"1700000000250000000","status":{"code":2,"message":"timeout"}}}`,
+		"",
+		"",
+	}, "\n")
+
+	var out bytes.Buffer
+	err := readEvents(strings.NewReader(stream), func(event string, data []byte) error {
+		return printTailEvent(&out, event, data, tailOptions{color: true})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected two lines, got %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], colorRed) || !strings.Contains(lines[0], "ERROR  checkout payment failed trace_id=0102") {
+		t.Errorf("Unexpected log line %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "SPAN   payments/api GET / 250ms ERROR: timeout") {
+		t.Errorf("Unexpected span line %q", lines[1])
+	}
+}
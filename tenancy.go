@@ -0,0 +1,62 @@
+package main
+
+import (
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/config"
+	"github.com/RedShiftVelocity/sqlite-otel/database"
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+)
+
+// tenantPolicies combines the flag defaults with per-tenant overrides from
+// the configuration file
+func tenantPolicies(opts *serverOptions, cfg *config.Config) (database.TenantPolicy, map[string]database.TenantPolicy) {
+	defaultPolicy := database.TenantPolicy{
+		Retention:    opts.retention,
+		MaxSizeBytes: opts.maxDBSizeMB * 1024 * 1024,
+	}
+
+	policies := make(map[string]database.TenantPolicy, len(cfg.Tenants))
+	for tenant, tc := range cfg.Tenants {
+		policy := defaultPolicy
+		if tc.Retention != nil {
+			policy.Retention = time.Duration(*tc.Retention)
+		}
+		if tc.MaxSizeMB != nil {
+			policy.MaxSizeBytes = *tc.MaxSizeMB * 1024 * 1024
+		}
+		policies[tenant] = policy
+	}
+	return defaultPolicy, policies
+}
+
+// startRetention purges expired data now and then every interval until the
+// returned stop function is called
+func startRetention(tenants *database.TenantManager, interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			tenants.ApplyRetention(time.Now())
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	logging.Debug("Retention runs every %s", interval)
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
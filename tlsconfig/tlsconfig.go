@@ -0,0 +1,215 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedShiftVelocity/sqlite-otel/logging"
+)
+
+// DefaultReloadInterval is how often certificate files are checked for changes
+const DefaultReloadInterval = 30 * time.Second
+
+// Options defines the TLS settings for the OTLP receivers
+type Options struct {
+	CertFile          string        // PEM encoded server certificate (chain)
+	KeyFile           string        // PEM encoded private key for CertFile
+	ClientCAFile      string        // PEM encoded CA bundle used to verify client certificates
+	RequireClientCert bool          // Reject clients that do not present a valid certificate
+	MinVersion        string        // Minimum TLS version: "1.0", "1.1", "1.2" or "1.3"
+	ReloadInterval    time.Duration // How often to check files for changes (default: 30s)
+}
+
+// Enabled reports whether TLS has been requested
+func (o Options) Enabled() bool {
+	return o.CertFile != "" || o.KeyFile != ""
+}
+
+// Validate checks the options for inconsistent combinations
+func (o Options) Validate() error {
+	if o.CertFile == "" || o.KeyFile == "" {
+		return fmt.Errorf("both a certificate and a key file are required for TLS")
+	}
+	if o.RequireClientCert && o.ClientCAFile == "" {
+		return fmt.Errorf("requiring client certificates needs a client CA file")
+	}
+	if _, err := ParseMinVersion(o.MinVersion); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ParseMinVersion converts a version string such as "1.2" to its crypto/tls constant
+func ParseMinVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(version)), "tls") {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version '%s' (expected 1.0, 1.1, 1.2 or 1.3)", version)
+	}
+}
+
+// fileState records what a watched file looked like when it was last loaded
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader serves the current certificate and client CA pool and reloads
+// them from disk when the underlying files change, without a restart
+type Reloader struct {
+	opts       Options
+	minVersion uint16
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	files     map[string]fileState
+	lastCheck time.Time
+}
+
+// New loads the configured certificate files and returns a Reloader
+func New(opts Options) (*Reloader, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.ReloadInterval <= 0 {
+		opts.ReloadInterval = DefaultReloadInterval
+	}
+	minVersion, _ := ParseMinVersion(opts.MinVersion)
+
+	r := &Reloader{
+		opts:       opts,
+		minVersion: minVersion,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns a server configuration backed by the reloader
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: r.minVersion,
+		// Build the effective configuration per handshake so a reloaded
+		// client CA bundle takes effect for new connections
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.maybeReload()
+			return r.currentConfig(), nil
+		},
+	}
+}
+
+// currentConfig builds a configuration from the currently loaded material
+func (r *Reloader) currentConfig() *tls.Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cfg := &tls.Config{
+		MinVersion:   r.minVersion,
+		Certificates: []tls.Certificate{*r.cert},
+	}
+	if r.clientCAs != nil {
+		cfg.ClientCAs = r.clientCAs
+		if r.opts.RequireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return cfg
+}
+
+// maybeReload reloads certificate material if any watched file changed.
+// Files are checked at most once per ReloadInterval.
+func (r *Reloader) maybeReload() {
+	r.mu.RLock()
+	due := time.Since(r.lastCheck) >= r.opts.ReloadInterval
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	r.mu.Lock()
+	r.lastCheck = time.Now()
+	changed := false
+	for path, prev := range r.files {
+		stat, err := os.Stat(path)
+		if err != nil {
+			// A missing file is usually a renewal in progress; keep serving
+			// the old material and check again later
+			continue
+		}
+		if !stat.ModTime().Equal(prev.modTime) || stat.Size() != prev.size {
+			changed = true
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if err := r.load(); err != nil {
+		logging.Error("Failed to reload TLS certificates, keeping previous ones: %v", err)
+		return
+	}
+	logging.Info("Reloaded TLS certificates from %s", r.opts.CertFile)
+}
+
+// Reload unconditionally reloads the certificate files from disk
+func (r *Reloader) Reload() error {
+	return r.load()
+}
+
+// load reads the certificate, key and client CA files and swaps them in
+func (r *Reloader) load() error {
+	files := make(map[string]fileState)
+	for _, path := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		files[path] = fileState{modTime: stat.ModTime(), size: stat.Size()}
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		pemData, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemData) {
+			return fmt.Errorf("no certificates found in client CA file %s", r.opts.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.files = files
+	r.lastCheck = time.Now()
+	return nil
+}
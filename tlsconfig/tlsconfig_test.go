@@ -0,0 +1,164 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSigned writes a self-signed certificate and key for commonName
+func writeSelfSigned(t *testing.T, certPath, keyPath, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certPath, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// servedCommonName returns the subject CN of the certificate served for a new handshake
+func servedCommonName(t *testing.T, r *Reloader) string {
+	t.Helper()
+
+	cfg, err := r.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestParseMinVersion(t *testing.T) {
+	tests := map[string]uint16{
+		"":       tls.VersionTLS12,
+		"1.2":    tls.VersionTLS12,
+		"1.3":    tls.VersionTLS13,
+		"TLS1.3": tls.VersionTLS13,
+		"1.0":    tls.VersionTLS10,
+	}
+	for input, expected := range tests {
+		got, err := ParseMinVersion(input)
+		if err != nil {
+			t.Errorf("ParseMinVersion(%q) returned error: %v", input, err)
+			continue
+		}
+		if got != expected {
+			t.Errorf("ParseMinVersion(%q) = %x, expected %x", input, got, expected)
+		}
+	}
+
+	if _, err := ParseMinVersion("2.0"); err == nil {
+		t.Error("Expected error for unsupported version")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Options{CertFile: "cert.pem"}).Validate(); err == nil {
+		t.Error("Expected error when key file is missing")
+	}
+	if err := (Options{CertFile: "cert.pem", KeyFile: "key.pem", RequireClientCert: true}).Validate(); err == nil {
+		t.Error("Expected error when requiring client certificates without a CA")
+	}
+}
+
+func TestCertificateReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	certPath := filepath.Join(tmpDir, "cert.pem")
+	keyPath := filepath.Join(tmpDir, "key.pem")
+	writeSelfSigned(t, certPath, keyPath, "first")
+
+	r, err := New(Options{
+		CertFile:       certPath,
+		KeyFile:        keyPath,
+		ReloadInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cn := servedCommonName(t, r); cn != "first" {
+		t.Fatalf("Expected initial certificate CN 'first', got '%s'", cn)
+	}
+
+	// Replace the files and make sure the modification time moves forward
+	writeSelfSigned(t, certPath, keyPath, "second")
+	future := time.Now().Add(2 * time.Second)
+	os.Chtimes(certPath, future, future)
+	os.Chtimes(keyPath, future, future)
+	time.Sleep(5 * time.Millisecond)
+
+	if cn := servedCommonName(t, r); cn != "second" {
+		t.Errorf("Expected reloaded certificate CN 'second', got '%s'", cn)
+	}
+}
+
+func TestClientAuthConfiguration(t *testing.T) {
+	tmpDir := t.TempDir()
+	certPath := filepath.Join(tmpDir, "cert.pem")
+	keyPath := filepath.Join(tmpDir, "key.pem")
+	caPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "ca-key.pem")
+	writeSelfSigned(t, certPath, keyPath, "server")
+	writeSelfSigned(t, caPath, caKeyPath, "client-ca")
+
+	r, err := New(Options{
+		CertFile:          certPath,
+		KeyFile:           keyPath,
+		ClientCAFile:      caPath,
+		RequireClientCert: true,
+		MinVersion:        "1.3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := r.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("Expected RequireAndVerifyClientCert, got %v", cfg.ClientAuth)
+	}
+	if cfg.ClientCAs == nil {
+		t.Error("Expected client CA pool to be configured")
+	}
+	if cfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("Expected TLS 1.3 minimum, got %x", cfg.MinVersion)
+	}
+}
@@ -0,0 +1,663 @@
+'use strict';
+
+// The UI is served under /ui/, the API under /api/v1/ of the same collector
+const API_BASE = new URL('../api/v1/', location.href);
+const SETTINGS_KEY = 'sqlite-otel-ui';
+const PAGE_LIMIT = 200;
+const MAX_LIMIT = 1000;
+
+const SEVERITIES = [
+  { name: 'All', min: 0 },
+  { name: 'Debug', min: 5 },
+  { name: 'Info', min: 9 },
+  { name: 'Warn', min: 13 },
+  { name: 'Error', min: 17 },
+  { name: 'Fatal', min: 21 },
+];
+const SPAN_KINDS = ['Unspecified', 'Internal', 'Server', 'Client', 'Producer', 'Consumer'];
+const STATUS_CODES = ['Unset', 'Ok', 'Error'];
+const PALETTE = ['#0066cc', '#2da44e', '#bf8700', '#8250df', '#cf222e', '#1b7c83', '#e16f24', '#bf3989', '#57606a', '#4493f8'];
+
+const view = document.getElementById('view');
+const rangeSelect = document.getElementById('range');
+const settingsForm = document.getElementById('settings');
+
+// ---- Settings ----
+
+function loadSettings() {
+  try {
+    return JSON.parse(localStorage.getItem(SETTINGS_KEY)) || {};
+  } catch (e) {
+    return {};
+  }
+}
+
+let settings = loadSettings();
+
+function saveSettings() {
+  localStorage.setItem(SETTINGS_KEY, JSON.stringify(settings));
+}
+
+// ---- DOM helpers ----
+
+// el creates an element. Strings and numbers among the children become
+// text nodes, so data is never interpreted as HTML.
+function el(tag, props, ...children) {
+  const node = document.createElement(tag);
+  for (const [key, value] of Object.entries(props || {})) {
+    if (value === undefined || value === null || value === false) continue;
+    if (key === 'class') node.className = value;
+    else if (key === 'text') node.textContent = value;
+    else if (key.startsWith('on')) node.addEventListener(key.slice(2), value);
+    else if (key === 'style') Object.assign(node.style, value);
+    else node.setAttribute(key, value === true ? '' : value);
+  }
+  append(node, children);
+  return node;
+}
+
+function append(node, children) {
+  for (const child of children.flat()) {
+    if (child === undefined || child === null || child === false) continue;
+    node.appendChild(child instanceof Node ? child : document.createTextNode(String(child)));
+  }
+  return node;
+}
+
+function svg(tag, attrs, ...children) {
+  const node = document.createElementNS('http://www.w3.org/2000/svg', tag);
+  for (const [key, value] of Object.entries(attrs || {})) node.setAttribute(key, value);
+  for (const child of children) {
+    node.appendChild(typeof child === 'string' ? document.createTextNode(child) : child);
+  }
+  return node;
+}
+
+function errorBox(err) {
+  return el('div', { class: 'error-box', text: err.message || String(err) });
+}
+
+function empty(text) {
+  return el('div', { class: 'empty', text });
+}
+
+// ---- API ----
+
+async function api(path, params) {
+  const url = new URL(path, API_BASE);
+  for (const [key, value] of Object.entries(params || {})) {
+    if (value !== undefined && value !== null && value !== '') url.searchParams.set(key, value);
+  }
+  const headers = {};
+  if (settings.token) headers.Authorization = 'Bearer ' + settings.token;
+  if (settings.tenant) headers[settings.tenantHeader || 'X-Scope-OrgID'] = settings.tenant;
+  const resp = await fetch(url, { headers });
+  if (!resp.ok) {
+    const text = (await resp.text()).trim();
+    if (resp.status === 401 || resp.status === 403) {
+      throw new Error(`${resp.status}: ${text || 'not authorized'}. Set an API key with read permission under Settings.`);
+    }
+    if (resp.status === 404 && settings.tenant) {
+      throw new Error(`${text || 'Not found'}. The tenant has no data yet.`);
+    }
+    throw new Error(`${resp.status}: ${text || resp.statusText}`);
+  }
+  return (await resp.json()).data;
+}
+
+function since() {
+  return rangeSelect.value;
+}
+
+// ---- Formatting ----
+
+function pad(n, width) {
+  return String(n).padStart(width || 2, '0');
+}
+
+function formatTime(nanos) {
+  if (!nanos) return '';
+  const d = new Date(nanos / 1e6);
+  return `${d.getFullYear()}-${pad(d.getMonth() + 1)}-${pad(d.getDate())} ` +
+    `${pad(d.getHours())}:${pad(d.getMinutes())}:${pad(d.getSeconds())}.${pad(d.getMilliseconds(), 3)}`;
+}
+
+function plural(n, noun) {
+  return `${n} ${noun}${n === 1 ? '' : 's'}`;
+}
+
+function formatDuration(nanos) {
+  if (nanos < 1e3) return `${Math.round(nanos)}ns`;
+  if (nanos < 1e6) return `${+(nanos / 1e3).toFixed(1)}µs`;
+  if (nanos < 1e9) return `${+(nanos / 1e6).toFixed(1)}ms`;
+  if (nanos < 60e9) return `${+(nanos / 1e9).toFixed(2)}s`;
+  return `${+(nanos / 60e9).toFixed(1)}m`;
+}
+
+// anyValue converts an OTLP JSON AnyValue into a plain value
+function anyValue(v) {
+  if (!v || typeof v !== 'object') return v;
+  if ('stringValue' in v) return v.stringValue;
+  if ('boolValue' in v) return v.boolValue;
+  if ('intValue' in v) return Number(v.intValue);
+  if ('doubleValue' in v) return v.doubleValue;
+  if ('bytesValue' in v) return v.bytesValue;
+  if ('arrayValue' in v) return ((v.arrayValue || {}).values || []).map(anyValue);
+  if ('kvlistValue' in v) return attributes((v.kvlistValue || {}).values);
+  return null;
+}
+
+// attributes converts an OTLP JSON key-value list into an object
+function attributes(list) {
+  const out = {};
+  for (const kv of list || []) out[kv.key] = anyValue(kv.value);
+  return out;
+}
+
+function valueText(v) {
+  if (v === null || v === undefined) return '';
+  return typeof v === 'object' ? JSON.stringify(v) : String(v);
+}
+
+// kvTable lists the properties of obj, sorted unless keepOrder is set
+function kvTable(obj, keepOrder) {
+  const keys = keepOrder ? Object.keys(obj) : Object.keys(obj).sort();
+  if (keys.length === 0) return el('div', { class: 'muted', text: 'None' });
+  return el('table', { class: 'kv' },
+    keys.map((k) => el('tr', null, el('td', { text: k }), el('td', { text: valueText(obj[k]) }))));
+}
+
+function severityOf(record) {
+  const n = record.severityNumber || 0;
+  const found = n > 0 && ['fatal', 'error', 'warn', 'info', 'debug', 'trace']
+    .find((name) => n >= ({ fatal: 21, error: 17, warn: 13, info: 9, debug: 5, trace: 1 })[name]);
+  const name = found || '';
+  return { text: (record.severityText || name).toUpperCase(), cls: name ? `sev sev-${name}` : 'sev' };
+}
+
+function serviceColor(name) {
+  let hash = 0;
+  for (const c of name || '') hash = (hash * 31 + c.charCodeAt(0)) >>> 0;
+  return PALETTE[hash % PALETTE.length];
+}
+
+// ---- Routing ----
+
+function currentRoute() {
+  const hash = location.hash.replace(/^#\/?/, '');
+  const [path, query] = hash.split('?');
+  const [name, ...rest] = path.split('/');
+  return { name: name || 'traces', arg: rest.join('/'), params: new URLSearchParams(query || '') };
+}
+
+function navigate(name, params) {
+  const query = new URLSearchParams();
+  for (const [key, value] of Object.entries(params || {})) {
+    if (value !== undefined && value !== null && value !== '' && value !== false) query.set(key, value);
+  }
+  const hash = `#/${name}` + (query.toString() ? `?${query}` : '');
+  if (location.hash === hash) render();
+  else location.hash = hash;
+}
+
+const views = { traces: renderTraces, trace: renderTrace, logs: renderLogs, metrics: renderMetrics };
+
+let renderToken = 0;
+
+async function render() {
+  const route = currentRoute();
+  const fn = views[route.name] || renderTraces;
+  for (const link of document.querySelectorAll('.topbar nav a')) {
+    const active = link.dataset.view === route.name || (route.name === 'trace' && link.dataset.view === 'traces');
+    link.classList.toggle('active', active);
+  }
+  // Responses of a view the user has left are ignored
+  const token = ++renderToken;
+  const content = el('div');
+  view.replaceChildren(content);
+  try {
+    await fn(content, route, () => token === renderToken);
+  } catch (err) {
+    if (token === renderToken) content.replaceChildren(errorBox(err));
+  }
+}
+
+async function serviceSelect(selected, onchange) {
+  let services = [];
+  try {
+    services = await api('services');
+  } catch (e) {
+    // Filters still work without the list
+  }
+  return el('select', { name: 'service', onchange },
+    el('option', { value: '', text: 'All services' }),
+    services.map((s) => el('option', { value: s, text: s, selected: s === selected })));
+}
+
+// ---- Traces ----
+
+async function renderTraces(root, route, current) {
+  const p = route.params;
+  const form = el('form', { class: 'filters' });
+  const submit = () => {
+    const data = new FormData(form);
+    navigate('traces', {
+      service: data.get('service'),
+      name: data.get('name').trim(),
+      min_duration: data.get('min_duration').trim(),
+      errors: data.get('errors') ? 'true' : '',
+    });
+  };
+  form.addEventListener('submit', (e) => { e.preventDefault(); submit(); });
+  append(form, [
+    await serviceSelect(p.get('service'), submit),
+    el('input', { name: 'name', placeholder: 'Span name', value: p.get('name') || '' }),
+    el('input', { name: 'min_duration', placeholder: 'Min duration, e.g. 250ms', size: 22, value: p.get('min_duration') || '' }),
+    el('label', null, el('input', { type: 'checkbox', name: 'errors', checked: p.get('errors') === 'true', onchange: submit }), ' Errors only'),
+    el('button', { type: 'submit', text: 'Search' }),
+  ]);
+  root.replaceChildren(form);
+
+  const traces = await api('traces', {
+    service: p.get('service'), name: p.get('name'), min_duration: p.get('min_duration'),
+    errors: p.get('errors'), since: since(), limit: PAGE_LIMIT,
+  });
+  if (!current()) return;
+  if (traces.length === 0) {
+    root.appendChild(empty('No traces in this range'));
+    return;
+  }
+  const longest = Math.max(...traces.map((t) => t.endTimeUnixNano - t.startTimeUnixNano), 1);
+  root.appendChild(el('table', { class: 'list' },
+    el('tr', null, ['Start', 'Root span', 'Duration', 'Spans', 'Errors', 'Services'].map((h) => el('th', { text: h }))),
+    traces.map((t) => {
+      const duration = t.endTimeUnixNano - t.startTimeUnixNano;
+      return el('tr', { class: 'clickable', onclick: () => navigate('trace/' + t.traceId) },
+        el('td', { class: 'nowrap', text: formatTime(t.startTimeUnixNano) }),
+        el('td', null,
+          el('span', { class: 'muted', text: (t.rootServiceName || '?') + ' ' }),
+          t.rootName || el('em', { text: 'missing root span' })),
+        el('td', { class: 'nowrap' }, formatDuration(duration),
+          el('div', { class: 'duration-bar', style: { width: `${Math.max(1, (100 * duration) / longest)}%` } })),
+        el('td', { text: t.spanCount }),
+        el('td', { class: t.errorCount ? 'status-error' : 'muted', text: t.errorCount }),
+        el('td', null, t.services.map((s) => el('span', { class: 'tag', text: s }))));
+    })));
+}
+
+// buildTree orders spans depth first from their parent links. Spans whose
+// parent was not received are shown as extra roots.
+function buildTree(spans) {
+  const byId = new Map(spans.map((s) => [s.spanId, { span: s, children: [] }]));
+  const roots = [];
+  for (const node of byId.values()) {
+    const parent = node.span.parentSpanId && byId.get(node.span.parentSpanId);
+    if (parent && parent !== node) parent.children.push(node);
+    else roots.push(node);
+  }
+  const ordered = [];
+  const byStart = (a, b) => a.span.startTimeUnixNano - b.span.startTimeUnixNano;
+  const visit = (node, depth) => {
+    ordered.push({ span: node.span, depth });
+    node.children.sort(byStart).forEach((child) => visit(child, depth + 1));
+  };
+  roots.sort(byStart).forEach((node) => visit(node, 0));
+  return ordered;
+}
+
+async function renderTrace(root, route, current) {
+  const traceId = route.arg;
+  const [spans, logs] = await Promise.all([
+    api('spans', { trace_id: traceId, limit: MAX_LIMIT }),
+    api('logs', { trace_id: traceId, limit: MAX_LIMIT }).catch(() => []),
+  ]);
+  if (!current()) return;
+  if (spans.length === 0) {
+    root.replaceChildren(empty(`Trace ${traceId} was not found`));
+    return;
+  }
+
+  const rows = buildTree(spans);
+  const start = Math.min(...spans.map((s) => s.startTimeUnixNano));
+  const end = Math.max(...spans.map((s) => s.endTimeUnixNano));
+  const total = Math.max(end - start, 1);
+  const top = rows[0].span;
+  const services = [...new Set(spans.map((s) => s.serviceName).filter(Boolean))];
+
+  const detail = el('div');
+  const waterfall = el('div', { class: 'waterfall' });
+  const ticks = [0, 0.25, 0.5, 0.75, 1];
+  waterfall.appendChild(el('div', { class: 'wf-row ruler' },
+    el('div', { class: 'wf-label', text: 'Service · span' }),
+    el('div', { class: 'wf-track' }, ticks.map((f) =>
+      el('span', { class: 'wf-tick', style: { left: `${f * 100}%` }, text: f ? formatDuration(f * total) : '0' })))));
+
+  let selected = null;
+  for (const { span, depth } of rows) {
+    const duration = span.endTimeUnixNano - span.startTimeUnixNano;
+    const left = (100 * (span.startTimeUnixNano - start)) / total;
+    const width = (100 * duration) / total;
+    const isError = span.statusCode === 2;
+    const row = el('div', { class: 'wf-row', title: span.name },
+      el('div', { class: 'wf-label', style: { paddingLeft: `${8 + depth * 14}px` } },
+        el('span', { class: 'service', text: span.serviceName }),
+        el('span', { class: isError ? 'status-error' : '', text: span.name })),
+      el('div', { class: 'wf-track' },
+        el('div', { class: isError ? 'wf-bar error' : 'wf-bar', style: { left: `${left}%`, width: `${width}%`, background: serviceColor(span.serviceName) } }),
+        el('span', { class: 'wf-time', style: left + width > 85 ? { right: `${100 - left + 0.5}%` } : { left: `${left + width + 0.5}%` }, text: formatDuration(duration) })));
+    row.addEventListener('click', () => {
+      if (selected) selected.classList.remove('selected');
+      selected = row;
+      row.classList.add('selected');
+      detail.replaceChildren(spanDetail(span, logs));
+    });
+    waterfall.appendChild(row);
+  }
+
+  const errors = spans.filter((s) => s.statusCode === 2).length;
+  root.replaceChildren(
+    el('div', { class: 'trace-header' },
+      el('h2', null, el('span', { class: 'muted', text: top.serviceName + ' ' }), top.name),
+      el('div', { class: 'meta' },
+        el('span', { class: 'mono', text: traceId }),
+        el('span', { text: formatTime(start) }),
+        el('span', { text: formatDuration(end - start) }),
+        el('span', { text: plural(spans.length, 'span') }),
+        errors ? el('span', { class: 'status-error', text: plural(errors, 'error') }) : null,
+        el('span', null, services.map((s) => el('span', { class: 'tag', text: s }))),
+        el('a', { href: `#/logs?trace_id=${encodeURIComponent(traceId)}`, text: plural(logs.length, 'log record') }))),
+    spans.length >= MAX_LIMIT ? el('div', { class: 'error-box', text: `Only the first ${MAX_LIMIT} spans are shown.` }) : null,
+    waterfall,
+    detail);
+  waterfall.children[1].click();
+}
+
+function spanDetail(span, logs) {
+  const duration = span.endTimeUnixNano - span.startTimeUnixNano;
+  const spanLogs = logs.filter((l) => l.spanId === span.spanId);
+  const status = STATUS_CODES[span.statusCode] || span.statusCode;
+  return el('div', { class: 'detail' },
+    el('h3', null, span.name),
+    kvTable({
+      service: span.serviceName,
+      kind: SPAN_KINDS[span.kind] || span.kind,
+      status: span.statusMessage ? `${status}: ${span.statusMessage}` : status,
+      start: formatTime(span.startTimeUnixNano),
+      duration: formatDuration(duration),
+      'span id': span.spanId,
+      'parent span id': span.parentSpanId || '',
+      scope: [span.scopeName, span.scopeVersion].filter(Boolean).join(' '),
+    }, true),
+    el('h4', { text: 'Attributes' }),
+    kvTable(attributes(span.attributes)),
+    el('h4', { text: `Events (${(span.events || []).length})` }),
+    (span.events || []).length === 0 ? el('div', { class: 'muted', text: 'None' }) :
+      el('table', { class: 'list' }, (span.events || []).map((e) => el('tr', null,
+        el('td', { class: 'nowrap mono', text: '+' + formatDuration(Number(e.timeUnixNano) - span.startTimeUnixNano) }),
+        el('td', { text: e.name }),
+        el('td', null, kvTable(attributes(e.attributes)))))),
+    el('h4', { text: `Links (${(span.links || []).length})` }),
+    (span.links || []).length === 0 ? el('div', { class: 'muted', text: 'None' }) :
+      el('table', { class: 'list' }, (span.links || []).map((l) => el('tr', null,
+        el('td', { class: 'mono' }, el('a', { href: `#/trace/${encodeURIComponent(l.traceId)}`, text: l.traceId })),
+        el('td', { class: 'mono', text: l.spanId }),
+        el('td', null, kvTable(attributes(l.attributes)))))),
+    el('h4', { text: `Logs (${spanLogs.length})` }),
+    spanLogs.length === 0 ? el('div', { class: 'muted', text: 'None' }) : logTable(spanLogs, false),
+    el('h4', { text: 'Resource' }),
+    kvTable(attributes(span.resourceAttributes)));
+}
+
+// ---- Logs ----
+
+async function renderLogs(root, route, current) {
+  const p = route.params;
+  const minSeverity = Number(p.get('min_severity') || 0);
+  const form = el('form', { class: 'filters' });
+  const submit = (severity) => {
+    const data = new FormData(form);
+    navigate('logs', {
+      service: data.get('service'),
+      search: data.get('search').trim(),
+      trace_id: data.get('trace_id').trim(),
+      min_severity: typeof severity === 'number' ? severity : minSeverity,
+    });
+  };
+  form.addEventListener('submit', (e) => { e.preventDefault(); submit(); });
+  append(form, [
+    el('div', { class: 'group' }, SEVERITIES.map((s) => el('button', {
+      type: 'button', class: s.min === minSeverity ? 'active' : '', text: s.name + (s.min && s.min < 21 ? '+' : ''),
+      onclick: () => submit(s.min),
+    }))),
+    await serviceSelect(p.get('service'), () => submit()),
+    el('input', { name: 'search', placeholder: 'Body contains', value: p.get('search') || '' }),
+    el('input', { name: 'trace_id', class: 'mono', placeholder: 'Trace ID', size: 34, value: p.get('trace_id') || '' }),
+    el('button', { type: 'submit', text: 'Search' }),
+  ]);
+  root.replaceChildren(form);
+
+  // A trace is shown whole, whatever the selected range
+  const traceId = p.get('trace_id');
+  const logs = await api('logs', {
+    service: p.get('service'), search: p.get('search'), trace_id: traceId,
+    min_severity: minSeverity || '', since: traceId ? '' : since(), limit: PAGE_LIMIT,
+  });
+  if (!current()) return;
+  root.appendChild(logs.length === 0 ? empty('No log records match') : logTable(logs, true));
+}
+
+function logTable(logs, withService) {
+  const table = el('table', { class: 'list' },
+    el('tr', null, ['Time', 'Severity', withService ? 'Service' : null, 'Body', 'Trace'].filter(Boolean).map((h) => el('th', { text: h }))));
+  const columns = withService ? 5 : 4;
+  for (const log of logs) {
+    const severity = severityOf(log);
+    const body = anyValue(log.body);
+    let details = null;
+    const row = el('tr', { class: 'clickable' },
+      el('td', { class: 'nowrap mono', text: formatTime(log.timeUnixNano || log.observedTimeUnixNano) }),
+      el('td', null, el('span', { class: severity.cls, text: severity.text })),
+      withService ? el('td', { class: 'nowrap', text: log.serviceName }) : null,
+      el('td', { class: 'body', text: valueText(body) }),
+      el('td', { class: 'mono nowrap' }, log.traceId ? el('a', {
+        href: `#/trace/${encodeURIComponent(log.traceId)}`, text: log.traceId.slice(0, 8) + '…', title: log.traceId,
+        onclick: (e) => e.stopPropagation(),
+      }) : ''));
+    row.addEventListener('click', () => {
+      if (details) {
+        details.remove();
+        details = null;
+        return;
+      }
+      details = el('tr', { class: 'details' }, el('td', { colspan: columns },
+        kvTable(Object.assign({
+          'trace id': log.traceId || '',
+          'span id': log.spanId || '',
+          scope: [log.scopeName, log.scopeVersion].filter(Boolean).join(' '),
+        }, attributes(log.attributes)), true),
+        el('h4', { text: 'Resource' }),
+        kvTable(attributes(log.resourceAttributes))));
+      row.after(details);
+    });
+    table.appendChild(row);
+  }
+  return table;
+}
+
+// ---- Metrics ----
+
+async function renderMetrics(root, route, current) {
+  const p = route.params;
+  const form = el('form', { class: 'filters' });
+  const submit = () => {
+    const data = new FormData(form);
+    navigate('metrics', { service: data.get('service'), name: data.get('name'), rate: data.get('rate') ? 'true' : '' });
+  };
+  form.addEventListener('submit', (e) => { e.preventDefault(); submit(); });
+  const names = await api('metric-names', { service: p.get('service') });
+  if (!current()) return;
+  const name = p.get('name') || (names[0] && names[0].name) || '';
+  const info = names.find((m) => m.name === name);
+  append(form, [
+    await serviceSelect(p.get('service'), submit),
+    el('select', { name: 'name', onchange: submit },
+      names.map((m) => el('option', { value: m.name, selected: m.name === name, text: `${m.name} (${m.metricType}${m.unit ? ', ' + m.unit : ''})` }))),
+    info && info.metricType === 'sum' ?
+      el('label', { title: 'Per second change of a cumulative sum' },
+        el('input', { type: 'checkbox', name: 'rate', checked: p.get('rate') === 'true', onchange: submit }), ' Rate') : null,
+  ]);
+  root.replaceChildren(form);
+  if (!name) {
+    root.appendChild(empty('No metrics have been received'));
+    return;
+  }
+  if (info && info.description) root.appendChild(el('p', { class: 'muted', text: info.description }));
+
+  const points = await api('metrics', { name, service: p.get('service'), since: since(), limit: MAX_LIMIT });
+  if (!current()) return;
+  let series = groupSeries(points);
+  if (p.get('rate') === 'true') series = series.map(toRate);
+  series = series.filter((s) => s.points.length > 0);
+  if (series.length === 0) {
+    root.appendChild(empty(points.length ? 'This metric has no plottable values (histograms and summaries are not charted)' : 'No data points in this range'));
+    return;
+  }
+  if (points.length >= MAX_LIMIT) {
+    root.appendChild(el('div', { class: 'muted', text: `Showing the latest ${MAX_LIMIT} data points; narrow the range to see all of them.` }));
+  }
+  root.appendChild(lineChart(series));
+  root.appendChild(el('div', { class: 'legend' }, series.map((s) =>
+    el('span', null, el('span', { class: 'swatch', style: { background: s.color } }), s.label))));
+  root.appendChild(el('table', { class: 'list' },
+    el('tr', null, ['Series', 'Latest', 'Min', 'Max', 'Points'].map((h) => el('th', { text: h }))),
+    series.map((s) => {
+      const values = s.points.map((pt) => pt[1]);
+      return el('tr', null,
+        el('td', null, el('span', { class: 'swatch', style: { background: s.color } }), s.label),
+        el('td', { class: 'mono', text: formatNumber(values[values.length - 1]) }),
+        el('td', { class: 'mono', text: formatNumber(Math.min(...values)) }),
+        el('td', { class: 'mono', text: formatNumber(Math.max(...values)) }),
+        el('td', { text: values.length }));
+    })));
+}
+
+// groupSeries splits data points into one series per service and
+// attribute set, oldest point first
+function groupSeries(points) {
+  const byKey = new Map();
+  for (const pt of points) {
+    if (pt.value === null || pt.value === undefined) continue;
+    const attrs = attributes(pt.attributes);
+    const labels = Object.keys(attrs).sort().map((k) => `${k}=${valueText(attrs[k])}`);
+    const key = [pt.serviceName, ...labels].join(' ');
+    if (!byKey.has(key)) byKey.set(key, { label: key || '(no labels)', points: [] });
+    byKey.get(key).points.push([pt.timeUnixNano, pt.value, pt.startTimeUnixNano]);
+  }
+  return [...byKey.values()].map((s, i) => {
+    s.points.sort((a, b) => a[0] - b[0]);
+    s.color = PALETTE[i % PALETTE.length];
+    return s;
+  });
+}
+
+// toRate turns a cumulative series into its per second change, skipping
+// resets where the value drops or the start time changes
+function toRate(s) {
+  const points = [];
+  for (let i = 1; i < s.points.length; i++) {
+    const [t0, v0, start0] = s.points[i - 1];
+    const [t1, v1, start1] = s.points[i];
+    if (t1 <= t0 || v1 < v0 || start1 !== start0) continue;
+    points.push([t1, (v1 - v0) / ((t1 - t0) / 1e9)]);
+  }
+  return Object.assign({}, s, { points, label: s.label + ' /s' });
+}
+
+function formatNumber(v) {
+  if (!Number.isFinite(v)) return String(v);
+  if (v !== 0 && (Math.abs(v) >= 1e6 || Math.abs(v) < 1e-3)) return v.toExponential(3);
+  return String(+v.toFixed(3));
+}
+
+// niceTicks returns about count round numbers covering min to max
+function niceTicks(min, max, count) {
+  if (min === max) {
+    min -= Math.abs(min) / 2 || 1;
+    max += Math.abs(max) / 2 || 1;
+  }
+  const raw = (max - min) / count;
+  const magnitude = Math.pow(10, Math.floor(Math.log10(raw)));
+  const step = [1, 2, 5, 10].map((m) => m * magnitude).find((s) => s >= raw);
+  const ticks = [];
+  for (let v = Math.floor(min / step) * step; v <= max + step / 2; v += step) ticks.push(+v.toPrecision(12));
+  return ticks;
+}
+
+function lineChart(series) {
+  const width = 960, height = 320;
+  const margin = { top: 12, right: 16, bottom: 28, left: 64 };
+  const all = series.flatMap((s) => s.points);
+  const tMin = Math.min(...all.map((pt) => pt[0]));
+  const tMax = Math.max(...all.map((pt) => pt[0]));
+  const ticks = niceTicks(Math.min(0, ...all.map((pt) => pt[1])), Math.max(...all.map((pt) => pt[1])), 5);
+  const vMin = ticks[0], vMax = ticks[ticks.length - 1];
+  const x = (t) => margin.left + ((t - tMin) / (tMax - tMin || 1)) * (width - margin.left - margin.right);
+  const y = (v) => height - margin.bottom - ((v - vMin) / (vMax - vMin || 1)) * (height - margin.top - margin.bottom);
+
+  const chart = svg('svg', { class: 'chart', viewBox: `0 0 ${width} ${height}`, role: 'img' });
+  for (const v of ticks) {
+    chart.appendChild(svg('line', { class: 'grid', x1: margin.left, x2: width - margin.right, y1: y(v), y2: y(v) }));
+    chart.appendChild(svg('text', { x: margin.left - 6, y: y(v) + 4, 'text-anchor': 'end' }, formatNumber(v)));
+  }
+  const span = tMax - tMin;
+  for (let i = 0; i <= 4; i++) {
+    const t = tMin + (span * i) / 4;
+    const d = new Date(t / 1e6);
+    const label = span > 86400e9 ? `${d.getMonth() + 1}/${d.getDate()} ${pad(d.getHours())}:${pad(d.getMinutes())}` :
+      `${pad(d.getHours())}:${pad(d.getMinutes())}:${pad(d.getSeconds())}`;
+    const anchor = i === 0 ? 'start' : i === 4 ? 'end' : 'middle';
+    chart.appendChild(svg('text', { x: x(t), y: height - 8, 'text-anchor': anchor }, label));
+  }
+  for (const s of series) {
+    const coords = s.points.map((pt) => `${x(pt[0]).toFixed(1)},${y(pt[1]).toFixed(1)}`).join(' ');
+    chart.appendChild(svg('polyline', { class: 'series', points: coords, stroke: s.color }));
+    if (s.points.length <= 200) {
+      for (const pt of s.points) {
+        chart.appendChild(svg('circle', { cx: x(pt[0]), cy: y(pt[1]), r: 2.5, fill: s.color },
+          svg('title', null, `${s.label}\n${formatTime(pt[0])}\n${formatNumber(pt[1])}`)));
+      }
+    }
+  }
+  return chart;
+}
+
+// ---- Startup ----
+
+function initControls() {
+  rangeSelect.value = settings.range !== undefined ? settings.range : '1h';
+  rangeSelect.addEventListener('change', () => {
+    settings.range = rangeSelect.value;
+    saveSettings();
+    render();
+  });
+  document.getElementById('refresh').addEventListener('click', render);
+  document.getElementById('settings-toggle').addEventListener('click', () => {
+    settingsForm.hidden = !settingsForm.hidden;
+  });
+  for (const name of ['tenantHeader', 'tenant', 'token']) {
+    settingsForm.elements[name].value = settings[name] || '';
+  }
+  settingsForm.addEventListener('submit', (e) => {
+    e.preventDefault();
+    for (const name of ['tenantHeader', 'tenant', 'token']) {
+      settings[name] = settingsForm.elements[name].value.trim();
+    }
+    saveSettings();
+    settingsForm.hidden = true;
+    render();
+  });
+}
+
+initControls();
+window.addEventListener('hashchange', render);
+render();
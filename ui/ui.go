@@ -0,0 +1,39 @@
+// Package ui serves the embedded web interface for browsing stored
+// telemetry. The interface is a static single-page application that reads
+// data through the /api/v1 query endpoints.
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var files embed.FS
+
+// contentSecurityPolicy only lets the pages load the embedded assets and
+// call the collector they are served from
+const contentSecurityPolicy = "default-src 'self'; img-src 'self' data:; frame-ancestors 'none'"
+
+// Handler serves the web UI. It expects paths relative to where it is
+// mounted, so use it with http.StripPrefix.
+func Handler() http.Handler {
+	static, err := fs.Sub(files, "static")
+	if err != nil {
+		panic(err)
+	}
+	server := http.FileServer(http.FS(static))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// Embedded files have no modification time, so make browsers
+		// revalidate rather than keep assets of an older version
+		w.Header().Set("Cache-Control", "no-cache")
+		server.ServeHTTP(w, r)
+	})
+}